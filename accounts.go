@@ -0,0 +1,107 @@
+package lighthouse
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Accounts manages the *Services of several Lighthouse accounts keyed
+// by account name.  Requests made by every account's *Service share a
+// single rate limiter, so tools working across accounts at once stay
+// within an overall request rate.
+type Accounts struct {
+	mu       sync.Mutex
+	services map[string]*Service
+	limiter  *rate.Limiter
+}
+
+// NewAccounts returns an empty *Accounts whose services are rate
+// limited to one request per interval with bursts of up to
+// burstSize requests, as in Transport.  If interval is zero, requests
+// are not rate limited by Accounts.
+func NewAccounts(interval time.Duration, burstSize int) *Accounts {
+	a := &Accounts{
+		services: map[string]*Service{},
+	}
+	if interval != time.Duration(0) {
+		a.limiter = newLimiter(interval, burstSize)
+	}
+	return a
+}
+
+// Add adds s as the *Service of account name, replacing any *Service
+// previously added for name.  Unless the *Accounts was created
+// without rate limiting, s is rate limited using middleware, see
+// Service.Use, so any rate limiting done by s's Transport is in
+// addition to the shared rate limit.
+func (a *Accounts) Add(name string, s *Service) {
+	if a.limiter != nil {
+		limiter := a.limiter
+		s.Use(func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				err := limiter.Wait(req.Context())
+				if err != nil {
+					return nil, err
+				}
+				return next.RoundTrip(req)
+			})
+		})
+	}
+	a.mu.Lock()
+	a.services[name] = s
+	a.mu.Unlock()
+}
+
+// Get returns the *Service of account name, or nil if no such
+// account has been added.
+func (a *Accounts) Get(name string) *Service {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.services[name]
+}
+
+// Names returns the names of the accounts in sorted order.
+func (a *Accounts) Names() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	names := make([]string, 0, len(a.services))
+	for name := range a.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Each calls fn with the name and *Service of each account in the
+// order returned by Names.  Each continues with the remaining
+// accounts when fn fails and returns a *MultiError whose items are
+// indexed by the failed account's position in Names, or nil if fn
+// succeeded for every account.
+func (a *Accounts) Each(fn func(name string, s *Service) error) error {
+	br := &BatchResult{}
+	for i, name := range a.Names() {
+		err := fn(name, a.Get(name))
+		if err != nil {
+			err = &accountError{name: name, err: err}
+		}
+		br.Add(i, err)
+	}
+	return br.Err()
+}
+
+// accountError records the account for which Each's callback failed.
+type accountError struct {
+	name string
+	err  error
+}
+
+func (ae *accountError) Error() string {
+	return fmt.Sprintf("account %s: %v", ae.name, ae.err)
+}
+
+func (ae *accountError) Unwrap() error { return ae.err }
@@ -0,0 +1,205 @@
+package lighthouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// BatchItem records the outcome of a single item of a batch
+// operation.
+type BatchItem struct {
+	// Index identifies the item within the batch, i.e., its
+	// index in the slice passed to the batch operation or, for
+	// paginated operations, its page number.
+	Index int
+
+	// Err is the error returned for the item, or nil if it
+	// succeeded.
+	Err error
+}
+
+// OK reports whether the item succeeded.
+func (bi *BatchItem) OK() bool {
+	return bi.Err == nil
+}
+
+// Retriable reports whether the item failed with an error which may
+// succeed if retried, see Retriable.
+func (bi *BatchItem) Retriable() bool {
+	return bi.Err != nil && Retriable(bi.Err)
+}
+
+func (bi *BatchItem) Error() string {
+	return fmt.Sprintf("item %d: %v", bi.Index, bi.Err)
+}
+
+func (bi *BatchItem) Unwrap() error { return bi.Err }
+
+// Retriable reports whether err may succeed if the request is
+// retried, i.e., a rate limited or server error response, a timeout
+// or a failure to connect.  Other error responses, canceled requests
+// and ErrMaxRequestsExceeded are not retriable.
+func Retriable(err error) bool {
+	var er *ErrorResponse
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &er):
+		return errors.Is(er, ErrRateLimited) || errors.Is(er, ErrServer)
+	case errors.Is(err, ErrMaxRequestsExceeded), errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
+
+// BatchResult records the outcome of each item of a batch
+// operation.  The zero value is an empty result ready to use.
+type BatchResult struct {
+	Items []*BatchItem
+}
+
+// Add records the outcome of the item with the given index.  err
+// is nil if the item succeeded.
+func (br *BatchResult) Add(index int, err error) {
+	br.Items = append(br.Items, &BatchItem{Index: index, Err: err})
+}
+
+// Failed returns the items which failed.
+func (br *BatchResult) Failed() []*BatchItem {
+	failed := []*BatchItem{}
+	for _, bi := range br.Items {
+		if !bi.OK() {
+			failed = append(failed, bi)
+		}
+	}
+	return failed
+}
+
+// Retriable returns the indexes of the items which failed with a
+// retriable error.
+func (br *BatchResult) Retriable() []int {
+	indexes := []int{}
+	for _, bi := range br.Items {
+		if bi.Retriable() {
+			indexes = append(indexes, bi.Index)
+		}
+	}
+	return indexes
+}
+
+// Err returns a *MultiError containing the items which failed, or
+// nil if every item succeeded.
+func (br *BatchResult) Err() error {
+	failed := br.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].Index < failed[j].Index })
+	return &MultiError{Items: failed}
+}
+
+// MultiError is returned by batch operations when some items fail.
+// Items contains the failed items sorted by index.  errors.Is and
+// errors.As match the error of any failed item.
+type MultiError struct {
+	Items []*BatchItem
+}
+
+func (me *MultiError) Error() string {
+	msgs := make([]string, 0, len(me.Items))
+	for _, bi := range me.Items {
+		msgs = append(msgs, bi.Error())
+	}
+	return fmt.Sprintf("%d item(s) failed: %s", len(me.Items), strings.Join(msgs, "; "))
+}
+
+func (me *MultiError) Unwrap() []error {
+	errs := make([]error, 0, len(me.Items))
+	for _, bi := range me.Items {
+		errs = append(errs, bi.Err)
+	}
+	return errs
+}
+
+// Retriable reports whether every failed item may succeed if
+// retried.
+func (me *MultiError) Retriable() bool {
+	for _, bi := range me.Items {
+		if !bi.Retriable() {
+			return false
+		}
+	}
+	return len(me.Items) > 0
+}
+
+// BatchFunc makes the requests of item i of a batch run by a Batch
+// and returns its result.
+type BatchFunc func(ctx context.Context, i int) (interface{}, error)
+
+// Batch runs many API calls concurrently using a Pool and collects
+// their results in order.  As with Pool, requests made through a
+// *Service whose client uses a *Transport share the transport's rate
+// limiter, so adding workers never exceeds the rate limit.
+type Batch struct {
+	Pool
+}
+
+// NewBatch returns a *Batch using workers workers.
+func NewBatch(workers int) *Batch {
+	return &Batch{
+		Pool: Pool{
+			Workers: workers,
+		},
+	}
+}
+
+// Run calls fn once for each index in [0, n), running up to
+// b.Workers calls at once, and returns the results indexed by item.
+// The results of failed items are those returned by fn, usually nil.
+// If any items fail, Run returns a *MultiError containing them.  If
+// ctx is canceled or b.StopOnError is set and an item fails, the
+// items which were not started fail with the context's error.
+func (b *Batch) Run(ctx context.Context, n int, fn BatchFunc) ([]interface{}, error) {
+	var (
+		mu      sync.Mutex
+		results = make([]interface{}, n)
+		started = make([]bool, n)
+		br      = &BatchResult{}
+	)
+
+	pool := b.Pool
+	err := pool.Run(ctx, n, func(ctx context.Context, i int) error {
+		mu.Lock()
+		started[i] = true
+		mu.Unlock()
+
+		v, err := fn(ctx, i)
+
+		mu.Lock()
+		results[i] = v
+		br.Add(i, err)
+		mu.Unlock()
+		return err
+	})
+
+	if err != nil {
+		notStarted := ctx.Err()
+		if notStarted == nil {
+			notStarted = context.Canceled
+		}
+		for i := range started {
+			if !started[i] {
+				br.Add(i, notStarted)
+			}
+		}
+	}
+	return results, br.Err()
+}
@@ -3,16 +3,12 @@
 package bins
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/internal/crud"
 )
 
 type Service struct {
@@ -28,17 +24,22 @@ func NewService(s *lighthouse.Service, projectID int) *Service {
 }
 
 type Bin struct {
-	Default      bool       `json:"default"`
-	ID           int        `json:"id"`
-	Name         string     `json:"name"`
-	Position     int        `json:"position"`
-	ProjectID    int        `json:"project_id"`
-	Query        string     `json:"query"`
-	Shared       bool       `json:"shared"`
-	TicketsCount int        `json:"tickets_count"`
-	UpdatedAt    *time.Time `json:"updated_at"`
-	UserID       int        `json:"user_id"`
-	Global       bool       `json:"global"`
+	Default      bool             `json:"default"`
+	ID           int              `json:"id"`
+	Name         string           `json:"name"`
+	Position     int              `json:"position"`
+	ProjectID    int              `json:"project_id"`
+	Query        string           `json:"query"`
+	Shared       bool             `json:"shared"`
+	TicketsCount int              `json:"tickets_count"`
+	UpdatedAt    *lighthouse.Time `json:"updated_at"`
+	UserID       int              `json:"user_id"`
+	Global       bool             `json:"global"`
+}
+
+// WebURL returns the web URL of the ticket listing for b in account.
+func (b *Bin) WebURL(account string) string {
+	return lighthouse.WebURL(account, "projects", strconv.Itoa(b.ProjectID), "tickets", "bins", strconv.Itoa(b.ID))
 }
 
 type Bins []*Bin
@@ -55,94 +56,24 @@ type BinUpdate struct {
 	Query   string `json:"query"`
 }
 
-type binRequest struct {
-	Bin interface{} `json:"ticket_bin"`
-}
-
-func (br *binRequest) Encode(w io.Writer) error {
-	enc := json.NewEncoder(w)
-	return enc.Encode(br)
-}
-
-type binResponse struct {
-	Bin *Bin `json:"ticket_bin"`
-}
-
-func (tr *binResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(tr)
-}
-
-type binsResponse struct {
-	Bins []*binResponse `json:"ticket_bins"`
-}
-
-func (bsr *binsResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(bsr)
-}
-
-func (bsr *binsResponse) bins() Bins {
-	bs := make(Bins, 0, len(bsr.Bins))
-	for _, b := range bsr.Bins {
-		bs = append(bs, b.Bin)
-	}
-
-	return bs
-}
-
-func (s *Service) List() (Bins, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+".json", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
-	}
-
-	bsresp := &binsResponse{}
-	err = bsresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return bsresp.bins(), nil
+func (s *Service) List(reqOpts ...lighthouse.RequestOption) (Bins, error) {
+	return crud.List[Bin](s.s, s.basePath+".json", "ticket_bin", reqOpts...)
 }
 
-func (s *Service) Get(idOrName string) (*Bin, error) {
+func (s *Service) Get(idOrName string, reqOpts ...lighthouse.RequestOption) (*Bin, error) {
 	id, err := lighthouse.ID(idOrName)
 	if err == nil {
-		return s.GetByID(id)
+		return s.GetByID(id, reqOpts...)
 	}
-	return s.GetByName(idOrName)
+	return s.GetByName(idOrName, reqOpts...)
 }
 
-func (s *Service) GetByID(id int) (*Bin, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+"/"+strconv.Itoa(id)+".json", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
-	}
-
-	bresp := &binResponse{}
-	err = bresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return bresp.Bin, nil
+func (s *Service) GetByID(id int, reqOpts ...lighthouse.RequestOption) (*Bin, error) {
+	return crud.Get[Bin](s.s, s.basePath+"/"+strconv.Itoa(id)+".json", "ticket_bin", reqOpts...)
 }
 
-func (s *Service) GetByName(name string) (*Bin, error) {
-	bs, err := s.List()
+func (s *Service) GetByName(name string, reqOpts ...lighthouse.RequestOption) (*Bin, error) {
+	bs, err := s.List(reqOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -156,100 +87,43 @@ func (s *Service) GetByName(name string) (*Bin, error) {
 }
 
 // Only the fields in BinCreate can be set.
-func (s *Service) Create(b *Bin) (*Bin, error) {
-	breq := &binRequest{
-		Bin: &BinCreate{
-			Default: b.Default,
-			Name:    b.Name,
-			Query:   b.Query,
-		},
-	}
-
-	buf := &bytes.Buffer{}
-	err := breq.Encode(buf)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := s.s.RoundTrip("POST", s.basePath+".json", buf)
-	if err != nil {
-		return nil, err
+func (s *Service) Create(b *Bin, reqOpts ...lighthouse.RequestOption) (*Bin, error) {
+	bc := &BinCreate{
+		Default: b.Default,
+		Name:    b.Name,
+		Query:   b.Query,
 	}
-	defer resp.Body.Close()
 
-	err = lighthouse.CheckResponse(resp, http.StatusCreated)
-	if err != nil {
-		return nil, err
-	}
-
-	bresp := &binResponse{
-		Bin: b,
-	}
-	err = bresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return b, nil
+	return crud.Create(s.s, s.basePath+".json", "ticket_bin", bc, b, reqOpts...)
 }
 
 // Only the fields in BinUpdate can be set.
-func (s *Service) Update(b *Bin) error {
-	breq := &binRequest{
-		Bin: &BinUpdate{
-			Default: b.Default,
-			Name:    b.Name,
-			Query:   b.Query,
-		},
+func (s *Service) Update(b *Bin, reqOpts ...lighthouse.RequestOption) error {
+	bu := &BinUpdate{
+		Default: b.Default,
+		Name:    b.Name,
+		Query:   b.Query,
 	}
 
-	buf := &bytes.Buffer{}
-	err := breq.Encode(buf)
-	if err != nil {
-		return err
-	}
-
-	resp, err := s.s.RoundTrip("PUT", s.basePath+"/"+strconv.Itoa(b.ID)+".json", buf)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return crud.Update(s.s, s.basePath+"/"+strconv.Itoa(b.ID)+".json", "ticket_bin", bu, reqOpts...)
 }
 
-func (s *Service) Delete(idOrName string) error {
+func (s *Service) Delete(idOrName string, reqOpts ...lighthouse.RequestOption) error {
 	id, err := lighthouse.ID(idOrName)
 	if err == nil {
-		return s.DeleteByID(id)
+		return s.DeleteByID(id, reqOpts...)
 	}
-	return s.DeleteByName(idOrName)
+	return s.DeleteByName(idOrName, reqOpts...)
 }
 
-func (s *Service) DeleteByID(id int) error {
-	resp, err := s.s.RoundTrip("DELETE", s.basePath+"/"+strconv.Itoa(id)+".json", nil)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return err
-	}
-
-	return nil
+func (s *Service) DeleteByID(id int, reqOpts ...lighthouse.RequestOption) error {
+	return crud.Delete(s.s, s.basePath+"/"+strconv.Itoa(id)+".json", reqOpts...)
 }
 
-func (s *Service) DeleteByName(name string) error {
-	b, err := s.GetByName(name)
+func (s *Service) DeleteByName(name string, reqOpts ...lighthouse.RequestOption) error {
+	b, err := s.GetByName(name, reqOpts...)
 	if err != nil {
 		return err
 	}
-	return s.DeleteByID(b.ID)
+	return s.DeleteByID(b.ID, reqOpts...)
 }
@@ -0,0 +1,177 @@
+package lighthouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBreakerFailures is the number of consecutive failed
+	// requests which open a *CircuitBreaker if
+	// CircuitBreaker.Failures is zero.
+	DefaultBreakerFailures = 5
+	// DefaultBreakerCoolDown is the amount of time a
+	// *CircuitBreaker stays open if CircuitBreaker.CoolDown is
+	// zero.
+	DefaultBreakerCoolDown = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned by *Service.RoundTrip without making a
+// request while Service.Breaker is open.
+var ErrCircuitOpen = fmt.Errorf("circuit breaker open, Lighthouse appears to be unavailable")
+
+// CircuitState is the state of a *CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed allows every request.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails every request with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen allows a single trial request, which
+	// closes the breaker if it succeeds and opens it again if it
+	// fails.
+	CircuitHalfOpen
+)
+
+func (cs CircuitState) String() string {
+	switch cs {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(cs))
+}
+
+// CircuitBreaker stops a *Service from making requests while
+// Lighthouse appears to be unavailable, see Service.Breaker.  A
+// request fails if it returns an error other than the cancellation of
+// its context or a 5xx response.  Once Failures consecutive requests
+// have failed the breaker opens, failing every request with
+// ErrCircuitOpen for CoolDown, so long running operations such as
+// exports don't spend their rate limit on requests which are bound
+// to fail.  After CoolDown the breaker is half-open and allows a
+// single trial request to decide whether to close or open again.
+//
+// CircuitBreaker is safe for concurrent use and may be shared by
+// several services.
+type CircuitBreaker struct {
+	// Failures is the number of consecutive failed requests
+	// which open the breaker.  If Failures is zero,
+	// DefaultBreakerFailures is used.
+	Failures int
+
+	// CoolDown is the amount of time the breaker stays open
+	// before allowing a trial request.  If CoolDown is zero,
+	// DefaultBreakerCoolDown is used.
+	CoolDown time.Duration
+
+	// OnStateChange, if non-nil, is called whenever the breaker
+	// changes state, with the error of the request which opened
+	// it, if any.  It must not make requests through a service
+	// using the breaker.
+	OnStateChange func(from, to CircuitState, err error)
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// State returns the current state of cb.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= cb.coolDown() {
+		return CircuitHalfOpen
+	}
+	return cb.state
+}
+
+func (cb *CircuitBreaker) failureThreshold() int {
+	if cb.Failures > 0 {
+		return cb.Failures
+	}
+	return DefaultBreakerFailures
+}
+
+func (cb *CircuitBreaker) coolDown() time.Duration {
+	if cb.CoolDown > 0 {
+		return cb.CoolDown
+	}
+	return DefaultBreakerCoolDown
+}
+
+// setState changes the state of cb, calling OnStateChange once cb.mu
+// has been released if it is non-nil.  cb.mu must be held.
+func (cb *CircuitBreaker) setState(to CircuitState, err error) func() {
+	from := cb.state
+	cb.state = to
+	if to == CircuitOpen {
+		cb.openedAt = time.Now()
+	}
+	if from == to || cb.OnStateChange == nil {
+		return func() {}
+	}
+	return func() { cb.OnStateChange(from, to, err) }
+}
+
+// allow returns ErrCircuitOpen if a request may not be made.
+func (cb *CircuitBreaker) allow() error {
+	cb.mu.Lock()
+	notify := func() {}
+	defer func() { notify() }()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.coolDown() {
+			return ErrCircuitOpen
+		}
+		notify = cb.setState(CircuitHalfOpen, nil)
+		cb.trial = true
+		return nil
+	case CircuitHalfOpen:
+		if cb.trial {
+			return ErrCircuitOpen
+		}
+		cb.trial = true
+	}
+	return nil
+}
+
+// record records the outcome of a request allowed by allow.
+func (cb *CircuitBreaker) record(resp *http.Response, err error) {
+	failed := err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	if err == nil && resp.StatusCode >= 500 {
+		failed, err = true, fmt.Errorf("received %s response", resp.Status)
+	}
+
+	cb.mu.Lock()
+	notify := func() {}
+	defer func() { notify() }()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitHalfOpen {
+		cb.trial = false
+	}
+	if !failed {
+		if err == nil {
+			cb.failures = 0
+			notify = cb.setState(CircuitClosed, nil)
+		}
+		return
+	}
+	cb.failures++
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.failureThreshold() {
+		notify = cb.setState(CircuitOpen, err)
+	}
+}
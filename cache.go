@@ -0,0 +1,132 @@
+package lighthouse
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// cacheable reports whether req may be answered from a cache.
+func cacheable(req *http.Request) bool {
+	return req.Method == "GET" && len(req.Header.Get("Range")) == 0
+}
+
+// validators returns the ETag and Last-Modified headers of resp,
+// which are used to revalidate a cached response.
+func validators(resp *http.Response) (etag, lastModified string) {
+	return resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+}
+
+// conditionalRequest returns a copy of req which is answered with 304
+// Not Modified if the resource still matches etag or has not been
+// modified since lastModified.
+func conditionalRequest(req *http.Request, etag, lastModified string) *http.Request {
+	req2 := cloneRequest(req) // per http.RoundTripper contract
+	if len(etag) > 0 {
+		req2.Header.Set("If-None-Match", etag)
+	}
+	if len(lastModified) > 0 {
+		req2.Header.Set("If-Modified-Since", lastModified)
+	}
+	return req2
+}
+
+// MemoryCache is an http.RoundTripper which caches GET responses
+// carrying an ETag or Last-Modified header in memory.  Cached
+// responses are revalidated with If-None-Match or If-Modified-Since,
+// and a 304 Not Modified response is answered with the cached body.
+// Revalidated requests still count against the rate limit, but
+// Lighthouse does not need to send the body again.
+//
+// MemoryCache is safe for concurrent use.  Entries are never evicted,
+// use DiskCache for long running processes or large exports.
+type MemoryCache struct {
+	// Base specifies the mechanism by which individual HTTP
+	// requests are made.  If Base is nil, http.DefaultTransport
+	// is used.
+	Base http.RoundTripper
+
+	mu      sync.Mutex
+	entries map[string]*memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	etag         string
+	lastModified string
+	statusCode   int
+	header       http.Header
+	body         []byte
+}
+
+func (mc *MemoryCache) base() http.RoundTripper {
+	if mc.Base != nil {
+		return mc.Base
+	}
+	return http.DefaultTransport
+}
+
+func (mc *MemoryCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheable(req) {
+		return mc.base().RoundTrip(req)
+	}
+
+	key := RedactURL(req.URL)
+	mc.mu.Lock()
+	entry, cached := mc.entries[key]
+	mc.mu.Unlock()
+
+	req2 := req
+	if cached {
+		req2 = conditionalRequest(req, entry.etag, entry.lastModified)
+	}
+
+	resp, err := mc.base().RoundTrip(req2)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached && resp.StatusCode == http.StatusNotModified {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		return &http.Response{
+			Status:        http.StatusText(entry.statusCode),
+			StatusCode:    entry.statusCode,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        entry.header,
+			Body:          ioutil.NopCloser(bytes.NewReader(entry.body)),
+			ContentLength: int64(len(entry.body)),
+			Request:       req,
+		}, nil
+	}
+
+	etag, lastModified := validators(resp)
+	if resp.StatusCode != http.StatusOK || (len(etag) == 0 && len(lastModified) == 0) {
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	mc.mu.Lock()
+	if mc.entries == nil {
+		mc.entries = map[string]*memoryCacheEntry{}
+	}
+	mc.entries[key] = &memoryCacheEntry{
+		etag:         etag,
+		lastModified: lastModified,
+		statusCode:   resp.StatusCode,
+		header:       resp.Header,
+		body:         body,
+	}
+	mc.mu.Unlock()
+
+	return resp, nil
+}
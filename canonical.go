@@ -0,0 +1,74 @@
+package lighthouse
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// NullPolicy selects how MarshalCanonical writes object fields whose
+// value is null.
+type NullPolicy int
+
+const (
+	// NullsExplicit writes fields whose value is null as null, so
+	// every encoding of a type has the same fields.
+	NullsExplicit NullPolicy = iota
+	// NullsOmitted omits fields whose value is null.  Nulls in
+	// arrays are always written.
+	NullsOmitted
+)
+
+// MarshalCanonical returns the canonical JSON encoding of v, for
+// files such as those in exports which should only differ between
+// runs when the data they contain differs.  v is encoded with
+// json.Marshal, then re-encoded with the keys of every object sorted,
+// including those of fields such as raw_data holding JSON returned
+// by Lighthouse, null fields written according to nulls, numbers
+// written exactly as encoded and two space indentation, followed by a
+// newline.
+func MarshalCanonical(v interface{}, nulls NullPolicy) ([]byte, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var value interface{}
+	err = dec.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	if nulls == NullsOmitted {
+		value = omitNulls(value)
+	}
+
+	out := &bytes.Buffer{}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	// maps are encoded with their keys sorted
+	err = enc.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// omitNulls removes the fields whose value is null from the objects
+// in value.
+func omitNulls(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if field == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = omitNulls(field)
+		}
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = omitNulls(elem)
+		}
+	}
+	return value
+}
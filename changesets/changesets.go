@@ -4,27 +4,29 @@
 package changesets
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/internal/crud"
+	"github.com/nwidger/lighthouse/tickets"
 )
 
 type Service struct {
-	basePath string
-	s        *lighthouse.Service
+	basePath  string
+	projectID int
+	s         *lighthouse.Service
 }
 
 func NewService(s *lighthouse.Service, projectID int) *Service {
 	return &Service{
-		basePath: s.BasePath + "/projects/" + strconv.Itoa(projectID) + "/changesets",
-		s:        s,
+		basePath:  s.BasePath + "/projects/" + strconv.Itoa(projectID) + "/changesets",
+		projectID: projectID,
+		s:         s,
 	}
 }
 
@@ -86,64 +88,87 @@ func (c *Change) UnmarshalJSON(data []byte) error {
 type Changes []*Change
 
 type Changeset struct {
-	Body      string     `json:"body"`
-	BodyHTML  string     `json:"body_html"`
-	ChangedAt *time.Time `json:"changed_at"`
-	Changes   Changes    `json:"changes"`
-	Committer string     `json:"committer"`
-	ProjectID int        `json:"project_id"`
-	Revision  string     `json:"revision"`
-	TicketID  int        `json:"ticket_id"`
-	Title     string     `json:"title"`
-	UserID    int        `json:"user_id"`
+	Body      string           `json:"body"`
+	BodyHTML  string           `json:"body_html"`
+	ChangedAt *lighthouse.Time `json:"changed_at"`
+	Changes   Changes          `json:"changes"`
+	Committer string           `json:"committer"`
+	ProjectID int              `json:"project_id"`
+	Revision  string           `json:"revision"`
+	TicketID  int              `json:"ticket_id"`
+	Title     string           `json:"title"`
+	UserID    int              `json:"user_id"`
+
+	// RevisionURL is not returned by Lighthouse, it is set by
+	// Changesets.SetRevisionURLs.
+	RevisionURL string `json:"revision_url,omitempty"`
 }
 
 type Changesets []*Changeset
 
-type ChangesetCreate struct {
-	Body      string     `json:"body"`
-	BodyHTML  string     `json:"body_html"`
-	ChangedAt *time.Time `json:"changed_at"`
-	Changes   Changes    `json:"changes"`
-	Revision  string     `json:"revision"`
-	Title     string     `json:"title"`
-	UserID    int        `json:"user_id"`
-}
-
-type changesetRequest struct {
-	Changeset interface{} `json:"changeset"`
-}
-
-func (cr *changesetRequest) Encode(w io.Writer) error {
-	enc := json.NewEncoder(w)
-	return enc.Encode(cr)
-}
-
-type changesetResponse struct {
-	Changeset *Changeset `json:"changeset"`
-}
-
-func (cr *changesetResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(cr)
-}
-
-type changesetsResponse struct {
-	ChangesetResponse []*changesetResponse `json:"changesets"`
+// SetRevisionURLs sets the RevisionURL of each changeset in cs using
+// template, see RevisionURL.
+func (cs Changesets) SetRevisionURLs(template string) {
+	for _, c := range cs {
+		c.RevisionURL = RevisionURL(template, c.Revision)
+	}
 }
 
-func (csr *changesetsResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(csr)
+// RevisionURL returns the URL of revision in a repository browser
+// such as GitHub or GitLab.  In template, '{revision}' is replaced
+// with revision and '{short}' with its first 7 characters, i.e.,
+// 'https://github.com/OWNER/REPO/commit/{revision}'.  If template is
+// empty, RevisionURL returns the empty string.
+func RevisionURL(template, revision string) string {
+	if len(template) == 0 {
+		return ""
+	}
+	short := revision
+	if len(short) > 7 {
+		short = short[:7]
+	}
+	return strings.NewReplacer(
+		"{revision}", url.PathEscape(revision),
+		"{short}", url.PathEscape(short),
+	).Replace(template)
 }
 
-func (csr *changesetsResponse) changesets() Changesets {
-	cs := make(Changesets, 0, len(csr.ChangesetResponse))
-	for _, c := range csr.ChangesetResponse {
-		cs = append(cs, c.Changeset)
+// revisionReferenceRegexp matches the '(from [REVISION])' Lighthouse
+// adds to tickets updated by a changeset, submatching the bracketed
+// revision and the revision itself, so other bracketed numbers, i.e.,
+// '[42]' or a list index, are not mistaken for revisions.
+var revisionReferenceRegexp = regexp.MustCompile(`\(from (\[(r?[0-9]+|[0-9a-fA-F]{7,40})\])\)`)
+
+// LinkRevisions returns text with each revision reference, i.e., the
+// '[a1b2c3d]' in '(from [a1b2c3d])' which Lighthouse adds to tickets
+// updated by a changeset, replaced by a Markdown link to the revision
+// using template, see RevisionURL.  Bracketed revisions elsewhere and
+// references which are already links are left alone.  If template is
+// empty, text is returned unchanged.
+func LinkRevisions(text, template string) string {
+	if len(template) == 0 {
+		return text
 	}
+	buf := &strings.Builder{}
+	prev := 0
+	for _, m := range revisionReferenceRegexp.FindAllStringSubmatchIndex(text, -1) {
+		revision := strings.TrimPrefix(text[m[4]:m[5]], "r")
+		buf.WriteString(text[prev:m[3]])
+		buf.WriteString("(" + RevisionURL(template, revision) + ")")
+		prev = m[3]
+	}
+	buf.WriteString(text[prev:])
+	return buf.String()
+}
 
-	return cs
+type ChangesetCreate struct {
+	Body      string           `json:"body"`
+	BodyHTML  string           `json:"body_html"`
+	ChangedAt *lighthouse.Time `json:"changed_at"`
+	Changes   Changes          `json:"changes"`
+	Revision  string           `json:"revision"`
+	Title     string           `json:"title"`
+	UserID    int              `json:"user_id"`
 }
 
 type ListOptions struct {
@@ -151,7 +176,7 @@ type ListOptions struct {
 	Page int
 }
 
-func (s *Service) List(opts *ListOptions) (Changesets, error) {
+func (s *Service) List(opts *ListOptions, reqOpts ...lighthouse.RequestOption) (Changesets, error) {
 	path := s.basePath + ".json"
 	if opts != nil {
 		u, err := url.Parse(path)
@@ -166,129 +191,154 @@ func (s *Service) List(opts *ListOptions) (Changesets, error) {
 		path = u.String()
 	}
 
-	resp, err := s.s.RoundTrip("GET", path, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
-	}
-
-	csresp := &changesetsResponse{}
-	err = csresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return csresp.changesets(), nil
+	return crud.List[Changeset](s.s, path, "changeset", reqOpts...)
 }
 
 // ListAll repeatedly calls List and returns all pages.  ListAll
-// ignores opts.Page.
-func (s *Service) ListAll(opts *ListOptions) (Changesets, error) {
+// ignores opts.Page.  If an error occurs, the pages retrieved so far
+// are returned along with the error.
+func (s *Service) ListAll(opts *ListOptions, reqOpts ...lighthouse.RequestOption) (Changesets, error) {
+	cs := Changesets{}
+	err := s.Pages(opts, func(p Changesets) {
+		cs = append(cs, p...)
+	}, reqOpts...).All()
+	return cs, err
+}
+
+// Pages returns a *lighthouse.Pager which calls List for each page
+// and passes the page's changesets to fn.  Pages ignores opts.Page.
+func (s *Service) Pages(opts *ListOptions, fn func(Changesets), reqOpts ...lighthouse.RequestOption) *lighthouse.Pager {
 	realOpts := ListOptions{}
 	if opts != nil {
 		realOpts = *opts
 	}
 
-	cs := Changesets{}
-
-	for realOpts.Page = 1; ; realOpts.Page++ {
-		p, err := s.List(&realOpts)
+	return lighthouse.NewPager(func(page int) (int, error) {
+		realOpts.Page = page
+		p, err := s.List(&realOpts, reqOpts...)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
-		if len(p) == 0 {
-			break
+		if len(p) > 0 {
+			fn(p)
 		}
-
-		cs = append(cs, p...)
-	}
-
-	return cs, nil
+		return len(p), nil
+	})
 }
 
-func (s *Service) New() (*Changeset, error) {
-	return s.Get("new")
+func (s *Service) New(reqOpts ...lighthouse.RequestOption) (*Changeset, error) {
+	return s.Get("new", reqOpts...)
 }
 
-func (s *Service) Get(revision string) (*Changeset, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+"/"+revision+".json", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+func (s *Service) Get(revision string, reqOpts ...lighthouse.RequestOption) (*Changeset, error) {
+	return crud.Get[Changeset](s.s, s.basePath+"/"+revision+".json", "changeset", reqOpts...)
+}
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
+// Only the fields in ChangesetCreate can be set.
+func (s *Service) Create(c *Changeset, reqOpts ...lighthouse.RequestOption) (*Changeset, error) {
+	cc := &ChangesetCreate{
+		Body:      c.Body,
+		BodyHTML:  c.BodyHTML,
+		ChangedAt: c.ChangedAt,
+		Changes:   c.Changes,
+		Revision:  c.Revision,
+		Title:     c.Title,
+		UserID:    c.UserID,
 	}
 
-	cresp := &changesetResponse{}
-	err = cresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+	return crud.Create(s.s, s.basePath+".json", "changeset", cc, c, reqOpts...)
+}
 
-	return cresp.Changeset, nil
+func (s *Service) Delete(revision string, reqOpts ...lighthouse.RequestOption) error {
+	return crud.Delete(s.s, s.basePath+"/"+revision+".json", reqOpts...)
 }
 
-// Only the fields in ChangesetCreate can be set.
-func (s *Service) Create(c *Changeset) (*Changeset, error) {
-	creq := &changesetRequest{
-		Changeset: &ChangesetCreate{
-			Body:      c.Body,
-			BodyHTML:  c.BodyHTML,
-			ChangedAt: c.ChangedAt,
-			Changes:   c.Changes,
-			Revision:  c.Revision,
-			Title:     c.Title,
-			UserID:    c.UserID,
-		},
-	}
+// TicketReference is a reference to a ticket in a changeset body
+// using Lighthouse's commit message keyword convention, i.e.,
+// '[#123]' or '[#123 state:resolved responsible:fred]'.
+type TicketReference struct {
+	Number int
 
-	buf := &bytes.Buffer{}
-	err := creq.Encode(buf)
-	if err != nil {
-		return nil, err
-	}
+	// Command contains the keywords following the ticket
+	// number, if any.
+	Command string
+}
 
-	resp, err := s.s.RoundTrip("POST", s.basePath+".json", buf)
-	if err != nil {
-		return nil, err
+type TicketReferences []*TicketReference
+
+var ticketReferenceRegexp = regexp.MustCompile(`\[#([0-9]+)([^\]]*)\]`)
+
+// Merge returns refs with the references to each ticket merged into
+// one, in the order the tickets are first referenced.  The commands
+// of the merged references are joined in order, so later keywords
+// take precedence.
+func (refs TicketReferences) Merge() TicketReferences {
+	merged := TicketReferences{}
+	byNumber := map[int]*TicketReference{}
+	for _, ref := range refs {
+		m, ok := byNumber[ref.Number]
+		if !ok {
+			m = &TicketReference{Number: ref.Number}
+			byNumber[ref.Number] = m
+			merged = append(merged, m)
+		}
+		m.Command = strings.TrimSpace(m.Command + " " + ref.Command)
 	}
-	defer resp.Body.Close()
+	return merged
+}
 
-	err = lighthouse.CheckResponse(resp, http.StatusCreated)
-	if err != nil {
-		return nil, err
+// ParseTicketReferences returns the ticket references found in body.
+func ParseTicketReferences(body string) TicketReferences {
+	refs := TicketReferences{}
+	for _, m := range ticketReferenceRegexp.FindAllStringSubmatch(body, -1) {
+		number, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		refs = append(refs, &TicketReference{
+			Number:  number,
+			Command: strings.TrimSpace(m[2]),
+		})
 	}
+	return refs
+}
 
-	cresp := &changesetResponse{
-		Changeset: c,
-	}
-	err = cresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
+// LinkTickets emulates Lighthouse's handling of commit message
+// keywords for repositories no longer connected to Lighthouse.  Each
+// ticket referenced in c's body, or its title if the body is empty,
+// receives a comment containing the body prefixed with
+// '(from [REVISION])'.  If the reference contains keywords, they are
+// then applied to the ticket using tickets.Service.BulkEdit.  A
+// ticket referenced more than once is commented on once, with the
+// keywords of its references merged, see TicketReferences.Merge.  The
+// numbers of the updated tickets are returned.
+func (s *Service) LinkTickets(c *Changeset, reqOpts ...lighthouse.RequestOption) ([]int, error) {
+	body := c.Body
+	if len(strings.TrimSpace(body)) == 0 {
+		body = c.Title
 	}
 
-	return c, nil
-}
+	t := tickets.NewService(s.s, s.projectID)
+	numbers := []int{}
 
-func (s *Service) Delete(revision string) error {
-	resp, err := s.s.RoundTrip("DELETE", s.basePath+"/"+revision+".json", nil)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+	for _, ref := range ParseTicketReferences(body).Merge() {
+		err := t.Comment(ref.Number, fmt.Sprintf("(from [%s]) %s", c.Revision, body), reqOpts...)
+		if err != nil {
+			return numbers, err
+		}
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return err
+		if len(ref.Command) > 0 {
+			err = t.BulkEdit(&tickets.BulkEditOptions{
+				Query:   strconv.Itoa(ref.Number),
+				Command: ref.Command,
+			}, reqOpts...)
+			if err != nil {
+				return numbers, err
+			}
+		}
+
+		numbers = append(numbers, ref.Number)
 	}
 
-	return nil
+	return numbers, nil
 }
@@ -0,0 +1,23 @@
+package changesets_test
+
+import (
+	"fmt"
+
+	"github.com/nwidger/lighthouse/changesets"
+)
+
+func ExampleLinkRevisions() {
+	template := "https://github.com/OWNER/REPO/commit/{revision}"
+	fmt.Println(changesets.LinkRevisions("(from [a1b2c3d4]) Fix crash on login, see [1234567] [#123 state:resolved]", template))
+	// Output: (from [a1b2c3d4](https://github.com/OWNER/REPO/commit/a1b2c3d4)) Fix crash on login, see [1234567] [#123 state:resolved]
+}
+
+func ExampleTicketReferences_Merge() {
+	refs := changesets.ParseTicketReferences("Fix crash on login [#12] [#7] [#12 state:resolved]")
+	for _, ref := range refs.Merge() {
+		fmt.Printf("%d %q\n", ref.Number, ref.Command)
+	}
+	// Output:
+	// 12 "state:resolved"
+	// 7 ""
+}
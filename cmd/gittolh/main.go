@@ -165,7 +165,7 @@ func createChangesets(oldrev, newrev, refname string) ([]*changesets.Changeset,
 			Body:      body,
 			Committer: commitEmail,
 			Revision:  revision,
-			ChangedAt: &commitTime,
+			ChangedAt: lighthouse.NewTime(commitTime),
 			Changes:   changesets.Changes{},
 		}
 
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// expandAlias replaces the first command-line argument naming an
+// alias defined in the config file's 'aliases' map with the alias's
+// expansion.  Aliases cannot shadow built-in commands.
+func expandAlias(args []string) ([]string, error) {
+	aliases := viper.GetStringMapString("aliases")
+	if len(aliases) == 0 {
+		return args, nil
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if strings.HasPrefix(arg, "-") {
+			if flagTakesValue(arg) {
+				i++
+			}
+			continue
+		}
+
+		for _, c := range RootCmd.Commands() {
+			if c.Name() == arg || c.HasAlias(arg) {
+				return args, nil
+			}
+		}
+
+		expansion, ok := aliases[strings.ToLower(arg)]
+		if !ok {
+			return args, nil
+		}
+		words, err := splitWords(expansion)
+		if err != nil {
+			return nil, fmt.Errorf("alias %q: %v", arg, err)
+		}
+
+		expanded := append([]string{}, args[:i]...)
+		expanded = append(expanded, words...)
+		expanded = append(expanded, args[i+1:]...)
+		return expanded, nil
+	}
+
+	return args, nil
+}
+
+// flagTakesValue reports whether arg is a persistent flag whose
+// value is given in the following argument.
+func flagTakesValue(arg string) bool {
+	if strings.Contains(arg, "=") {
+		return false
+	}
+	var f *pflag.Flag
+	flags := RootCmd.PersistentFlags()
+	if strings.HasPrefix(arg, "--") {
+		f = flags.Lookup(arg[2:])
+	} else if len(arg) == 2 {
+		f = flags.ShorthandLookup(arg[1:])
+	}
+	return f != nil && len(f.NoOptDefVal) == 0
+}
+
+// splitWords splits s into words using shell-like rules for single
+// quotes, double quotes and backslash escapes.
+func splitWords(s string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
@@ -0,0 +1,13 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+// attachmentsCmd represents the attachments command
+var attachmentsCmd = &cobra.Command{
+	Use:   "attachments",
+	Short: "Manage ticket and milestone attachments",
+}
+
+func init() {
+	RootCmd.AddCommand(attachmentsCmd)
+}
@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+type attachmentsSyncCmdOpts struct {
+	workers int
+}
+
+var attachmentsSyncCmdFlags attachmentsSyncCmdOpts
+
+// attachmentsIndexFile is the name of the index written by lh
+// attachments sync to the root of the mirror.
+const attachmentsIndexFile = "index.json"
+
+// mirroredAttachment is an entry of the index of an attachments
+// mirror.
+type mirroredAttachment struct {
+	ID          int    `json:"id"`
+	Ticket      int    `json:"ticket,omitempty"`
+	Milestone   int    `json:"milestone,omitempty"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	// Path is the path of the attachment's contents relative to
+	// the root of the mirror.
+	Path string `json:"path"`
+}
+
+// AttachmentsSyncSummary reports what lh attachments sync did.
+type AttachmentsSyncSummary struct {
+	Downloaded int `json:"downloaded"`
+	Unchanged  int `json:"unchanged"`
+	Failed     int `json:"failed"`
+}
+
+// attachmentsSyncCmd represents the attachments sync command
+var attachmentsSyncCmd = &cobra.Command{
+	Use:   "sync DIR",
+	Short: "Mirror a project's attachments into a local directory (requires -p)",
+	Long: `Mirror a project's attachments into a local directory (requires -p)
+
+Downloads the attachments of every ticket and milestone of the
+project into DIR.  Contents are stored by SHA-256 hash under
+DIR/objects, so identical files are stored once, and DIR/index.json
+maps each attachment's ID, ticket or milestone and filename to the
+path of its contents.  Attachments already in the index whose
+contents are present with the expected size are not downloaded
+again, so running sync repeatedly only fetches new or changed
+attachments.  Attachments which fail to download are reported and
+left out of the index.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := attachmentsSyncCmdFlags
+		if len(args) != 1 {
+			FatalUsage(cmd, "Please specify the directory to sync attachments into")
+		}
+		dir := args[0]
+		projectID := Project()
+		t := tickets.NewService(service, projectID)
+
+		entries, as, err := projectAttachments(t, milestones.NewService(service, projectID))
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		for _, d := range []string{"objects", "tmp"} {
+			err = os.MkdirAll(filepath.Join(dir, d), 0755)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+		}
+		index, err := readAttachmentsIndex(dir)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		summary := &AttachmentsSyncSummary{}
+		download := tickets.Attachments{}
+		for i, a := range as {
+			if old, ok := index[a.ID]; ok && old.Size == int64(a.Size) {
+				fi, err := os.Stat(filepath.Join(dir, old.Path))
+				if err == nil && fi.Size() == old.Size {
+					entries[i].SHA256, entries[i].Path = old.SHA256, old.Path
+					summary.Unchanged++
+					continue
+				}
+			}
+			download = append(download, a)
+		}
+
+		hashes := make(map[*tickets.Attachment]hash.Hash, len(download))
+		for _, a := range download {
+			hashes[a] = sha256.New()
+		}
+		tmpPath := func(a *tickets.Attachment) string {
+			return tickets.AttachmentPath(filepath.Join(dir, "tmp"), a)
+		}
+		err = t.DownloadAttachments(download, &tickets.DownloadOptions{
+			Workers: flags.workers,
+			Create: func(a *tickets.Attachment) (io.Writer, error) {
+				f, err := os.Create(tmpPath(a))
+				if err != nil {
+					return nil, err
+				}
+				return &hashingFile{f: f, h: hashes[a]}, nil
+			},
+			Progress: func(a *tickets.Attachment, done, total int) {
+				fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", done, total, a.Filename)
+			},
+		})
+		failed := map[*tickets.Attachment]bool{}
+		var me *lighthouse.MultiError
+		if errors.As(err, &me) {
+			for _, bi := range me.Items {
+				a := download[bi.Index]
+				failed[a] = true
+				fmt.Fprintf(os.Stderr, "%d %s: %v\n", a.ID, a.Filename, bi.Err)
+				os.Remove(tmpPath(a))
+			}
+		} else if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		byID := map[int]*mirroredAttachment{}
+		for _, e := range entries {
+			byID[e.ID] = e
+		}
+		for _, a := range download {
+			if failed[a] {
+				summary.Failed++
+				continue
+			}
+			sum := hex.EncodeToString(hashes[a].Sum(nil))
+			rel := filepath.Join("objects", sum[:2], sum)
+			err = os.MkdirAll(filepath.Join(dir, filepath.Dir(rel)), 0755)
+			if err == nil {
+				err = os.Rename(tmpPath(a), filepath.Join(dir, rel))
+			}
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			byID[a.ID].SHA256, byID[a.ID].Path = sum, rel
+			summary.Downloaded++
+		}
+
+		mirrored := []*mirroredAttachment{}
+		for _, e := range entries {
+			if len(e.Path) > 0 {
+				mirrored = append(mirrored, e)
+			}
+		}
+		err = writeAttachmentsIndex(dir, mirrored)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		Output(summary)
+	},
+}
+
+// hashingFile is a file which hashes what is written to it.
+type hashingFile struct {
+	f *os.File
+	h hash.Hash
+}
+
+func (hf *hashingFile) Write(p []byte) (int, error) {
+	hf.h.Write(p)
+	return hf.f.Write(p)
+}
+
+func (hf *hashingFile) Close() error {
+	return hf.f.Close()
+}
+
+// projectAttachments returns the attachments of every ticket and
+// milestone of a project along with index entries for each of them
+// whose contents are yet to be filled in.
+func projectAttachments(t *tickets.Service, m *milestones.Service) ([]*mirroredAttachment, tickets.Attachments, error) {
+	entries := []*mirroredAttachment{}
+	as := tickets.Attachments{}
+	add := func(a *tickets.Attachment, ticket, milestone int) {
+		if a == nil {
+			return
+		}
+		entries = append(entries, &mirroredAttachment{
+			ID:          a.ID,
+			Ticket:      ticket,
+			Milestone:   milestone,
+			Filename:    a.Filename,
+			ContentType: a.ContentType,
+			Size:        int64(a.Size),
+		})
+		as = append(as, a)
+	}
+
+	var err error
+	it := t.Iter(&tickets.ListOptions{Limit: tickets.MaxLimit})
+	for it.Next() {
+		ticket := it.Ticket()
+		if ticket.AttachmentsCount == 0 {
+			continue
+		}
+		// tickets returned by List may not include attachments
+		if len(ticket.Attachments) < ticket.AttachmentsCount {
+			ticket, err = t.GetByNumber(ticket.Number)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		for _, a := range ticket.Attachments {
+			add(a.Attachment, ticket.Number, 0)
+		}
+	}
+	if err = it.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	ms, err := m.ListAll(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, milestone := range ms {
+		if milestone.AttachmentsCount == 0 {
+			continue
+		}
+		// milestones returned by List do not include attachments
+		full, err := m.GetByID(milestone.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, a := range full.Attachments {
+			add(a.Attachment, 0, milestone.ID)
+		}
+	}
+
+	return entries, as, nil
+}
+
+// readAttachmentsIndex reads the index of the mirror in dir, keyed by
+// attachment ID.  A missing index is empty.
+func readAttachmentsIndex(dir string) (map[int]*mirroredAttachment, error) {
+	index := map[int]*mirroredAttachment{}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, attachmentsIndexFile))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := []*mirroredAttachment{}
+	err = json.Unmarshal(buf, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", attachmentsIndexFile, err)
+	}
+	for _, e := range entries {
+		index[e.ID] = e
+	}
+	return index, nil
+}
+
+// writeAttachmentsIndex replaces the index of the mirror in dir with
+// entries, sorted by attachment ID.
+func writeAttachmentsIndex(dir string, entries []*mirroredAttachment) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	buf, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "tmp", attachmentsIndexFile)
+	err = ioutil.WriteFile(tmp, append(buf, '\n'), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, attachmentsIndexFile))
+}
+
+func init() {
+	attachmentsCmd.AddCommand(attachmentsSyncCmd)
+	attachmentsSyncCmd.Flags().IntVar(&attachmentsSyncCmdFlags.workers, "workers", lighthouse.DefaultPoolWorkers, "Number of attachments to download at once")
+}
@@ -0,0 +1,298 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type backupCmdOpts struct {
+	dest          string
+	encrypt       string
+	incremental   bool
+	noAttachments bool
+	only          []string
+	state         string
+}
+
+var backupCmdFlags backupCmdOpts
+
+// backupCmd represents the backup command
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Export Lighthouse account data and upload it",
+	Long: `Export Lighthouse account data and upload it
+
+Combines export, validation, encryption and upload into a single
+command suitable for running from cron.  A summary is printed on
+success and the exit status is non-zero on failure.
+
+--dest may be an s3:// URL (uploaded using 'aws s3 cp'), a gs://
+URL (uploaded using 'gsutil cp') or a local directory.
+
+--encrypt may be 'age:RECIPIENT' (encrypted using 'age') or
+'gpg:RECIPIENT' (encrypted using 'gpg').
+
+With --incremental, only tickets updated since the last successful
+backup to --dest are included.  The time of the last backup is
+recorded in the file given by --state.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := backupCmdFlags
+		if len(flags.dest) == 0 {
+			FatalUsage(cmd, "Please specify backup destination with --dest")
+		}
+		encrypt, err := encryptCommand(flags.encrypt)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		err = backup(Account(), flags, encrypt)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Backup failed:", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// backup exports account to a temporary directory, validates,
+// encrypts and uploads the export, records the time of the backup in
+// flags.state and prints a summary.  The temporary directory is
+// always removed.
+func backup(account string, flags backupCmdOpts, encrypt func(path string) (string, error)) error {
+	start := time.Now()
+	stateKey := account + " " + flags.dest
+
+	state := map[string]time.Time{}
+	buf, err := ioutil.ReadFile(flags.state)
+	if err == nil {
+		err = json.Unmarshal(buf, &state)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	opts := &exportOptions{
+		noAttachments: flags.noAttachments,
+		only:          flags.only,
+		quiet:         true,
+	}
+	kind := "full"
+	if last, ok := state[stateKey]; ok && flags.incremental {
+		opts.since = &last
+		kind = "incremental"
+	}
+
+	dir, err := ioutil.TempDir("", "lh-backup")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	name := fmt.Sprintf("%s_%s_%s.tar.gz", account, start.Format("2006-01-02T150405"), kind)
+	path := filepath.Join(dir, name)
+
+	summary, err := exportAccount(service, account, path, opts)
+	if err != nil {
+		return err
+	}
+
+	files, err := validateExport(path)
+	if err != nil {
+		return fmt.Errorf("export validation failed: %v", err)
+	}
+	if files != summary.Files {
+		return fmt.Errorf("export validation failed: wrote %d files, read %d", summary.Files, files)
+	}
+
+	if encrypt != nil {
+		path, err = encrypt(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	location, err := uploadBackup(path, flags.dest)
+	if err != nil {
+		return err
+	}
+
+	state[stateKey] = start
+	buf, err = json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(flags.state, append(buf, '\n'), 0600)
+	}
+	if err != nil {
+		return fmt.Errorf("backup uploaded but unable to record state: %v", err)
+	}
+
+	fmt.Printf("Backup of Lighthouse account %s succeeded\n\n", account)
+	fmt.Printf("  Type:         %s\n", kind)
+	if opts.since != nil {
+		fmt.Printf("  Since:        %s\n", opts.since.Format(time.RFC3339))
+	}
+	fmt.Printf("  Location:     %s\n", location)
+	fmt.Printf("  Size:         %d bytes\n", fi.Size())
+	fmt.Printf("  Encrypted:    %t\n", encrypt != nil)
+	fmt.Printf("  Projects:     %d\n", summary.Projects)
+	fmt.Printf("  Tickets:      %d\n", summary.Tickets)
+	fmt.Printf("  Attachments:  %d\n", summary.Attachments)
+	fmt.Printf("  Users:        %d\n", summary.Users)
+	fmt.Printf("  Files:        %d\n", summary.Files)
+	fmt.Printf("  API requests: %d\n", service.Requests())
+	fmt.Printf("  Duration:     %s\n", time.Since(start).Round(time.Second))
+	return nil
+}
+
+// validateExport reads back the export at path, ensuring it is a
+// valid gzipped tarball whose JSON files all parse, and returns the
+// number of regular files it contains.
+func validateExport(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	z, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, err
+	}
+	defer z.Close()
+	tr := tar.NewReader(z)
+
+	files := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return files, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		files++
+		if filepath.Ext(hdr.Name) != ".json" {
+			_, err = io.Copy(ioutil.Discard, tr)
+			if err != nil {
+				return files, err
+			}
+			continue
+		}
+		var v interface{}
+		err = json.NewDecoder(tr).Decode(&v)
+		if err != nil {
+			return files, fmt.Errorf("%s: %v", hdr.Name, err)
+		}
+	}
+
+	return files, nil
+}
+
+// encryptCommand parses spec, which has the form 'TOOL:RECIPIENT',
+// and returns a function which encrypts a file, returning the path
+// of the encrypted file.  If spec is empty, encryptCommand returns
+// nil.
+func encryptCommand(spec string) (func(path string) (string, error), error) {
+	if len(spec) == 0 {
+		return nil, nil
+	}
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || len(parts[1]) == 0 {
+		return nil, fmt.Errorf("invalid --encrypt %q, expected age:RECIPIENT or gpg:RECIPIENT", spec)
+	}
+	tool, recipient := parts[0], parts[1]
+
+	var args func(in, out string) []string
+	switch tool {
+	case "age":
+		args = func(in, out string) []string {
+			return []string{"-r", recipient, "-o", out, in}
+		}
+	case "gpg":
+		args = func(in, out string) []string {
+			return []string{"--batch", "--yes", "--encrypt", "--recipient", recipient, "--output", out, in}
+		}
+	default:
+		return nil, fmt.Errorf("unknown encryption tool %q, expected age or gpg", tool)
+	}
+
+	return func(path string) (string, error) {
+		out := path + "." + tool
+		err := runTool(tool, args(path, out)...)
+		if err != nil {
+			return "", err
+		}
+		return out, nil
+	}, nil
+}
+
+// uploadBackup copies the file at path to dest, returning its final
+// location.
+func uploadBackup(path, dest string) (string, error) {
+	name := filepath.Base(path)
+	location := strings.TrimSuffix(dest, "/") + "/" + name
+
+	switch {
+	case strings.HasPrefix(dest, "s3://"):
+		return location, runTool("aws", "s3", "cp", "--only-show-errors", path, location)
+	case strings.HasPrefix(dest, "gs://"):
+		return location, runTool("gsutil", "-q", "cp", path, location)
+	case strings.Contains(dest, "://"):
+		return "", fmt.Errorf("unsupported backup destination %q", dest)
+	}
+
+	location = filepath.Join(dest, name)
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(location, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return "", err
+	}
+	return location, out.Close()
+}
+
+func runTool(name string, args ...string) error {
+	c := exec.Command(name, args...)
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(backupCmd)
+	home, _ := os.UserHomeDir()
+	backupCmd.Flags().StringVar(&backupCmdFlags.dest, "dest", "", "Backup destination, an s3:// or gs:// URL or a local directory (required)")
+	backupCmd.Flags().StringVar(&backupCmdFlags.encrypt, "encrypt", "", "Encrypt backup using age:RECIPIENT or gpg:RECIPIENT")
+	backupCmd.Flags().BoolVar(&backupCmdFlags.incremental, "incremental", false, "Only include tickets updated since the last backup")
+	backupCmd.Flags().BoolVar(&backupCmdFlags.noAttachments, "no-attachments", false, "Don't include attachments in backup")
+	backupCmd.Flags().StringSliceVar(&backupCmdFlags.only, "only", nil, "Only back up data for the given comma-separated Lighthouse projects")
+	backupCmd.Flags().StringVar(&backupCmdFlags.state, "state", filepath.Join(home, ".lh-backup.json"), "File recording the time of the last backup")
+}
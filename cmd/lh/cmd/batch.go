@@ -0,0 +1,353 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/messages"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type batchCmdOpts struct {
+	stopOnError bool
+}
+
+var batchCmdFlags batchCmdOpts
+
+// batchCommand is a line read by lh batch.
+type batchCommand struct {
+	Op       string          `json:"op"`
+	Resource string          `json:"resource"`
+	Project  batchID         `json:"project,omitempty"`
+	ID       batchID         `json:"id,omitempty"`
+	Fields   json.RawMessage `json:"fields,omitempty"`
+	// Ref is echoed in the command's result to help callers
+	// match results to commands.
+	Ref json.RawMessage `json:"ref,omitempty"`
+}
+
+// batchID is an ID or name, given as a JSON number or string.
+type batchID string
+
+func (bi *batchID) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*bi = batchID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("expected number or string, got %s", data)
+	}
+	*bi = batchID(n.String())
+	return nil
+}
+
+// BatchResult is written by lh batch for each command it reads.
+type BatchResult struct {
+	Line   int             `json:"line"`
+	Ref    json.RawMessage `json:"ref,omitempty"`
+	OK     bool            `json:"ok"`
+	Result interface{}     `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// batchCmd represents the batch command
+var batchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Execute newline-delimited JSON commands read from standard input",
+	Long: `Execute newline-delimited JSON commands read from standard input
+
+Reads one JSON command per line, i.e.,
+
+  {"op":"update","resource":"ticket","id":42,"fields":{"state":"resolved"}}
+
+and writes one JSON result per line to standard output, i.e.,
+
+  {"line":1,"ok":true,"result":{...}}
+
+so other programs can drive Lighthouse through a single lh process
+whose requests share one rate limiter.  Commands are executed in
+order.  A failed command's result has "ok" false and an "error"
+message, and the remaining commands are still executed unless
+--stop-on-error is given.  lh batch exits with status 1 if any
+command failed.
+
+"op" is one of get, list, create, update or delete and "resource" is
+one of ticket, milestone, message or bin.  "id" is the ticket number
+or the ID or name of the milestone, message or bin for get, update
+and delete.  "project" is a project ID or name, defaulting to -p.
+"fields" are the resource's fields, keyed by JSON name, for create
+and update, and for list tickets may contain "query".  Update only
+changes the given fields.  "ref" is echoed in the result.  Blank
+lines are ignored.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := batchCmdFlags
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		b := &batcher{projects: map[string]int{}}
+		failed := false
+		sc := bufio.NewScanner(os.Stdin)
+		sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for line := 1; sc.Scan(); line++ {
+			data := bytes.TrimSpace(sc.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+			result := b.execute(line, data)
+			err := enc.Encode(result)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			if !result.OK {
+				failed = true
+				if flags.stopOnError {
+					break
+				}
+			}
+		}
+		if err := sc.Err(); err != nil {
+			FatalUsage(cmd, err)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// batcher executes lh batch commands.
+type batcher struct {
+	// projects caches project IDs by the ID or name given.
+	projects map[string]int
+}
+
+func (b *batcher) execute(line int, data []byte) *BatchResult {
+	result := &BatchResult{Line: line}
+	bc := &batchCommand{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(bc)
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid command: %v", err)
+		return result
+	}
+	result.Ref = bc.Ref
+	v, err := b.run(bc)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.OK, result.Result = true, v
+	return result
+}
+
+func (b *batcher) project(projectStr string) (int, error) {
+	if len(projectStr) == 0 {
+		projectStr = viper.GetString("project")
+	}
+	if len(projectStr) == 0 {
+		return 0, fmt.Errorf("must supply project, either in the command or via -p")
+	}
+	if id, ok := b.projects[projectStr]; ok {
+		return id, nil
+	}
+	id, err := ProjectID(projectStr)
+	if err != nil {
+		return 0, err
+	}
+	b.projects[projectStr] = id
+	return id, nil
+}
+
+func (b *batcher) run(bc *batchCommand) (interface{}, error) {
+	switch bc.Op {
+	case "get", "list", "create", "update", "delete":
+	default:
+		return nil, fmt.Errorf("unknown op %q, expected one of get, list, create, update or delete", bc.Op)
+	}
+	id := string(bc.ID)
+	switch bc.Op {
+	case "get", "update", "delete":
+		if len(id) == 0 {
+			return nil, fmt.Errorf("%s %s requires id", bc.Op, bc.Resource)
+		}
+	}
+	projectID, err := b.project(string(bc.Project))
+	if err != nil {
+		return nil, err
+	}
+
+	switch bc.Resource {
+	case "ticket":
+		return b.ticket(tickets.NewService(service, projectID), bc.Op, id, bc.Fields)
+	case "milestone":
+		return b.milestone(milestones.NewService(service, projectID), bc.Op, id, bc.Fields)
+	case "message":
+		return b.message(messages.NewService(service, projectID), bc.Op, id, bc.Fields)
+	case "bin":
+		return b.bin(bins.NewService(service, projectID), bc.Op, id, bc.Fields)
+	}
+	return nil, fmt.Errorf("unknown resource %q, expected one of ticket, milestone, message or bin", bc.Resource)
+}
+
+// decodeFields decodes fields into v, leaving fields of v which are
+// not present unchanged.  Fields which v does not have are an error
+// rather than being silently dropped.
+func decodeFields(fields json.RawMessage, v interface{}) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(fields))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err != nil {
+		return fmt.Errorf("invalid fields: %v", err)
+	}
+	return nil
+}
+
+func (b *batcher) ticket(t *tickets.Service, op, id string, fields json.RawMessage) (interface{}, error) {
+	switch op {
+	case "get":
+		return t.Get(id)
+	case "list":
+		opts := &tickets.ListOptions{}
+		err := decodeFields(fields, &struct {
+			Query *string `json:"query"`
+		}{&opts.Query})
+		if err != nil {
+			return nil, err
+		}
+		opts.Limit = tickets.MaxLimit
+		return t.ListAll(opts)
+	case "create":
+		tkt := &tickets.Ticket{}
+		err := decodeFields(fields, tkt)
+		if err != nil {
+			return nil, err
+		}
+		return t.Create(tkt)
+	case "update":
+		number, err := tickets.Number(id)
+		if err != nil {
+			return nil, err
+		}
+		update := &tickets.TicketUpdate{}
+		err = decodeFields(fields, update)
+		if err != nil {
+			return nil, err
+		}
+		err = t.UpdatePartial(number, update)
+		if err != nil {
+			return nil, err
+		}
+		return t.GetByNumber(number)
+	}
+	return nil, t.Delete(id)
+}
+
+func (b *batcher) milestone(m *milestones.Service, op, id string, fields json.RawMessage) (interface{}, error) {
+	switch op {
+	case "get":
+		return m.Get(id)
+	case "list":
+		return m.ListAll(nil)
+	case "create":
+		milestone := &milestones.Milestone{}
+		err := decodeFields(fields, milestone)
+		if err != nil {
+			return nil, err
+		}
+		return m.Create(milestone)
+	case "update":
+		milestone, err := m.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		err = decodeFields(fields, milestone)
+		if err != nil {
+			return nil, err
+		}
+		err = m.Update(milestone)
+		if err != nil {
+			return nil, err
+		}
+		return m.GetByID(milestone.ID)
+	}
+	return nil, m.Delete(id)
+}
+
+func (b *batcher) message(m *messages.Service, op, id string, fields json.RawMessage) (interface{}, error) {
+	switch op {
+	case "get":
+		return m.Get(id)
+	case "list":
+		return m.List()
+	case "create":
+		message := &messages.Message{}
+		err := decodeFields(fields, message)
+		if err != nil {
+			return nil, err
+		}
+		return m.Create(message)
+	case "update":
+		message, err := m.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		err = decodeFields(fields, message)
+		if err != nil {
+			return nil, err
+		}
+		err = m.Update(message)
+		if err != nil {
+			return nil, err
+		}
+		return m.GetByID(message.ID)
+	}
+	return nil, m.Delete(id)
+}
+
+func (b *batcher) bin(bs *bins.Service, op, id string, fields json.RawMessage) (interface{}, error) {
+	switch op {
+	case "get":
+		return bs.Get(id)
+	case "list":
+		return bs.List()
+	case "create":
+		bin := &bins.Bin{}
+		err := decodeFields(fields, bin)
+		if err != nil {
+			return nil, err
+		}
+		return bs.Create(bin)
+	case "update":
+		bin, err := bs.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		err = decodeFields(fields, bin)
+		if err != nil {
+			return nil, err
+		}
+		err = bs.Update(bin)
+		if err != nil {
+			return nil, err
+		}
+		return bs.GetByID(bin.ID)
+	}
+	return nil, bs.Delete(id)
+}
+
+func init() {
+	RootCmd.AddCommand(batchCmd)
+	batchCmd.Flags().BoolVar(&batchCmdFlags.stopOnError, "stop-on-error", false, "Stop at the first command which fails")
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+type commentCmdOpts struct {
+	noNotify bool
+	watchers []string
+}
+
+var commentCmdFlags commentCmdOpts
+
+// commentCmd represents the comment command
+var commentCmd = &cobra.Command{
+	Use:   "comment [number] [body]",
+	Short: "Comment on a ticket (requires -p)",
+	Long: `Comment on a ticket (requires -p)
+
+Adds BODY as a comment on ticket NUMBER.  Only the comment is sent, so
+the ticket's title, state, tags and other fields are left unchanged.
+Use - as BODY to read the comment from standard input.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := commentCmdFlags
+		projectID := Project()
+		t := tickets.NewService(service, projectID)
+		if len(args) != 2 {
+			FatalUsage(cmd, "must supply ticket number and comment")
+		}
+		number, err := tickets.Number(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		body := args[1]
+		if body == "-" {
+			buf, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			body = string(buf)
+		}
+		if len(strings.TrimSpace(body)) == 0 {
+			FatalUsage(cmd, "must supply comment")
+		}
+		opts, err := NotifyOptions(flags.noNotify, flags.watchers)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = t.CommentWithOptions(number, body, opts)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		tkt, err := t.GetByNumber(number)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		Output(tkt)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(commentCmd)
+	commentCmd.Flags().BoolVar(&commentCmdFlags.noNotify, "no-notify", false, "Don't send notification emails")
+	commentCmd.Flags().StringSliceVar(&commentCmdFlags.watchers, "watchers", nil, "Comma-separated users to set as ticket watchers")
+}
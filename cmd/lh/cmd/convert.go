@@ -0,0 +1,13 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+// convertCmd represents the convert command
+var convertCmd = &cobra.Command{
+	Use:   "convert",
+	Short: "Convert Lighthouse resources",
+}
+
+func init() {
+	RootCmd.AddCommand(convertCmd)
+}
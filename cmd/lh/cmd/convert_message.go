@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nwidger/lighthouse/messages"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+type convertMessageCmdOpts struct {
+	toTicket bool
+	noLink   bool
+	noNotify bool
+}
+
+var convertMessageCmdFlags convertMessageCmdOpts
+
+// convertMessageCmd represents the convert message command
+var convertMessageCmd = &cobra.Command{
+	Use:   "message [id-or-title]",
+	Short: "Convert a message (requires -p)",
+	Long: `Convert a message (requires -p)
+
+With --to-ticket, creates a ticket whose title is the message's title
+and whose body is the message's body followed by each of its
+comments.  Unless --no-link is given, a comment linking to the new
+ticket is then added to the message.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := convertMessageCmdFlags
+		projectID := Project()
+		if len(args) == 0 {
+			FatalUsage(cmd, "must supply message ID or title")
+		}
+		if !flags.toTicket {
+			FatalUsage(cmd, "Please specify what to convert the message to with --to-ticket")
+		}
+		m := messages.NewService(service, projectID)
+		t := tickets.NewService(service, projectID)
+		opts, err := NotifyOptions(flags.noNotify, nil)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		ticket, err := m.ConvertToTicket(args[0], t, opts, !flags.noLink)
+		if err != nil {
+			if ticket == nil {
+				FatalUsage(cmd, err)
+			}
+			fmt.Fprintf(os.Stderr, "Warning: created ticket #%d but unable to comment on message: %v\n", ticket.Number, err)
+		}
+		Output(ticket)
+	},
+}
+
+func init() {
+	convertCmd.AddCommand(convertMessageCmd)
+	convertMessageCmd.Flags().BoolVar(&convertMessageCmdFlags.toTicket, "to-ticket", false, "Convert message to a ticket")
+	convertMessageCmd.Flags().BoolVar(&convertMessageCmdFlags.noLink, "no-link", false, "Don't comment on the message with a link to the new ticket")
+	convertMessageCmd.Flags().BoolVar(&convertMessageCmdFlags.noNotify, "no-notify", false, "Don't send notification emails")
+}
@@ -37,7 +37,7 @@ var createBinCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(nb)
+		Output(nb)
 	},
 }
 
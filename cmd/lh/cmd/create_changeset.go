@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/nwidger/lighthouse"
 	"github.com/nwidger/lighthouse/changesets"
 	"github.com/spf13/cobra"
 )
@@ -16,6 +17,7 @@ type createChangesetsCmdOpts struct {
 	revision string
 	title    string
 	user     string
+	link     bool
 }
 
 var createChangesetsCmdFlags createChangesetsCmdOpts
@@ -62,7 +64,7 @@ var createChangesetCmd = &cobra.Command{
 			if err != nil {
 				FatalUsage(cmd, err)
 			}
-			changeset.ChangedAt = &changedAt
+			changeset.ChangedAt = lighthouse.NewTime(changedAt)
 		}
 		if len(flags.user) > 0 {
 			userID, err := UserID(flags.user)
@@ -75,7 +77,13 @@ var createChangesetCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(nm)
+		if flags.link {
+			_, err = m.LinkTickets(nm)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+		}
+		Output(nm)
 	},
 }
 
@@ -87,4 +95,5 @@ func init() {
 	createChangesetCmd.Flags().StringVar(&createChangesetsCmdFlags.revision, "revision", "", "Changeset revision (required)")
 	createChangesetCmd.Flags().StringVar(&createChangesetsCmdFlags.title, "title", "", "Changeset title (required)")
 	createChangesetCmd.Flags().StringVar(&createChangesetsCmdFlags.user, "user", "", "Assign changeset to user (optional)")
+	createChangesetCmd.Flags().BoolVar(&createChangesetsCmdFlags.link, "link-tickets", false, "Comment on and apply keywords to tickets referenced in body as '[#123 state:resolved]' (optional)")
 }
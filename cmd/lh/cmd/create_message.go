@@ -6,8 +6,10 @@ import (
 )
 
 type createMessagesCmdOpts struct {
-	title string
-	body  string
+	title    string
+	body     string
+	noNotify bool
+	watchers []string
 }
 
 var createMessagesCmdFlags createMessagesCmdOpts
@@ -31,11 +33,15 @@ var createMessageCmd = &cobra.Command{
 		if len(message.Body) == 0 {
 			FatalUsage(cmd, "Please specify message body with --body")
 		}
-		nm, err := m.Create(message)
+		opts, err := NotifyOptions(flags.noNotify, flags.watchers)
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(nm)
+		nm, err := m.CreateWithOptions(message, opts)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		Output(nm)
 	},
 }
 
@@ -43,4 +49,6 @@ func init() {
 	createCmd.AddCommand(createMessageCmd)
 	createMessageCmd.Flags().StringVar(&createMessagesCmdFlags.title, "title", "", "Message title (required)")
 	createMessageCmd.Flags().StringVar(&createMessagesCmdFlags.body, "body", "", "Message body (required)")
+	createMessageCmd.Flags().BoolVar(&createMessagesCmdFlags.noNotify, "no-notify", false, "Don't send notification emails (optional)")
+	createMessageCmd.Flags().StringSliceVar(&createMessagesCmdFlags.watchers, "watchers", nil, "Comma-separated users to notify of the message (optional)")
 }
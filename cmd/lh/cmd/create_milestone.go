@@ -3,6 +3,7 @@ package cmd
 import (
 	"time"
 
+	"github.com/nwidger/lighthouse"
 	"github.com/nwidger/lighthouse/milestones"
 	"github.com/spf13/cobra"
 )
@@ -36,13 +37,13 @@ var createMilestoneCmd = &cobra.Command{
 			if err != nil {
 				FatalUsage(cmd, err)
 			}
-			milestone.DueOn = &due
+			milestone.DueOn = lighthouse.NewTime(due)
 		}
 		nm, err := m.Create(milestone)
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(nm)
+		Output(nm)
 	},
 }
 
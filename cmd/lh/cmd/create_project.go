@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/nwidger/lighthouse/projects"
 	"github.com/spf13/cobra"
 )
@@ -9,6 +11,7 @@ type createProjectsCmdOpts struct {
 	archived bool
 	name     string
 	public   bool
+	template string
 }
 
 var createProjectsCmdFlags createProjectsCmdOpts
@@ -26,14 +29,43 @@ var createProjectCmd = &cobra.Command{
 			Name:     flags.name,
 			Public:   flags.public,
 		}
+		var tmpl *projectTemplate
+		if len(flags.template) > 0 {
+			tmpl, err = readProjectTemplate(flags.template)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			if len(project.Name) == 0 {
+				project.Name = tmpl.Name
+			}
+			if tmpl.Public {
+				project.Public = true
+			}
+		}
 		if len(project.Name) == 0 {
 			FatalUsage(cmd, "Please specify project name with --name")
 		}
+		if tmpl != nil {
+			err = tmpl.checkMembers()
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+		}
 		np, err := p.Create(project)
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(np)
+		if tmpl != nil {
+			err = tmpl.apply(np)
+			if err != nil {
+				FatalUsage(cmd, fmt.Errorf("created project %d but unable to apply template: %v", np.ID, err))
+			}
+			np, err = p.GetByID(np.ID)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+		}
+		Output(np)
 	},
 }
 
@@ -42,4 +74,5 @@ func init() {
 	createProjectCmd.Flags().BoolVar(&createProjectsCmdFlags.archived, "archived", false, "Create archived project")
 	createProjectCmd.Flags().StringVar(&createProjectsCmdFlags.name, "name", "", "Project name (required)")
 	createProjectCmd.Flags().BoolVar(&createProjectsCmdFlags.public, "public", false, "Create public project")
+	createProjectCmd.Flags().StringVar(&createProjectsCmdFlags.template, "from-template", "", "Apply states, bins, milestones and members from YAML template file")
 }
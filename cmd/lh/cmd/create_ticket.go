@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nwidger/lighthouse"
 	"github.com/nwidger/lighthouse/tickets"
 	"github.com/spf13/cobra"
 )
@@ -12,6 +17,12 @@ type createTicketsCmdOpts struct {
 	assigned  string
 	milestone string
 	tags      string
+	noNotify  bool
+	watchers  []string
+
+	creator        string
+	createdAt      string
+	migrationToken string
 }
 
 var createTicketsCmdFlags createTicketsCmdOpts
@@ -34,6 +45,12 @@ var createTicketCmd = &cobra.Command{
 		if len(tc.Title) == 0 {
 			FatalUsage(cmd, "Please specify ticket title with --title")
 		}
+		if len(tc.State) > 0 {
+			tc.State, err = ValidState(t, tc.State)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+		}
 		if len(flags.assigned) > 0 {
 			tc.AssignedUserID, err = UserID(flags.assigned)
 			if err != nil {
@@ -46,11 +63,43 @@ var createTicketCmd = &cobra.Command{
 				FatalUsage(cmd, err)
 			}
 		}
-		nt, err := t.Create(tc)
+		opts, err := NotifyOptions(flags.noNotify, flags.watchers)
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(nt)
+		if len(flags.creator) == 0 && len(flags.createdAt) == 0 {
+			nt, err := t.CreateWithOptions(tc, opts)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			Output(nt)
+			return
+		}
+		if len(flags.migrationToken) == 0 {
+			FatalUsage(cmd, "Please specify account owner's API token with --migration-token when using --creator or --created-at")
+		}
+		if len(flags.creator) > 0 {
+			tc.CreatorID, err = UserID(flags.creator)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+		}
+		if len(flags.createdAt) > 0 {
+			createdAt, err := time.Parse(time.RFC3339, flags.createdAt)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			tc.CreatedAt = lighthouse.NewTime(createdAt)
+		}
+		creatorID := tc.CreatorID
+		nt, err := t.CreateWithCreator(tc, opts, flags.migrationToken)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		if creatorID != 0 && nt.CreatorID != creatorID {
+			fmt.Fprintln(os.Stderr, "Warning: Lighthouse ignored --creator, ticket was created by", nt.CreatorName)
+		}
+		Output(nt)
 	},
 }
 
@@ -62,4 +111,9 @@ func init() {
 	createTicketCmd.Flags().StringVar(&createTicketsCmdFlags.assigned, "assigned", "", "Assign ticket to a user (optional)")
 	createTicketCmd.Flags().StringVar(&createTicketsCmdFlags.milestone, "milestone", "", "Assign ticket to a milestone (optional)")
 	createTicketCmd.Flags().StringVar(&createTicketsCmdFlags.tags, "tags", "", "Comma-separated tags (optional)")
+	createTicketCmd.Flags().BoolVar(&createTicketsCmdFlags.noNotify, "no-notify", false, "Don't send notification emails (optional)")
+	createTicketCmd.Flags().StringSliceVar(&createTicketsCmdFlags.watchers, "watchers", nil, "Comma-separated users to set as ticket watchers (optional)")
+	createTicketCmd.Flags().StringVar(&createTicketsCmdFlags.creator, "creator", "", "Create ticket as this user, requires --migration-token (optional)")
+	createTicketCmd.Flags().StringVar(&createTicketsCmdFlags.createdAt, "created-at", "", "Ticket creation time in RFC 3339 format, requires --migration-token (optional)")
+	createTicketCmd.Flags().StringVar(&createTicketsCmdFlags.migrationToken, "migration-token", "", "API token of an account owner, used with --creator and --created-at (optional)")
 }
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"github.com/nwidger/lighthouse/export"
+	"github.com/spf13/cobra"
+)
+
+type diffExportsCmdOpts struct {
+	summary bool
+	kinds   []string
+}
+
+var diffExportsCmdFlags diffExportsCmdOpts
+
+// diffExportsCmd represents the diff-exports command
+var diffExportsCmd = &cobra.Command{
+	Use:   "diff-exports [from] [to]",
+	Short: "Compare two Lighthouse exports",
+	Long: `Compare two Lighthouse exports
+
+Lists the projects, milestones, tickets and ticket attachments added,
+changed or removed between export archives (or extracted export
+directories) FROM and TO, such as two backups of the same account.
+Changed projects, milestones and tickets list the fields which
+differ, changed tickets also list the number of versions added.  Use
+--summary to only count the changes of each kind.
+
+`,
+	// works on local files only, no account/token required
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := diffExportsCmdFlags
+		if len(args) != 2 {
+			FatalUsage(cmd, "must supply two export archives or directories")
+		}
+		from, err := export.Open(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		to, err := export.Open(args[1])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		changes := export.Diff(from, to)
+		if len(flags.kinds) > 0 {
+			kinds := map[string]bool{}
+			for _, kind := range flags.kinds {
+				kinds[kind] = true
+			}
+			filtered := export.Changes{}
+			for _, c := range changes {
+				if kinds[c.Kind] {
+					filtered = append(filtered, c)
+				}
+			}
+			changes = filtered
+		}
+		if flags.summary {
+			Output(changes.Summary())
+			return
+		}
+		Output(changes)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(diffExportsCmd)
+	diffExportsCmd.Flags().BoolVar(&diffExportsCmdFlags.summary, "summary", false, "Only output the number of changes of each kind")
+	diffExportsCmd.Flags().StringSliceVar(&diffExportsCmdFlags.kinds, "kind", nil, "Only list changes to these kinds of resources (project, milestone, ticket, attachment)")
+}
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/profiles"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tokens"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Statuses of a DoctorCheck.
+const (
+	doctorOK      = "ok"
+	doctorWarning = "warning"
+	doctorError   = "error"
+	doctorSkipped = "skipped"
+)
+
+// maxClockSkew is the clock skew above which doctor warns, since
+// relative dates such as those used by stale and remind are computed
+// locally.
+const maxClockSkew = time.Minute
+
+// DoctorCheck is the result of a single check made by doctor.
+type DoctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	// Fix suggests how to fix a failed check.
+	Fix string `json:"fix,omitempty"`
+}
+
+// doctorResponses records the Date header and status of the
+// responses to the requests made by doctor.
+type doctorResponses struct {
+	mu          sync.Mutex
+	skew        time.Duration
+	dated       bool
+	rateLimited int
+}
+
+func (dr *doctorResponses) middleware(next http.RoundTripper) http.RoundTripper {
+	return lighthouse.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			return resp, err
+		}
+		dr.mu.Lock()
+		defer dr.mu.Unlock()
+		if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil && !dr.dated {
+			dr.skew, dr.dated = time.Since(date), true
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			dr.rateLimited++
+		}
+		return resp, err
+	})
+}
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check your configuration, credentials and connectivity",
+	Long: `Check your configuration, credentials and connectivity
+
+Checks that the config file can be read, that an account and
+credentials are configured, that the account can be reached with
+them, whether the API token can create, update and delete
+resources, the rate limit settings, the difference between the local
+clock and Lighthouse's and, if -p is given, that the project exists.
+Each check is printed along with a suggested fix if it failed.  With
+--output, the checks are written in the given format instead.
+
+Exits with status 1 if any check failed.
+`,
+	// report missing account/token rather than failing
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		checks := doctor(cmd)
+		failed := false
+		for _, c := range checks {
+			if c.Status == doctorError {
+				failed = true
+			}
+		}
+		if cmd.Flags().Changed("output") {
+			Output(checks)
+		} else {
+			for _, c := range checks {
+				fmt.Fprintf(os.Stdout, "%-8s %-12s %s\n", c.Status, c.Name, c.Detail)
+				if len(c.Fix) > 0 {
+					fmt.Fprintf(os.Stdout, "%-8s %-12s fix: %s\n", "", "", c.Fix)
+				}
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// doctor runs each check in turn, skipping those which depend on a
+// failed check.
+func doctor(cmd *cobra.Command) []*DoctorCheck {
+	checks := []*DoctorCheck{}
+	check := func(name, status, detail, fix string) *DoctorCheck {
+		c := &DoctorCheck{Name: name, Status: status, Detail: detail, Fix: fix}
+		checks = append(checks, c)
+		return c
+	}
+	skip := func(reason string, names ...string) []*DoctorCheck {
+		for _, name := range names {
+			check(name, doctorSkipped, reason, "")
+		}
+		return checks
+	}
+
+	err := viper.ReadInConfig()
+	switch {
+	case err == nil:
+		check("config", doctorOK, viper.ConfigFileUsed(), "")
+	case errors.As(err, &viper.ConfigFileNotFoundError{}):
+		check("config", doctorWarning, "no config file found, using flags and environment variables only", "run 'lh init' to create one")
+	default:
+		check("config", doctorError, err.Error(), "fix the config file or pass another with --config")
+	}
+
+	account := viper.GetString("account")
+	if len(account) == 0 {
+		check("account", doctorError, "no account name", "pass -a or set 'account' in the config file, if your URL is https://acme.lighthouseapp.com your account is 'acme'")
+		return skip("no account", "credentials", "connection", "token", "rate-limit", "clock", "project")
+	}
+	if multipleAccounts(account) {
+		check("account", doctorError, "doctor checks a single account, not "+account, "run doctor once for each account with -a")
+		return skip("no account", "credentials", "connection", "token", "rate-limit", "clock", "project")
+	}
+	if baseURL := viper.GetString("base-url"); len(baseURL) > 0 {
+		check("account", doctorOK, account+" at "+baseURL, "")
+	} else {
+		check("account", doctorOK, account+" at "+lighthouse.BasePath(account), "")
+	}
+
+	token := viper.GetString("token")
+	switch {
+	case len(token) > 0:
+		check("credentials", doctorOK, "API token "+maskToken(token), "")
+	case viper.GetBool("keyring"):
+		tk, err := keyringGet(account)
+		if err != nil {
+			check("credentials", doctorError, "unable to read API token from keyring: "+err.Error(), "run 'lh init' to store the token again or pass -t")
+			return skip("no credentials", "connection", "token", "rate-limit", "clock", "project")
+		}
+		token = tk
+		check("credentials", doctorOK, "API token "+maskToken(token)+" from keyring", "")
+	case len(viper.GetString("email")) > 0 && len(viper.GetString("password")) > 0:
+		check("credentials", doctorOK, "email/password for "+viper.GetString("email"), "")
+	default:
+		check("credentials", doctorError, "no API token or email/password", "create an API token at "+lighthouse.WebURL(WebAccount(), "users", "me")+" and pass -t or run 'lh init'")
+		return skip("no credentials", "connection", "token", "rate-limit", "clock", "project")
+	}
+
+	if _, err := serviceOptions(); err != nil {
+		check("connection", doctorError, err.Error(), "check --proxy, --ca-cert, --client-cert and --client-key")
+		return skip("no connection", "token", "rate-limit", "clock", "project")
+	}
+	s := newService(cmd, account, token, true)
+	service = s
+	configureLogger()
+	dr := &doctorResponses{}
+	s.Use(dr.middleware)
+	start := time.Now()
+	u, err := profiles.NewService(s).Get()
+	switch {
+	case err == nil:
+		check("connection", doctorOK, fmt.Sprintf("authenticated as %s in %v", u.Name, time.Since(start).Round(time.Millisecond)), "")
+	case errors.Is(err, lighthouse.ErrUnauthorized):
+		check("connection", doctorError, err.Error(), "check the API token or email/password, tokens may be revoked at "+lighthouse.WebURL(WebAccount(), "users", "me"))
+	case errors.Is(err, lighthouse.ErrNotFound):
+		check("connection", doctorError, err.Error(), "check the account name (-a) and --base-url")
+	default:
+		check("connection", doctorError, err.Error(), "check your network connection, --base-url and proxy settings (--proxy or HTTPS_PROXY)")
+	}
+	if err != nil {
+		return skip("no connection", "token", "rate-limit", "clock", "project")
+	}
+
+	if len(token) > 0 {
+		t, err := tokens.NewService(s).Get(token)
+		switch {
+		case err != nil:
+			check("token", doctorWarning, "unable to get token: "+err.Error(), "")
+		case t.ReadOnly:
+			check("token", doctorWarning, "read-only, create, update and delete commands will fail", "create a token without 'read only' at "+lighthouse.WebURL(WebAccount(), "users", "me"))
+		case t.ProjectID != 0:
+			check("token", doctorOK, fmt.Sprintf("read/write, limited to project %d", t.ProjectID), "")
+		default:
+			check("token", doctorOK, "read/write", "")
+		}
+	} else {
+		check("token", doctorSkipped, "authenticating with email/password", "")
+	}
+
+	interval, burst := viper.GetDuration("rate-limit-interval"), viper.GetInt("rate-limit-burst-size")
+	switch {
+	case dr.rateLimited > 0:
+		check("rate-limit", doctorWarning, fmt.Sprintf("%d request(s) were rate limited", dr.rateLimited), "increase --rate-limit-interval or wait for other clients sharing the token to finish")
+	case interval == 0:
+		check("rate-limit", doctorWarning, "disabled, Lighthouse may reject requests with 429 Too Many Requests", "remove --rate-limit-interval 0 or 'rate-limit-interval' from the config file")
+	case interval < lighthouse.DefaultRateLimitInterval:
+		check("rate-limit", doctorWarning, fmt.Sprintf("%d request(s) every %v is faster than the default of 1 every %v", burst, interval, lighthouse.DefaultRateLimitInterval), "increase --rate-limit-interval")
+	default:
+		check("rate-limit", doctorOK, fmt.Sprintf("%d request(s) every %v", burst, interval), "")
+	}
+
+	dr.mu.Lock()
+	skew, dated := dr.skew, dr.dated
+	dr.mu.Unlock()
+	switch {
+	case !dated:
+		check("clock", doctorSkipped, "no Date header in responses", "")
+	case skew > maxClockSkew || skew < -maxClockSkew:
+		check("clock", doctorWarning, fmt.Sprintf("local clock differs from Lighthouse's by %v", skew.Round(time.Second)), "synchronize your clock, relative dates such as 'stale --idle' are computed locally")
+	default:
+		check("clock", doctorOK, fmt.Sprintf("within %v of Lighthouse", maxClockSkew), "")
+	}
+
+	projectStr := viper.GetString("project")
+	if len(projectStr) == 0 {
+		check("project", doctorSkipped, "no project given with -p", "")
+		return checks
+	}
+	p, err := projects.NewService(s).Get(projectStr)
+	if err != nil {
+		names := []string{}
+		if ps, err := projects.NewService(s).List(); err == nil {
+			for _, p := range ps {
+				names = append(names, p.Name)
+			}
+		}
+		fix := "check -p or 'project' in the config file"
+		if len(names) > 0 {
+			fix += ", available projects are " + strings.Join(names, ", ")
+		}
+		check("project", doctorError, err.Error(), fix)
+		return checks
+	}
+	check("project", doctorOK, fmt.Sprintf("%d %s", p.ID, p.Name), "")
+	return checks
+}
+
+// maskToken returns token with all but its first 4 characters
+// masked.
+func maskToken(token string) string {
+	if len(token) <= 4 {
+		return strings.Repeat("*", len(token))
+	}
+	return token[:4] + strings.Repeat("*", len(token)-4)
+}
+
+func init() {
+	RootCmd.AddCommand(doctorCmd)
+}
@@ -4,24 +4,28 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"mime"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/nwidger/lighthouse"
 	"github.com/nwidger/lighthouse/bins"
 	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/cmd/lh/output"
 	"github.com/nwidger/lighthouse/messages"
 	"github.com/nwidger/lighthouse/milestones"
 	"github.com/nwidger/lighthouse/profiles"
 	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tags"
 	"github.com/nwidger/lighthouse/tickets"
 	"github.com/nwidger/lighthouse/users"
 	"github.com/spf13/cobra"
@@ -30,6 +34,8 @@ import (
 type exportCmdOpts struct {
 	noAttachments bool
 	only          []string
+	workers       int
+	parallel      int
 }
 
 var exportCmdFlags exportCmdOpts
@@ -44,270 +50,586 @@ Export will be written to the current directory with filename
 ACCOUNT_YYYY-MM-DD.tar.gz.  If export fails due to issuing too many
 API requests, consider using -r and -b to rate limit API requests.
 
+With --account=all, each account in the config file's 'accounts' map
+is exported to its own ACCOUNT_YYYY-MM-DD.tar.gz, as is each account
+given with --account=ACCOUNT,ACCOUNT,...  Up to --parallel accounts
+are exported at once, sharing the rate limit given by -r and -b.  A
+summary of each account's export is printed once every export has
+finished, and the exit status is 1 if any export failed.
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		flags := exportCmdFlags
+		opts := &exportOptions{
+			noAttachments: flags.noAttachments,
+			only:          flags.only,
+			workers:       flags.workers,
+		}
+		if accounts != nil {
+			exportAccounts(cmd, accounts, flags.parallel, opts)
+			return
+		}
+		account := Account()
+		_, err := exportAccount(service, account, exportName(account), opts)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+	},
+}
 
-		only := map[int]bool{}
-		for _, projectStr := range flags.only {
-			id, err := ProjectID(projectStr)
-			if err != nil {
-				log.Fatal(err)
+type exportOptions struct {
+	noAttachments bool
+	only          []string
+
+	// if non-nil, only tickets updated since this time are
+	// exported
+	since *time.Time
+
+	// don't print the name of each exported file
+	quiet bool
+
+	// number of tickets, milestones and users to fetch at once
+	workers int
+}
+
+type exportedAttachment struct {
+	filename string
+	data     []byte
+}
+
+type exportedTicket struct {
+	ticket      *tickets.Ticket
+	attachments []*exportedAttachment
+}
+
+// fetchTicket fetches the full metadata of ticket number and, unless
+// noAttachments is set, the contents of its attachments.
+func fetchTicket(t *tickets.Service, number int, noAttachments bool, workers int) (*exportedTicket, error) {
+	ticket, err := t.GetByNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	et := &exportedTicket{
+		ticket: ticket,
+	}
+	if noAttachments {
+		return et, nil
+	}
+	as := make(tickets.Attachments, 0, len(ticket.Attachments))
+	for _, attachment := range ticket.Attachments {
+		as = append(as, attachment.Attachment)
+	}
+	et.attachments, err = fetchAttachments(t, as, workers)
+	if err != nil {
+		return nil, err
+	}
+	return et, nil
+}
+
+// fetchAttachments downloads the contents of as using up to workers
+// workers.
+func fetchAttachments(t *tickets.Service, as tickets.Attachments, workers int) ([]*exportedAttachment, error) {
+	bufs := make(map[*tickets.Attachment]*bytes.Buffer, len(as))
+	for _, a := range as {
+		bufs[a] = &bytes.Buffer{}
+	}
+	err := t.DownloadAttachments(as, &tickets.DownloadOptions{
+		Workers: workers,
+		Create: func(a *tickets.Attachment) (io.Writer, error) {
+			return bufs[a], nil
+		},
+	})
+	// some attachments might fail with a 404, don't consider
+	// this an error
+	failed := map[int]bool{}
+	var me *lighthouse.MultiError
+	if errors.As(err, &me) {
+		for _, bi := range me.Items {
+			var er *lighthouse.ErrorResponse
+			if !errors.As(bi.Err, &er) {
+				return nil, bi.Err
 			}
-			only[id] = true
+			failed[bi.Index] = true
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	eas := []*exportedAttachment{}
+	for i, a := range as {
+		if failed[i] {
+			continue
 		}
+		eas = append(eas, &exportedAttachment{
+			filename: a.Filename,
+			data:     bufs[a].Bytes(),
+		})
+	}
+	return eas, nil
+}
 
-		account := Account()
-		base := filepath.Join(".", account)
+type exportedMilestone struct {
+	milestone   *milestones.Milestone
+	attachments []*exportedAttachment
+}
+
+// fetchMilestone fetches the full metadata of milestone if it has
+// attachments and, unless noAttachments is set, the contents of its
+// attachments.
+func fetchMilestone(m *milestones.Service, t *tickets.Service, milestone *milestones.Milestone, noAttachments bool, workers int) (*exportedMilestone, error) {
+	em := &exportedMilestone{
+		milestone: milestone,
+	}
+	if noAttachments || milestone.AttachmentsCount == 0 {
+		return em, nil
+	}
+	// milestones returned by List do not include attachments
+	full, err := m.GetByID(milestone.ID)
+	if err != nil {
+		return nil, err
+	}
+	em.milestone = full
+	as := make(tickets.Attachments, 0, len(full.Attachments))
+	for _, attachment := range full.Attachments {
+		if attachment.Attachment != nil {
+			as = append(as, attachment.Attachment)
+		}
+	}
+	em.attachments, err = fetchAttachments(t, as, workers)
+	if err != nil {
+		return nil, err
+	}
+	return em, nil
+}
 
-		exportFilename := fmt.Sprintf(`%s_%s.tar.gz`, account, time.Now().Format(`2006-01-02`))
+type exportedUser struct {
+	user        *users.User
+	memberships users.Memberships
+	avatar      *exportedAttachment
+}
+
+// fetchUser fetches user id, their memberships and their avatar.
+// Fetching some users or memberships may result in a 401, so
+// fetchUser returns nil rather than an error if the user can't be
+// fetched and leaves memberships nil if they can't be fetched.
+func fetchUser(u *users.Service, id int) (*exportedUser, error) {
+	user, err := u.GetByID(id)
+	if err != nil {
+		return nil, nil
+	}
+	eu := &exportedUser{
+		user: user,
+	}
+	memberships, err := u.MembershipsByID(id)
+	if err == nil {
+		eu.memberships = memberships
+	}
+	if len(user.AvatarURL) == 0 {
+		return eu, nil
+	}
+	rc, ctype, err := u.GetAvatar(user)
+	if err != nil {
+		return eu, nil
+	}
+	buf, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+	ext := ".jpg"
+	mediatype, _, err := mime.ParseMediaType(ctype)
+	if err == nil {
+		switch mediatype {
+		case "image/bmp":
+			ext = ".bmp"
+		case "image/gif":
+			ext = ".gif"
+		case "image/jpeg":
+			ext = ".jpg"
+		case "image/png":
+			ext = ".png"
+		}
+	}
+	eu.avatar = &exportedAttachment{
+		filename: "avatar" + ext,
+		data:     buf,
+	}
+	return eu, nil
+}
+
+// exportSummary counts the resources written by exportAccount.
+type exportSummary struct {
+	Account     string `json:"account,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+	Projects    int    `json:"projects"`
+	Tickets     int    `json:"tickets"`
+	Attachments int    `json:"attachments"`
+	Users       int    `json:"users"`
+	Files       int    `json:"files"`
+	Requests    int    `json:"requests"`
+	Duration    string `json:"duration,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// exportName returns the default filename of an export of account.
+func exportName(account string) string {
+	return fmt.Sprintf(`%s_%s.tar.gz`, account, time.Now().Format(`2006-01-02`))
+}
 
-		f, err := os.Create(exportFilename)
+// exportAccounts exports each account in a to its own archive, up to
+// parallel accounts at once, then prints a summary of every export.
+// Exits with status 1 if any export failed.
+func exportAccounts(cmd *cobra.Command, a *lighthouse.Accounts, parallel int, opts *exportOptions) {
+	names := a.Names()
+	summaries := make([]*exportSummary, len(names))
+	lighthouse.NewPool(parallel).Run(context.Background(), len(names), func(ctx context.Context, i int) error {
+		start := time.Now()
+		s := a.Get(names[i])
+		name := exportName(names[i])
+		summary, err := exportAccount(s, names[i], name, opts)
 		if err != nil {
-			FatalUsage(cmd, err)
+			summary = &exportSummary{Error: err.Error()}
+			name = ""
 		}
-		defer f.Close()
-		z := gzip.NewWriter(f)
-		defer z.Close()
-		tw := tar.NewWriter(z)
-		defer tw.Close()
-
-		fatalUsage := func(cmd *cobra.Command, v ...interface{}) {
-			tw.Close()
-			z.Close()
-			f.Close()
-			FatalUsage(cmd, v...)
+		summary.Account, summary.Filename = names[i], name
+		summary.Requests = s.Requests()
+		summary.Duration = time.Since(start).Round(time.Second).String()
+		summaries[i] = summary
+		return nil
+	})
+
+	failed := false
+	for _, summary := range summaries {
+		if len(summary.Error) > 0 {
+			failed = true
 		}
+	}
+	outputOpts := OutputOptions()
+	if !cmd.Flags().Changed("output") {
+		outputOpts.Format = output.FormatTable
+	}
+	err := output.Write(os.Stdout, summaries, outputOpts)
+	if err != nil {
+		FatalUsage(cmd, err)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
 
-		// no way to list users, so instead we'll build up a
-		// map of all user ID's we see and then fetch those
-		usersMap := map[int]bool{}
+// exportAccount writes an export of account to exportFilename using
+// s.  If the export fails, exportFilename is removed.
+func exportAccount(s *lighthouse.Service, account, exportFilename string, opts *exportOptions) (*exportSummary, error) {
+	f, err := os.Create(exportFilename)
+	if err != nil {
+		return nil, err
+	}
+	z := gzip.NewWriter(f)
+	tw := tar.NewWriter(z)
+	ew := &exportWriter{
+		tw:    tw,
+		quiet: opts.quiet,
+	}
 
-		writeDir(cmd, tw, base)
+	summary, err := writeExport(s, account, ew, opts)
+	if err == nil {
+		err = ew.err
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = z.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(exportFilename)
+		return nil, err
+	}
+	summary.Files = ew.files
+	return summary, nil
+}
+
+// writeExport writes an export of account to ew using s.
+func writeExport(s *lighthouse.Service, account string, ew *exportWriter, opts *exportOptions) (*exportSummary, error) {
+	summary := &exportSummary{}
 
-		// account plan (only works if you are the account
-		// owner, don't consider it an error if this fails)
-		plan, err := service.Plan()
-		if err == nil {
-			writeJSONFile(cmd, tw, filepath.Join(base, "plan.json"), plan)
+	only := map[int]bool{}
+	for _, projectStr := range opts.only {
+		project, err := projects.NewService(s).Get(projectStr)
+		if err != nil {
+			return nil, err
 		}
+		only[project.ID] = true
+	}
+
+	base := filepath.Join(".", account)
+
+	// no way to list users, so instead we'll build up a
+	// map of all user ID's we see and then fetch those
+	usersMap := map[int]bool{}
+
+	ew.writeDir(base)
+
+	// account plan (only works if you are the account
+	// owner, don't consider it an error if this fails)
+	plan, err := s.Plan()
+	if err == nil {
+		ew.writeJSONFile(filepath.Join(base, "plan.json"), plan)
+	}
+
+	// account profile
+	pp := profiles.NewService(s)
+	up, err := pp.Get()
+	if err == nil {
+		usersMap[up.ID] = true
+		ew.writeJSONFile(filepath.Join(base, "profile.json"), up)
+	}
 
-		// account profile
-		pp := profiles.NewService(service)
-		up, err := pp.Get()
-		if err == nil {
-			usersMap[up.ID] = true
-			writeJSONFile(cmd, tw, filepath.Join(base, "profile.json"), up)
+	// account projects
+	p := projects.NewService(s)
+	ps, err := p.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, project := range ps {
+		if ew.err != nil {
+			return nil, ew.err
+		}
+
+		// skip if project not in --only
+		if len(only) > 0 && !only[project.ID] {
+			continue
 		}
 
-		// account projects
-		p := projects.NewService(service)
-		ps, err := p.List()
+		summary.Projects++
+		projectBase := filepath.Join(base, "projects", filename(fmt.Sprintf("%d-%s", project.ID, project.Permalink)))
+		ew.writeDir(projectBase)
+
+		// project metadata
+		usersMap[project.DefaultAssignedUserID] = true
+		ew.writeJSONFile(filepath.Join(projectBase, "project.json"), project)
+
+		// project memberships
+		memberships, err := p.MembershipsByID(project.ID)
 		if err != nil {
-			fatalUsage(cmd, err)
+			return nil, err
 		}
-		for _, project := range ps {
-			// skip if project not in --only
-			if len(only) > 0 && !only[project.ID] {
-				continue
-			}
+		for _, membership := range memberships {
+			usersMap[membership.UserID] = true
+		}
+		ew.writeJSONFile(filepath.Join(projectBase, "memberships.json"), memberships)
 
-			projectBase := filepath.Join(base, "projects", filename(fmt.Sprintf("%d-%s", project.ID, project.Permalink)))
-			writeDir(cmd, tw, projectBase)
+		// project tags
+		ts, err := tags.NewService(s, project.ID).List()
+		if err != nil {
+			return nil, err
+		}
+		ew.writeJSONFile(filepath.Join(projectBase, "tags.json"), ts)
 
-			// project metadata
-			usersMap[project.DefaultAssignedUserID] = true
-			writeJSONFile(cmd, tw, filepath.Join(projectBase, "project.json"), project)
+		// project bins
+		binsBase := filepath.Join(projectBase, "bins")
+		b := bins.NewService(s, project.ID)
+		bs, err := b.List()
+		if err != nil {
+			return nil, err
+		}
+		ew.writeDir(binsBase)
+		for _, bin := range bs {
+			usersMap[bin.UserID] = true
+			ew.writeJSONFile(filepath.Join(binsBase, filename(fmt.Sprintf("%d-%s", bin.ID, bin.Name))+".json"), bin)
+		}
 
-			// project memberships
-			memberships, err := p.MembershipsByID(project.ID)
+		// project changesets
+		c := changesets.NewService(s, project.ID)
+		changesetOpts := &changesets.ListOptions{}
+		changesetsBase := filepath.Join(projectBase, "changesets")
+		ew.writeDir(changesetsBase)
+		for changesetOpts.Page = 1; ; changesetOpts.Page++ {
+			cs, err := c.List(changesetOpts)
 			if err != nil {
-				fatalUsage(cmd, err)
-			}
-			for _, membership := range memberships {
-				usersMap[membership.UserID] = true
+				return nil, err
 			}
-			writeJSONFile(cmd, tw, filepath.Join(projectBase, "memberships.json"), memberships)
-
-			// project bins
-			binsBase := filepath.Join(projectBase, "bins")
-			b := bins.NewService(service, project.ID)
-			bs, err := b.List()
-			if err != nil {
-				fatalUsage(cmd, err)
+			if len(cs) == 0 {
+				break
 			}
-			writeDir(cmd, tw, binsBase)
-			for _, bin := range bs {
-				usersMap[bin.UserID] = true
-				writeJSONFile(cmd, tw, filepath.Join(binsBase, filename(fmt.Sprintf("%d-%s", bin.ID, bin.Name))+".json"), bin)
+			for _, changeset := range cs {
+				usersMap[changeset.UserID] = true
+				ew.writeJSONFile(filepath.Join(changesetsBase, filename(fmt.Sprintf("%s", changeset.Revision))+".json"), changeset)
 			}
+		}
 
-			// project changesets
-			c := changesets.NewService(service, project.ID)
-			changesetOpts := &changesets.ListOptions{}
-			changesetsBase := filepath.Join(projectBase, "changesets")
-			writeDir(cmd, tw, changesetsBase)
-			for changesetOpts.Page = 1; ; changesetOpts.Page++ {
-				cs, err := c.List(changesetOpts)
-				if err != nil {
-					fatalUsage(cmd, err)
-				}
-				if len(cs) == 0 {
-					break
-				}
-				for _, changeset := range cs {
-					usersMap[changeset.UserID] = true
-					writeJSONFile(cmd, tw, filepath.Join(changesetsBase, filename(fmt.Sprintf("%s", changeset.Revision))+".json"), changeset)
+		// project messages
+		messagesBase := filepath.Join(projectBase, "messages")
+		mg := messages.NewService(s, project.ID)
+		mgs, err := mg.List()
+		if err != nil {
+			return nil, err
+		}
+		ew.writeDir(messagesBase)
+		for _, message := range mgs {
+			usersMap[message.UserID] = true
+			ew.writeJSONFile(filepath.Join(messagesBase, filename(fmt.Sprintf("%d-%s", message.ID, message.Permalink))+".json"), message)
+		}
+
+		// project milestones
+		milestonesBase := filepath.Join(projectBase, "milestones")
+		m := milestones.NewService(s, project.ID)
+		ms, err := m.ListAll(nil)
+		if err != nil {
+			return nil, err
+		}
+		ew.writeDir(milestonesBase)
+		// fetch milestones and their attachments
+		// concurrently then write them in order
+		fetchedMilestones, err := lighthouse.NewBatch(opts.workers).Run(context.Background(), len(ms), func(ctx context.Context, i int) (interface{}, error) {
+			return fetchMilestone(m, tickets.NewService(s, project.ID), ms[i], opts.noAttachments, opts.workers)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range fetchedMilestones {
+			em := result.(*exportedMilestone)
+			milestone := em.milestone
+			milestoneName := filename(fmt.Sprintf("%d-%s", milestone.ID, milestone.Permalink))
+			ew.writeJSONFile(filepath.Join(milestonesBase, milestoneName+".json"), milestone)
+			if opts.noAttachments || len(milestone.Attachments) == 0 {
+				continue
+			}
+			milestoneBase := filepath.Join(milestonesBase, milestoneName)
+			ew.writeDir(milestoneBase)
+			for _, attachment := range milestone.Attachments {
+				if attachment.Attachment != nil {
+					usersMap[attachment.Attachment.UploaderID] = true
 				}
 			}
+			for _, ea := range em.attachments {
+				ew.writeFile(filepath.Join(milestoneBase, ea.filename), ea.data)
+				summary.Attachments++
+			}
+		}
 
-			// project messages
-			messagesBase := filepath.Join(projectBase, "messages")
-			mg := messages.NewService(service, project.ID)
-			mgs, err := mg.List()
+		// project tickets
+		t := tickets.NewService(s, project.ID)
+		ticketOpts := &tickets.ListOptions{
+			Limit: tickets.MaxLimit,
+		}
+		ticketsBase := filepath.Join(projectBase, "tickets")
+		ew.writeDir(ticketsBase)
+		for ticketOpts.Page = 1; ; ticketOpts.Page++ {
+			ts, err := t.List(ticketOpts)
 			if err != nil {
-				fatalUsage(cmd, err)
+				return nil, err
 			}
-			writeDir(cmd, tw, messagesBase)
-			for _, message := range mgs {
-				usersMap[message.UserID] = true
-				writeJSONFile(cmd, tw, filepath.Join(messagesBase, filename(fmt.Sprintf("%d-%s", message.ID, message.Permalink))+".json"), message)
+			if len(ts) == 0 {
+				break
+			}
+			// tickets are sorted by last update, so stop
+			// once we've seen every ticket updated since
+			// opts.since
+			more := true
+			for i, ticket := range ts {
+				if opts.since != nil && ticket.UpdatedAt != nil && ticket.UpdatedAt.Before(*opts.since) {
+					ts, more = ts[:i], false
+					break
+				}
 			}
 
-			// project milestones
-			milestonesBase := filepath.Join(projectBase, "milestones")
-			m := milestones.NewService(service, project.ID)
-			ms, err := m.ListAll(nil)
+			// full ticket metadata only returned by
+			// fetching ticket directly, fetch tickets and
+			// their attachments concurrently then write
+			// them in order
+			fetched, err := lighthouse.NewBatch(opts.workers).Run(context.Background(), len(ts), func(ctx context.Context, i int) (interface{}, error) {
+				return fetchTicket(t, ts[i].Number, opts.noAttachments, opts.workers)
+			})
 			if err != nil {
-				fatalUsage(cmd, err)
-			}
-			writeDir(cmd, tw, milestonesBase)
-			for _, milestone := range ms {
-				writeJSONFile(cmd, tw, filepath.Join(milestonesBase, filename(fmt.Sprintf("%d-%s", milestone.ID, milestone.Permalink))+".json"), milestone)
+				return nil, err
 			}
 
-			// project tickets
-			t := tickets.NewService(service, project.ID)
-			ticketOpts := &tickets.ListOptions{
-				Limit: tickets.MaxLimit,
-			}
-			ticketsBase := filepath.Join(projectBase, "tickets")
-			writeDir(cmd, tw, ticketsBase)
-			for ticketOpts.Page = 1; ; ticketOpts.Page++ {
-				ts, err := t.List(ticketOpts)
-				if err != nil {
-					fatalUsage(cmd, err)
-				}
-				if len(ts) == 0 {
-					break
+			for _, result := range fetched {
+				et := result.(*exportedTicket)
+				ticket := et.ticket
+
+				usersMap[ticket.AssignedUserID] = true
+				usersMap[ticket.CreatorID] = true
+				usersMap[ticket.UserID] = true
+				for _, watcherID := range ticket.WatchersIDs {
+					usersMap[watcherID] = true
 				}
-				for _, ticket := range ts {
-					// full ticket metadata only
-					// returned by fetching ticket
-					// directly
-					ticket, err := t.GetByNumber(ticket.Number)
-					if err != nil {
-						fatalUsage(cmd, err)
+				for _, version := range ticket.Versions {
+					usersMap[version.AssignedUserID] = true
+					usersMap[version.CreatorID] = true
+					usersMap[version.UserID] = true
+					if version.DiffableAttributes != nil {
+						usersMap[version.DiffableAttributes.AssignedUser] = true
 					}
-
-					usersMap[ticket.AssignedUserID] = true
-					usersMap[ticket.CreatorID] = true
-					usersMap[ticket.UserID] = true
-					for _, watcherID := range ticket.WatchersIDs {
+					for _, watcherID := range version.WatchersIDs {
 						usersMap[watcherID] = true
 					}
-					for _, version := range ticket.Versions {
-						usersMap[version.AssignedUserID] = true
-						usersMap[version.CreatorID] = true
-						usersMap[version.UserID] = true
-						if version.DiffableAttributes != nil {
-							usersMap[version.DiffableAttributes.AssignedUser] = true
-						}
-						for _, watcherID := range version.WatchersIDs {
-							usersMap[watcherID] = true
-						}
-					}
-
-					ticketBase := filepath.Join(ticketsBase, filename(fmt.Sprintf("%d-%s", ticket.Number, ticket.Permalink)))
-					writeDir(cmd, tw, ticketBase)
-					writeJSONFile(cmd, tw, filepath.Join(ticketBase, "ticket.json"), ticket)
+				}
 
-					if flags.noAttachments {
-						continue
-					}
+				ticketBase := filepath.Join(ticketsBase, filename(fmt.Sprintf("%d-%s", ticket.Number, ticket.Permalink)))
+				ew.writeDir(ticketBase)
+				ew.writeJSONFile(filepath.Join(ticketBase, "ticket.json"), ticket)
+				summary.Tickets++
 
-					// ticket attachments (some of
-					// these might fail with a
-					// 404, don't consider this an
-					// error)
-					for _, attachment := range ticket.Attachments {
-						usersMap[attachment.Attachment.UploaderID] = true
-						rc, err := t.GetAttachment(attachment.Attachment)
-						if err != nil {
-							continue
-						}
-						buf, err := ioutil.ReadAll(rc)
-						if err != nil {
-							fatalUsage(cmd, err)
-						}
-						writeFile(cmd, tw, filepath.Join(ticketBase, attachment.Attachment.Filename), buf)
-					}
+				if opts.noAttachments {
+					continue
 				}
-			}
-		}
 
-		// account users (fetching some users or memberships
-		// may result in a 401, don't consider this an error
-		// if it fails)
-		usersBase := filepath.Join(base, "users")
-		u := users.NewService(service)
-		writeDir(cmd, tw, usersBase)
-		for id := range usersMap {
-			if id <= 0 {
-				continue
-			}
-			user, err := u.GetByID(id)
-			if err != nil {
-				continue
+				for _, attachment := range ticket.Attachments {
+					usersMap[attachment.Attachment.UploaderID] = true
+				}
+				for _, ea := range et.attachments {
+					ew.writeFile(filepath.Join(ticketBase, ea.filename), ea.data)
+					summary.Attachments++
+				}
 			}
-			userBase := filepath.Join(usersBase, filename(fmt.Sprintf("%d-%s", user.ID, user.Name)))
-			writeDir(cmd, tw, userBase)
-			writeJSONFile(cmd, tw, filepath.Join(userBase, "user.json"), user)
-
-			memberships, err := u.MembershipsByID(id)
-			if err == nil {
-				writeJSONFile(cmd, tw, filepath.Join(userBase, "memberships.json"), memberships)
-			}
-
-			if len(user.AvatarURL) == 0 {
-				continue
+			if !more {
+				break
 			}
+		}
+	}
 
-			rc, ctype, err := u.GetAvatar(user)
-			if err != nil {
-				continue
-			}
-			buf, err := ioutil.ReadAll(rc)
-			if err != nil {
-				fatalUsage(cmd, err)
-			}
-			ext := ".jpg"
-			mediatype, _, err := mime.ParseMediaType(ctype)
-			if err == nil {
-				switch mediatype {
-				case "image/bmp":
-					ext = ".bmp"
-				case "image/gif":
-					ext = ".gif"
-				case "image/jpeg":
-					ext = ".jpg"
-				case "image/png":
-					ext = ".png"
-				}
-			}
-			writeFile(cmd, tw, filepath.Join(userBase, fmt.Sprintf("avatar%s", ext)), buf)
+	// account users, fetched concurrently then written in
+	// order of ID
+	usersBase := filepath.Join(base, "users")
+	u := users.NewService(s)
+	ew.writeDir(usersBase)
+	ids := []int{}
+	for id := range usersMap {
+		if id > 0 {
+			ids = append(ids, id)
 		}
-	},
+	}
+	sort.Ints(ids)
+	fetchedUsers, err := lighthouse.NewBatch(opts.workers).Run(context.Background(), len(ids), func(ctx context.Context, i int) (interface{}, error) {
+		return fetchUser(u, ids[i])
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range fetchedUsers {
+		eu := result.(*exportedUser)
+		if eu == nil {
+			continue
+		}
+		user := eu.user
+		userBase := filepath.Join(usersBase, filename(fmt.Sprintf("%d-%s", user.ID, user.Name)))
+		ew.writeDir(userBase)
+		ew.writeJSONFile(filepath.Join(userBase, "user.json"), user)
+		summary.Users++
+
+		if eu.memberships != nil {
+			ew.writeJSONFile(filepath.Join(userBase, "memberships.json"), eu.memberships)
+		}
+		if eu.avatar != nil {
+			ew.writeFile(filepath.Join(userBase, eu.avatar.filename), eu.avatar.data)
+		}
+	}
+
+	return summary, nil
 }
 
 func filename(name string) string {
@@ -330,16 +652,35 @@ func filename(name string) string {
 	return name
 }
 
-func writeJSONFile(cmd *cobra.Command, tw *tar.Writer, filename string, v interface{}) {
-	data, err := json.MarshalIndent(v, "", "  ")
+// exportWriter writes the files of an export to a tar archive,
+// recording the first error so it need only be checked once.
+type exportWriter struct {
+	tw *tar.Writer
+	// don't print the name of each file written
+	quiet bool
+	// number of files written
+	files int
+	err   error
+}
+
+// writeJSONFile writes v in canonical form, see
+// lighthouse.MarshalCanonical, so exports of unchanged data are
+// identical.
+func (ew *exportWriter) writeJSONFile(filename string, v interface{}) {
+	data, err := lighthouse.MarshalCanonical(v, lighthouse.NullsExplicit)
 	if err != nil {
-		FatalUsage(cmd, err)
+		if ew.err == nil {
+			ew.err = err
+		}
+		return
 	}
-	data = append(data, '\n')
-	writeFile(cmd, tw, filename, data)
+	ew.writeFile(filename, data)
 }
 
-func writeDir(cmd *cobra.Command, tw *tar.Writer, dirname string) {
+func (ew *exportWriter) writeDir(dirname string) {
+	if ew.err != nil {
+		return
+	}
 	hdr := &tar.Header{
 		Typeflag: tar.TypeDir,
 		Name:     dirname,
@@ -348,14 +689,17 @@ func writeDir(cmd *cobra.Command, tw *tar.Writer, dirname string) {
 		Gid:      1000,
 		ModTime:  time.Now(),
 	}
-	err := tw.WriteHeader(hdr)
-	if err != nil {
-		FatalUsage(cmd, err)
-	}
+	ew.err = ew.tw.WriteHeader(hdr)
 }
 
-func writeFile(cmd *cobra.Command, tw *tar.Writer, filename string, data []byte) {
-	fmt.Fprintln(os.Stderr, filename)
+func (ew *exportWriter) writeFile(filename string, data []byte) {
+	if ew.err != nil {
+		return
+	}
+	if !ew.quiet {
+		fmt.Fprintln(os.Stderr, filename)
+	}
+	ew.files++
 	hdr := &tar.Header{
 		Typeflag: tar.TypeReg,
 		Name:     filename,
@@ -365,18 +709,17 @@ func writeFile(cmd *cobra.Command, tw *tar.Writer, filename string, data []byte)
 		Gid:      1000,
 		ModTime:  time.Now(),
 	}
-	err := tw.WriteHeader(hdr)
-	if err != nil {
-		FatalUsage(cmd, err)
-	}
-	_, err = io.Copy(tw, bytes.NewReader(data))
-	if err != nil {
-		FatalUsage(cmd, err)
+	ew.err = ew.tw.WriteHeader(hdr)
+	if ew.err != nil {
+		return
 	}
+	_, ew.err = io.Copy(ew.tw, bytes.NewReader(data))
 }
 
 func init() {
 	RootCmd.AddCommand(exportCmd)
 	exportCmd.Flags().BoolVar(&exportCmdFlags.noAttachments, "no-attachments", false, "Don't include attachments in export")
 	exportCmd.Flags().StringSliceVar(&exportCmdFlags.only, "only", nil, "Only export data for the given comma-separated Lighthouse projects")
+	exportCmd.Flags().IntVar(&exportCmdFlags.workers, "workers", lighthouse.DefaultPoolWorkers, "Number of tickets, milestones and users to fetch at once")
+	exportCmd.Flags().IntVar(&exportCmdFlags.parallel, "parallel", lighthouse.DefaultPoolWorkers, "Number of accounts to export at once with --account=all or several accounts")
 }
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+type exportTicketCmdOpts struct {
+	file string
+}
+
+var exportTicketCmdFlags exportTicketCmdOpts
+
+// exportTicketCmd represents the export ticket command
+var exportTicketCmd = &cobra.Command{
+	Use:   "ticket [number]",
+	Short: "Export a ticket and its attachments as a bundle (requires -p)",
+	Long: `Export a ticket and its attachments as a bundle (requires -p)
+
+The ticket, its versions and its attachments are written to a gzipped
+tarball, by default ticket-NUMBER.tar.gz in the current directory, for
+sharing a complete reproduction case with someone outside the
+tracker.  Use --file - to write the bundle to standard out.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := exportTicketCmdFlags
+		if len(args) == 0 {
+			FatalUsage(cmd, "Please specify ticket number")
+		}
+		projectID := Project()
+		number, err := tickets.Number(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		file := flags.file
+		if len(file) == 0 {
+			file = fmt.Sprintf("ticket-%d.tar.gz", number)
+		}
+		var w io.Writer = os.Stdout
+		if file != "-" {
+			f, err := os.Create(file)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		err = tickets.NewService(service, projectID).ExportBundle(number, w)
+		if err != nil {
+			if file != "-" {
+				os.Remove(file)
+			}
+			FatalUsage(cmd, err)
+		}
+		if file != "-" {
+			fmt.Fprintln(os.Stderr, file)
+		}
+	},
+}
+
+func init() {
+	exportCmd.AddCommand(exportTicketCmd)
+	exportTicketCmd.Flags().StringVar(&exportTicketCmdFlags.file, "file", "", "Write bundle to this file instead of ticket-NUMBER.tar.gz ('-' for standard out)")
+}
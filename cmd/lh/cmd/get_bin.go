@@ -19,7 +19,7 @@ var binCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(bin)
+		Output(bin)
 	},
 }
 
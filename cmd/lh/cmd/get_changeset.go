@@ -20,7 +20,8 @@ var changesetCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(changeset)
+		changeset.RevisionURL = changesets.RevisionURL(RevisionURLTemplate(projectID), changeset.Revision)
+		Output(changeset)
 	},
 }
 
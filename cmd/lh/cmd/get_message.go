@@ -19,7 +19,7 @@ var messageCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(msg)
+		Output(msg)
 	},
 }
 
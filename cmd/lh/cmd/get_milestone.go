@@ -19,7 +19,7 @@ var milestoneCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(milestone)
+		Output(milestone)
 	},
 }
 
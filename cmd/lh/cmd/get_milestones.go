@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/spf13/cobra"
+)
+
+// getMilestonesCmd represents the get milestones command
+var getMilestonesCmd = &cobra.Command{
+	Use:   "milestones",
+	Short: "Get all milestones (requires -p)",
+	Long: `Get all milestones (requires -p)
+
+Equivalent to 'lh list milestones --all'.  Use --output ics for an
+iCalendar feed of milestone due dates or --output csv for
+spreadsheets.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectID := Project()
+		m := milestones.NewService(service, projectID)
+		ms, err := m.ListAll(nil)
+		if errors.Is(err, lighthouse.ErrMaxRequestsExceeded) && len(ms) > 0 {
+			OutputPartial(ms, err)
+		}
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		Output(ms)
+	},
+}
+
+func init() {
+	getCmd.AddCommand(getMilestonesCmd)
+}
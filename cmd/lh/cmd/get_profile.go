@@ -15,7 +15,7 @@ var profileCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(u)
+		Output(u)
 	},
 }
 
@@ -26,13 +26,13 @@ var projectCmd = &cobra.Command{
 			if err != nil {
 				FatalUsage(cmd, err)
 			}
-			JSON(ms)
+			Output(ms)
 		} else {
 			project, err := p.Get(args[0])
 			if err != nil {
 				FatalUsage(cmd, err)
 			}
-			JSON(project)
+			Output(project)
 		}
 	},
 }
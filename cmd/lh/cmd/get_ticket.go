@@ -37,7 +37,7 @@ var ticketCmd = &cobra.Command{
 			FatalUsage(cmd, err)
 		}
 		if len(flags.attachment) == 0 {
-			JSON(ticket)
+			Output(ticket)
 		} else {
 			var attachment *tickets.Attachment
 			for _, a := range ticket.Attachments {
@@ -30,7 +30,7 @@ var userCmd = &cobra.Command{
 			if err != nil {
 				FatalUsage(cmd, err)
 			}
-			JSON(memberships)
+			Output(memberships)
 		} else if flags.avatar {
 			user, err := u.Get(args[0])
 			if err != nil {
@@ -50,7 +50,7 @@ var userCmd = &cobra.Command{
 			if err != nil {
 				FatalUsage(cmd, err)
 			}
-			JSON(user)
+			Output(user)
 		}
 	},
 }
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+// TicketVersionSummary is a ticket version as listed by lh get
+// versions.
+type TicketVersionSummary struct {
+	Version   int              `json:"version"`
+	UserName  string           `json:"user_name"`
+	CreatedAt *lighthouse.Time `json:"created_at"`
+	// Summary describes Changes compactly, i.e., 'state: new →
+	// resolved; commented'.
+	Summary string            `json:"summary"`
+	Changes []*tickets.Change `json:"changes"`
+}
+
+// getVersionsCmd represents the get versions command
+var getVersionsCmd = &cobra.Command{
+	Use:   "versions [number]",
+	Short: "Get the version history of a ticket (requires -p)",
+	Long: `Get the version history of a ticket (requires -p)
+
+Lists each version of the ticket with its author, time and a summary
+of the title, state, assigned user, milestone and tag changes it
+made.  Use --output table for a compact listing, the default JSON
+output includes each change's old and new values.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectID := Project()
+		t := tickets.NewService(service, projectID)
+		if len(args) == 0 {
+			FatalUsage(cmd, "must supply ticket number")
+		}
+		ticket, err := t.Get(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		names := &versionNames{projectID: projectID}
+		summaries := []*TicketVersionSummary{}
+		for i, vc := range ticket.Versions.Changelog() {
+			commented := len(strings.TrimSpace(ticket.Versions[i].Body)) > 0
+			summaries = append(summaries, &TicketVersionSummary{
+				Version:   vc.Version,
+				UserName:  vc.UserName,
+				CreatedAt: vc.CreatedAt,
+				Summary:   names.summarize(vc.Changes, commented),
+				Changes:   vc.Changes,
+			})
+		}
+		if len(summaries) > 0 {
+			summaries[0].Summary = "opened"
+		}
+		Output(summaries)
+	},
+}
+
+// versionNames looks up the names of the users and milestones
+// referred to by version changes, fetching them only when needed.
+type versionNames struct {
+	projectID  int
+	users      map[int]string
+	milestones map[int]string
+}
+
+func (vn *versionNames) user(id int) string {
+	if id == 0 {
+		return "nobody"
+	}
+	if vn.users == nil {
+		vn.users = map[int]string{}
+		ms, err := projects.NewService(service).MembershipsByID(vn.projectID)
+		if err == nil {
+			for _, m := range ms {
+				if m.User != nil {
+					vn.users[m.UserID] = m.User.Name
+				}
+			}
+		}
+	}
+	if name, ok := vn.users[id]; ok {
+		return name
+	}
+	return strconv.Itoa(id)
+}
+
+func (vn *versionNames) milestone(id int) string {
+	if id == 0 {
+		return "none"
+	}
+	if vn.milestones == nil {
+		vn.milestones = map[int]string{}
+		ms, err := milestones.NewService(service, vn.projectID).ListAll(nil)
+		if err == nil {
+			for _, m := range ms {
+				vn.milestones[m.ID] = m.Title
+			}
+		}
+	}
+	if title, ok := vn.milestones[id]; ok {
+		return title
+	}
+	return strconv.Itoa(id)
+}
+
+// summarize describes changes, and whether the version has a comment,
+// on a single line.
+func (vn *versionNames) summarize(changes []*tickets.Change, commented bool) string {
+	parts := []string{}
+	for _, c := range changes {
+		switch c.Attribute {
+		case tickets.AttributeTitle:
+			parts = append(parts, fmt.Sprintf("title: %q → %q", c.From, c.To))
+		case tickets.AttributeState:
+			parts = append(parts, fmt.Sprintf("state: %s → %s", c.From, c.To))
+		case tickets.AttributeAssignedUser:
+			parts = append(parts, fmt.Sprintf("assigned: %s → %s", vn.user(c.FromID), vn.user(c.ToID)))
+		case tickets.AttributeMilestone:
+			parts = append(parts, fmt.Sprintf("milestone: %s → %s", vn.milestone(c.FromID), vn.milestone(c.ToID)))
+		case tickets.AttributeTag:
+			parts = append(parts, fmt.Sprintf("tags: %s → %s", c.From, c.To))
+		}
+	}
+	if commented {
+		parts = append(parts, "commented")
+	}
+	return strings.Join(parts, "; ")
+}
+
+func init() {
+	getCmd.AddCommand(getVersionsCmd)
+}
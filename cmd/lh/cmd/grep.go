@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+type grepCmdOpts struct {
+	in         []string
+	regex      bool
+	ignoreCase bool
+	query      string
+}
+
+var grepCmdFlags grepCmdOpts
+
+// Parts of a ticket searched by grep.
+const (
+	grepTitles   = "titles"
+	grepBodies   = "bodies"
+	grepComments = "comments"
+)
+
+// GrepMatch is a line of a ticket matching the pattern given to
+// grep.
+type GrepMatch struct {
+	ProjectID   int    `json:"project_id"`
+	ProjectName string `json:"project_name"`
+	Number      int    `json:"number"`
+	Title       string `json:"title"`
+	// In is 'title', 'body' or 'comment'.
+	In string `json:"in"`
+	// Version is the ticket version of a matching comment.
+	Version int `json:"version,omitempty"`
+	// Line is the line number within the title, body or comment.
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// String formats m as a line of grep output, i.e., '#42 comment
+// 3:5: panic: runtime error'.
+func (m *GrepMatch) String() string {
+	in := m.In
+	if m.Version > 0 {
+		in += " " + strconv.Itoa(m.Version)
+	}
+	return fmt.Sprintf("#%d %s:%d: %s", m.Number, in, m.Line, m.Text)
+}
+
+// grepCmd represents the grep command
+var grepCmd = &cobra.Command{
+	Use:   "grep [pattern]",
+	Short: "Find lines of tickets matching a pattern (requires -p or --workspace)",
+	Long: `Find lines of tickets matching a pattern (requires -p or --workspace)
+
+Prints each line of the titles, bodies and comments of tickets
+containing PATTERN, prefixed by the ticket number, where it was
+found and its line number, i.e., to find which ticket discussed a
+stack trace:
+
+  #42 comment 3:5: panic: runtime error: invalid memory address
+
+PATTERN is matched literally unless --regex is given, in which case it
+is a Go regular expression.  Use --in to choose what is searched and
+--query to only search the tickets matching a search query.  Tickets
+are searched a page at a time and matches are printed as they are
+found.  Searching comments requires fetching each ticket, use --in to
+skip them for a faster search.
+
+With --workspace, the tickets of each of the workspace's projects are
+searched and each match is prefixed by its project's name, i.e.,
+'Widgets: #42 comment 3:5: ...'.  With --offline, the tickets of an
+export are searched instead.  With --output, the matches are
+collected and written in the given format.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := grepCmdFlags
+		if len(args) != 1 || len(args[0]) == 0 {
+			FatalUsage(cmd, "must supply pattern")
+		}
+		expr := args[0]
+		if !flags.regex {
+			expr = regexp.QuoteMeta(expr)
+		}
+		if flags.ignoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		in := map[string]bool{}
+		for _, s := range flags.in {
+			switch s {
+			case grepTitles, grepBodies, grepComments:
+				in[s] = true
+			default:
+				FatalUsage(cmd, fmt.Sprintf("invalid --in %q, expected %s, %s or %s", s, grepTitles, grepBodies, grepComments))
+			}
+		}
+
+		projectIDs, err := Projects()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		collect := cmd.Flags().Changed("output")
+		matches := []*GrepMatch{}
+		for _, projectID := range projectIDs {
+			prefix, projectName := "", ""
+			if len(projectIDs) > 1 || collect {
+				p, err := projects.NewService(service).GetByID(projectID)
+				if err != nil {
+					FatalUsage(cmd, err)
+				}
+				prefix, projectName = p.Name+": ", p.Name
+			}
+			t := tickets.NewService(service, projectID)
+			opts := &tickets.ListOptions{
+				Query: flags.query,
+				Limit: tickets.MaxLimit,
+			}
+			err := t.Pages(opts, func(ts tickets.Tickets) {
+				for _, tkt := range ts {
+					if in[grepComments] && len(tkt.Versions) == 0 {
+						full, err := t.GetByNumber(tkt.Number)
+						if err != nil {
+							FatalUsage(cmd, err)
+						}
+						tkt = full
+					}
+					for _, m := range grepTicket(re, tkt, in) {
+						m.ProjectID, m.ProjectName = projectID, projectName
+						if collect {
+							matches = append(matches, m)
+							continue
+						}
+						fmt.Fprintln(os.Stdout, prefix+m.String())
+					}
+				}
+			}).All()
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+		}
+		if collect {
+			Output(matches)
+		}
+	},
+}
+
+// grepTicket returns the lines of t's title, body and comments
+// matching re, limited to the parts of the ticket in in.
+func grepTicket(re *regexp.Regexp, t *tickets.Ticket, in map[string]bool) []*GrepMatch {
+	matches := []*GrepMatch{}
+	grep := func(where string, version int, text string) {
+		lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+		for i, line := range lines {
+			if re.MatchString(line) {
+				matches = append(matches, &GrepMatch{
+					Number:  t.Number,
+					Title:   t.Title,
+					In:      where,
+					Version: version,
+					Line:    i + 1,
+					Text:    line,
+				})
+			}
+		}
+	}
+	if in[grepTitles] {
+		grep("title", 0, t.Title)
+	}
+	if in[grepBodies] {
+		body := t.OriginalBody
+		if len(t.Versions) > 0 {
+			body = t.Versions[0].Body
+		} else if len(body) == 0 {
+			body = t.Body
+		}
+		grep("body", 0, body)
+	}
+	if in[grepComments] {
+		for i, v := range t.Versions {
+			if i > 0 {
+				grep("comment", v.Version, v.Body)
+			}
+		}
+	}
+	return matches
+}
+
+func init() {
+	RootCmd.AddCommand(grepCmd)
+	grepCmd.Flags().StringSliceVar(&grepCmdFlags.in, "in", []string{grepTitles, grepBodies, grepComments}, "Comma-separated parts of tickets to search ("+grepTitles+", "+grepBodies+", "+grepComments+")")
+	grepCmd.Flags().BoolVar(&grepCmdFlags.regex, "regex", false, "Treat pattern as a Go regular expression")
+	grepCmd.Flags().BoolVarP(&grepCmdFlags.ignoreCase, "ignore-case", "i", false, "Ignore case when matching")
+	grepCmd.Flags().StringVar(&grepCmdFlags.query, "query", "", "Only search tickets matching this search query, see http://help.lighthouseapp.com/faqs/getting-started/how-do-i-search-for-tickets")
+}
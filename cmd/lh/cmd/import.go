@@ -0,0 +1,13 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import Lighthouse resources",
+}
+
+func init() {
+	RootCmd.AddCommand(importCmd)
+}
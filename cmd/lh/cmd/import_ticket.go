@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type importTicketCmdOpts struct {
+	milestone   string
+	sameAccount bool
+	noNotify    bool
+}
+
+var importTicketCmdFlags importTicketCmdOpts
+
+// importTicketCmd represents the import ticket command
+var importTicketCmd = &cobra.Command{
+	Use:   "ticket [bundle.tar.gz]",
+	Short: "Create a ticket from a bundle written by 'lh export ticket' (requires -p)",
+	Long: `Create a ticket from a bundle written by 'lh export ticket' (requires -p)
+
+The new ticket gets the next ticket number in the project.  Its body
+includes the comments of the original ticket, and the bundle's
+attachments are added to it.
+
+Users in the bundle are mapped to users in this account using the
+config file's 'import-users' map, keyed by the original user's ID or
+name, whose values are user IDs or names in this account.  Use
+--same-account if the bundle came from this account.  The assigned
+user and watchers are dropped unless they are mapped.
+
+The ticket is added to --milestone, or to a milestone with the same
+title as the original ticket's milestone if the project has one.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := importTicketCmdFlags
+		if len(args) == 0 {
+			FatalUsage(cmd, "Please specify ticket bundle")
+		}
+		projectID := Project()
+		f, err := os.Open(args[0])
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		b, err := tickets.ReadBundle(f)
+		f.Close()
+		if err != nil {
+			FatalUsage(cmd, fmt.Errorf("%s: %v", args[0], err))
+		}
+
+		opts := &tickets.ImportOptions{}
+		opts.Users, err = importUsers(b, flags.sameAccount)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		if len(flags.milestone) > 0 {
+			opts.MilestoneID, err = MilestoneID(flags.milestone)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+		} else if len(b.Ticket.MilestoneTitle) > 0 {
+			m, err := milestones.NewService(service, projectID).GetByTitle(b.Ticket.MilestoneTitle)
+			if err == nil {
+				opts.MilestoneID = m.ID
+			}
+		}
+		if flags.noNotify {
+			notifyAll := false
+			opts.NotifyAll = &notifyAll
+		}
+
+		t, err := tickets.NewService(service, projectID).ImportBundle(b, opts)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		Output(t)
+	},
+}
+
+// importUsers returns the mapping of user IDs in b to user IDs in
+// this account given by the config file's 'import-users' map, or the
+// identity mapping if sameAccount is set.
+func importUsers(b *tickets.Bundle, sameAccount bool) (map[int]int, error) {
+	names := map[int]string{}
+	addName := func(id int, name string) {
+		if id != 0 && len(name) > 0 {
+			names[id] = name
+		}
+	}
+	addName(b.Ticket.AssignedUserID, b.Ticket.AssignedUserName)
+	addName(b.Ticket.CreatorID, b.Ticket.CreatorName)
+	addName(b.Ticket.UserID, b.Ticket.UserName)
+	for _, v := range b.Versions {
+		addName(v.CreatorID, v.CreatorName)
+		addName(v.UserID, v.UserName)
+	}
+
+	users := map[int]int{}
+	if sameAccount {
+		for _, id := range append([]int{b.Ticket.AssignedUserID}, b.Ticket.WatchersIDs...) {
+			if id != 0 {
+				users[id] = id
+			}
+		}
+		return users, nil
+	}
+
+	for from, to := range viper.GetStringMapString("import-users") {
+		fromID, err := lighthouse.ID(from)
+		if err != nil {
+			fromID = 0
+			for id, name := range names {
+				if strings.EqualFold(name, from) {
+					fromID = id
+					break
+				}
+			}
+			if fromID == 0 {
+				// user doesn't appear in this bundle
+				continue
+			}
+		}
+		toID, err := UserID(to)
+		if err != nil {
+			return nil, fmt.Errorf("import-users: %q: %v", to, err)
+		}
+		users[fromID] = toID
+	}
+	return users, nil
+}
+
+func init() {
+	importCmd.AddCommand(importTicketCmd)
+	importTicketCmd.Flags().StringVar(&importTicketCmdFlags.milestone, "milestone", "", "Milestone ID or title of the new ticket")
+	importTicketCmd.Flags().BoolVar(&importTicketCmdFlags.sameAccount, "same-account", false, "Keep the original users, the bundle came from this account")
+	importTicketCmd.Flags().BoolVar(&importTicketCmdFlags.noNotify, "no-notify", false, "Don't notify project members of the new ticket")
+}
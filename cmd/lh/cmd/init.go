@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tokens"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// maxTokenAttempts is the number of times lh init asks for a token
+// which fails to validate before giving up.
+const maxTokenAttempts = 3
+
+// initCmd represents the init command
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Interactively create a config file",
+	Long: `Interactively create a config file
+
+Prompts for your Lighthouse account name, API token, default project
+and rate limits, validates the token against the Lighthouse API and
+writes the results to the config file (default is $HOME/.lh.yaml).
+The token may optionally be stored in the system keyring rather than
+in the config file.
+
+`,
+	// don't require account/token to already be configured
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		p := &prompter{
+			r: bufio.NewReader(os.Stdin),
+			w: os.Stdout,
+		}
+
+		path := cfgFile
+		if len(path) == 0 {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			path = filepath.Join(home, ".lh.yaml")
+		}
+		if _, err := os.Stat(path); err == nil {
+			if !p.confirm(fmt.Sprintf("Config file %s already exists, overwrite?", path), false) {
+				return
+			}
+		}
+
+		config := yaml.MapSlice{}
+
+		account := p.ask("Lighthouse account name", viper.GetString("account"))
+		if len(account) == 0 {
+			FatalUsage(cmd, "must supply account name")
+		}
+		config = append(config, yaml.MapItem{Key: "account", Value: account})
+
+		var s *lighthouse.Service
+		token := viper.GetString("token")
+		for attempt := 1; ; {
+			token = p.ask("Lighthouse API token", token)
+			if len(token) == 0 {
+				continue
+			}
+			s = lighthouse.NewService(account, &http.Client{
+				Transport: &lighthouse.Transport{
+					Token:              token,
+					TokenAsBasicAuth:   true,
+					RateLimitInterval:  lighthouse.DefaultRateLimitInterval,
+					RateLimitBurstSize: lighthouse.DefaultRateLimitBurstSize,
+				},
+			})
+			t, err := tokens.NewService(s).Get(token)
+			if err != nil {
+				fmt.Fprintln(p.w, "Unable to validate token:", err)
+				// a wrong account name makes every token
+				// invalid, so give up rather than asking
+				// forever
+				if attempt == maxTokenAttempts {
+					FatalUsage(cmd, fmt.Errorf("unable to validate token after %d attempts, check that account name %q is correct", attempt, account))
+				}
+				attempt++
+				token = ""
+				continue
+			}
+			if t.ReadOnly {
+				fmt.Fprintln(p.w, "Token is read-only, create/update/delete commands will fail")
+			}
+			break
+		}
+
+		if p.confirm("Store token in system keyring instead of config file?", false) {
+			err := keyringSet(account, token)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			config = append(config, yaml.MapItem{Key: "keyring", Value: true})
+		} else {
+			config = append(config, yaml.MapItem{Key: "token", Value: token})
+		}
+
+		ps, err := projects.NewService(s).List()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		if len(ps) > 0 {
+			fmt.Fprintln(p.w, "Projects:")
+			for _, project := range ps {
+				fmt.Fprintf(p.w, "  %d\t%s\n", project.ID, project.Name)
+			}
+		}
+		for {
+			projectStr := p.ask("Default project ID or name (optional)", viper.GetString("project"))
+			if len(projectStr) == 0 {
+				break
+			}
+			project, err := projects.NewService(s).Get(projectStr)
+			if err != nil {
+				fmt.Fprintln(p.w, err)
+				continue
+			}
+			config = append(config, yaml.MapItem{Key: "project", Value: project.Name})
+			break
+		}
+
+		for {
+			intervalStr := p.ask("Rate limit interval (use 0 to disable rate limiting)", lighthouse.DefaultRateLimitInterval.String())
+			interval, err := time.ParseDuration(intervalStr)
+			if err != nil {
+				fmt.Fprintln(p.w, err)
+				continue
+			}
+			if interval != lighthouse.DefaultRateLimitInterval {
+				config = append(config, yaml.MapItem{Key: "rate-limit-interval", Value: interval.String()})
+			}
+			break
+		}
+
+		for {
+			burstStr := p.ask("Rate limit burst size", strconv.Itoa(lighthouse.DefaultRateLimitBurstSize))
+			burst, err := strconv.Atoi(burstStr)
+			if err != nil || burst < 1 {
+				fmt.Fprintf(p.w, "invalid burst size %q\n", burstStr)
+				continue
+			}
+			if burst != lighthouse.DefaultRateLimitBurstSize {
+				config = append(config, yaml.MapItem{Key: "rate-limit-burst-size", Value: burst})
+			}
+			break
+		}
+
+		buf, err := yaml.Marshal(config)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = ioutil.WriteFile(path, buf, 0600)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		fmt.Fprintln(p.w, "Wrote config file", path)
+	},
+}
+
+type prompter struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// ask prompts for a value, returning def if the answer is empty.
+func (p *prompter) ask(question, def string) string {
+	if len(def) > 0 {
+		fmt.Fprintf(p.w, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.w, "%s: ", question)
+	}
+	line, err := p.r.ReadString('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		fmt.Fprintln(p.w)
+		os.Exit(1)
+	}
+	line = strings.TrimSpace(line)
+	if len(line) == 0 {
+		return def
+	}
+	return line
+}
+
+// confirm prompts for a yes/no answer, returning def if the answer
+// is empty.
+func (p *prompter) confirm(question string, def bool) bool {
+	choices := "y/N"
+	if def {
+		choices = "Y/n"
+	}
+	for {
+		answer := strings.ToLower(p.ask(fmt.Sprintf("%s (%s)", question, choices), ""))
+		switch answer {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(initCmd)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// keyringService is the service name under which lh stores API
+// tokens in the system keyring.
+const keyringService = "lh"
+
+// keyringSet stores token for account in the system keyring.  On
+// macOS the login keychain is used via security(1), on other Unix
+// systems the Secret Service is used via secret-tool(1).  The token
+// is passed on standard input so it does not appear in the process
+// list.
+func keyringSet(account, token string) error {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		// security -i reads commands from standard input
+		c = exec.Command("security", "-i")
+		c.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+			securityQuote(keyringService), securityQuote(account), securityQuote(token)))
+	case "windows":
+		return fmt.Errorf("keyring not supported on %s", runtime.GOOS)
+	default:
+		c = exec.Command("secret-tool", "store",
+			"--label", fmt.Sprintf("Lighthouse API token (%s)", account),
+			"service", keyringService, "account", account)
+		c.Stdin = strings.NewReader(token)
+	}
+	stderr := &bytes.Buffer{}
+	c.Stderr = stderr
+	err := c.Run()
+	if err == nil && runtime.GOOS == "darwin" && stderr.Len() > 0 {
+		// security -i reports failed commands on standard
+		// error but still exits successfully
+		err = fmt.Errorf("security failed")
+	}
+	if err != nil {
+		return fmt.Errorf("unable to store token in keyring: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// keyringGet retrieves the token for account from the system
+// keyring.
+func keyringGet(account string) (string, error) {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.Command("security", "find-generic-password",
+			"-s", keyringService, "-a", account, "-w")
+	case "windows":
+		return "", fmt.Errorf("keyring not supported on %s", runtime.GOOS)
+	default:
+		c = exec.Command("secret-tool", "lookup",
+			"service", keyringService, "account", account)
+	}
+	stderr := &bytes.Buffer{}
+	c.Stderr = stderr
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("unable to read token from keyring: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	token := strings.TrimSpace(string(out))
+	if len(token) == 0 {
+		return "", fmt.Errorf("no token for account %q in keyring", account)
+	}
+	return token, nil
+}
+
+// securityQuote quotes s as an argument of a security(1) interactive
+// mode command.
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -1,13 +1,90 @@
 package cmd
 
-import "github.com/spf13/cobra"
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/messages"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+type listCmdOpts struct {
+	idsOnly bool
+}
+
+var listCmdFlags listCmdOpts
 
 // listCmd represents the list command
 var listCmd = &cobra.Command{
-	Use:   "list",
-	Short: "List Lighthouse resources",
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List Lighthouse resources",
+	Long: `List Lighthouse resources
+
+With --ids-only, each resource is written on its own line as its ID
+and name separated by a tab, suitable for shell scripts and
+completion caches.  --ids-only ignores --output and --columns.
+`,
+}
+
+// idNames returns the ID and name of each resource in v, which must
+// be a list of resources, for use with --ids-only.  It returns false
+// if v is not a supported list.
+func idNames(v interface{}) ([][2]string, bool) {
+	var rows [][2]string
+	switch v := v.(type) {
+	case projects.Projects:
+		for _, p := range v {
+			rows = append(rows, [2]string{strconv.Itoa(p.ID), p.Name})
+		}
+	case milestones.Milestones:
+		for _, m := range v {
+			rows = append(rows, [2]string{strconv.Itoa(m.ID), m.Title})
+		}
+	case tickets.Tickets:
+		for _, t := range v {
+			rows = append(rows, [2]string{strconv.Itoa(t.Number), t.Title})
+		}
+	case bins.Bins:
+		for _, b := range v {
+			rows = append(rows, [2]string{strconv.Itoa(b.ID), b.Name})
+		}
+	case messages.Messages:
+		for _, m := range v {
+			rows = append(rows, [2]string{strconv.Itoa(m.ID), m.Title})
+		}
+	case changesets.Changesets:
+		for _, c := range v {
+			rows = append(rows, [2]string{c.Revision, c.Title})
+		}
+	default:
+		return nil, false
+	}
+	return rows, true
+}
+
+// writeIDNames writes rows to w as tab-separated lines.  Tabs and
+// newlines in names are replaced with spaces so each resource is
+// always a single line.
+func writeIDNames(w io.Writer, rows [][2]string) error {
+	r := strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+	for _, row := range rows {
+		_, err := fmt.Fprintf(w, "%s\t%s\n", row[0], r.Replace(row[1]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func init() {
 	RootCmd.AddCommand(listCmd)
+	listCmd.PersistentFlags().BoolVar(&listCmdFlags.idsOnly, "ids-only", false, "Only output the ID and name of each resource, separated by a tab")
 }
@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"errors"
+
+	"github.com/nwidger/lighthouse"
 	"github.com/nwidger/lighthouse/changesets"
 	"github.com/spf13/cobra"
 )
@@ -32,10 +35,14 @@ var changesetsCmd = &cobra.Command{
 		} else {
 			cs, err = c.List(opts)
 		}
+		cs.SetRevisionURLs(RevisionURLTemplate(projectID))
+		if errors.Is(err, lighthouse.ErrMaxRequestsExceeded) && len(cs) > 0 {
+			OutputPartial(cs, err)
+		}
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(cs)
+		Output(cs)
 	},
 }
 
@@ -16,7 +16,7 @@ var messagesCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(ms)
+		Output(ms)
 	},
 }
 
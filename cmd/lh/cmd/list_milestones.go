@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"errors"
+
+	"github.com/nwidger/lighthouse"
 	"github.com/nwidger/lighthouse/milestones"
 	"github.com/spf13/cobra"
 )
@@ -32,10 +35,13 @@ var milestonesCmd = &cobra.Command{
 		} else {
 			ms, err = m.List(opts)
 		}
+		if errors.Is(err, lighthouse.ErrMaxRequestsExceeded) && len(ms) > 0 {
+			OutputPartial(ms, err)
+		}
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(ms)
+		Output(ms)
 	},
 }
 
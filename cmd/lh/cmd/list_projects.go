@@ -15,7 +15,7 @@ var projectsCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(ps)
+		Output(ps)
 	},
 }
 
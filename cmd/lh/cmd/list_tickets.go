@@ -1,15 +1,28 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nwidger/lighthouse"
 	"github.com/nwidger/lighthouse/tickets"
 	"github.com/spf13/cobra"
 )
 
 type ticketsCmdOpts struct {
-	query string
-	limit int
-	page  int
-	all   bool
+	query       string
+	bin         string
+	refreshBins bool
+	binsCache   string
+	limit       int
+	page        int
+	all         bool
 }
 
 var ticketsCmdFlags ticketsCmdOpts
@@ -17,36 +30,118 @@ var ticketsCmdFlags ticketsCmdOpts
 // ticketsCmd represents the tickets command
 var ticketsCmd = &cobra.Command{
 	Use:   "tickets",
-	Short: "List tickets (requires -p)",
+	Short: "List tickets (requires -p or --workspace)",
+	Long: `List tickets (requires -p or --workspace)
+
+With --workspace, the tickets of each of the workspace's projects are
+listed.
+
+--bin runs the query of the named ticket bin, i.e., --bin 'My Open'.
+Bins are looked up in the project followed by global bins from other
+projects.  The bins visible to you across all projects are cached in
+the file given by --bins-cache, which is refreshed when a bin isn't
+found or --refresh-bins is given.  --query is appended to the bin's
+query.
+`,
 	Run: func(cmd *cobra.Command, args []string) {
-		var (
-			err error
-			ts  tickets.Tickets
-		)
+		var err error
 		flags := ticketsCmdFlags
-		projectID := Project()
-		t := tickets.NewService(service, projectID)
-		opts := &tickets.ListOptions{
-			Query: flags.query,
-			Limit: flags.limit,
-			Page:  flags.page,
+		ts := tickets.Tickets{}
+		projectIDs, err := Projects()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		for _, projectID := range projectIDs {
+			t := tickets.NewService(service, projectID)
+			query := flags.query
+			if len(flags.bin) > 0 {
+				preset, err := BinPreset(flags.binsCache, flags.bin, projectID, flags.refreshBins)
+				if err != nil {
+					FatalUsage(cmd, err)
+				}
+				query = strings.TrimSpace(preset.Query + " " + query)
+			}
+			opts := &tickets.ListOptions{
+				Query: query,
+				Limit: flags.limit,
+				Page:  flags.page,
+			}
+			var pts tickets.Tickets
+			if flags.all {
+				pts, err = t.ListAll(opts)
+			} else {
+				pts, err = t.List(opts)
+			}
+			ts = append(ts, pts...)
+			if err != nil {
+				break
+			}
 		}
-		if flags.all {
-			ts, err = t.ListAll(opts)
-		} else {
-			ts, err = t.List(opts)
+		if errors.Is(err, lighthouse.ErrMaxRequestsExceeded) && len(ts) > 0 {
+			OutputPartial(ts, err)
 		}
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(ts)
+		Output(ts)
 	},
 }
 
 func init() {
 	listCmd.AddCommand(ticketsCmd)
 	ticketsCmd.Flags().StringVar(&ticketsCmdFlags.query, "query", "", "Search query, see http://help.lighthouseapp.com/faqs/getting-started/how-do-i-search-for-tickets")
+	ticketsCmd.Flags().StringVar(&ticketsCmdFlags.bin, "bin", "", "Use the query of the named ticket bin")
+	ticketsCmd.Flags().BoolVar(&ticketsCmdFlags.refreshBins, "refresh-bins", false, "Refresh the cached ticket bins before using --bin")
+	home, _ := os.UserHomeDir()
+	ticketsCmd.Flags().StringVar(&ticketsCmdFlags.binsCache, "bins-cache", filepath.Join(home, ".lh-bins.json"), "File caching the ticket bins used by --bin")
 	ticketsCmd.Flags().IntVar(&ticketsCmdFlags.limit, "limit", 0, "The number of tickets per page to return")
 	ticketsCmd.Flags().IntVar(&ticketsCmdFlags.page, "page", 0, "Page to return")
 	ticketsCmd.Flags().BoolVar(&ticketsCmdFlags.all, "all", false, "Return all tickets")
 }
+
+// BinPreset returns the preset for the ticket bin name in projectID
+// using the presets cached for the current account in cachePath.  The
+// cache is refreshed if refresh is true or name isn't found.
+func BinPreset(cachePath, name string, projectID int, refresh bool) (*tickets.Preset, error) {
+	account := Account()
+	cache := map[string]*tickets.Presets{}
+	buf, err := ioutil.ReadFile(cachePath)
+	if err == nil {
+		err = json.Unmarshal(buf, &cache)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read bins cache: %v", err)
+	}
+
+	if presets, ok := cache[account]; ok && presets != nil && !refresh {
+		if p, ok := presets.Lookup(name, projectID); ok {
+			return p, nil
+		}
+	}
+
+	presets, err := tickets.SyncPresets(service)
+	if err != nil {
+		return nil, err
+	}
+	cache[account] = presets
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(cache)
+	if err == nil {
+		err = ioutil.WriteFile(cachePath, b.Bytes(), 0600)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to write bins cache: %v\n", err)
+	}
+
+	p, ok := presets.Lookup(name, projectID)
+	if !ok {
+		names := presets.Names(projectID)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no such bin %q", name)
+		}
+		return nil, fmt.Errorf("no such bin %q, expected one of: %s", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
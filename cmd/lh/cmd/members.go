@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/spf13/cobra"
+)
+
+// Member is a user's membership in a project.
+type Member struct {
+	MembershipID int    `json:"membership_id"`
+	UserID       int    `json:"user_id"`
+	Name         string `json:"name"`
+	Job          string `json:"job"`
+	Role         string `json:"role"`
+}
+
+func newMember(m *projects.Membership) *Member {
+	member := &Member{
+		MembershipID: m.ID,
+		UserID:       m.UserID,
+		Role:         m.Role,
+	}
+	if m.User != nil {
+		member.Name = m.User.Name
+		member.Job = m.User.Job
+	}
+	return member
+}
+
+// membersCmd represents the members command
+var membersCmd = &cobra.Command{
+	Use:   "members",
+	Short: "Manage project members (requires -p)",
+}
+
+// findMember returns the membership in ms of the user with the given
+// ID, full name or first name.
+func findMember(ms projects.Memberships, userStr string) (*projects.Membership, bool) {
+	id, err := lighthouse.ID(userStr)
+	if err == nil {
+		for _, m := range ms {
+			if m.UserID == id {
+				return m, true
+			}
+		}
+		return nil, false
+	}
+	lower := strings.ToLower(userStr)
+	for _, m := range ms {
+		if m.User == nil {
+			continue
+		}
+		fullName := strings.ToLower(m.User.Name)
+		firstName := fullName
+		idx := strings.Index(fullName, " ")
+		if idx != -1 {
+			firstName = fullName[:idx]
+		}
+		if fullName == lower || firstName == lower {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// addMember adds the user userStr to project projectID with the given
+// role.  If the user is already a member, their role is changed if
+// role is non-empty.
+func addMember(projectID int, userStr, role string) (*projects.Membership, error) {
+	p := projects.NewService(service)
+	ms, err := p.MembershipsByID(projectID)
+	if err != nil {
+		return nil, err
+	}
+	if m, ok := findMember(ms, userStr); ok {
+		if len(role) == 0 || m.Role == role {
+			return m, nil
+		}
+		m.Role = role
+		err = p.UpdateMembership(projectID, m)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	userID, err := UserID(userStr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find user %q: %v", userStr, err)
+	}
+	return p.AddMembership(projectID, &projects.Membership{
+		UserID: userID,
+		Role:   role,
+	})
+}
+
+func init() {
+	RootCmd.AddCommand(membersCmd)
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+type membersAddCmdOpts struct {
+	role string
+	csv  string
+}
+
+var membersAddCmdFlags membersAddCmdOpts
+
+// membersAddCmd represents the members add command
+var membersAddCmd = &cobra.Command{
+	Use:   "add [user...]",
+	Short: "Add users to a project (requires -p)",
+	Long: `Add users to a project (requires -p)
+
+Users may be given by ID, full name or first name.  Users which are
+already members of the project are left alone unless --role is given,
+in which case their role is changed.
+
+Use --csv to add the users listed in a CSV file, or '-' for standard
+in, with one user per row and an optional second column giving the
+user's role, i.e.,
+
+  user,role
+  Fred Freddington,admin
+  12345,
+
+A header row whose first column is 'user' is skipped.  Rows without a
+role use --role.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := membersAddCmdFlags
+		projectID := Project()
+
+		type row struct{ user, role string }
+		rows := []row{}
+		for _, arg := range args {
+			rows = append(rows, row{user: arg, role: flags.role})
+		}
+		if len(flags.csv) > 0 {
+			records, err := readMembersCSV(flags.csv)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			for _, record := range records {
+				r := row{user: record[0], role: flags.role}
+				if len(record) > 1 && len(record[1]) > 0 {
+					r.role = record[1]
+				}
+				rows = append(rows, r)
+			}
+		}
+		if len(rows) == 0 {
+			FatalUsage(cmd, "Please specify users to add or --csv")
+		}
+
+		members := []*Member{}
+		for _, r := range rows {
+			m, err := addMember(projectID, r.user, r.role)
+			if err != nil {
+				FatalUsage(cmd, fmt.Errorf("unable to add %q: %v", r.user, err))
+			}
+			members = append(members, newMember(m))
+		}
+		Output(members)
+	},
+}
+
+// readMembersCSV returns the non-empty records of the CSV file at
+// path, or standard in if path is '-', skipping any header row.
+func readMembersCSV(path string) ([][]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+	records := [][]string{}
+	for i := 0; ; i++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for j := range record {
+			record[j] = strings.TrimSpace(record[j])
+		}
+		if len(record[0]) == 0 {
+			continue
+		}
+		if i == 0 && strings.EqualFold(record[0], "user") {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func init() {
+	membersCmd.AddCommand(membersAddCmd)
+	membersAddCmd.Flags().StringVar(&membersAddCmdFlags.role, "role", "", "Role to assign to the users")
+	membersAddCmd.Flags().StringVar(&membersAddCmdFlags.csv, "csv", "", "Add the users listed in a CSV file ('-' for standard in)")
+}
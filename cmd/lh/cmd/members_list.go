@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/spf13/cobra"
+)
+
+// membersListCmd represents the members list command
+var membersListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List project members (requires -p)",
+	Run: func(cmd *cobra.Command, args []string) {
+		projectID := Project()
+		ms, err := projects.NewService(service).MembershipsByID(projectID)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		members := []*Member{}
+		for _, m := range ms {
+			members = append(members, newMember(m))
+		}
+		Output(members)
+	},
+}
+
+func init() {
+	membersCmd.AddCommand(membersListCmd)
+}
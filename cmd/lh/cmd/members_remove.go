@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/spf13/cobra"
+)
+
+// membersRemoveCmd represents the members remove command
+var membersRemoveCmd = &cobra.Command{
+	Use:   "remove [user...]",
+	Short: "Remove users from a project (requires -p)",
+	Long: `Remove users from a project (requires -p)
+
+Users may be given by ID, full name or first name.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			FatalUsage(cmd, "Please specify users to remove")
+		}
+		projectID := Project()
+		p := projects.NewService(service)
+		ms, err := p.MembershipsByID(projectID)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		removed := []*Member{}
+		for _, userStr := range args {
+			m, ok := findMember(ms, userStr)
+			if !ok {
+				FatalUsage(cmd, fmt.Errorf("%q is not a member of the project", userStr))
+			}
+			err = p.RemoveMembership(projectID, m.ID)
+			if err != nil {
+				FatalUsage(cmd, fmt.Errorf("unable to remove %q: %v", userStr, err))
+			}
+			removed = append(removed, newMember(m))
+		}
+		Output(removed)
+	},
+}
+
+func init() {
+	membersCmd.AddCommand(membersRemoveCmd)
+}
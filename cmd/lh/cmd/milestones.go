@@ -0,0 +1,13 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+// manageMilestonesCmd represents the milestones command
+var manageMilestonesCmd = &cobra.Command{
+	Use:   "milestones",
+	Short: "Manage milestones",
+}
+
+func init() {
+	RootCmd.AddCommand(manageMilestonesCmd)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/spf13/cobra"
+)
+
+type milestonesDedupeCmdOpts struct {
+	dryRun  bool
+	noClose bool
+}
+
+var milestonesDedupeCmdFlags milestonesDedupeCmdOpts
+
+// milestonesDedupeCmd represents the milestones dedupe command
+var milestonesDedupeCmd = &cobra.Command{
+	Use:   "dedupe",
+	Short: "Merge milestones with similar titles (requires -p)",
+	Long: `Merge milestones with similar titles (requires -p)
+
+Milestones whose titles differ only by case, whitespace, a leading
+'v' or 'version' or trailing '.0' components (i.e., 'v1.0', 'V1.0'
+and '1.0') are considered duplicates.  In each group of duplicates,
+the milestone with the most tickets is kept, the tickets of the
+others are moved to it without notifying project members and the
+others are closed.
+
+Prints each group of duplicates along with the numbers of the moved
+tickets.  Use --dry-run to see what would be merged without changing
+anything.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := milestonesDedupeCmdFlags
+		projectID := Project()
+		m := milestones.NewService(service, projectID)
+		ms, err := m.ListAll(nil)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		dups := milestones.FindDuplicates(ms)
+		for _, d := range dups {
+			err = m.Merge(d, !flags.noClose, flags.dryRun)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+		}
+		Output(dups)
+	},
+}
+
+func init() {
+	manageMilestonesCmd.AddCommand(milestonesDedupeCmd)
+	milestonesDedupeCmd.Flags().BoolVar(&milestonesDedupeCmdFlags.dryRun, "dry-run", false, "Only print the duplicates and affected tickets, don't change anything")
+	milestonesDedupeCmd.Flags().BoolVar(&milestonesDedupeCmdFlags.noClose, "no-close", false, "Don't close duplicate milestones after moving their tickets")
+}
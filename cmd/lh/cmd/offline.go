@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/export"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// offlineCommands lists the top-level commands which may be run with
+// --offline.  Only commands which never modify Lighthouse resources
+// belong here.
+var offlineCommands = map[string]bool{
+	"get":    true,
+	"grep":   true,
+	"list":   true,
+	"open":   true,
+	"search": true,
+}
+
+// offlineService sets service to answer requests from the export
+// given by --offline-export instead of the Lighthouse API.
+func offlineService(cmd *cobra.Command) {
+	top := cmd
+	for top.HasParent() && top.Parent().HasParent() {
+		top = top.Parent()
+	}
+	if !offlineCommands[top.Name()] {
+		FatalUsage(cmd, "Command '"+top.Name()+"' is not available with --offline")
+	}
+	path := viper.GetString("offline-export")
+	if len(path) == 0 {
+		FatalUsage(cmd, "Please specify export archive or directory via --offline-export, LH_OFFLINE_EXPORT or config file")
+	}
+	e, err := export.Open(path)
+	if err != nil {
+		FatalUsage(cmd, err)
+	}
+	if len(viper.GetString("account")) == 0 {
+		viper.Set("account", e.Account)
+	}
+	service = lighthouse.NewService(e.Account, &http.Client{
+		Transport: e.Transport(),
+	})
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/messages"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+type openCmdOpts struct {
+	milestone string
+	message   string
+	bin       string
+	print     bool
+}
+
+var openCmdFlags openCmdOpts
+
+// openCmd represents the open command
+var openCmd = &cobra.Command{
+	Use:   "open [ticket-number]",
+	Short: "Open a project, ticket, milestone, message or bin in a web browser (requires -p)",
+	Long: `Open a project, ticket, milestone, message or bin in a web browser (requires -p)
+
+With no arguments, the project given by -p is opened.  Given a ticket
+number, the ticket is opened.  Use --milestone, --message or --bin to
+open a milestone, message or ticket bin instead.  Use --print to print
+the URL instead of opening it.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var (
+			err error
+			u   string
+		)
+		flags := openCmdFlags
+		account := WebAccount()
+		projectID := Project()
+		switch {
+		case len(args) > 0:
+			number, err := lighthouse.ID(args[0])
+			if err != nil {
+				FatalUsage(cmd, fmt.Errorf("invalid ticket number %q", args[0]))
+			}
+			t := &tickets.Ticket{ProjectID: projectID, Number: number}
+			u = t.WebURL(account)
+		case len(flags.milestone) > 0:
+			var m *milestones.Milestone
+			m, err = milestones.NewService(service, projectID).Get(flags.milestone)
+			if err == nil {
+				m.ProjectID = projectID
+				u = m.WebURL(account)
+			}
+		case len(flags.message) > 0:
+			var m *messages.Message
+			m, err = messages.NewService(service, projectID).Get(flags.message)
+			if err == nil {
+				m.ProjectID = projectID
+				u = m.WebURL(account)
+			}
+		case len(flags.bin) > 0:
+			var b *bins.Bin
+			b, err = bins.NewService(service, projectID).Get(flags.bin)
+			if err == nil {
+				b.ProjectID = projectID
+				u = b.WebURL(account)
+			}
+		default:
+			var p *projects.Project
+			p, err = projects.NewService(service).GetByID(projectID)
+			if err == nil {
+				u = p.WebURL(account)
+			}
+		}
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		if flags.print {
+			fmt.Println(u)
+			return
+		}
+		err = openBrowser(u)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+	},
+}
+
+// openBrowser opens u in the user's web browser.
+func openBrowser(u string) error {
+	var c *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		c = exec.Command("open", u)
+	case "windows":
+		c = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		c = exec.Command("xdg-open", u)
+	}
+	stderr := &bytes.Buffer{}
+	c.Stderr = stderr
+	err := c.Run()
+	if err != nil {
+		return fmt.Errorf("unable to open browser: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(openCmd)
+	openCmd.Flags().StringVar(&openCmdFlags.milestone, "milestone", "", "Open the milestone with the given ID or title")
+	openCmd.Flags().StringVar(&openCmdFlags.message, "message", "", "Open the message with the given ID or title")
+	openCmd.Flags().StringVar(&openCmdFlags.bin, "bin", "", "Open the ticket bin with the given ID or name")
+	openCmd.Flags().BoolVar(&openCmdFlags.print, "print", false, "Print the URL instead of opening it")
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/projects"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// projectTemplate describes the configuration applied to a project
+// by 'lh create project --from-template'.
+type projectTemplate struct {
+	Name         string   `yaml:"name"`
+	Public       bool     `yaml:"public"`
+	OpenStates   []string `yaml:"open_states"`
+	ClosedStates []string `yaml:"closed_states"`
+	Bins         []struct {
+		Name    string `yaml:"name"`
+		Query   string `yaml:"query"`
+		Default bool   `yaml:"default"`
+	} `yaml:"bins"`
+	Milestones []struct {
+		Title string `yaml:"title"`
+		Goals string `yaml:"goals"`
+		Due   string `yaml:"due"`
+	} `yaml:"milestones"`
+	Members []string `yaml:"members"`
+}
+
+func readProjectTemplate(path string) (*projectTemplate, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &projectTemplate{}
+	err = yaml.UnmarshalStrict(buf, tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, m := range tmpl.Milestones {
+		if len(m.Title) == 0 {
+			return nil, fmt.Errorf("%s: milestone missing title", path)
+		}
+		if len(m.Due) > 0 {
+			_, err = time.Parse("2006-01-02", m.Due)
+			if err != nil {
+				return nil, fmt.Errorf("%s: milestone %q: %v", path, m.Title, err)
+			}
+		}
+	}
+	for _, b := range tmpl.Bins {
+		if len(b.Name) == 0 {
+			return nil, fmt.Errorf("%s: bin missing name", path)
+		}
+	}
+	for _, member := range tmpl.Members {
+		if len(member) == 0 {
+			return nil, fmt.Errorf("%s: empty member", path)
+		}
+	}
+	return tmpl, nil
+}
+
+// checkMembers ensures each of the template's members is a known
+// user, so a misspelled member is reported before the project is
+// created rather than leaving it partially configured.
+func (tmpl *projectTemplate) checkMembers() error {
+	for _, member := range tmpl.Members {
+		_, err := UserID(member)
+		if err != nil {
+			return fmt.Errorf("unable to find member %q: %v", member, err)
+		}
+	}
+	return nil
+}
+
+// apply applies the template's states, bins, milestones and members
+// to project.
+func (tmpl *projectTemplate) apply(project *projects.Project) error {
+	if len(tmpl.OpenStates) > 0 || len(tmpl.ClosedStates) > 0 {
+		p := projects.NewService(service)
+		if len(tmpl.OpenStates) > 0 {
+			project.OpenStates = strings.Join(tmpl.OpenStates, "\n")
+		}
+		if len(tmpl.ClosedStates) > 0 {
+			project.ClosedStates = strings.Join(tmpl.ClosedStates, "\n")
+		}
+		err := p.Update(project)
+		if err != nil {
+			return fmt.Errorf("unable to set states: %v", err)
+		}
+	}
+
+	b := bins.NewService(service, project.ID)
+	for _, bin := range tmpl.Bins {
+		_, err := b.Create(&bins.Bin{
+			Name:    bin.Name,
+			Query:   bin.Query,
+			Default: bin.Default,
+		})
+		if err != nil {
+			return fmt.Errorf("unable to create bin %q: %v", bin.Name, err)
+		}
+	}
+
+	m := milestones.NewService(service, project.ID)
+	for _, milestone := range tmpl.Milestones {
+		nm := &milestones.Milestone{
+			Title: milestone.Title,
+			Goals: milestone.Goals,
+		}
+		if len(milestone.Due) > 0 {
+			due, err := time.Parse("2006-01-02", milestone.Due)
+			if err != nil {
+				return err
+			}
+			nm.DueOn = lighthouse.NewTime(due)
+		}
+		_, err := m.Create(nm)
+		if err != nil {
+			return fmt.Errorf("unable to create milestone %q: %v", milestone.Title, err)
+		}
+	}
+
+	for _, member := range tmpl.Members {
+		_, err := addMember(project.ID, member, "")
+		if err != nil {
+			return fmt.Errorf("unable to add member %q: %v", member, err)
+		}
+	}
+
+	return nil
+}
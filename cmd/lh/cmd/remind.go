@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type remindCmdOpts struct {
+	dueIn  string
+	notify []string
+}
+
+var remindCmdFlags remindCmdOpts
+
+// Reminder is an open milestone which is due soon or overdue.
+type Reminder struct {
+	ProjectID        int              `json:"project_id"`
+	ProjectName      string           `json:"project_name"`
+	MilestoneID      int              `json:"milestone_id"`
+	Title            string           `json:"title"`
+	DueOn            *lighthouse.Time `json:"due_on"`
+	DaysLeft         int              `json:"days_left"`
+	Overdue          bool             `json:"overdue"`
+	OpenTicketsCount int              `json:"open_tickets_count"`
+	URL              string           `json:"url"`
+}
+
+// remindCmd represents the remind command
+var remindCmd = &cobra.Command{
+	Use:   "remind",
+	Short: "Remind about milestones which are due soon or overdue",
+	Long: `Remind about milestones which are due soon or overdue
+
+Scans the milestones of every project (or only the project given by
+-p or the projects of the workspace given by --workspace) for
+incomplete milestones due within --due-in, which may be given in
+days (7d), weeks (2w) or as a Go duration (168h), and overdue
+milestones.  The reminders are written to standard out and, if any
+are found, sent to each --notify target:
+
+  slack://hooks.slack.com/services/...  Slack incoming webhook
+  https://example.com/hook              POST {"text": "..."} as JSON
+
+The exit status is 1 if any notification fails.  Intended to be run
+periodically, i.e., from cron.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := remindCmdFlags
+		dueIn, err := parseDuration(flags.dueIn)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		for _, target := range flags.notify {
+			_, err = notifyURL(target)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+		}
+
+		var ps projects.Projects
+		if len(viper.GetString("project")) > 0 || len(viper.GetString("workspace")) > 0 {
+			projectIDs, err := Projects()
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			for _, projectID := range projectIDs {
+				p, err := projects.NewService(service).GetByID(projectID)
+				if err != nil {
+					FatalUsage(cmd, err)
+				}
+				ps = append(ps, p)
+			}
+		} else {
+			ps, err = projects.NewService(service).List()
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+		}
+
+		now := time.Now()
+		reminders := []*Reminder{}
+		for _, p := range ps {
+			if p.Archived {
+				continue
+			}
+			ms, err := milestones.NewService(service, p.ID).ListAll(nil)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			for _, m := range ms {
+				r, ok := milestoneReminder(p, m, now, dueIn)
+				if ok {
+					reminders = append(reminders, r)
+				}
+			}
+		}
+
+		// write the reminders before notifying so they are not
+		// lost if a notification fails
+		Output(reminders)
+		if len(reminders) > 0 {
+			text := reminderText(reminders)
+			failed := false
+			for _, target := range flags.notify {
+				err = notify(target, text)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					failed = true
+				}
+			}
+			if failed {
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+// milestoneReminder returns a reminder for m if it is incomplete and
+// due before now+dueIn.
+func milestoneReminder(p *projects.Project, m *milestones.Milestone, now time.Time, dueIn time.Duration) (*Reminder, bool) {
+	if m.DueOn == nil || m.DueOn.IsZero() || m.CompletedAt != nil {
+		return nil, false
+	}
+	if m.DueOn.After(now.Add(dueIn)) {
+		return nil, false
+	}
+	due := time.Date(m.DueOn.Year(), m.DueOn.Month(), m.DueOn.Day(), 0, 0, 0, 0, time.UTC)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	daysLeft := int(due.Sub(today) / (24 * time.Hour))
+	u := m.URL
+	if len(u) == 0 {
+		u = m.WebURL(WebAccount())
+	}
+	return &Reminder{
+		ProjectID:        p.ID,
+		ProjectName:      p.Name,
+		MilestoneID:      m.ID,
+		Title:            m.Title,
+		DueOn:            m.DueOn,
+		DaysLeft:         daysLeft,
+		Overdue:          daysLeft < 0,
+		OpenTicketsCount: m.OpenTicketsCount,
+		URL:              u,
+	}, true
+}
+
+func reminderText(reminders []*Reminder) string {
+	lines := []string{"Milestone reminders:"}
+	for _, r := range reminders {
+		var when string
+		switch {
+		case r.DaysLeft < -1:
+			when = fmt.Sprintf("is %d days overdue", -r.DaysLeft)
+		case r.DaysLeft == -1:
+			when = "is 1 day overdue"
+		case r.DaysLeft == 0:
+			when = "is due today"
+		case r.DaysLeft == 1:
+			when = "is due tomorrow"
+		default:
+			when = fmt.Sprintf("is due in %d days", r.DaysLeft)
+		}
+		line := fmt.Sprintf("- %s: %s %s (%s, %d open tickets)",
+			r.ProjectName, r.Title, when, r.DueOn.Format("2006-01-02"), r.OpenTicketsCount)
+		if len(r.URL) > 0 {
+			line += " " + r.URL
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// notifyURL returns the webhook URL for the --notify target.
+func notifyURL(target string) (*url.URL, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "slack":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("invalid notify target %q, must be a slack://, http:// or https:// URL", target)
+	}
+	if len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid notify target %q, must include host", target)
+	}
+	return u, nil
+}
+
+// notifyClient is used to send notifications, webhooks which don't
+// respond must not hang lh remind when run from cron.
+var notifyClient = &http.Client{Timeout: 30 * time.Second}
+
+// notify posts text to the webhook given by target as a JSON object
+// with a 'text' field, as expected by Slack incoming webhooks.
+func notify(target, text string) error {
+	u, err := notifyURL(target)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	// webhook URLs usually contain a secret, only report the host
+	resp, err := notifyClient.Post(u.String(), "application/json", bytes.NewReader(buf))
+	if err != nil {
+		if ue, ok := err.(*url.Error); ok {
+			err = ue.Err
+		}
+		return fmt.Errorf("notify %s: %v", u.Host, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notify %s: unexpected response %s", u.Host, resp.Status)
+	}
+	return nil
+}
+
+func init() {
+	RootCmd.AddCommand(remindCmd)
+	remindCmd.Flags().StringVar(&remindCmdFlags.dueIn, "due-in", "7d", "Remind about milestones due within this duration")
+	remindCmd.Flags().StringSliceVar(&remindCmdFlags.notify, "notify", nil, "Comma-separated webhook URLs to send reminders to (slack://, http:// or https://)")
+}
@@ -1,19 +1,27 @@
 package cmd
 
 import (
-	"encoding/json"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/nwidger/jsoncolor"
 	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/cmd/lh/output"
 	"github.com/nwidger/lighthouse/milestones"
 	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
 	"github.com/nwidger/lighthouse/users"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -22,8 +30,222 @@ import (
 var (
 	cfgFile string
 	service *lighthouse.Service
+
+	// accounts is set instead of service when --account=all is
+	// given, see EachAccount
+	accounts *lighthouse.Accounts
 )
 
+// AllAccounts is the account name which selects every account in the
+// config file's 'accounts' map.
+const AllAccounts = "all"
+
+// allAccountsCommands are the commands supporting --account=all and
+// comma-separated lists of accounts.
+var allAccountsCommands = map[string]bool{
+	"lh export": true,
+	"lh search": true,
+}
+
+// workspaceCommands are the commands supporting --workspace, see
+// Projects.
+var workspaceCommands = map[string]bool{
+	"lh grep":         true,
+	"lh list tickets": true,
+	"lh remind":       true,
+	"lh search":       true,
+	"lh stale":        true,
+}
+
+// newService returns a *lighthouse.Service for account authenticated
+// with token or, if token is empty, the keyring or the email and
+// password flags.  If rateLimit is set, requests are rate limited
+// according to the rate limit flags.
+func newService(cmd *cobra.Command, account, token string, rateLimit bool) *lighthouse.Service {
+	email, password, interval, burstSize := viper.GetString("email"), viper.GetString("password"),
+		viper.GetDuration("rate-limit-interval"), viper.GetInt("rate-limit-burst-size")
+	lt := &lighthouse.Transport{
+		TokenAsBasicAuth: true,
+	}
+	client := &http.Client{
+		Transport: lt,
+	}
+	if len(token) == 0 && viper.GetBool("keyring") {
+		tk, err := keyringGet(account)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		token = tk
+	}
+	if len(token) > 0 {
+		lt.Token = token
+	} else if len(email) > 0 && len(password) > 0 {
+		pw := password
+		if strings.HasPrefix(password, "@") && len(password) > 1 {
+			buf, err := ioutil.ReadFile(password[1:])
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			pw = strings.TrimSpace(string(buf))
+		}
+		lt.Email = email
+		lt.Password = pw
+	} else {
+		FatalUsage(cmd, "Please specify token or email & password")
+	}
+	if rateLimit && interval != time.Duration(0) {
+		lt.RateLimitInterval = interval
+		lt.RateLimitBurstSize = burstSize
+	}
+	if dir := viper.GetString("cache-dir"); len(dir) > 0 {
+		lt.Base = &lighthouse.DiskCache{Dir: dir}
+	}
+	opts, err := serviceOptions()
+	if err != nil {
+		FatalUsage(cmd, err)
+	}
+	var s *lighthouse.Service
+	if baseURL := viper.GetString("base-url"); len(baseURL) > 0 {
+		s, err = lighthouse.NewServiceWithBaseURL(baseURL, client, opts...)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+	} else {
+		s = lighthouse.NewService(account, client, opts...)
+	}
+	s.RateLimitRetryRequests = true
+	s.MaxRequests = viper.GetInt("max-requests")
+	s.DryRun = viper.GetBool("dry-run")
+	if failures := viper.GetInt("breaker-failures"); failures > 0 {
+		s.Breaker = &lighthouse.CircuitBreaker{
+			Failures: failures,
+			CoolDown: viper.GetDuration("breaker-cool-down"),
+			OnStateChange: func(from, to lighthouse.CircuitState, err error) {
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: circuit breaker %s: %v\n", account, to, err)
+					return
+				}
+				fmt.Fprintf(os.Stderr, "%s: circuit breaker %s\n", account, to)
+			},
+		}
+	}
+	if ttl := viper.GetDuration("cache-ttl"); ttl > 0 {
+		s.Cache = &lighthouse.ResponseCache{TTL: ttl}
+		if dir := viper.GetString("cache-dir"); len(dir) > 0 {
+			s.Cache.Dir = filepath.Join(dir, "responses")
+		}
+	}
+	return s
+}
+
+// serviceOptions returns the lighthouse.ServiceOptions given by the
+// proxy and TLS flags.
+func serviceOptions() ([]lighthouse.ServiceOption, error) {
+	opts := []lighthouse.ServiceOption{}
+	if proxy := viper.GetString("proxy"); len(proxy) > 0 {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, err
+		}
+		if len(u.Scheme) == 0 || len(u.Host) == 0 {
+			return nil, fmt.Errorf("invalid proxy URL %q, must include scheme and host", proxy)
+		}
+		opts = append(opts, lighthouse.WithProxy(u))
+	}
+	certFile, keyFile := viper.GetString("client-cert"), viper.GetString("client-key")
+	if len(certFile) > 0 || len(keyFile) > 0 {
+		if len(certFile) == 0 || len(keyFile) == 0 {
+			return nil, fmt.Errorf("--client-cert and --client-key must be used together")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, lighthouse.WithTLSConfig(&tls.Config{
+			Certificates: []tls.Certificate{cert},
+		}))
+	}
+	if files := viper.GetStringSlice("ca-cert"); len(files) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, file := range files {
+			buf, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(buf) {
+				return nil, fmt.Errorf("no PEM certificates found in %s", file)
+			}
+		}
+		opts = append(opts, lighthouse.WithRootCAs(pool))
+	}
+	return opts, nil
+}
+
+// multipleAccounts reports whether account selects several accounts,
+// i.e., it is AllAccounts or a comma-separated list of accounts.
+func multipleAccounts(account string) bool {
+	return account == AllAccounts || strings.Contains(account, ",")
+}
+
+// newAccounts returns a *lighthouse.Accounts containing the accounts
+// selected by account, either every account in the config file's
+// 'accounts' map, which maps account names to API tokens, if account
+// is AllAccounts, or the comma-separated accounts in account.
+// Accounts with an empty token are authenticated as in newService.
+// The rate limit flags apply to all accounts combined.
+func newAccounts(cmd *cobra.Command, account string) *lighthouse.Accounts {
+	if len(viper.GetString("base-url")) > 0 {
+		FatalUsage(cmd, "--base-url cannot be used with multiple accounts")
+	}
+	tokens := viper.GetStringMapString("accounts")
+	if account == AllAccounts && len(tokens) == 0 {
+		FatalUsage(cmd, "--account="+AllAccounts+" requires an 'accounts' map in the config file")
+	}
+	names := []string{}
+	if account == AllAccounts {
+		for name := range tokens {
+			names = append(names, name)
+		}
+	} else {
+		for _, name := range strings.Split(account, ",") {
+			name = strings.TrimSpace(name)
+			if len(name) == 0 || name == AllAccounts {
+				FatalUsage(cmd, "invalid account list", account)
+			}
+			names = append(names, name)
+		}
+	}
+	a := lighthouse.NewAccounts(viper.GetDuration("rate-limit-interval"), viper.GetInt("rate-limit-burst-size"))
+	for _, name := range names {
+		a.Add(name, newService(cmd, name, tokens[name], false))
+	}
+	return a
+}
+
+// EachAccount calls fn with the account given by -a or, with
+// multiple accounts, with each account in turn, see newAccounts.
+// service and Account return the current account while fn runs and
+// are restored once EachAccount returns.
+func EachAccount(fn func(account string)) {
+	if accounts == nil {
+		fn(Account())
+		return
+	}
+	prevService, prevAccount := service, viper.Get("account")
+	defer func() {
+		service = prevService
+		viper.Set("account", prevAccount)
+	}()
+	for _, name := range accounts.Names() {
+		service = accounts.Get(name)
+		viper.Set("account", name)
+		fn(name)
+	}
+}
+
 // RootCmd represents the base command when called without any subcommands
 var RootCmd = &cobra.Command{
 	Use:   "lh",
@@ -33,7 +255,10 @@ var RootCmd = &cobra.Command{
 Please specify your Lighthouse account name via -a, --account, the
 LH_ACCOUNT environment variable or the config file.  If your
 Lighthouse URL is 'https://your-account-name.lighthouseapp.com' then
-your account name is 'your-account-name'.
+your account name is 'your-account-name'.  The export and search
+commands accept --account=all to use every account in the config
+file's 'accounts' map, which maps account names to API tokens, or a
+comma-separated list of accounts to use some of them.
 
 Lighthouse requires a valid API token or email/password to
 authenticate API requests.  Please specify a Lighthouse API token via
@@ -55,48 +280,88 @@ Windows systems, the default config file is
 %USERPROFILE%\.lh.yaml if necessary.  On all systems, the default can
 be overridden with --config.
 
+Run 'lh init' to interactively create a config file.
+
+Aliases for commonly used commands may be defined in the config
+file's 'aliases' map.  For example, with the alias
+'mine: list tickets --all --query "responsible:me state:open"', running
+'lh mine' is equivalent to running the full command.
+
 `,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		account, token, email, password, interval, burstSize := viper.GetString("account"), viper.GetString("token"),
-			viper.GetString("email"), viper.GetString("password"),
-			viper.GetDuration("rate-limit-interval"), viper.GetInt("rate-limit-burst-size")
-		if len(account) == 0 {
-			FatalUsage(cmd, "Please specify Lighthouse account name via -a, --account, LH_ACCOUNT or config file")
+		// a project given by -p takes precedence over a workspace
+		// not given by --workspace
+		if cmd.Flags().Changed("project") && !cmd.Flags().Changed("workspace") {
+			viper.Set("workspace", "")
 		}
-		lt := &lighthouse.Transport{
-			TokenAsBasicAuth: true,
+		if name := viper.GetString("workspace"); len(name) > 0 && !workspaceCommands[cmd.CommandPath()] {
+			FatalUsage(cmd, fmt.Sprintf("workspace %q is not supported by", name), cmd.CommandPath()+", please specify project via -p")
 		}
-		client := &http.Client{
-			Transport: lt,
+		if viper.GetBool("offline") {
+			offlineService(cmd)
+			configureLogger()
+			return
 		}
-		if len(token) > 0 {
-			lt.Token = token
-		} else if len(email) > 0 && len(password) > 0 {
-			pw := password
-			if strings.HasPrefix(password, "@") && len(password) > 1 {
-				buf, err := ioutil.ReadFile(password[1:])
-				if err != nil {
-					FatalUsage(cmd, err)
-				}
-				pw = strings.TrimSpace(string(buf))
-			}
-			lt.Email = email
-			lt.Password = pw
-		} else {
-			FatalUsage(cmd, "Please specify token or email & password")
+		account := viper.GetString("account")
+		if len(account) == 0 {
+			FatalUsage(cmd, "Please specify Lighthouse account name via -a, --account, LH_ACCOUNT or config file")
 		}
-		if interval != time.Duration(0) {
-			lt.RateLimitInterval = interval
-			lt.RateLimitBurstSize = burstSize
+		if multipleAccounts(account) {
+			if !allAccountsCommands[cmd.CommandPath()] {
+				FatalUsage(cmd, "multiple accounts are not supported by", cmd.CommandPath())
+			}
+			accounts = newAccounts(cmd, account)
+			configureLogger()
+			return
 		}
-		service = lighthouse.NewService(account, client)
-		service.RateLimitRetryRequests = true
+		service = newService(cmd, account, viper.GetString("token"), true)
+		configureLogger()
 	},
 }
 
+// configureLogger logs API requests to standard error if --verbose
+// or --debug is given.
+func configureLogger() {
+	verbose, debug := viper.GetBool("verbose"), viper.GetBool("debug")
+	if !verbose && !debug {
+		return
+	}
+	level := slog.LevelInfo
+	if debug {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	if accounts != nil {
+		for _, name := range accounts.Names() {
+			s := accounts.Get(name)
+			s.Logger, s.LogBodies = logger, debug
+		}
+		return
+	}
+	service.Logger, service.LogBodies = logger, debug
+}
+
 // Execute adds all child commands to the root command sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	// aliases are defined in the config file, which must be read
+	// before the command-line is parsed
+	args := os.Args[1:]
+	for i, arg := range args {
+		if arg == "--config" && i+1 < len(args) {
+			cfgFile = args[i+1]
+		} else if strings.HasPrefix(arg, "--config=") {
+			cfgFile = strings.TrimPrefix(arg, "--config=")
+		}
+	}
+	initConfig()
+	expanded, err := expandAlias(args)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(-1)
+	}
+	RootCmd.SetArgs(expanded)
+
 	if err := RootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(-1)
@@ -106,34 +371,81 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 	RootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.lh.yaml)")
-	RootCmd.PersistentFlags().StringP("account", "a", "", "Lighthouse account name")
+	RootCmd.PersistentFlags().StringP("account", "a", "", "Lighthouse account name (use '"+AllAccounts+"' or a comma-separated list with export and search to use several accounts in the config file)")
 	RootCmd.PersistentFlags().StringP("token", "t", "", "Lighthouse API token")
 	RootCmd.PersistentFlags().String("email", "", "Lighthouse email (cannot be used with --token)")
 	RootCmd.PersistentFlags().String("password", "", "Lighthouse password (cannot be used with --token)")
 	RootCmd.PersistentFlags().StringP("project", "p", "", "Lighthouse project ID or name")
-	RootCmd.PersistentFlags().BoolP("monochrome", "M", false, "Monochrome (don't colorize JSON)")
+	RootCmd.PersistentFlags().String("workspace", "", "Run commands supporting it against the projects of the named workspace in the config file instead of -p")
+	RootCmd.PersistentFlags().BoolP("monochrome", "M", false, "Monochrome (don't colorize output, also set by NO_COLOR)")
+	RootCmd.PersistentFlags().Bool("no-color", false, "Alias for --monochrome")
+	RootCmd.PersistentFlags().String("pager", "", "Pager used when output is a terminal (default is $PAGER or less)")
+	RootCmd.PersistentFlags().Bool("no-pager", false, "Don't page output")
+	RootCmd.PersistentFlags().StringP("output", "o", output.FormatJSON, "Output format ("+strings.Join(output.Formats, ", ")+")")
+	RootCmd.PersistentFlags().String("template", "", "Go template used by --output template, executed once per resource")
+	RootCmd.PersistentFlags().StringSlice("columns", nil, "Comma-separated JSON field names displayed by --output table")
+	RootCmd.PersistentFlags().String("time-format", "", "Time display format (relative, rfc3339, local or a Go time layout)")
 	RootCmd.PersistentFlags().DurationP("rate-limit-interval", "r", lighthouse.DefaultRateLimitInterval, "Interval used to rate limit API requests (use 0 to disable rate limiting)")
 	RootCmd.PersistentFlags().IntP("rate-limit-burst-size", "b", lighthouse.DefaultRateLimitBurstSize, "Burst size used to rate limit API requests (must be used with --rate-limit-interval)")
+	RootCmd.PersistentFlags().String("base-url", "", "Send API requests to this URL instead of https://ACCOUNT.lighthouseapp.com")
+	RootCmd.PersistentFlags().String("proxy", "", "Send API requests through this HTTP or HTTPS proxy URL instead of $HTTPS_PROXY")
+	RootCmd.PersistentFlags().StringSlice("ca-cert", nil, "Comma-separated PEM files of certificate authorities to trust in addition to the system's")
+	RootCmd.PersistentFlags().String("client-cert", "", "PEM file of a TLS client certificate (requires --client-key)")
+	RootCmd.PersistentFlags().String("client-key", "", "PEM file of the TLS client certificate's private key (requires --client-cert)")
+	RootCmd.PersistentFlags().Int("max-requests", 0, "Maximum number of API requests a command may make (0 for no limit)")
+	RootCmd.PersistentFlags().Bool("offline", false, "Serve read commands from a local export instead of the API (requires --offline-export)")
+	RootCmd.PersistentFlags().String("offline-export", "", "Export archive or extracted export directory used by --offline")
+	RootCmd.PersistentFlags().String("cache-dir", "", "Cache API responses in this directory, revalidating them with ETag or Last-Modified (useful when re-running exports)")
+	RootCmd.PersistentFlags().Int("breaker-failures", 0, "Stop making API requests for --breaker-cool-down after this many consecutive failures (0 to disable)")
+	RootCmd.PersistentFlags().Duration("breaker-cool-down", lighthouse.DefaultBreakerCoolDown, "Time to wait before trying again once --breaker-failures is reached")
+	RootCmd.PersistentFlags().Duration("cache-ttl", 0, "Answer repeated API requests from a cache for this long, kept in --cache-dir if given (0 to disable)")
+	RootCmd.PersistentFlags().Bool("dry-run", false, "Print the POST, PUT and DELETE requests a command would make to standard error instead of sending them")
+	RootCmd.PersistentFlags().BoolP("verbose", "v", false, "Log the method, URL, status and latency of each API request to standard error")
+	RootCmd.PersistentFlags().Bool("debug", false, "Like --verbose, but also log request and response bodies")
 	viper.BindPFlag("account", RootCmd.PersistentFlags().Lookup("account"))
 	viper.BindPFlag("token", RootCmd.PersistentFlags().Lookup("token"))
 	viper.BindPFlag("email", RootCmd.PersistentFlags().Lookup("email"))
 	viper.BindPFlag("password", RootCmd.PersistentFlags().Lookup("password"))
 	viper.BindPFlag("project", RootCmd.PersistentFlags().Lookup("project"))
+	viper.BindPFlag("workspace", RootCmd.PersistentFlags().Lookup("workspace"))
 	viper.BindPFlag("monochrome", RootCmd.PersistentFlags().Lookup("monochrome"))
+	viper.BindPFlag("no-color", RootCmd.PersistentFlags().Lookup("no-color"))
+	viper.BindPFlag("pager", RootCmd.PersistentFlags().Lookup("pager"))
+	viper.BindPFlag("no-pager", RootCmd.PersistentFlags().Lookup("no-pager"))
+	viper.BindPFlag("output", RootCmd.PersistentFlags().Lookup("output"))
+	viper.BindPFlag("template", RootCmd.PersistentFlags().Lookup("template"))
+	viper.BindPFlag("columns", RootCmd.PersistentFlags().Lookup("columns"))
+	viper.BindPFlag("time-format", RootCmd.PersistentFlags().Lookup("time-format"))
 	viper.BindPFlag("rate-limit-interval", RootCmd.PersistentFlags().Lookup("rate-limit-interval"))
 	viper.BindPFlag("rate-limit-burst-size", RootCmd.PersistentFlags().Lookup("rate-limit-burst-size"))
+	viper.BindPFlag("base-url", RootCmd.PersistentFlags().Lookup("base-url"))
+	viper.BindPFlag("proxy", RootCmd.PersistentFlags().Lookup("proxy"))
+	viper.BindPFlag("ca-cert", RootCmd.PersistentFlags().Lookup("ca-cert"))
+	viper.BindPFlag("client-cert", RootCmd.PersistentFlags().Lookup("client-cert"))
+	viper.BindPFlag("client-key", RootCmd.PersistentFlags().Lookup("client-key"))
+	viper.BindPFlag("max-requests", RootCmd.PersistentFlags().Lookup("max-requests"))
+	viper.BindPFlag("offline", RootCmd.PersistentFlags().Lookup("offline"))
+	viper.BindPFlag("offline-export", RootCmd.PersistentFlags().Lookup("offline-export"))
+	viper.BindPFlag("cache-dir", RootCmd.PersistentFlags().Lookup("cache-dir"))
+	viper.BindPFlag("breaker-failures", RootCmd.PersistentFlags().Lookup("breaker-failures"))
+	viper.BindPFlag("breaker-cool-down", RootCmd.PersistentFlags().Lookup("breaker-cool-down"))
+	viper.BindPFlag("cache-ttl", RootCmd.PersistentFlags().Lookup("cache-ttl"))
+	viper.BindPFlag("dry-run", RootCmd.PersistentFlags().Lookup("dry-run"))
+	viper.BindPFlag("verbose", RootCmd.PersistentFlags().Lookup("verbose"))
+	viper.BindPFlag("debug", RootCmd.PersistentFlags().Lookup("debug"))
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
 	if cfgFile != "" { // enable ability to specify config file via flag
 		viper.SetConfigFile(cfgFile)
+	} else {
+		viper.SetConfigName(".lh")   // name of config file (without extension)
+		viper.AddConfigPath("$HOME") // adding home directory as first search path
 	}
 
-	viper.SetConfigName(".lh")   // name of config file (without extension)
-	viper.AddConfigPath("$HOME") // adding home directory as first search path
-	viper.SetEnvPrefix("lh")     // will be uppercased automatically
-	viper.AutomaticEnv()         // read in environment variables that match
+	viper.SetEnvPrefix("lh") // will be uppercased automatically
+	viper.AutomaticEnv()     // read in environment variables that match
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
@@ -141,16 +453,75 @@ func initConfig() {
 	}
 }
 
-func JSON(v interface{}) {
-	marshalIndent := jsoncolor.MarshalIndent
-	if viper.GetBool("monochrome") {
-		marshalIndent = json.MarshalIndent
+// Output writes v to standard out using the format selected by
+// --output.  If standard out is a terminal, output is paged using
+// the pager selected by --pager.
+func Output(v interface{}) {
+	// --ids-only output is meant for scripts, so it is never paged
+	var rows [][2]string
+	idsOnly := false
+	if listCmdFlags.idsOnly {
+		rows, idsOnly = idNames(v)
+	}
+	var w io.Writer = os.Stdout
+	if pager := Pager(); len(pager) > 0 && !idsOnly {
+		p, err := output.StartPager(pager, os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Unable to start pager:", err)
+		} else {
+			defer p.Close()
+			w = p
+		}
+	}
+	var err error
+	if idsOnly {
+		err = writeIDNames(w, rows)
+	} else {
+		err = output.Write(w, v, OutputOptions())
 	}
-	buf, err := marshalIndent(v, "", "  ")
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Println(string(buf))
+}
+
+// Pager returns the pager command to use or the empty string if
+// output should not be paged.
+func Pager() string {
+	if viper.GetBool("no-pager") || !output.IsTerminal(os.Stdout) {
+		return ""
+	}
+	pager := viper.GetString("pager")
+	if len(pager) == 0 {
+		pager = os.Getenv("PAGER")
+	}
+	if len(pager) == 0 {
+		pager = "less"
+	}
+	if pager == "cat" {
+		return ""
+	}
+	return pager
+}
+
+// OutputPartial writes the results retrieved before err occurred
+// to standard out, labeling them as partial on standard error, and
+// exits.  It is used when --max-requests is exceeded part way
+// through a listing.
+func OutputPartial(v interface{}, err error) {
+	fmt.Fprintf(os.Stderr, "Partial results: %v (--max-requests %d)\n", err, viper.GetInt("max-requests"))
+	Output(v)
+	os.Exit(2)
+}
+
+func OutputOptions() *output.Options {
+	return &output.Options{
+		Format:     viper.GetString("output"),
+		Template:   viper.GetString("template"),
+		Columns:    viper.GetStringSlice("columns"),
+		TimeFormat: viper.GetString("time-format"),
+		Monochrome: viper.GetBool("monochrome") || viper.GetBool("no-color") ||
+			output.NoColor() || !output.IsTerminal(os.Stdout),
+	}
 }
 
 func Account() string {
@@ -161,6 +532,17 @@ func Account() string {
 	return account
 }
 
+// WebAccount returns the account to pass to lighthouse.WebURL and
+// the WebURL methods of resources: --base-url if given, so web URLs
+// point at the same server as API requests, otherwise the account
+// name.
+func WebAccount() string {
+	if baseURL := viper.GetString("base-url"); len(baseURL) > 0 {
+		return baseURL
+	}
+	return Account()
+}
+
 func Project() int {
 	projectStr := viper.GetString("project")
 	if len(projectStr) == 0 {
@@ -173,6 +555,44 @@ func Project() int {
 	return projectID
 }
 
+// Projects returns the IDs of the projects of the workspace given by
+// --workspace, LH_WORKSPACE or the config file, or the project given
+// by -p if no workspace is given.  An explicit -p takes precedence
+// over a workspace not given by --workspace.  Workspaces are defined
+// in the config file's workspaces map, each listing project IDs or
+// names.  Only the commands in workspaceCommands accept a workspace.
+func Projects() ([]int, error) {
+	name := viper.GetString("workspace")
+	if len(name) == 0 {
+		return []int{Project()}, nil
+	}
+	var (
+		projectStrs []string
+		found       bool
+	)
+	for key, value := range viper.GetStringMapStringSlice("workspaces") {
+		if strings.EqualFold(key, name) {
+			projectStrs, found = value, true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("No such workspace %q, please define it in the workspaces map of the config file", name)
+	}
+	if len(projectStrs) == 0 {
+		return nil, fmt.Errorf("Workspace %q has no projects", name)
+	}
+	projectIDs := []int{}
+	for _, projectStr := range projectStrs {
+		projectID, err := ProjectID(projectStr)
+		if err != nil {
+			return nil, fmt.Errorf("workspace %q: %v", name, err)
+		}
+		projectIDs = append(projectIDs, projectID)
+	}
+	return projectIDs, nil
+}
+
 func UserID(userStr string) (int, error) {
 	s := users.NewService(service)
 	u, err := s.Get(userStr)
@@ -192,6 +612,30 @@ func MilestoneID(milestoneStr string) (int, error) {
 	return m.ID, nil
 }
 
+// RevisionURLTemplate returns the revision URL template configured
+// for projectID in the config file's 'revision-urls' map, which is
+// keyed by project ID or name, or the empty string if there is none.
+func RevisionURLTemplate(projectID int) string {
+	templates := viper.GetStringMapString("revision-urls")
+	if len(templates) == 0 {
+		return ""
+	}
+	if template, ok := templates[strconv.Itoa(projectID)]; ok {
+		return template
+	}
+	// fetch the project once rather than looking up each key
+	p, err := projects.NewService(service).GetByID(projectID)
+	if err != nil {
+		return ""
+	}
+	for projectStr, template := range templates {
+		if strings.EqualFold(projectStr, p.Name) || strings.EqualFold(projectStr, p.Permalink) {
+			return template
+		}
+	}
+	return ""
+}
+
 func ProjectID(projectStr string) (int, error) {
 	s := projects.NewService(service)
 	p, err := s.Get(projectStr)
@@ -201,8 +645,45 @@ func ProjectID(projectStr string) (int, error) {
 	return p.ID, nil
 }
 
+// ValidState returns the project's spelling of state, or an error
+// listing the project's states if it isn't one of them.
+func ValidState(t *tickets.Service, state string) (string, error) {
+	ss, err := t.States()
+	if err != nil {
+		return "", err
+	}
+	valid, err := ss.Normalize(state)
+	return string(valid), err
+}
+
+// NotifyOptions returns ticket notification options suppressing
+// notifications if noNotify is set and replacing the ticket's
+// watchers with watcherStrs if non-empty.
+func NotifyOptions(noNotify bool, watcherStrs []string) (*tickets.NotifyOptions, error) {
+	opts := &tickets.NotifyOptions{}
+	if noNotify {
+		notifyAll := false
+		opts.NotifyAll = &notifyAll
+	}
+	for _, watcherStr := range watcherStrs {
+		id, err := UserID(watcherStr)
+		if err != nil {
+			return nil, err
+		}
+		opts.MultipleWatchers = append(opts.MultipleWatchers, id)
+	}
+	return opts, nil
+}
+
 func FatalUsage(cmd *cobra.Command, v ...interface{}) {
 	fmt.Println(v...)
+	for _, x := range v {
+		// not a usage error, the command was aborted because
+		// of --max-requests
+		if err, ok := x.(error); ok && errors.Is(err, lighthouse.ErrMaxRequestsExceeded) {
+			os.Exit(2)
+		}
+	}
 	fmt.Println()
 	cmd.Usage()
 	os.Exit(1)
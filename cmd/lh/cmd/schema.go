@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/messages"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/profiles"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/nwidger/lighthouse/tokens"
+	"github.com/nwidger/lighthouse/users"
+	"github.com/spf13/cobra"
+)
+
+// schemaCommands maps the get and list commands to a value of the
+// type they output.
+var schemaCommands = map[string]interface{}{
+	"get bin":                   &bins.Bin{},
+	"get changeset":             &changesets.Changeset{},
+	"get message":               &messages.Message{},
+	"get milestone":             &milestones.Milestone{},
+	"get milestones":            milestones.Milestones{},
+	"get plan":                  &lighthouse.Plan{},
+	"get profile":               &profiles.User{},
+	"get project":               &projects.Project{},
+	"get project --memberships": projects.Memberships{},
+	"get ticket":                &tickets.Ticket{},
+	"get token":                 &tokens.Token{},
+	"get user":                  &users.User{},
+	"get user --memberships":    users.Memberships{},
+	"get versions":              []*TicketVersionSummary{},
+	"list bins":                 bins.Bins{},
+	"list changesets":           changesets.Changesets{},
+	"list messages":             messages.Messages{},
+	"list milestones":           milestones.Milestones{},
+	"list projects":             projects.Projects{},
+	"list tickets":              tickets.Tickets{},
+}
+
+// schemaCmd represents the schema command
+var schemaCmd = &cobra.Command{
+	Use:   "schema [command]",
+	Short: "Print the JSON schema of the output of a get or list command",
+	Long: `Print the JSON schema of the output of a get or list command
+
+Prints a JSON schema (draft 2020-12) describing the JSON written by
+the given get or list command with --output json, i.e., 'lh schema
+get ticket', so scripts and dashboards consuming lh's output can
+validate their parsers against it.  The schema is derived from the
+types lh decodes Lighthouse's responses into.  Fields Lighthouse adds
+which lh doesn't know about are passed through, so objects allow
+additional properties.  With no arguments, the supported commands are
+listed.
+`,
+	// describes lh itself, no account/token required
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			names := make([]string, 0, len(schemaCommands))
+			for name := range schemaCommands {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Println(name)
+			}
+			return
+		}
+		name := strings.Join(args, " ")
+		v, ok := schemaCommands[name]
+		if !ok {
+			FatalUsage(cmd, fmt.Errorf("no schema for %q, run 'lh schema' to list supported commands", name))
+		}
+		schema := jsonSchema(reflect.TypeOf(v))
+		schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+		schema["title"] = "lh " + name
+		buf, err := lighthouse.MarshalCanonical(schema, lighthouse.NullsExplicit)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		os.Stdout.Write(buf)
+	},
+}
+
+type schemaObject = map[string]interface{}
+
+var (
+	timeSchema = schemaObject{"type": "string", "format": "date-time"}
+
+	// schemaOverrides are the schemas of types which implement
+	// json.Marshaler with an encoding unlike their fields
+	schemaOverrides = map[reflect.Type]schemaObject{
+		reflect.TypeOf(time.Time{}):       timeSchema,
+		reflect.TypeOf(lighthouse.Time{}): timeSchema,
+		reflect.TypeOf(json.RawMessage{}): {},
+		reflect.TypeOf(projects.StatesList{}): {
+			"type":        "string",
+			"description": "comma-separated list of states",
+		},
+		reflect.TypeOf(tickets.AlphabeticalTag{}): {
+			"type":        "array",
+			"description": "tag name and number of tickets",
+			"prefixItems": []interface{}{
+				schemaObject{"type": "string"},
+				schemaObject{"type": "integer"},
+			},
+			"items": false,
+		},
+		reflect.TypeOf(users.ActiveTicket{}): {
+			"type":        "array",
+			"description": "ticket number, title, URL and last update as a Unix timestamp",
+			"prefixItems": []interface{}{
+				schemaObject{"type": "integer"},
+				schemaObject{"type": "string"},
+				schemaObject{"type": "string"},
+				schemaObject{"type": "number"},
+			},
+			"items": false,
+		},
+		reflect.TypeOf(changesets.Change{}): {
+			"type":        "array",
+			"description": "operation and, if any, path",
+			"items":       schemaObject{"type": "string"},
+			"minItems":    1,
+			"maxItems":    2,
+		},
+	}
+)
+
+// jsonSchema returns the JSON schema of the encoding of t by
+// encoding/json.
+func jsonSchema(t reflect.Type) schemaObject {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+
+	var schema schemaObject
+	if override, ok := schemaOverrides[t]; ok {
+		schema = schemaObject{}
+		for k, v := range override {
+			schema[k] = v
+		}
+		if len(schema) == 0 {
+			return schema
+		}
+	} else {
+		switch t.Kind() {
+		case reflect.Bool:
+			schema = schemaObject{"type": "boolean"}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			schema = schemaObject{"type": "integer"}
+		case reflect.Float32, reflect.Float64:
+			schema = schemaObject{"type": "number"}
+		case reflect.String:
+			schema = schemaObject{"type": "string"}
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 {
+				schema = schemaObject{"type": "string", "contentEncoding": "base64"}
+				break
+			}
+			schema = schemaObject{"type": "array", "items": jsonSchema(t.Elem())}
+			// nil slices are encoded as null
+			nullable = t.Kind() == reflect.Slice
+		case reflect.Map:
+			schema = schemaObject{"type": "object", "additionalProperties": jsonSchema(t.Elem())}
+			nullable = true
+		case reflect.Struct:
+			properties := schemaObject{}
+			addProperties(properties, t)
+			schema = schemaObject{"type": "object", "properties": properties}
+		default:
+			return schemaObject{}
+		}
+	}
+
+	if nullable {
+		if typ, ok := schema["type"].(string); ok {
+			schema["type"] = []interface{}{typ, "null"}
+		}
+	}
+	return schema
+}
+
+// addProperties adds the schema of each field of the struct type t
+// encoded by encoding/json to properties, including the fields of
+// embedded structs.
+func addProperties(properties schemaObject, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && len(name) == 0 && ft.Kind() == reflect.Struct {
+			addProperties(properties, ft)
+			continue
+		}
+		if len(f.PkgPath) > 0 {
+			// unexported
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		properties[name] = jsonSchema(f.Type)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(schemaCmd)
+}
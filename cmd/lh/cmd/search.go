@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/profiles"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/search"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+type searchCmdOpts struct {
+	allProjects bool
+	all         bool
+	limit       int
+	workers     int
+}
+
+var searchCmdFlags searchCmdOpts
+
+// searchCmd represents the search command
+var searchCmd = &cobra.Command{
+	Use:   "search [query]",
+	Short: "Search tickets in one or all projects",
+	Long: `Search tickets in one or all projects
+
+Lighthouse only searches tickets within a single project.  With
+--all-projects, the query is run against every project in the
+account, up to --workers projects at a time, and the results are
+merged.  Results are ranked by how well their title, tags and body
+match the query's bare words unless the query includes 'sort:'.
+Each result includes the project_name of its project.
+
+Without --all-projects, the project given by -p or the projects of
+the workspace given by --workspace are searched.
+
+With --account=all, every project of each account in the config
+file's 'accounts' map is searched and each result also includes its
+account.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := searchCmdFlags
+		query := strings.Join(args, " ")
+		if len(strings.TrimSpace(query)) == 0 {
+			FatalUsage(cmd, "must supply search query")
+		}
+		q, err := search.Parse(query)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+
+		// each project searched, along with its account's service
+		// and the query with 'me' resolved for the account
+		type target struct {
+			account string
+			s       *lighthouse.Service
+			q       *search.Query
+			project *projects.Project
+		}
+		targets := []*target{}
+		EachAccount(func(account string) {
+			var ps projects.Projects
+			if flags.allProjects || accounts != nil {
+				ps, err = projects.NewService(service).List()
+				if err != nil {
+					FatalUsage(cmd, err)
+				}
+			} else {
+				projectIDs, err := Projects()
+				if err != nil {
+					FatalUsage(cmd, err)
+				}
+				for _, projectID := range projectIDs {
+					p, err := projects.NewService(service).GetByID(projectID)
+					if err != nil {
+						FatalUsage(cmd, err)
+					}
+					ps = append(ps, p)
+				}
+			}
+			aq := *q
+			if u, err := profiles.NewService(service).Get(); err == nil {
+				aq.Me = u.Name
+			}
+			for _, p := range ps {
+				targets = append(targets, &target{
+					account: account,
+					s:       service,
+					q:       &aq,
+					project: p,
+				})
+			}
+		})
+
+		found := make([]tickets.Tickets, len(targets))
+		pool := lighthouse.NewPool(flags.workers)
+		err = pool.Run(context.Background(), len(targets), func(ctx context.Context, i int) error {
+			t := tickets.NewService(targets[i].s, targets[i].project.ID)
+			opts := &tickets.ListOptions{
+				Query: query,
+				Limit: flags.limit,
+			}
+			var err error
+			if flags.all {
+				found[i], err = t.ListAll(opts)
+			} else {
+				found[i], err = t.List(opts)
+			}
+			if err != nil {
+				return fmt.Errorf("project %q: %v", targets[i].project.Name, err)
+			}
+			return nil
+		})
+
+		rs := search.Results{}
+		for i, ts := range found {
+			for _, t := range ts {
+				r := &search.Result{
+					Ticket:      t,
+					ProjectName: targets[i].project.Name,
+					Score:       targets[i].q.Score(t),
+				}
+				if accounts != nil {
+					r.Account = targets[i].account
+				}
+				rs = append(rs, r)
+			}
+		}
+		q.Rank(rs)
+
+		var me *lighthouse.MultiError
+		if errors.As(err, &me) && len(rs) > 0 {
+			for _, bi := range me.Items {
+				fmt.Fprintln(os.Stderr, "Warning:", bi.Err)
+			}
+			err = nil
+		}
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		Output(rs)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(searchCmd)
+	searchCmd.Flags().BoolVar(&searchCmdFlags.allProjects, "all-projects", false, "Search every project in the account")
+	searchCmd.Flags().BoolVar(&searchCmdFlags.all, "all", false, "Return all matching tickets instead of the first page from each project")
+	searchCmd.Flags().IntVar(&searchCmdFlags.limit, "limit", 0, "The number of tickets per page to return from each project")
+	searchCmd.Flags().IntVar(&searchCmdFlags.workers, "workers", lighthouse.DefaultPoolWorkers, "Number of projects to search at once")
+}
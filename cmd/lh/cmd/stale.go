@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+type staleCmdOpts struct {
+	idle     string
+	query    string
+	comment  string
+	tag      string
+	preview  bool
+	noNotify bool
+}
+
+var staleCmdFlags staleCmdOpts
+
+// staleCmd represents the stale command
+var staleCmd = &cobra.Command{
+	Use:   "stale",
+	Short: "Find open tickets with no recent updates (requires -p or --workspace)",
+	Long: `Find open tickets with no recent updates (requires -p or --workspace)
+
+Lists open tickets which have not been updated for the duration given
+by --idle, which may be given in days (60d), weeks (8w) or as a Go
+duration (1440h).  Use --comment and --tag to comment on and tag each
+stale ticket, and --preview to see which tickets would be changed
+without changing them.
+
+With --workspace, the tickets of each of the workspace's projects are
+checked.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := staleCmdFlags
+		idle, err := parseDuration(flags.idle)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		stale := tickets.Tickets{}
+		projectIDs, err := Projects()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		for _, projectID := range projectIDs {
+			ts, err := tickets.NewService(service, projectID).ListStale(flags.query, time.Now().Add(-idle))
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+			stale = append(stale, ts...)
+		}
+		if flags.preview || (len(flags.comment) == 0 && len(flags.tag) == 0) {
+			Output(stale)
+			return
+		}
+		opts, err := NotifyOptions(flags.noNotify, nil)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		for _, tkt := range stale {
+			t := tickets.NewService(service, tkt.ProjectID)
+			if len(flags.comment) > 0 {
+				err = t.CommentWithOptions(tkt.Number, flags.comment, opts)
+				if err != nil {
+					FatalUsage(cmd, err)
+				}
+			}
+			if len(flags.tag) == 0 || hasTag(tkt, flags.tag) {
+				continue
+			}
+			tag := flags.tag
+			if strings.Contains(tag, " ") {
+				tag = strconv.Quote(tag)
+			}
+			tkt.Tag = strings.TrimSpace(tkt.Tag + " " + tag)
+			tu := &tickets.TicketUpdate{
+				Tag: &tkt.Tag,
+			}
+			if opts != nil {
+				tu.NotifyAll = opts.NotifyAll
+			}
+			err = t.UpdatePartial(tkt.Number, tu)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+		}
+		Output(stale)
+	},
+}
+
+// parseDuration parses a duration which may also be given in days
+// ('60d') or weeks ('8w').
+func parseDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+func hasTag(t *tickets.Ticket, tag string) bool {
+	for _, tr := range t.Tags {
+		if tr != nil && tr.Tag != nil && strings.EqualFold(tr.Tag.Name, tag) {
+			return true
+		}
+	}
+	for _, name := range strings.Fields(t.Tag) {
+		if strings.EqualFold(strings.Trim(name, `"`), tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	RootCmd.AddCommand(staleCmd)
+	staleCmd.Flags().StringVar(&staleCmdFlags.idle, "idle", "60d", "Minimum time since a ticket was last updated")
+	staleCmd.Flags().StringVar(&staleCmdFlags.query, "query", "", "Additional search query, see http://help.lighthouseapp.com/faqs/getting-started/how-do-i-search-for-tickets")
+	staleCmd.Flags().StringVar(&staleCmdFlags.comment, "comment", "", "Comment to add to each stale ticket")
+	staleCmd.Flags().StringVar(&staleCmdFlags.tag, "tag", "", "Tag to add to each stale ticket")
+	staleCmd.Flags().BoolVar(&staleCmdFlags.preview, "preview", false, "Only list stale tickets, don't comment on or tag them")
+	staleCmd.Flags().BoolVar(&staleCmdFlags.noNotify, "no-notify", false, "Don't send notification emails")
+}
@@ -0,0 +1,13 @@
+package cmd
+
+import "github.com/spf13/cobra"
+
+// tagsCmd represents the tags command
+var tagsCmd = &cobra.Command{
+	Use:   "tags",
+	Short: "Manage ticket tags",
+}
+
+func init() {
+	RootCmd.AddCommand(tagsCmd)
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+type tagsApplyCmdOpts struct {
+	query   string
+	add     []string
+	remove  []string
+	preview bool
+}
+
+var tagsApplyCmdFlags tagsApplyCmdOpts
+
+// tagsApplyCmd represents the tags apply command
+var tagsApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Add and remove tags on all tickets matching a query (requires -p)",
+	Long: `Add and remove tags on all tickets matching a query (requires -p)
+
+Prints the numbers of the affected tickets.  Use --preview to see
+which tickets would be affected without changing them.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := tagsApplyCmdFlags
+		projectID := Project()
+		t := tickets.NewService(service, projectID)
+		if len(flags.query) == 0 {
+			FatalUsage(cmd, "Please specify query with --query")
+		}
+		if len(flags.add) == 0 && len(flags.remove) == 0 {
+			FatalUsage(cmd, "Please specify tags with --add or --remove")
+		}
+		numbers, err := t.TagByQuery(flags.query, flags.add, flags.remove, flags.preview)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		Output(numbers)
+	},
+}
+
+func init() {
+	tagsCmd.AddCommand(tagsApplyCmd)
+	tagsApplyCmd.Flags().StringVar(&tagsApplyCmdFlags.query, "query", "", "Search query, see http://help.lighthouseapp.com/faqs/getting-started/how-do-i-search-for-tickets (required)")
+	tagsApplyCmd.Flags().StringSliceVar(&tagsApplyCmdFlags.add, "add", nil, "Comma-separated tags to add")
+	tagsApplyCmd.Flags().StringSliceVar(&tagsApplyCmdFlags.remove, "remove", nil, "Comma-separated tags to remove")
+	tagsApplyCmd.Flags().BoolVar(&tagsApplyCmdFlags.preview, "preview", false, "Only print the affected ticket numbers, don't change any tickets")
+}
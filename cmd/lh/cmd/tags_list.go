@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/nwidger/lighthouse/tags"
+	"github.com/spf13/cobra"
+)
+
+// tagsListCmd represents the tags list command
+var tagsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the tags used by a project's tickets (requires -p)",
+	Run: func(cmd *cobra.Command, args []string) {
+		projectID := Project()
+		ts, err := tags.NewService(service, projectID).List()
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		Output(ts)
+	},
+}
+
+func init() {
+	tagsCmd.AddCommand(tagsListCmd)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"github.com/nwidger/lighthouse/tags"
+	"github.com/spf13/cobra"
+)
+
+type tagsMergeCmdOpts struct {
+	into    string
+	preview bool
+}
+
+var tagsMergeCmdFlags tagsMergeCmdOpts
+
+// tagsMergeCmd represents the tags merge command
+var tagsMergeCmd = &cobra.Command{
+	Use:   "merge TAG...",
+	Short: "Replace several tags with one on every ticket using them (requires -p)",
+	Long: `Replace several tags with one on every ticket using them (requires -p)
+
+Replaces each TAG with the tag given by --into, i.e., to merge 'bug'
+and 'defect' into 'bugs':
+
+  lh tags merge bug defect --into bugs
+
+Prints the numbers of the affected tickets.  Use --preview to see
+which tickets would be affected without changing them.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := tagsMergeCmdFlags
+		if len(args) == 0 {
+			FatalUsage(cmd, "Please specify the tags to merge")
+		}
+		if len(flags.into) == 0 {
+			FatalUsage(cmd, "Please specify the tag to merge into with --into")
+		}
+		projectID := Project()
+		numbers, err := tags.NewService(service, projectID).Merge(args, flags.into, flags.preview)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		Output(numbers)
+	},
+}
+
+func init() {
+	tagsCmd.AddCommand(tagsMergeCmd)
+	tagsMergeCmd.Flags().StringVar(&tagsMergeCmdFlags.into, "into", "", "Tag to merge the tags into (required)")
+	tagsMergeCmd.Flags().BoolVar(&tagsMergeCmdFlags.preview, "preview", false, "Only print the affected ticket numbers, don't change any tickets")
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"github.com/nwidger/lighthouse/tags"
+	"github.com/spf13/cobra"
+)
+
+type tagsRenameCmdOpts struct {
+	preview bool
+}
+
+var tagsRenameCmdFlags tagsRenameCmdOpts
+
+// tagsRenameCmd represents the tags rename command
+var tagsRenameCmd = &cobra.Command{
+	Use:   "rename OLD NEW",
+	Short: "Rename a tag on every ticket using it (requires -p)",
+	Long: `Rename a tag on every ticket using it (requires -p)
+
+Prints the numbers of the affected tickets.  If NEW is already in use
+the two tags are merged.  Use --preview to see which tickets would be
+affected without changing them.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := tagsRenameCmdFlags
+		if len(args) != 2 {
+			FatalUsage(cmd, "Please specify the tag to rename and its new name")
+		}
+		projectID := Project()
+		numbers, err := tags.NewService(service, projectID).Rename(args[0], args[1], flags.preview)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		Output(numbers)
+	},
+}
+
+func init() {
+	tagsCmd.AddCommand(tagsRenameCmd)
+	tagsRenameCmd.Flags().BoolVar(&tagsRenameCmdFlags.preview, "preview", false, "Only print the affected ticket numbers, don't change any tickets")
+}
@@ -0,0 +1,348 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/spf13/cobra"
+)
+
+type triageCmdOpts struct {
+	query    string
+	noNotify bool
+}
+
+var triageCmdFlags triageCmdOpts
+
+// triageCmd represents the triage command
+var triageCmd = &cobra.Command{
+	Use:   "triage",
+	Short: "Interactively triage tickets one at a time (requires -p)",
+	Long: `Interactively triage tickets one at a time (requires -p)
+
+Shows each ticket matching --query (default 'state:new') in turn and
+waits for a single key press choosing an action:
+
+  a  assign the ticket to a user
+  m  set the ticket's milestone
+  t  add a tag to the ticket
+  c  close the ticket with one of the project's closed states
+  s  skip to the next ticket (also space or enter)
+  q  quit
+
+Each action immediately changes only the affected field of the
+ticket, so concurrent edits to its other fields are not overwritten.
+Assign, milestone and tag prompt for a value and leave the ticket
+shown so several actions can be taken, close moves on to the next
+ticket.  If standard input is not a terminal, each key must be
+followed by enter.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		flags := triageCmdFlags
+		projectID := Project()
+		t := tickets.NewService(service, projectID)
+		p, err := projects.NewService(service).GetByID(projectID)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		opts, err := NotifyOptions(flags.noNotify, nil)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		ts, err := t.ListAll(&tickets.ListOptions{
+			Query: flags.query,
+			Limit: tickets.MaxLimit,
+		})
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		if len(ts) == 0 {
+			fmt.Println("No tickets match", strconv.Quote(flags.query))
+			return
+		}
+
+		tr := &triager{
+			t:      t,
+			opts:   opts,
+			states: tickets.NewStates(p),
+			keys:   newKeyReader(os.Stdin),
+			w:      os.Stdout,
+		}
+		defer tr.keys.restore()
+
+		// restore the terminal if interrupted while it is in
+		// non-canonical mode
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		defer signal.Stop(c)
+		go func() {
+			if _, ok := <-c; ok {
+				tr.keys.restore()
+				fmt.Fprintln(tr.w)
+				os.Exit(1)
+			}
+		}()
+
+		changed := 0
+		for i, tkt := range ts {
+			fmt.Fprintf(tr.w, "\n[%d/%d] ", i+1, len(ts))
+			tr.show(tkt)
+			n, quit, err := tr.triage(tkt)
+			if err != nil {
+				tr.keys.restore()
+				FatalUsage(cmd, err)
+			}
+			if n > 0 {
+				changed++
+			}
+			if quit {
+				break
+			}
+		}
+		fmt.Fprintf(tr.w, "\nChanged %d of %d tickets\n", changed, len(ts))
+	},
+}
+
+// triager applies the actions chosen by the user to the tickets
+// shown by lh triage.
+type triager struct {
+	t      *tickets.Service
+	opts   *tickets.NotifyOptions
+	states *tickets.States
+	keys   *keyReader
+	w      io.Writer
+}
+
+// show prints a summary of tkt.
+func (tr *triager) show(tkt *tickets.Ticket) {
+	fmt.Fprintf(tr.w, "#%d %s\n", tkt.Number, tkt.Title)
+	fmt.Fprintf(tr.w, "  state: %s  assigned: %s  milestone: %s  tags: %s\n",
+		tkt.State, orNone(tkt.AssignedUserName), orNone(tkt.MilestoneTitle), orNone(tkt.Tag))
+	if len(tkt.CreatorName) > 0 {
+		fmt.Fprintf(tr.w, "  reported by %s", tkt.CreatorName)
+		if tkt.CreatedAt != nil {
+			fmt.Fprintf(tr.w, " on %s", tkt.CreatedAt.Format("2006-01-02"))
+		}
+		fmt.Fprintln(tr.w)
+	}
+	body := strings.TrimSpace(tkt.OriginalBody)
+	if len(body) == 0 {
+		return
+	}
+	lines := strings.Split(body, "\n")
+	if len(lines) > 10 {
+		lines = append(lines[:10], "...")
+	}
+	for _, line := range lines {
+		fmt.Fprintln(tr.w, "  | "+strings.TrimRight(line, "\r"))
+	}
+}
+
+// update changes the fields of ticket number set in tu, notifying
+// according to tr.opts.
+func (tr *triager) update(number int, tu *tickets.TicketUpdate) error {
+	if tr.opts != nil {
+		tu.NotifyAll = tr.opts.NotifyAll
+		tu.MultipleWatchers = tr.opts.MultipleWatchers
+	}
+	return tr.t.UpdatePartial(number, tu)
+}
+
+// triage reads actions for tkt until the user moves on to the next
+// ticket, returning the number of changes made and whether the user
+// quit.
+func (tr *triager) triage(tkt *tickets.Ticket) (int, bool, error) {
+	changes := 0
+	for {
+		fmt.Fprint(tr.w, "[a]ssign [m]ilestone [t]ag [c]lose [s]kip [q]uit? ")
+		key, err := tr.keys.key()
+		if err == io.EOF {
+			fmt.Fprintln(tr.w)
+			return changes, true, nil
+		}
+		if err != nil {
+			return changes, false, err
+		}
+		if unicode.IsPrint(key) {
+			fmt.Fprint(tr.w, string(key))
+		}
+		fmt.Fprintln(tr.w)
+
+		switch key {
+		case 'a':
+			name := tr.keys.line(tr.w, "Assign to")
+			if len(name) == 0 {
+				continue
+			}
+			id, err := UserID(name)
+			if err != nil {
+				fmt.Fprintln(tr.w, err)
+				continue
+			}
+			err = tr.update(tkt.Number, &tickets.TicketUpdate{AssignedUserID: lighthouse.Int(id)})
+			if err != nil {
+				return changes, false, err
+			}
+			tkt.AssignedUserID, tkt.AssignedUserName = id, name
+		case 'm':
+			title := tr.keys.line(tr.w, "Milestone")
+			if len(title) == 0 {
+				continue
+			}
+			id, err := MilestoneID(title)
+			if err != nil {
+				fmt.Fprintln(tr.w, err)
+				continue
+			}
+			err = tr.update(tkt.Number, &tickets.TicketUpdate{MilestoneID: lighthouse.Int(id)})
+			if err != nil {
+				return changes, false, err
+			}
+			tkt.MilestoneID, tkt.MilestoneTitle = id, title
+		case 't':
+			tag := tr.keys.line(tr.w, "Tag")
+			if len(tag) == 0 || hasTag(tkt, tag) {
+				continue
+			}
+			if strings.Contains(tag, " ") {
+				tag = strconv.Quote(tag)
+			}
+			tags := strings.TrimSpace(tkt.Tag + " " + tag)
+			err = tr.update(tkt.Number, &tickets.TicketUpdate{Tag: lighthouse.String(tags)})
+			if err != nil {
+				return changes, false, err
+			}
+			tkt.Tag = tags
+		case 'c':
+			closed := tr.states.Closed
+			if len(closed) == 0 {
+				fmt.Fprintln(tr.w, "project has no closed states")
+				continue
+			}
+			names := make([]string, 0, len(closed))
+			for _, cs := range closed {
+				names = append(names, string(cs))
+			}
+			state := tr.keys.line(tr.w, fmt.Sprintf("Close as (%s) [%s]", strings.Join(names, ", "), closed[0]))
+			if len(state) == 0 {
+				state = string(closed[0])
+			}
+			closedState, err := tr.states.NormalizeClosed(state)
+			if err != nil {
+				fmt.Fprintln(tr.w, err)
+				continue
+			}
+			err = tr.update(tkt.Number, &tickets.TicketUpdate{State: lighthouse.String(string(closedState))})
+			if err != nil {
+				return changes, false, err
+			}
+			return changes + 1, false, nil
+		case 's', ' ', '\n', '\r':
+			return changes, false, nil
+		case 'q':
+			return changes, true, nil
+		default:
+			continue
+		}
+		changes++
+		fmt.Fprintln(tr.w, "  updated")
+	}
+}
+
+func orNone(s string) string {
+	if len(s) == 0 {
+		return "none"
+	}
+	return s
+}
+
+// keyReader reads single key presses from a terminal, falling back to
+// reading the first character of each line if it is not one.
+type keyReader struct {
+	f *os.File
+	r *bufio.Reader
+	// saved holds the terminal settings to restore while the
+	// terminal is in non-canonical mode, see stty(1)
+	saved string
+}
+
+func newKeyReader(f *os.File) *keyReader {
+	kr := &keyReader{f: f, r: bufio.NewReader(f)}
+	kr.raw()
+	return kr
+}
+
+func (kr *keyReader) stty(args ...string) (string, error) {
+	c := exec.Command("stty", args...)
+	c.Stdin = kr.f
+	out, err := c.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// raw puts the terminal in non-canonical mode without echo so key
+// presses can be read as they are typed.
+func (kr *keyReader) raw() {
+	saved, err := kr.stty("-g")
+	if err != nil {
+		return
+	}
+	_, err = kr.stty("-icanon", "-echo", "min", "1")
+	if err != nil {
+		return
+	}
+	kr.saved = saved
+}
+
+// restore restores the terminal's original settings.
+func (kr *keyReader) restore() {
+	if len(kr.saved) > 0 {
+		kr.stty(kr.saved)
+		kr.saved = ""
+	}
+}
+
+// key reads a single key press.
+func (kr *keyReader) key() (rune, error) {
+	if len(kr.saved) > 0 {
+		r, _, err := kr.r.ReadRune()
+		return r, err
+	}
+	line, err := kr.r.ReadString('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return 0, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return '\n', nil
+	}
+	return []rune(line)[0], nil
+}
+
+// line prompts for a line of input, which is read with the terminal
+// in canonical mode so it can be edited.
+func (kr *keyReader) line(w io.Writer, prompt string) string {
+	raw := len(kr.saved) > 0
+	kr.restore()
+	if raw {
+		defer kr.raw()
+	}
+	fmt.Fprintf(w, "%s: ", prompt)
+	line, _ := kr.r.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+func init() {
+	RootCmd.AddCommand(triageCmd)
+	triageCmd.Flags().StringVar(&triageCmdFlags.query, "query", "state:new", "Search query selecting the tickets to triage, see http://help.lighthouseapp.com/faqs/getting-started/how-do-i-search-for-tickets")
+	triageCmd.Flags().BoolVar(&triageCmdFlags.noNotify, "no-notify", false, "Don't send notification emails")
+}
@@ -50,7 +50,7 @@ var updateBinCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(bin)
+		Output(bin)
 	},
 }
 
@@ -42,7 +42,7 @@ var updateMessageCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(message)
+		Output(message)
 	},
 }
 
@@ -3,6 +3,7 @@ package cmd
 import (
 	"time"
 
+	"github.com/nwidger/lighthouse"
 	"github.com/nwidger/lighthouse/milestones"
 	"github.com/spf13/cobra"
 )
@@ -44,7 +45,7 @@ var updateMilestoneCmd = &cobra.Command{
 			if err != nil {
 				FatalUsage(cmd, err)
 			}
-			milestone.DueOn = &due
+			milestone.DueOn = lighthouse.NewTime(due)
 		}
 		err = m.Update(milestone)
 		if err != nil {
@@ -66,7 +67,7 @@ var updateMilestoneCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(milestone)
+		Output(milestone)
 	},
 }
 
@@ -6,11 +6,13 @@ import (
 )
 
 type updateProjectsCmdOpts struct {
-	archived  bool
-	unarchive bool
-	name      string
-	public    bool
-	private   bool
+	archived         bool
+	unarchive        bool
+	name             string
+	public           bool
+	private          bool
+	sendChangesets   bool
+	noSendChangesets bool
 }
 
 var updateProjectsCmdFlags updateProjectsCmdOpts
@@ -19,6 +21,7 @@ var updateProjectsCmdFlags updateProjectsCmdOpts
 var updateProjectCmd = &cobra.Command{
 	Use:   "project",
 	Short: "Update a project",
+	Long:  `Update a project`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
 		flags := updateProjectsCmdFlags
@@ -49,11 +52,21 @@ var updateProjectCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
+		if flags.sendChangesets || flags.noSendChangesets {
+			sendChangesets := flags.sendChangesets
+			is := &projects.IntegrationSettings{
+				SendChangesetsToEvents: &sendChangesets,
+			}
+			err = p.UpdateIntegrationSettings(project.ID, is)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
+		}
 		project, err = p.GetByID(project.ID)
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(project)
+		Output(project)
 	},
 }
 
@@ -64,4 +77,6 @@ func init() {
 	updateProjectCmd.Flags().StringVar(&updateProjectsCmdFlags.name, "name", "", "Change project name")
 	updateProjectCmd.Flags().BoolVar(&updateProjectsCmdFlags.public, "public", false, "Make project public")
 	updateProjectCmd.Flags().BoolVar(&updateProjectsCmdFlags.private, "private", false, "Make project private")
+	updateProjectCmd.Flags().BoolVar(&updateProjectsCmdFlags.sendChangesets, "send-changesets-to-events", false, "List changesets in the project's activity stream")
+	updateProjectCmd.Flags().BoolVar(&updateProjectsCmdFlags.noSendChangesets, "no-send-changesets-to-events", false, "Stop listing changesets in the project's activity stream")
 }
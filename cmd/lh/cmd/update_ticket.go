@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -9,13 +10,16 @@ import (
 )
 
 type updateTicketsCmdOpts struct {
-	title      string
-	comment    string
-	state      string
-	assigned   string
-	milestone  string
-	tags       string
-	attachment string
+	title       string
+	comment     string
+	state       string
+	assigned    string
+	milestone   string
+	tags        string
+	attachments []string
+	noNotify    bool
+	watchers    []string
+	patch       string
 }
 
 var updateTicketsCmdFlags updateTicketsCmdOpts
@@ -24,6 +28,15 @@ var updateTicketsCmdFlags updateTicketsCmdOpts
 var updateTicketCmd = &cobra.Command{
 	Use:   "ticket [number]",
 	Short: "Update a ticket (requires -p)",
+	Long: `Update a ticket (requires -p)
+
+--patch takes a JSON object whose fields are merged into the ticket
+before any other flags are applied, i.e.,
+--patch '{"state":"hold","milestone_id":123}'.  Fields not present
+in the object are left unchanged.  Only title, body, state,
+assigned_user_id, milestone_id and tag can be patched.  Use --patch -
+to read the object from standard input.
+`,
 	Run: func(cmd *cobra.Command, args []string) {
 		var err error
 		flags := updateTicketsCmdFlags
@@ -36,13 +49,33 @@ var updateTicketCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		if len(flags.attachment) > 0 {
-			f, err := os.Open(flags.attachment)
+		if len(flags.patch) > 0 {
+			patch := []byte(flags.patch)
+			if flags.patch == "-" {
+				patch, err = ioutil.ReadAll(os.Stdin)
+				if err != nil {
+					FatalUsage(cmd, err)
+				}
+			}
+			err = tkt.Patch(patch)
 			if err != nil {
 				FatalUsage(cmd, err)
 			}
-			defer f.Close()
-			err = t.AddAttachment(tkt, filepath.Base(flags.attachment), f)
+		}
+		if len(flags.attachments) > 0 {
+			files := make([]tickets.AttachmentUpload, 0, len(flags.attachments))
+			for _, attachment := range flags.attachments {
+				f, err := os.Open(attachment)
+				if err != nil {
+					FatalUsage(cmd, err)
+				}
+				defer f.Close()
+				files = append(files, tickets.AttachmentUpload{
+					Filename: filepath.Base(attachment),
+					Reader:   f,
+				})
+			}
+			err = t.AddAttachments(tkt, files)
 			if err != nil {
 				FatalUsage(cmd, err)
 			}
@@ -54,7 +87,10 @@ var updateTicketCmd = &cobra.Command{
 			tkt.Body = flags.comment
 		}
 		if len(flags.state) > 0 {
-			tkt.State = flags.state
+			tkt.State, err = ValidState(t, flags.state)
+			if err != nil {
+				FatalUsage(cmd, err)
+			}
 		}
 		if len(flags.assigned) > 0 {
 			tkt.AssignedUserID, err = UserID(flags.assigned)
@@ -71,7 +107,11 @@ var updateTicketCmd = &cobra.Command{
 		if len(flags.tags) > 0 {
 			tkt.Tag = flags.tags
 		}
-		err = t.Update(tkt)
+		opts, err := NotifyOptions(flags.noNotify, flags.watchers)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		err = t.UpdateWithOptions(tkt, opts)
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
@@ -79,7 +119,7 @@ var updateTicketCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(tkt)
+		Output(tkt)
 	},
 }
 
@@ -91,5 +131,8 @@ func init() {
 	updateTicketCmd.Flags().StringVar(&updateTicketsCmdFlags.assigned, "assigned", "", "Change user assigned to ticket")
 	updateTicketCmd.Flags().StringVar(&updateTicketsCmdFlags.milestone, "milestone", "", "Assign ticket to a milestone")
 	updateTicketCmd.Flags().StringVar(&updateTicketsCmdFlags.tags, "tags", "", "Comma-separated tags")
-	updateTicketCmd.Flags().StringVar(&updateTicketsCmdFlags.attachment, "attachment", "", "Add file as attachment to ticket")
+	updateTicketCmd.Flags().StringArrayVar(&updateTicketsCmdFlags.attachments, "attachment", nil, "Add file as attachment to ticket (may be repeated)")
+	updateTicketCmd.Flags().BoolVar(&updateTicketsCmdFlags.noNotify, "no-notify", false, "Don't send notification emails")
+	updateTicketCmd.Flags().StringSliceVar(&updateTicketsCmdFlags.watchers, "watchers", nil, "Comma-separated users to set as ticket watchers")
+	updateTicketCmd.Flags().StringVar(&updateTicketsCmdFlags.patch, "patch", "", "JSON object of ticket fields to change, or - to read from stdin")
 }
@@ -44,7 +44,7 @@ var updateUserCmd = &cobra.Command{
 		if err != nil {
 			FatalUsage(cmd, err)
 		}
-		JSON(user)
+		Output(user)
 	},
 }
 
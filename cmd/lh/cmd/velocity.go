@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/spf13/cobra"
+)
+
+// velocityCmd represents the velocity command
+var velocityCmd = &cobra.Command{
+	Use:   "velocity",
+	Short: "Report the points velocity of a project's milestones (requires -p)",
+	Long: `Report the points velocity of a project's milestones (requires -p)
+
+For each milestone with points, reports its open, closed and maximum
+points and its velocity, the number of points closed per week
+between the milestone's creation and its completion or, if it is
+incomplete, now.  The average velocity of the completed milestones
+and its trend, the change in velocity from one completed milestone to
+the next, are reported for the project as a whole.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		projectID := Project()
+		ms, err := milestones.NewService(service, projectID).ListAll(nil)
+		if err != nil {
+			FatalUsage(cmd, err)
+		}
+		Output(milestones.Velocity(ms, time.Now()))
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(velocityCmd)
+}
@@ -0,0 +1,35 @@
+package output_test
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/cmd/lh/output"
+)
+
+func ExampleWrite_timeFormat() {
+	// archives may contain timestamps in layouts other than RFC
+	// 3339, only timestamp fields are reformatted
+	var v struct {
+		CreatedAt *lighthouse.Time `json:"created_at"`
+		Title     string           `json:"title"`
+	}
+	err := json.Unmarshal([]byte(`{"created_at":"2019/08/02 15:04:05 -0700","title":"2019-08-02T15:04:05Z"}`), &v)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = output.Write(os.Stdout, v, &output.Options{
+		TimeFormat: output.TimeRFC3339,
+		Monochrome: true,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Output:
+	// {
+	//   "created_at": "2019-08-02T22:04:05Z",
+	//   "title": "2019-08-02T15:04:05Z"
+	// }
+}
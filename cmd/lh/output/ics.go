@@ -0,0 +1,123 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// icsProductID identifies lh as the producer of iCalendar feeds.
+const icsProductID = "-//nwidger//lh//EN"
+
+// writeICS writes v as an iCalendar feed with an all-day event on the
+// due date of each element, i.e., milestones.  Elements without a due
+// date are skipped.  Event summaries, descriptions and URLs are taken
+// from the title, goals and url fields.
+func writeICS(w io.Writer, v interface{}, opts *Options) error {
+	es := elements(v)
+
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		fmt.Fprint(bw, foldICS(name+":"+value)+"\r\n")
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", icsProductID)
+	line("CALSCALE", "GREGORIAN")
+
+	t := elementType(es)
+	if t != nil {
+		if t.Kind() != reflect.Struct {
+			return fmt.Errorf("ics output requires resources with a due_on field")
+		}
+		_, index := fields(t)
+		if _, ok := index["due_on"]; !ok {
+			return fmt.Errorf("ics output requires resources with a due_on field, %s has none", t.Name())
+		}
+		field := func(e reflect.Value, name string) reflect.Value {
+			idx, ok := index[name]
+			if !ok {
+				return reflect.Value{}
+			}
+			return indirect(fieldByIndex(e, idx))
+		}
+		text := func(e reflect.Value, name string) string {
+			f := field(e, name)
+			if !f.IsValid() {
+				return ""
+			}
+			return fmt.Sprint(f.Interface())
+		}
+		timeOf := func(e reflect.Value, name string) (time.Time, bool) {
+			f := field(e, name)
+			if !f.IsValid() {
+				return time.Time{}, false
+			}
+			tm, ok := timeValue(f)
+			return tm, ok && !tm.IsZero()
+		}
+		now := time.Now()
+		for _, e := range es {
+			due, ok := timeOf(e, "due_on")
+			if !ok {
+				continue
+			}
+			stamp, ok := timeOf(e, "updated_at")
+			if !ok {
+				stamp = now
+			}
+			line("BEGIN", "VEVENT")
+			line("UID", fmt.Sprintf("%s-%s@lighthouseapp.com", strings.ToLower(t.Name()), text(e, "id")))
+			line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+			line("DTSTART;VALUE=DATE", due.Format("20060102"))
+			line("DTEND;VALUE=DATE", due.AddDate(0, 0, 1).Format("20060102"))
+			line("SUMMARY", escapeICS(text(e, "title")))
+			if goals := text(e, "goals"); len(goals) > 0 {
+				line("DESCRIPTION", escapeICS(goals))
+			}
+			if u := text(e, "url"); len(u) > 0 {
+				line("URL", u)
+			}
+			line("TRANSP", "TRANSPARENT")
+			line("END", "VEVENT")
+		}
+	}
+
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+var icsEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`;`, `\;`,
+	`,`, `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", `\n`,
+)
+
+// escapeICS escapes s for use as an iCalendar TEXT value.
+func escapeICS(s string) string {
+	return icsEscaper.Replace(s)
+}
+
+// foldICS folds content line s into lines of at most 75 octets as
+// required by RFC 5545, without splitting UTF-8 sequences.
+func foldICS(s string) string {
+	const max = 75
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		l := len(string(r))
+		if n+l > max {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += l
+	}
+	return b.String()
+}
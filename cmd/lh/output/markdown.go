@@ -0,0 +1,327 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/nwidger/lighthouse/tickets"
+)
+
+var (
+	textileHeadingRegexp = regexp.MustCompile(`^h([1-6])\.\s+`)
+	textileListRegexp    = regexp.MustCompile(`^([*#]+)\s+`)
+	textileTableRegexp   = regexp.MustCompile(`^\s*\|.*\|\s*$`)
+
+	// code spans, links and images, whose contents must not be
+	// converted further
+	textileCodeRegexp  = regexp.MustCompile(`@([^@\s][^@\r\n]*[^@\s]|[^@\s])@`)
+	textileLinkRegexp  = regexp.MustCompile(`"([^"\n]+)":((?:[a-zA-Z][a-zA-Z0-9+.-]*:|/)[^\s<>"]*[^\s<>".,;:!?)])`)
+	textileImageRegexp = regexp.MustCompile(`(?i)!((?:https?://|/)[^\s!()]+|[^\s!()]+\.(?:png|jpe?g|gif|svg|bmp|webp))(?:\(([^)]*)\))?!(?::((?:[a-z][a-z0-9+.-]*:|/)[^\s<>"]*[^\s<>".,;:!?)]))?`)
+	textileBoldRegexp  = regexp.MustCompile(`(^|[\s(\[{>])\*([^\s*](?:[^*\n]*[^\s*])?)\*($|[\s.,;:!?)\]}<])`)
+	textileDelRegexp   = regexp.MustCompile(`(^|[\s(\[{>])-([^\s-](?:[^-\n]*[^\s-])?)-($|[\s.,;:!?)\]}<])`)
+)
+
+// TextileToMarkdown converts text written in Lighthouse's Textile
+// dialect to GitHub Flavored Markdown.  Headings, block quotes,
+// lists, tables, code blocks (bc., <pre> and @@@), code spans, links,
+// images, bold and deleted text are converted.  Other markup is
+// left as-is.
+func TextileToMarkdown(text string) string {
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	out := make([]string, 0, len(lines))
+	inCode, blockCode, inTable := false, false, false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		// code blocks are copied verbatim
+		switch {
+		case !inCode && (trimmed == "@@@" || strings.HasPrefix(trimmed, "<pre>")):
+			inCode = true
+			out = append(out, "```")
+			rest := strings.TrimPrefix(strings.TrimPrefix(trimmed, "<pre>"), "<code>")
+			if strings.HasSuffix(rest, "</pre>") {
+				rest = strings.TrimSuffix(strings.TrimSuffix(rest, "</pre>"), "</code>")
+				out = append(out, rest, "```")
+				inCode = false
+			} else if len(rest) > 0 && rest != "@@@" {
+				out = append(out, rest)
+			}
+			continue
+		case inCode && !blockCode && (trimmed == "@@@" || strings.HasSuffix(trimmed, "</pre>")):
+			inCode = false
+			rest := strings.TrimSuffix(strings.TrimSuffix(line, "</pre>"), "</code>")
+			if len(strings.TrimSpace(rest)) > 0 && trimmed != "@@@" {
+				out = append(out, rest)
+			}
+			out = append(out, "```")
+			continue
+		case inCode && blockCode && len(trimmed) == 0:
+			inCode, blockCode = false, false
+			out = append(out, "```", "")
+			continue
+		case inCode:
+			out = append(out, line)
+			continue
+		case strings.HasPrefix(trimmed, "bc. "):
+			inCode, blockCode = true, true
+			out = append(out, "```", strings.TrimPrefix(trimmed, "bc. "))
+			continue
+		}
+
+		if textileTableRegexp.MatchString(line) {
+			cells := strings.Split(strings.Trim(trimmed, "|"), "|")
+			for i, cell := range cells {
+				cells[i] = textileInline(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cell), "_.")))
+			}
+			out = append(out, "| "+strings.Join(cells, " | ")+" |")
+			if !inTable {
+				seps := make([]string, len(cells))
+				for i := range seps {
+					seps[i] = "---"
+				}
+				out = append(out, "| "+strings.Join(seps, " | ")+" |")
+			}
+			inTable = true
+			continue
+		}
+		inTable = false
+
+		switch {
+		case textileHeadingRegexp.MatchString(line):
+			m := textileHeadingRegexp.FindStringSubmatch(line)
+			level := int(m[1][0] - '0')
+			line = strings.Repeat("#", level) + " " + textileInline(line[len(m[0]):])
+		case strings.HasPrefix(line, "bq. "):
+			line = "> " + textileInline(strings.TrimPrefix(line, "bq. "))
+		case strings.HasPrefix(line, "p. "):
+			line = textileInline(strings.TrimPrefix(line, "p. "))
+		case textileListRegexp.MatchString(line):
+			m := textileListRegexp.FindStringSubmatch(line)
+			marker := "-"
+			if strings.HasSuffix(m[1], "#") {
+				marker = "1."
+			}
+			line = strings.Repeat("  ", len(m[1])-1) + marker + " " + textileInline(line[len(m[0]):])
+		default:
+			line = textileInline(line)
+		}
+		out = append(out, line)
+	}
+	if inCode {
+		out = append(out, "```")
+	}
+	return strings.Join(out, "\n")
+}
+
+// textileInline converts the inline markup of a single line.
+func textileInline(line string) string {
+	// code spans, links and images are converted first and their
+	// contents protected from the remaining conversions
+	type span struct {
+		start, end int
+		md         string
+	}
+	spans := []span{}
+	taken := func(start, end int) bool {
+		for _, s := range spans {
+			if start < s.end && end > s.start {
+				return true
+			}
+		}
+		return false
+	}
+	for _, m := range textileCodeRegexp.FindAllStringSubmatchIndex(line, -1) {
+		spans = append(spans, span{m[0], m[1], "`" + line[m[2]:m[3]] + "`"})
+	}
+	for _, m := range textileImageRegexp.FindAllStringSubmatchIndex(line, -1) {
+		if taken(m[0], m[1]) {
+			continue
+		}
+		alt := ""
+		if m[4] >= 0 {
+			alt = line[m[4]:m[5]]
+		}
+		md := "![" + alt + "](" + line[m[2]:m[3]] + ")"
+		if m[6] >= 0 {
+			md = "[" + md + "](" + line[m[6]:m[7]] + ")"
+		}
+		spans = append(spans, span{m[0], m[1], md})
+	}
+	for _, m := range textileLinkRegexp.FindAllStringSubmatchIndex(line, -1) {
+		if taken(m[0], m[1]) {
+			continue
+		}
+		spans = append(spans, span{m[0], m[1], "[" + line[m[2]:m[3]] + "](" + line[m[4]:m[5]] + ")"})
+	}
+
+	emphasis := func(s string) string {
+		// matches consume the character following them, so
+		// adjacent matches need a second pass
+		for i := 0; i < 2; i++ {
+			s = textileBoldRegexp.ReplaceAllString(s, "$1**$2**$3")
+			s = textileDelRegexp.ReplaceAllString(s, "$1~~$2~~$3")
+		}
+		return s
+	}
+
+	b := &strings.Builder{}
+	prev := 0
+	for prev < len(line) {
+		next := -1
+		for i, s := range spans {
+			if s.start >= prev && (next < 0 || s.start < spans[next].start) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		b.WriteString(emphasis(line[prev:spans[next].start]))
+		b.WriteString(spans[next].md)
+		prev = spans[next].end
+	}
+	b.WriteString(emphasis(line[prev:]))
+	return b.String()
+}
+
+// writeMarkdown writes each ticket in v, which must be a
+// *tickets.Ticket or tickets.Tickets, as a GitHub Flavored Markdown
+// thread: the ticket's title, fields and body followed by each of
+// its versions' changes and comments, with links to attachments.
+func writeMarkdown(w io.Writer, v interface{}, opts *Options) error {
+	var ts tickets.Tickets
+	switch x := v.(type) {
+	case *tickets.Ticket:
+		ts = tickets.Tickets{x}
+	case tickets.Tickets:
+		ts = x
+	default:
+		return fmt.Errorf("md output is only supported for tickets, not %T", v)
+	}
+	bw := bufio.NewWriter(w)
+	for i, t := range ts {
+		if i > 0 {
+			fmt.Fprint(bw, "\n---\n\n")
+		}
+		writeTicketMarkdown(bw, t, opts)
+	}
+	return bw.Flush()
+}
+
+func writeTicketMarkdown(w io.Writer, t *tickets.Ticket, opts *Options) {
+	timeFormat := opts.TimeFormat
+	if len(timeFormat) == 0 {
+		timeFormat = TimeLocal
+	}
+
+	fmt.Fprintf(w, "# #%d %s\n\n", t.Number, t.Title)
+	fields := [][2]string{
+		{"State", t.State},
+		{"Assigned to", t.AssignedUserName},
+		{"Milestone", t.MilestoneTitle},
+		{"Tags", t.Tag},
+	}
+	for _, f := range fields {
+		if len(f[1]) > 0 {
+			fmt.Fprintf(w, "- **%s:** %s\n", f[0], f[1])
+		}
+	}
+	if len(t.URL) > 0 {
+		fmt.Fprintf(w, "- **Lighthouse:** %s\n", t.URL)
+	}
+
+	// attachments are listed with the version created at the same
+	// time, remaining attachments are listed at the end
+	attachments := []*tickets.Attachment{}
+	for _, a := range t.Attachments {
+		if a.Attachment != nil {
+			attachments = append(attachments, a.Attachment)
+		}
+	}
+	versionAttachments := func(v *tickets.TicketVersion) []*tickets.Attachment {
+		matched, rest := []*tickets.Attachment{}, []*tickets.Attachment{}
+		for _, a := range attachments {
+			if a.CreatedAt != nil && v.CreatedAt != nil && a.CreatedAt.Equal(v.CreatedAt.Time) {
+				matched = append(matched, a)
+			} else {
+				rest = append(rest, a)
+			}
+		}
+		attachments = rest
+		return matched
+	}
+
+	if len(t.Versions) == 0 {
+		if body := strings.TrimSpace(t.OriginalBody); len(body) > 0 {
+			fmt.Fprintf(w, "\n%s\n", TextileToMarkdown(body))
+		}
+	}
+	changelog := t.Versions.Changelog()
+	for i, v := range t.Versions {
+		when := ""
+		if v.CreatedAt != nil {
+			when = " on " + FormatTime(v.CreatedAt.Time, timeFormat)
+		}
+		who := v.UserName
+		if len(who) == 0 {
+			who = "Unknown user"
+		}
+		if i == 0 {
+			fmt.Fprintf(w, "\n**%s** opened this ticket%s\n", who, when)
+		} else {
+			fmt.Fprintf(w, "\n### %s commented%s\n", who, when)
+			if changes := versionChanges(changelog[i]); len(changes) > 0 {
+				fmt.Fprintln(w)
+				for _, change := range changes {
+					fmt.Fprintf(w, "- %s\n", change)
+				}
+			}
+		}
+		if body := strings.TrimSpace(v.Body); len(body) > 0 {
+			fmt.Fprintf(w, "\n%s\n", TextileToMarkdown(body))
+		}
+		writeAttachmentsMarkdown(w, versionAttachments(v))
+	}
+	if len(attachments) > 0 {
+		fmt.Fprint(w, "\n## Attachments\n")
+		writeAttachmentsMarkdown(w, attachments)
+	}
+}
+
+// versionChanges describes the changes made by a version, other
+// than its body which is rendered as a comment.
+func versionChanges(vc *tickets.VersionChanges) []string {
+	changes := []string{}
+	for _, c := range vc.Changes {
+		switch c.Attribute {
+		case tickets.AttributeTitle:
+			changes = append(changes, fmt.Sprintf("changed title from %q to %q", c.From, c.To))
+		case tickets.AttributeState:
+			changes = append(changes, fmt.Sprintf("changed state from %s to %s", c.From, c.To))
+		case tickets.AttributeAssignedUser:
+			changes = append(changes, "changed assigned user")
+		case tickets.AttributeMilestone:
+			changes = append(changes, "changed milestone")
+		case tickets.AttributeTag:
+			changes = append(changes, fmt.Sprintf("changed tags from %s to %s", c.From, c.To))
+		}
+	}
+	return changes
+}
+
+func writeAttachmentsMarkdown(w io.Writer, attachments []*tickets.Attachment) {
+	if len(attachments) == 0 {
+		return
+	}
+	fmt.Fprintln(w)
+	for _, a := range attachments {
+		if a.IsImage() {
+			fmt.Fprintf(w, "- ![%s](%s)\n", a.Filename, a.URL)
+		} else {
+			fmt.Fprintf(w, "- [%s](%s)\n", a.Filename, a.URL)
+		}
+	}
+}
@@ -0,0 +1,549 @@
+// Package output renders Lighthouse resources for the lh CLI as
+// JSON, tables, CSV, iCalendar feeds, Markdown or user-supplied
+// templates.
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/nwidger/jsoncolor"
+	"github.com/nwidger/lighthouse"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatTable    = "table"
+	FormatTemplate = "template"
+	FormatCSV      = "csv"
+	FormatICS      = "ics"
+	FormatMarkdown = "md"
+)
+
+// Formats lists the supported output formats.
+var Formats = []string{FormatJSON, FormatTable, FormatTemplate, FormatCSV, FormatICS, FormatMarkdown}
+
+const (
+	// TimeRelative displays times relative to now, i.e., '3
+	// days ago'.
+	TimeRelative = "relative"
+	// TimeRFC3339 displays times in RFC 3339 format in UTC.
+	TimeRFC3339 = "rfc3339"
+	// TimeLocal displays times in RFC 3339 format in the local
+	// time zone.
+	TimeLocal = "local"
+)
+
+type Options struct {
+	// Format is one of FormatJSON, FormatTable, FormatTemplate,
+	// FormatCSV, FormatICS or FormatMarkdown.  Defaults to
+	// FormatJSON.
+	Format string
+
+	// Template is the text/template used by FormatTemplate.  If
+	// v is a slice, the template is executed once for each
+	// element.
+	Template string
+
+	// Columns overrides the table columns used by FormatTable
+	// and FormatCSV.  Columns are referred to by their JSON field
+	// name.
+	Columns []string
+
+	// TimeFormat controls how times are displayed.  It is one of
+	// TimeRelative, TimeRFC3339, TimeLocal or a Go time layout
+	// string.  If empty, JSON output contains times as returned
+	// by Lighthouse, CSV output uses TimeRFC3339 and
+	// table/template output uses TimeLocal.
+	TimeFormat string
+
+	// Monochrome disables colorized JSON and table output.
+	Monochrome bool
+}
+
+// DefaultColumns maps struct type names to the columns displayed by
+// FormatTable.  Types not listed display all scalar fields.
+var DefaultColumns = map[string][]string{
+	"Bin":        {"id", "name", "query", "tickets_count", "updated_at"},
+	"Change":     {"kind", "change", "project", "id", "name", "fields", "versions"},
+	"Changeset":  {"revision", "committer", "title", "changed_at"},
+	"GrepMatch":  {"project_name", "number", "in", "version", "line", "text"},
+	"Member":     {"user_id", "name", "job", "role"},
+	"Membership": {"id", "user_id", "account"},
+	"Message":    {"id", "title", "user_name", "comments_count", "updated_at"},
+	"Milestone":  {"id", "title", "due_on", "open_tickets_count", "tickets_count"},
+	"Project":    {"id", "name", "open_tickets_count", "archived", "public"},
+	"Reminder":   {"project_name", "title", "due_on", "days_left", "open_tickets_count"},
+	"Result":     {"project_name", "number", "state", "title", "score", "updated_at"},
+	"Ticket":     {"number", "state", "title", "assigned_user_name", "milestone_title", "updated_at"},
+	"Token":      {"token", "note", "read_only", "created_at"},
+	"User":       {"id", "name", "job"},
+
+	"TicketVersionSummary": {"version", "user_name", "created_at", "summary"},
+}
+
+// Write writes v to w according to opts.
+func Write(w io.Writer, v interface{}, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	switch opts.Format {
+	case "", FormatJSON:
+		return writeJSON(w, v, opts)
+	case FormatTable:
+		return writeTable(w, v, opts)
+	case FormatTemplate:
+		return writeTemplate(w, v, opts)
+	case FormatCSV:
+		return writeCSV(w, v, opts)
+	case FormatICS:
+		return writeICS(w, v, opts)
+	case FormatMarkdown:
+		return writeMarkdown(w, v, opts)
+	}
+	return fmt.Errorf("unknown output format %q, expected one of %s", opts.Format, strings.Join(Formats, ", "))
+}
+
+// FormatTime formats t according to format, see
+// Options.TimeFormat.
+func FormatTime(t time.Time, format string) string {
+	if t.IsZero() {
+		return ""
+	}
+	switch format {
+	case TimeRelative:
+		return relative(t, time.Now())
+	case TimeRFC3339:
+		return t.UTC().Format(time.RFC3339)
+	case "", TimeLocal:
+		return t.Local().Format(time.RFC3339)
+	}
+	return t.Format(format)
+}
+
+func relative(t, now time.Time) string {
+	d := now.Sub(t)
+	suffix := "ago"
+	if d < 0 {
+		d = -d
+		suffix = "from now"
+	}
+	var n int
+	var unit string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		n, unit = int(d/time.Minute), "minute"
+	case d < 24*time.Hour:
+		n, unit = int(d/time.Hour), "hour"
+	case d < 30*24*time.Hour:
+		n, unit = int(d/(24*time.Hour)), "day"
+	case d < 365*24*time.Hour:
+		n, unit = int(d/(30*24*time.Hour)), "month"
+	default:
+		n, unit = int(d/(365*24*time.Hour)), "year"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s %s", n, unit, suffix)
+}
+
+func writeJSON(w io.Writer, v interface{}, opts *Options) error {
+	if len(opts.TimeFormat) > 0 {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var generic interface{}
+		dec := json.NewDecoder(bytes.NewReader(buf))
+		dec.UseNumber()
+		err = dec.Decode(&generic)
+		if err != nil {
+			return err
+		}
+		v = reformatTimes(generic, opts.TimeFormat)
+	}
+	marshalIndent := jsoncolor.MarshalIndent
+	if opts.Monochrome {
+		marshalIndent = json.MarshalIndent
+	}
+	buf, err := marshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+	_, err = w.Write(buf)
+	return err
+}
+
+// reformatTimes walks a decoded JSON value reformatting the RFC 3339
+// timestamp strings of timestamp keys, see isTimeKey.
+func reformatTimes(v interface{}, format string) interface{} {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		for k, e := range vv {
+			if str, ok := e.(string); ok {
+				if isTimeKey(k) {
+					vv[k] = reformatTime(str, format)
+				}
+				continue
+			}
+			vv[k] = reformatTimes(e, format)
+		}
+	case []interface{}:
+		for i, e := range vv {
+			vv[i] = reformatTimes(e, format)
+		}
+	}
+	return v
+}
+
+// isTimeKey reports whether the JSON key k holds a timestamp, i.e.,
+// created_at or due_on.
+func isTimeKey(k string) bool {
+	return strings.HasSuffix(k, "_at") || strings.HasSuffix(k, "_on")
+}
+
+// reformatTime reformats str if it is a timestamp in one of
+// lighthouse.TimeLayouts, otherwise it is returned unchanged.
+func reformatTime(str, format string) string {
+	t, err := lighthouse.ParseTime(str)
+	if err != nil {
+		return str
+	}
+	return FormatTime(t.Time, format)
+}
+
+// elements returns the elements of v if v is a slice or array,
+// otherwise v itself.
+func elements(v interface{}) []reflect.Value {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		es := make([]reflect.Value, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			es = append(es, rv.Index(i))
+		}
+		return es
+	}
+	return []reflect.Value{rv}
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+var (
+	timeType           = reflect.TypeOf(time.Time{})
+	lighthouseTimeType = reflect.TypeOf(lighthouse.Time{})
+)
+
+// timeValue returns the time held by v if it is a time.Time or a
+// lighthouse.Time.
+func timeValue(v reflect.Value) (time.Time, bool) {
+	switch v.Type() {
+	case timeType:
+		return v.Interface().(time.Time), true
+	case lighthouseTimeType:
+		return v.Interface().(lighthouse.Time).Time, true
+	}
+	return time.Time{}, false
+}
+
+// fields maps JSON field names to struct field indexes for t,
+// including fields of embedded structs.
+func fields(t reflect.Type) (names []string, index map[string][]int) {
+	index = map[string][]int{}
+	var walk func(t reflect.Type, prefix []int)
+	walk = func(t reflect.Type, prefix []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			idx := append(append([]int{}, prefix...), i)
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if f.Anonymous && ft.Kind() == reflect.Struct {
+				walk(ft, idx)
+				continue
+			}
+			if len(f.PkgPath) > 0 {
+				continue
+			}
+			name := f.Name
+			if tag := f.Tag.Get("json"); len(tag) > 0 {
+				tag = strings.Split(tag, ",")[0]
+				if tag == "-" {
+					continue
+				}
+				if len(tag) > 0 {
+					name = tag
+				}
+			}
+			if _, ok := index[name]; ok {
+				continue
+			}
+			index[name] = idx
+			if isScalar(ft) {
+				names = append(names, name)
+			}
+		}
+	}
+	walk(t, nil)
+	return names, index
+}
+
+func isScalar(t reflect.Type) bool {
+	if t == timeType || t == lighthouseTimeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		v = indirect(v)
+		if !v.IsValid() {
+			return v
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+func cell(v reflect.Value, timeFormat string) string {
+	v = indirect(v)
+	if !v.IsValid() {
+		return ""
+	}
+	if tm, ok := timeValue(v); ok {
+		return FormatTime(tm, timeFormat)
+	}
+	s := fmt.Sprint(v.Interface())
+	s = strings.Join(strings.Fields(s), " ")
+	return s
+}
+
+// ANSI color escape codes.  All codes are the same length so that
+// tabwriter, which counts escape codes towards column widths, keeps
+// colorized columns aligned.
+const (
+	colorReset  = "\x1b[0m"
+	colorNone   = "\x1b[00m"
+	colorFaint  = "\x1b[02m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+)
+
+// columnColors maps JSON field names to functions returning the
+// color of a table cell in that column.  field returns the value of
+// the named field in the cell's row.
+var columnColors = map[string]func(value string, field func(name string) reflect.Value) string{
+	"state": func(value string, field func(name string) reflect.Value) string {
+		closed := indirect(field("closed"))
+		if !closed.IsValid() || closed.Kind() != reflect.Bool {
+			return colorNone
+		}
+		if closed.Bool() {
+			return colorFaint
+		}
+		return colorGreen
+	},
+	"importance_name": func(value string, field func(name string) reflect.Value) string {
+		value = strings.ToLower(value)
+		switch {
+		case strings.Contains(value, "critical"), strings.Contains(value, "urgent"), strings.Contains(value, "high"):
+			return colorRed
+		case strings.Contains(value, "medium"), strings.Contains(value, "normal"):
+			return colorYellow
+		case strings.Contains(value, "low"):
+			return colorFaint
+		}
+		return colorNone
+	},
+}
+
+func colorize(color, s string) string {
+	return color + s + colorReset
+}
+
+// elementType returns the type of the first non-nil element of es.
+func elementType(es []reflect.Value) reflect.Type {
+	for _, e := range es {
+		e = indirect(e)
+		if e.IsValid() {
+			return e.Type()
+		}
+	}
+	return nil
+}
+
+// tableColumns returns the columns displayed for struct type t by
+// FormatTable and FormatCSV and the index of every field of t.
+func tableColumns(t reflect.Type, opts *Options) ([]string, map[string][]int, error) {
+	names, index := fields(t)
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = DefaultColumns[t.Name()]
+	}
+	if len(columns) == 0 {
+		columns = names
+	}
+	for _, c := range columns {
+		if _, ok := index[c]; !ok {
+			valid := append([]string{}, names...)
+			sort.Strings(valid)
+			return nil, nil, fmt.Errorf("unknown column %q, expected one of %s", c, strings.Join(valid, ", "))
+		}
+	}
+	return columns, index, nil
+}
+
+func writeTable(w io.Writer, v interface{}, opts *Options) error {
+	es := elements(v)
+
+	t := elementType(es)
+	if t == nil {
+		return nil
+	}
+	if t.Kind() != reflect.Struct {
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		for _, e := range es {
+			fmt.Fprintln(tw, cell(e, opts.TimeFormat))
+		}
+		return tw.Flush()
+	}
+
+	columns, index, err := tableColumns(t, opts)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	header := make([]string, 0, len(columns))
+	for _, c := range columns {
+		header = append(header, strings.ToUpper(c))
+	}
+	if !opts.Monochrome {
+		for i, c := range columns {
+			if _, ok := columnColors[c]; ok {
+				header[i] = colorize(colorNone, header[i])
+			}
+		}
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, e := range es {
+		field := func(name string) reflect.Value {
+			idx, ok := index[name]
+			if !ok {
+				return reflect.Value{}
+			}
+			return fieldByIndex(e, idx)
+		}
+		row := make([]string, 0, len(columns))
+		for _, c := range columns {
+			value := cell(field(c), opts.TimeFormat)
+			if color, ok := columnColors[c]; ok && !opts.Monochrome {
+				value = colorize(color(value, field), value)
+			}
+			row = append(row, value)
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// TemplateFuncs returns the functions available to templates.  The
+// 'time' function formats a time.Time, lighthouse.Time or pointer to
+// either according to timeFormat and 'json' marshals its argument as
+// JSON.
+func TemplateFuncs(timeFormat string) template.FuncMap {
+	return template.FuncMap{
+		"time": func(v interface{}) string {
+			return cell(reflect.ValueOf(v), timeFormat)
+		},
+		"json": func(v interface{}) (string, error) {
+			buf, err := json.Marshal(v)
+			return string(buf), err
+		},
+	}
+}
+
+func writeTemplate(w io.Writer, v interface{}, opts *Options) error {
+	if len(opts.Template) == 0 {
+		return fmt.Errorf("must supply template")
+	}
+	tmpl, err := template.New("output").Funcs(TemplateFuncs(opts.TimeFormat)).Parse(opts.Template)
+	if err != nil {
+		return err
+	}
+	for _, e := range elements(v) {
+		err = tmpl.Execute(w, e.Interface())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func writeCSV(w io.Writer, v interface{}, opts *Options) error {
+	es := elements(v)
+	timeFormat := opts.TimeFormat
+	if len(timeFormat) == 0 {
+		timeFormat = TimeRFC3339
+	}
+
+	t := elementType(es)
+	if t == nil {
+		return nil
+	}
+	cw := csv.NewWriter(w)
+	if t.Kind() != reflect.Struct {
+		for _, e := range es {
+			cw.Write([]string{cell(e, timeFormat)})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	columns, index, err := tableColumns(t, opts)
+	if err != nil {
+		return err
+	}
+	cw.Write(columns)
+	for _, e := range es {
+		row := make([]string, 0, len(columns))
+		for _, c := range columns {
+			row = append(row, cell(fieldByIndex(e, index[c]), timeFormat))
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
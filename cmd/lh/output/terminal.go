@@ -0,0 +1,72 @@
+package output
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// IsTerminal reports whether f appears to be a terminal.
+func IsTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// NoColor reports whether the NO_COLOR environment variable is set,
+// see https://no-color.org.
+func NoColor() bool {
+	_, ok := os.LookupEnv("NO_COLOR")
+	return ok
+}
+
+// Pager is an io.WriteCloser which writes to the standard input of
+// a pager process such as less(1).
+type Pager struct {
+	cmd *exec.Cmd
+	w   io.WriteCloser
+}
+
+// StartPager starts command, which is run by the shell, with its
+// standard out and standard error connected to stdout.  Like git,
+// if LESS is not set in the environment it is set to 'FRX' so less
+// passes colors through and exits immediately if the output fits
+// on one screen.
+func StartPager(command string, stdout *os.File) (*Pager, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		args := strings.Fields(command)
+		cmd = exec.Command(args[0], args[1:]...)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", command)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	return &Pager{cmd: cmd, w: w}, nil
+}
+
+func (p *Pager) Write(b []byte) (int, error) {
+	return p.w.Write(b)
+}
+
+// Close closes the pager's standard input and waits for it to exit.
+func (p *Pager) Close() error {
+	p.w.Close()
+	return p.cmd.Wait()
+}
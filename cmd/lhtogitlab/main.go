@@ -2,25 +2,31 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
-	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
-	"github.com/mholt/archiver"
 	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/export"
 	"github.com/nwidger/lighthouse/milestones"
 	"github.com/nwidger/lighthouse/profiles"
 	"github.com/nwidger/lighthouse/projects"
@@ -38,8 +44,42 @@ var (
 	issuesMap     = map[int]*gitlab.Issue{}
 
 	groupsMap = map[string]*gitlab.Group{}
+
+	// iidOffset is added to Lighthouse ticket numbers to compute
+	// GitLab issue IID's.
+	iidOffset = 0
+
+	// revisionURLs maps Lighthouse project ID's to revision URL
+	// templates used to link changeset revisions in ticket
+	// comments, see changesets.RevisionURL.
+	revisionURLs = map[int]string{}
+
+	// issueMapping, if non-nil, computes the title, description
+	// and additional labels of migrated issues, see -issue-templates.
+	issueMapping *issueTemplates
+
+	// stateMapping is how Lighthouse ticket states are mapped to
+	// GitLab, one of the stateMapping constants, see
+	// -state-mapping.
+	stateMapping = stateMappingScopedLabels
+
+	// lhAccount is the name of the Lighthouse account being
+	// migrated, used to link migrated issues to their original
+	// tickets.
+	lhAccount = ""
+
+	// atExit contains functions which must be run before exiting,
+	// even if interrupted.
+	atExit []func()
 )
 
+func runAtExit() {
+	for i := len(atExit) - 1; i >= 0; i-- {
+		atExit[i]()
+	}
+	atExit = nil
+}
+
 func main() {
 	export := ""
 	token := ""
@@ -53,6 +93,23 @@ func main() {
 	delete := false
 	stateKey := "lh"
 	insecure := false
+	quiet := false
+	mappingPath := ""
+	allowRenumber := false
+	metadataPath := ""
+	rolesPath := ""
+	revisionURLsPath := ""
+	rawJSON := ""
+	rawJSONDir := "lighthouse/tickets"
+	reportPath := ""
+	verbose := false
+	debug := false
+	wiki := false
+	previous := ""
+	issueTemplatesPath := ""
+	ci := os.Getenv("CI") == "true"
+	failOn := ""
+	artifactsDir := ""
 
 	flag.StringVar(&token, "token", token, "GitLab API token to use")
 	flag.StringVar(&baseURL, "base-url", baseURL, "GitLab base URL to use (i.e., https://gitlab.example.com/)")
@@ -62,13 +119,43 @@ func main() {
 	flag.StringVar(&project, "project", project, "Only migrate projects with the given name (useful for testing)")
 	flag.StringVar(&milestone, "milestone", milestone, "Only migrate milestones with the given title (useful for testing)")
 	flag.StringVar(&stateKey, "state-key", stateKey, "Scoped label key used to map Lighthouse ticket states to GitLab scoped labels")
+	flag.StringVar(&stateMapping, "state-mapping", stateMapping, "How Lighthouse ticket states are mapped to GitLab (scoped-labels, labels, close-only or board-lists)")
 	flag.IntVar(&number, "number", number, "Only migrate tickets with the given number (useful for testing)")
 	flag.BoolVar(&delete, "delete", delete, "Do not import, delete all GitLab projects, groups and users (except root user and user owning API token -token) and then exit")
 	flag.BoolVar(&insecure, "insecure", insecure, "Allow insecure HTTPS connections to GitLab API")
+	flag.BoolVar(&quiet, "quiet", quiet, "Disable notification emails for all mapped GitLab users during import, restoring their notification settings afterwards")
+	flag.IntVar(&iidOffset, "iid-offset", iidOffset, "Offset added to Lighthouse ticket numbers to compute GitLab issue IID's")
+	flag.StringVar(&mappingPath, "mapping", mappingPath, "Path to JSON file to write mapping of Lighthouse ticket numbers to GitLab issue IID's")
+	flag.BoolVar(&allowRenumber, "allow-renumber", allowRenumber, "Allow importing with a non-administrator API token, which causes GitLab to renumber issues")
+	flag.StringVar(&rolesPath, "roles", rolesPath, "Path to JSON file mapping Lighthouse membership roles and users to GitLab access levels (guest, reporter, developer or maintainer)")
+	flag.StringVar(&revisionURLsPath, "revision-urls", revisionURLsPath, "Path to JSON file mapping Lighthouse project names to revision URL templates used to link changeset revisions")
+	flag.StringVar(&metadataPath, "metadata", metadataPath, "Path to JSON file mapping Lighthouse project metadata fields to where they are recorded in GitLab (description, label, attribute or ignore)")
+	flag.StringVar(&rawJSON, "raw-json", rawJSON, "Preserve each ticket's original ticket.json, including its version history, as an issue attachment (attachment) or a file committed to the project repository (repository)")
+	flag.StringVar(&rawJSONDir, "raw-json-dir", rawJSONDir, "Repository directory used by -raw-json repository")
+	flag.StringVar(&reportPath, "report", reportPath, "Path to JSON file to write report of API calls, failures and durations per phase and project")
+	flag.BoolVar(&verbose, "verbose", verbose, "Log the method, URL, status and latency of each GitLab API request to standard error")
+	flag.BoolVar(&debug, "debug", debug, "Like -verbose, but also log request and response bodies")
+	flag.StringVar(&previous, "previous", previous, "Path to the Lighthouse export file migrated by an earlier run, only migrate what changed since (requires the -mapping file written by that run)")
+	flag.StringVar(&issueTemplatesPath, "issue-templates", issueTemplatesPath, "Path to JSON file of Go templates computing the title, description and additional labels of each issue from its Lighthouse ticket")
+	flag.BoolVar(&wiki, "wiki", wiki, "Generate wiki pages summarizing each project's description, license and migrated milestones")
+	flag.BoolVar(&ci, "ci", ci, "Run non-interactively in a CI job, logging progress and failures to standard error as JSON (default true if $CI is true)")
+	flag.StringVar(&failOn, "fail-on", failOn, "Exit with a non-zero status code if a failure of the given severity or worse occurs (warning, error or never, default error with -ci and never otherwise)")
+	flag.StringVar(&artifactsDir, "artifacts-dir", artifactsDir, "Directory to write the -mapping and -report files to by default, as mapping.json and report.json")
+
+	err := flagsFromEnv(flag.CommandLine)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n", err)
+		flag.Usage()
+		os.Exit(1)
+	}
 
 	flag.Parse()
 
-	if len(flag.Args()) != 1 {
+	if len(flag.Args()) == 0 && len(os.Getenv(envPrefix+"EXPORT")) > 0 {
+		export = os.Getenv(envPrefix + "EXPORT")
+	} else if len(flag.Args()) == 1 {
+		export = flag.Arg(0)
+	} else {
 		fmt.Fprintf(os.Stderr, "Must specify path to Lighthouse export file\n\n")
 		flag.Usage()
 		os.Exit(1)
@@ -104,17 +191,96 @@ func main() {
 		os.Exit(1)
 	}
 
+	switch stateMapping {
+	case stateMappingScopedLabels, stateMappingLabels, stateMappingCloseOnly, stateMappingBoardLists:
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid -state-mapping %q, must be %s, %s, %s or %s\n\n", stateMapping,
+			stateMappingScopedLabels, stateMappingLabels, stateMappingCloseOnly, stateMappingBoardLists)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if rawJSON != "" && rawJSON != rawJSONAttachment && rawJSON != rawJSONRepository {
+		fmt.Fprintf(os.Stderr, "Invalid -raw-json %q, must be %s or %s\n\n", rawJSON, rawJSONAttachment, rawJSONRepository)
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if len(artifactsDir) > 0 {
+		if len(mappingPath) == 0 {
+			mappingPath = filepath.Join(artifactsDir, "mapping.json")
+		}
+		if len(reportPath) == 0 {
+			reportPath = filepath.Join(artifactsDir, "report.json")
+		}
+	}
+
+	if len(previous) > 0 && len(mappingPath) == 0 {
+		fmt.Fprintf(os.Stderr, "Must specify mapping file written by the earlier run via -mapping when using -previous\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if len(failOn) == 0 {
+		failOn = "never"
+		if ci {
+			failOn = "error"
+		}
+	}
+	failSeverity, ok := severities[failOn]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Invalid -fail-on %q, must be warning, error or never\n\n", failOn)
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	if !strings.HasSuffix(baseURL, "/") {
 		baseURL += "/"
 	}
 
-	export = flag.Arg(0)
+	if ci {
+		ciLogger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+		log.SetFlags(0)
+		log.SetOutput(ciLogWriter{})
+	}
+
+	if len(artifactsDir) > 0 {
+		err = os.MkdirAll(artifactsDir, 0755)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	exp, tempDir, err := readLHExport(export)
+	exp, cleanup, err := readLHExport(export, !delete, len(rawJSON) > 0)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer os.RemoveAll(tempDir)
+	defer cleanup()
+	lhAccount = exp.account
+
+	// with -previous, projects migrated by the earlier run are
+	// updated rather than created, see lhDelta
+	var (
+		delta           *lhDelta
+		previousMapping = map[int]*projectMapping{}
+		mapping         []*projectMapping
+	)
+	if len(previous) > 0 {
+		// only the metadata of the previous export is compared
+		prevExp, prevCleanup, err := readLHExport(previous, false, false)
+		if err != nil {
+			log.Fatal(err)
+		}
+		prevCleanup()
+		delta = newLHDelta(prevExp, exp)
+		mapping, err = readMapping(mappingPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, pm := range mapping {
+			previousMapping[pm.LighthouseProjectID] = pm
+		}
+	}
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
@@ -123,20 +289,44 @@ func main() {
 	go func(c chan os.Signal) {
 		<-c
 		signal.Reset(os.Interrupt)
-		if len(tempDir) > 0 {
-			os.RemoveAll(tempDir)
-		}
+		runAtExit()
+		cleanup()
 		os.Exit(1)
 	}(c)
 
-	var client *http.Client
+	var base http.RoundTripper = http.DefaultTransport
 	if insecure {
-		client = &http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
+		base = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	if verbose || debug {
+		level := slog.LevelInfo
+		if debug {
+			level = slog.LevelDebug
+		}
+		var handler slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+		if ci {
+			handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
 		}
+		logger := slog.New(handler)
+		base = lighthouse.LogMiddleware(logger, debug)(base)
 	}
+	client := &http.Client{
+		Transport: &perfTransport{base: base},
+	}
+
+	if len(reportPath) > 0 {
+		atExit = append(atExit, func() {
+			perf.end()
+			err := writeReport(reportPath, perf)
+			if err != nil {
+				logFailure(severityError, "unable to write report file", reportPath, err)
+			}
+		})
+		defer runAtExit()
+	}
+	perf.begin("setup", "")
 
 	git := gitlab.NewClient(client, token)
 	err = git.SetBaseURL(baseURL)
@@ -155,7 +345,7 @@ func main() {
 			log.Fatal(err)
 		}
 		for _, g := range gs {
-			fmt.Println("deleting group", g.Name)
+			logProgress("deleting group", g.Name)
 			_, err = git.Groups.DeleteGroup(g.ID)
 			if err != nil {
 				log.Fatal(err)
@@ -166,7 +356,7 @@ func main() {
 			log.Fatal(err)
 		}
 		for _, p := range ps {
-			fmt.Println("deleting project", p.Name)
+			logProgress("deleting project", p.Name)
 			_, err = git.Projects.DeleteProject(p.ID)
 			if err != nil {
 				log.Fatal(err)
@@ -180,7 +370,7 @@ func main() {
 			if u.Username == "root" || u.Username == me.Username {
 				continue
 			}
-			fmt.Println("deleting user", u.Username)
+			logProgress("deleting user", u.Username)
 			git.Users.DeleteUser(u.ID)
 			if err != nil {
 				log.Fatal(err)
@@ -203,19 +393,24 @@ func main() {
 		log.Fatal(err)
 	}
 
+	perf.begin("users", "")
 	for _, lhUser := range exp.users.list {
+		if delta != nil && !delta.newUser(lhUser.ID) {
+			continue
+		}
 		userOpt, options, ok := lhUserToCreateUser(lhUser, password)
 		if !ok {
 			continue
 		}
-		fmt.Println("creating user", *userOpt.Username)
+		logProgress("creating user", *userOpt.Username)
 		u, _, err := git.Users.CreateUser(userOpt, options...)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "unable to create user", lhUser.Name, err)
+			logFailure(severityError, "unable to create user", lhUser.Name, err)
 			continue
 		}
 		usersMap[lhUser.ID] = u
 		usersNameMap[lhUser.Name] = u
+		perf.item()
 	}
 
 	us, _, err := git.Users.ListUsers(&gitlab.ListUsersOptions{})
@@ -250,8 +445,126 @@ func main() {
 		}
 	}
 
+	if len(revisionURLsPath) > 0 {
+		f, err = os.Open(revisionURLsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		templates := map[string]string{}
+		dec = json.NewDecoder(f)
+		err = dec.Decode(&templates)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for name, template := range templates {
+			found := false
+			for _, lhProject := range exp.projects.list {
+				if strings.EqualFold(lhProject.Name, name) {
+					revisionURLs[lhProject.ID] = template
+					found = true
+				}
+			}
+			if !found {
+				log.Fatalf("no such Lighthouse project %q in -revision-urls", name)
+			}
+		}
+	}
+
+	metadata := projectMetadataMapping{}
+	for field, target := range defaultProjectMetadataMapping {
+		metadata[field] = target
+	}
+	if len(metadataPath) > 0 {
+		f, err = os.Open(metadataPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		dec = json.NewDecoder(f)
+		err = dec.Decode(&metadata)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = metadata.validate()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	roles := &roleMapping{
+		Default: defaultRoleMapping.Default,
+		Roles:   map[string]string{},
+		Users:   map[string]string{},
+	}
+	for role, level := range defaultRoleMapping.Roles {
+		roles.Roles[role] = level
+	}
+	if len(rolesPath) > 0 {
+		f, err = os.Open(rolesPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		dec = json.NewDecoder(f)
+		err = dec.Decode(roles)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = roles.validate()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if len(issueTemplatesPath) > 0 {
+		issueMapping, err = readIssueTemplates(issueTemplatesPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// GitLab silently ignores the IID of new issues unless the
+	// API token belongs to an administrator
+	if !me.IsAdmin && !allowRenumber {
+		log.Fatal("API token does not belong to an administrator, GitLab will not preserve Lighthouse ticket numbers as issue IID's (use -allow-renumber to import anyway)")
+	}
+
+	if len(mappingPath) > 0 {
+		atExit = append(atExit, func() {
+			err := writeMapping(mappingPath, mapping)
+			if err != nil {
+				logFailure(severityError, "unable to write mapping file", mappingPath, err)
+			}
+		})
+		defer runAtExit()
+	}
+
+	if quiet {
+		perf.begin("notifications", "")
+		restore := disableNotifications(git, me)
+		atExit = append(atExit, restore)
+		defer runAtExit()
+	}
+
+	perf.begin("groups", "")
 	for _, group := range groups {
-		fmt.Println("creating group", group.Name)
+		if delta != nil {
+			g, _, err := git.Groups.GetGroup(group.Path)
+			if err == nil {
+				for _, lhProjectName := range group.Projects {
+					groupsMap[projects.SanitizeName(lhProjectName)] = g
+				}
+				continue
+			}
+		}
+		logProgress("creating group", group.Name)
 		g, _, err := git.Groups.CreateGroup(&gitlab.CreateGroupOptions{
 			Name:        gitlab.String(group.Name),
 			Path:        gitlab.String(group.Path),
@@ -259,11 +572,12 @@ func main() {
 			Visibility:  gitlab.Visibility(gitlab.PrivateVisibility),
 		})
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "unable to create group", group.Name, err)
+			logFailure(severityError, "unable to create group", group.Name, err)
 			continue
 		}
+		perf.item()
 		for _, lhProjectName := range group.Projects {
-			groupsMap[sanitizeProjectName(lhProjectName)] = g
+			groupsMap[projects.SanitizeName(lhProjectName)] = g
 		}
 		for _, member := range group.Members {
 			u, ok := userByUsername(member)
@@ -275,7 +589,7 @@ func main() {
 				AccessLevel: gitlab.AccessLevel(gitlab.MaintainerPermissions),
 			})
 			if err != nil {
-				fmt.Fprintln(os.Stderr, "unable to add", member, "to group", group.Name, err)
+				logFailure(severityWarning, "unable to add", member, "to group", group.Name, err)
 			}
 		}
 	}
@@ -284,239 +598,1350 @@ func main() {
 		if len(project) > 0 && !strings.EqualFold(lhProject.Name, project) {
 			continue
 		}
-		projectOpt, options, ok := lhProjectToCreateProject(lhProject)
+		lhMetadata := lhProjectToMetadata(lhProject)
+		projectOpt, options, ok := lhProjectToCreateProject(lhProject, lhMetadata, metadata)
 		if !ok {
 			continue
 		}
-		fmt.Println("creating project", *projectOpt.Name)
-		p, _, err := git.Projects.CreateProject(projectOpt, options...)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "unable to create project", lhProject.Name, err)
-			continue
-		}
-		projectsMap[lhProject.ID] = p
+		perf.begin("project", lhProject.Name)
+		pm, migrated := previousMapping[lhProject.ID]
+		var p *gitlab.Project
+		if migrated {
+			logProgress("updating project", lhProject.Name)
+			p, _, err = git.Projects.GetProject(pm.GitLabProjectID, nil)
+			if err != nil {
+				logFailure(severityError, "unable to get project", lhProject.Name, err)
+				continue
+			}
+			projectsMap[lhProject.ID] = p
+		} else {
+			logProgress("creating project", *projectOpt.Name)
+			p, _, err = git.Projects.CreateProject(projectOpt, options...)
+			if err != nil {
+				logFailure(severityError, "unable to create project", lhProject.Name, err)
+				continue
+			}
+			projectsMap[lhProject.ID] = p
+			perf.item()
+
+			pm = &projectMapping{
+				LighthouseProjectID: lhProject.ID,
+				LighthouseProject:   lhProject.Name,
+				GitLabProjectID:     p.ID,
+				GitLabProject:       p.PathWithNamespace,
+				Tickets:             map[int]int{},
+			}
+			mapping = append(mapping, pm)
 
-		labelOpts, options, ok := lhProjectToCreateLabels(lhProject, stateKey)
-		if ok {
-			for _, labelOpt := range labelOpts {
-				_, _, err = git.Labels.CreateLabel(p.ID, labelOpt, options...)
+			labelOpts, options, ok := lhProjectToCreateLabels(lhProject, stateKey)
+			if ok {
+				labelIDs := map[string]int{}
+				for _, labelOpt := range labelOpts {
+					label, _, err := git.Labels.CreateLabel(p.ID, labelOpt, options...)
+					if err != nil {
+						logFailure(severityWarning, "unable to create label", labelOpt.Name, "in project", lhProject.Name, err)
+						continue
+					}
+					labelIDs[label.Name] = label.ID
+				}
+				if stateMapping == stateMappingBoardLists {
+					createStateBoardLists(git, p, lhProject, stateKey, labelIDs)
+				}
+			}
+
+			for _, labelOpt := range lhProjectMetadataToCreateLabels(lhMetadata, metadata) {
+				_, _, err = git.Labels.CreateLabel(p.ID, labelOpt)
+				if err != nil {
+					logFailure(severityWarning, "unable to create label", *labelOpt.Name, "in project", lhProject.Name, err)
+				}
+			}
+
+			for _, attr := range lhProjectMetadataToCustomAttributes(lhMetadata, metadata) {
+				_, _, err = git.CustomAttribute.SetCustomProjectAttribute(p.ID, attr)
 				if err != nil {
-					fmt.Fprintln(os.Stderr, "unable to create label", labelOpt.Name, "in project", lhProject.Name, err)
+					logFailure(severityWarning, "unable to set custom attribute", attr.Key, "on project", lhProject.Name, err)
+				}
+			}
+
+			for _, lhMembership := range lhProject.memberships {
+				memberOpt, options, ok := lhMembershipToAddProjectMember(lhMembership, roles)
+				if !ok {
 					continue
 				}
+				_, _, err = git.ProjectMembers.AddProjectMember(p.ID, memberOpt, options...)
+				if err != nil {
+					logFailure(severityWarning, "unable to add", lhMembership.User.Name, "to project", lhProject.Name, err)
+				}
 			}
 		}
 
-		for _, lhMembership := range lhProject.memberships {
-			memberOpt, options, ok := lhMembershipToAddProjectMember(lhMembership)
-			if !ok {
+		perf.begin("milestones", lhProject.Name)
+		if migrated {
+			existing, err := existingMilestones(git, p.ID)
+			if err != nil {
+				logFailure(severityError, "unable to list milestones in project", lhProject.Name, err)
 				continue
 			}
-			_, _, err = git.ProjectMembers.AddProjectMember(p.ID, memberOpt, options...)
-			if err != nil {
-				fmt.Fprintln(os.Stderr, "unable to add", lhMembership.User.Name, "to project", lhProject.Name, err)
+			for _, lhMilestone := range lhProject.milestones.list {
+				if prev, _ := delta.milestone(lhMilestone); prev != nil {
+					if m, ok := existing[prev.Title]; ok {
+						milestonesMap[lhMilestone.ID] = m
+					}
+				}
 			}
 		}
-
 		for _, lhMilestone := range lhProject.milestones.list {
 			if len(milestone) > 0 && !strings.EqualFold(lhMilestone.Title, milestone) {
 				continue
 			}
+			if migrated {
+				_, changed := delta.milestone(lhMilestone)
+				if !changed {
+					continue
+				}
+				if m, ok := milestonesMap[lhMilestone.ID]; ok {
+					updateMilestoneOpt, options, ok := lhMilestoneToUpdateChangedMilestone(lhMilestone)
+					if !ok {
+						continue
+					}
+					logProgress("updating milestone", lhMilestone.Title)
+					_, _, err = git.Milestones.UpdateMilestone(p.ID, m.ID, updateMilestoneOpt, options...)
+					if err != nil {
+						logFailure(severityError, "unable to update milestone", lhMilestone.Title, "in project", lhProject.Name, err)
+						continue
+					}
+					perf.item()
+					continue
+				}
+			}
 			createMilestoneOpt, options, ok := lhMilestoneToCreateMilestone(lhMilestone)
 			if !ok {
 				continue
 			}
-			fmt.Println("creating milestone", *createMilestoneOpt.Title)
+			for _, lhAttachment := range lhProject.milestones.attachments[lhMilestone.ID] {
+				file, options, ok := lhAttachmentToUploadFile(lhAttachment)
+				if !ok {
+					continue
+				}
+				pf, _, err := git.Projects.UploadFile(p.ID, file, options...)
+				if err != nil {
+					logFailure(severityWarning, "unable to upload attachment", lhAttachment.Filename, "for milestone", lhMilestone.Title, "in project", lhProject.Name, err)
+					continue
+				}
+				*createMilestoneOpt.Description += "\n\n" + pf.Markdown
+			}
+			logProgress("creating milestone", *createMilestoneOpt.Title)
 			m, _, err := git.Milestones.CreateMilestone(p.ID, createMilestoneOpt, options...)
 			if err != nil {
-				fmt.Fprintln(os.Stderr, "unable to create milestone", lhMilestone.Title, "in project", lhProject.Name, err)
+				logFailure(severityError, "unable to create milestone", lhMilestone.Title, "in project", lhProject.Name, err)
 				continue
 			}
 			milestonesMap[lhMilestone.ID] = m
+			perf.item()
 
 			updateMilestoneOpt, options, ok := lhMilestoneToUpdateMilestone(lhMilestone)
 			if ok {
 				_, _, err = git.Milestones.UpdateMilestone(p.ID, m.ID, updateMilestoneOpt, options...)
 				if err != nil {
-					fmt.Fprintln(os.Stderr, "unable to update milestone", lhMilestone.Title, "in project", lhProject.Name, err)
+					logFailure(severityError, "unable to update milestone", lhMilestone.Title, "in project", lhProject.Name, err)
 				}
 			}
 		}
 
+		perf.begin("issues", lhProject.Name)
+		newTickets := lhProject.tickets.list
+		if migrated {
+			newTickets = nil
+			for _, lhTicket := range lhProject.tickets.list {
+				if prev, _ := delta.ticket(lhProject.ID, lhTicket); prev == nil {
+					newTickets = append(newTickets, lhTicket)
+				}
+			}
+			if deleted := delta.deletedTickets(lhProject); len(deleted) > 0 {
+				logFailure(severityWarning, "tickets", deleted, "were deleted from project", lhProject.Name,
+					"since the previous export, their issues must be deleted manually")
+			}
+		}
+		conflicts, maxIID, err := iidConflicts(git, p.ID, newTickets)
+		if err != nil {
+			logFailure(severityError, "unable to check for existing issues in project", lhProject.Name, err)
+			continue
+		}
+		if len(conflicts) > 0 {
+			logFailure(severityError, "issue IID's", conflicts, "already exist in project", lhProject.Name,
+				"skipping its tickets, use -iid-offset", maxIID, "or greater to avoid conflicts")
+			continue
+		}
+
 		for _, lhTicket := range lhProject.tickets.list {
 			if number > 0 && lhTicket.Number != number {
 				continue
 			}
+			if migrated {
+				prev, changed := delta.ticket(lhProject.ID, lhTicket)
+				if !changed {
+					continue
+				}
+				if iid, ok := pm.Tickets[lhTicket.Number]; ok && prev != nil {
+					// only replay the versions added since
+					// the previous export
+					var lhVersions tickets.TicketVersions
+					if len(prev.Versions) < len(lhTicket.Versions) {
+						lhVersions = lhTicket.Versions[len(prev.Versions):]
+					}
+					logProgress("updating issue", iid)
+					createIssueVersions(git, p, lhProject, lhTicket, iid, lhVersions, stateKey)
+					perf.item()
+					continue
+				}
+			}
 			issueOpt, options, ok := lhTicketToCreateIssue(lhTicket, stateKey)
 			if !ok {
 				continue
 			}
-			fmt.Println("creating issue", *issueOpt.IID)
+			logProgress("creating issue", *issueOpt.IID)
 			i, _, err := git.Issues.CreateIssue(p.ID, issueOpt, options...)
 			if err != nil {
-				fmt.Fprintln(os.Stderr, "unable to create issue", lhTicket.Number, "in project", lhProject.Name, err)
+				logFailure(severityError, "unable to create issue", lhTicket.Number, "in project", lhProject.Name, err)
 				continue
 			}
+			if i.IID != *issueOpt.IID {
+				logFailure(severityWarning, "ticket", lhTicket.Number, "in project", lhProject.Name,
+					"was imported as issue", i.IID, "instead of", *issueOpt.IID)
+			}
 			issuesMap[lhTicket.Number] = i
+			perf.item()
+			pm.Tickets[lhTicket.Number] = i.IID
 
 			for _, watcherID := range lhTicket.WatchersIDs {
 				options := withSudoByUserID(watcherID)
 				_, _, err = git.Issues.SubscribeToIssue(p.ID, i.IID, options...)
 				if err != nil && err != io.EOF {
-					fmt.Fprintln(os.Stderr, "unable to subscribe user", watcherID, "to issue", i.IID, "in project", lhProject.Name, err)
+					logFailure(severityWarning, "unable to subscribe user", watcherID, "to issue", i.IID, "in project", lhProject.Name, err)
 				}
 			}
 
-			for _, lhVersion := range lhTicket.Versions {
-				issueOpt, options, ok := lhTicketVersionToUpdateIssue(lhVersion, stateKey)
-				if ok {
-					_, _, err = git.Issues.UpdateIssue(p.ID, i.IID, issueOpt, options...)
-					if err != nil {
-						fmt.Fprintln(os.Stderr, "unable to update issue", i.IID, "in project", lhProject.Name, err)
-					}
+			createIssueVersions(git, p, lhProject, lhTicket, i.IID, lhTicket.Versions, stateKey)
+
+			switch rawJSON {
+			case rawJSONAttachment:
+				pf, _, err := git.Projects.UploadFile(p.ID, lhTicket.filename)
+				if err != nil {
+					logFailure(severityWarning, "unable to upload", lhTicket.filename, "for issue", i.IID, "in project", lhProject.Name, err)
+					continue
 				}
-				var pfs []*gitlab.ProjectFile
-				for _, lhAttachment := range lhTicket.attachments.list {
-					if lhAttachment.CreatedAt == nil || lhVersion.CreatedAt == nil ||
-						!lhAttachment.CreatedAt.Equal(*lhVersion.CreatedAt) {
-						continue
-					}
-					file, options, ok := lhAttachmentToUploadFile(lhAttachment)
-					if !ok {
-						continue
-					}
-					pf, _, err := git.Projects.UploadFile(p.ID, file, options...)
-					if err != nil {
-						fmt.Fprintln(os.Stderr, "unable to upload file", file, "for issue", i.IID, "in project", lhProject.Name, err)
-						continue
-					}
-					pfs = append(pfs, pf)
+				noteOpt := lhTicketToRawJSONIssueNote(lhTicket, pf.Markdown)
+				_, _, err = git.Notes.CreateIssueNote(p.ID, i.IID, noteOpt)
+				if err != nil {
+					logFailure(severityWarning, "unable to create issue note for issue", i.IID, "in project", lhProject.Name, err)
 				}
-				noteOpt, options, ok := lhTicketVersionToCreateIssueNote(lhVersion, lhVersion.CreatedAt.Equal(*lhTicket.CreatedAt), pfs)
-				if ok {
-					_, _, err = git.Notes.CreateIssueNote(p.ID, i.IID, noteOpt, options...)
-					if err != nil {
-						fmt.Fprintln(os.Stderr, "unable to create issue note for issue", i.IID, "in project", lhProject.Name, err)
-					}
+			case rawJSONRepository:
+				buf, err := ioutil.ReadFile(lhTicket.filename)
+				if err != nil {
+					logFailure(severityWarning, "unable to read", lhTicket.filename, "for issue", i.IID, "in project", lhProject.Name, err)
+					continue
+				}
+				filePath, fileOpt := lhTicketToCreateFile(lhTicket, buf, rawJSONDir, p.DefaultBranch)
+				_, _, err = git.RepositoryFiles.CreateFile(p.ID, filePath, fileOpt)
+				if err != nil {
+					logFailure(severityWarning, "unable to create file", filePath, "for issue", i.IID, "in project", lhProject.Name, err)
+					continue
+				}
+				link := fmt.Sprintf("[%s](%s/blob/%s/%s)", filePath, p.WebURL, *fileOpt.Branch, filePath)
+				noteOpt := lhTicketToRawJSONIssueNote(lhTicket, link)
+				_, _, err = git.Notes.CreateIssueNote(p.ID, i.IID, noteOpt)
+				if err != nil {
+					logFailure(severityWarning, "unable to create issue note for issue", i.IID, "in project", lhProject.Name, err)
 				}
 			}
 		}
+
+		// wiki pages of projects migrated by an earlier run
+		// already exist
+		if wiki && !migrated {
+			perf.begin("wiki", lhProject.Name)
+			var pages []*gitlab.Wiki
+			for _, lhMilestone := range lhProject.milestones.list {
+				if _, ok := milestonesMap[lhMilestone.ID]; !ok {
+					continue
+				}
+				wikiOpt := lhMilestoneToCreateWikiPage(lhMilestone, lhProject.tickets.list, pm.Tickets)
+				logProgress("creating wiki page", *wikiOpt.Title)
+				w, _, err := git.Wikis.CreateWikiPage(p.ID, wikiOpt)
+				if err != nil {
+					logFailure(severityWarning, "unable to create wiki page for milestone", lhMilestone.Title, "in project", lhProject.Name, err)
+					continue
+				}
+				pages = append(pages, w)
+				perf.item()
+			}
+			wikiOpt := lhProjectToCreateWikiPage(lhProject, pages)
+			logProgress("creating wiki page", *wikiOpt.Title)
+			_, _, err = git.Wikis.CreateWikiPage(p.ID, wikiOpt)
+			if err != nil {
+				logFailure(severityWarning, "unable to create wiki home page in project", lhProject.Name, err)
+			} else {
+				perf.item()
+			}
+		}
 	}
-}
 
-func sanitizeProjectName(name string) string {
-	return strings.ReplaceAll(name, `'`, ``)
+	if failSeverity > 0 && failed(failSeverity) {
+		runAtExit()
+		os.Exit(1)
+	}
 }
 
-func projectByID(id int) (*gitlab.Project, bool) {
-	if id == 0 {
-		return nil, false
-	}
-	p, ok := projectsMap[id]
-	if !ok || p == nil {
-		return nil, false
+// createIssueVersions replays lhVersions of lhTicket on issue iid of
+// project p, updating the issue and adding a note, along with any
+// attachments, for each version.
+func createIssueVersions(git *gitlab.Client, p *gitlab.Project, lhProject *lhProject, lhTicket *lhTicket, iid int, lhVersions tickets.TicketVersions, stateKey string) {
+	// lhVersions are the last of lhTicket's versions, so the
+	// changelog of all of its versions is offset accordingly
+	changelog := lhTicket.Versions.Changelog()
+	offset := len(lhTicket.Versions) - len(lhVersions)
+	for i, lhVersion := range lhVersions {
+		var changes []*tickets.Change
+		if offset >= 0 && offset+i < len(changelog) {
+			changes = changelog[offset+i].Changes
+		}
+		issueOpt, options, ok := lhTicketVersionToUpdateIssue(lhVersion, stateKey)
+		if ok && issueMapping != nil {
+			data := &issueTemplateData{
+				Ticket:  lhTicket.Ticket,
+				Version: lhVersion,
+				Title:   *issueOpt.Title,
+				Labels:  issueOpt.Labels,
+			}
+			err := issueMapping.execute(data)
+			if err != nil {
+				logFailure(severityWarning, "unable to execute issue templates for ticket", lhTicket.Number, "version", lhVersion.Version, err)
+			} else {
+				issueOpt.Title, issueOpt.Labels = gitlab.String(data.Title), data.Labels
+			}
+		}
+		if ok {
+			_, _, err := git.Issues.UpdateIssue(p.ID, iid, issueOpt, options...)
+			if err != nil {
+				logFailure(severityError, "unable to update issue", iid, "in project", lhProject.Name, err)
+			}
+		}
+		var pfs []*gitlab.ProjectFile
+		for _, lhAttachment := range lhTicket.attachments.list {
+			if lhAttachment.CreatedAt == nil || lhVersion.CreatedAt == nil ||
+				!lhAttachment.CreatedAtTime().Equal(lhVersion.CreatedAtTime()) {
+				continue
+			}
+			file, options, ok := lhAttachmentToUploadFile(lhAttachment)
+			if !ok {
+				continue
+			}
+			pf, _, err := git.Projects.UploadFile(p.ID, file, options...)
+			if err != nil {
+				logFailure(severityWarning, "unable to upload file", file, "for issue", iid, "in project", lhProject.Name, err)
+				continue
+			}
+			pfs = append(pfs, pf)
+		}
+		// versions missing a creation time, i.e., from a malformed
+		// export, are never taken to be the ticket's current version
+		currentVersion := lhVersion.CreatedAt != nil && lhVersion.CreatedAtTime().Equal(lhTicket.CreatedAtTime())
+		noteOpt, options, ok := lhTicketVersionToCreateIssueNote(lhVersion, currentVersion, changes, pfs)
+		if ok {
+			_, _, err := git.Notes.CreateIssueNote(p.ID, iid, noteOpt, options...)
+			if err != nil {
+				logFailure(severityWarning, "unable to create issue note for issue", iid, "in project", lhProject.Name, err)
+			}
+		}
+	}
+}
+
+// envPrefix prefixes the names of the environment variables which
+// set lhtogitlab's flags, see flagsFromEnv.
+const envPrefix = "LHTOGITLAB_"
+
+// flagsFromEnv sets each flag in fs from the environment variable
+// named envPrefix followed by the flag's name in upper case with
+// dashes replaced by underscores, i.e., LHTOGITLAB_BASE_URL for
+// -base-url.  If that variable is unset, the flag is set from the
+// contents of the file named by the same variable with a _FILE
+// suffix, so secrets such as -token need not be passed on the command
+// line.  Flags given on the command line override the environment.
+func flagsFromEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		name := envPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			path, fileOK := os.LookupEnv(name + "_FILE")
+			if !fileOK {
+				return
+			}
+			buf, rerr := ioutil.ReadFile(path)
+			if rerr != nil {
+				err = fmt.Errorf("unable to read %s_FILE: %v", name, rerr)
+				return
+			}
+			value = strings.TrimRight(string(buf), "\r\n")
+		}
+		serr := fs.Set(f.Name, value)
+		if serr != nil {
+			err = fmt.Errorf("invalid value %q for %s: %v", value, name, serr)
+		}
+	})
+	return err
+}
+
+// severity is the severity of a failure logged by logFailure.
+type severity int
+
+const (
+	// severityWarning is a failure to migrate part of a resource,
+	// such as a label, note or attachment.
+	severityWarning severity = iota + 1
+	// severityError is a failure to migrate a user, group,
+	// project, milestone or issue.
+	severityError
+)
+
+// severities maps the values of -fail-on to the least severe failure
+// which causes a non-zero status code, zero meaning none.
+var severities = map[string]severity{
+	"warning": severityWarning,
+	"error":   severityError,
+	"never":   0,
+}
+
+var (
+	// ciLogger, if non-nil, logs progress and failures as JSON,
+	// see -ci.
+	ciLogger *slog.Logger
+
+	// failures counts the failures logged by logFailure by
+	// severity.
+	failures   = map[severity]int{}
+	failuresMu sync.Mutex
+)
+
+// logProgress prints a line reporting the progress of the migration
+// to standard output, or logs it with ciLogger if non-nil.
+func logProgress(a ...interface{}) {
+	if ciLogger != nil {
+		ciLogger.Info(strings.TrimSuffix(fmt.Sprintln(a...), "\n"))
+		return
+	}
+	fmt.Println(a...)
+}
+
+// logFailure prints a line reporting a failure of severity sev to
+// standard error, or logs it with ciLogger if non-nil.
+func logFailure(sev severity, a ...interface{}) {
+	failuresMu.Lock()
+	failures[sev]++
+	failuresMu.Unlock()
+	if ciLogger != nil {
+		level := slog.LevelWarn
+		if sev >= severityError {
+			level = slog.LevelError
+		}
+		ciLogger.Log(context.Background(), level, strings.TrimSuffix(fmt.Sprintln(a...), "\n"))
+		return
+	}
+	fmt.Fprintln(os.Stderr, a...)
+}
+
+// failed reports whether a failure of severity sev or worse has been
+// logged by logFailure.
+func failed(sev severity) bool {
+	failuresMu.Lock()
+	defer failuresMu.Unlock()
+	for s, n := range failures {
+		if s >= sev && n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ciLogWriter logs output written by the log package, such as fatal
+// errors, with ciLogger.
+type ciLogWriter struct{}
+
+func (ciLogWriter) Write(p []byte) (int, error) {
+	ciLogger.Error(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+const (
+	// stateMappingScopedLabels maps each Lighthouse ticket state
+	// to a scoped label, i.e., lh::new, so an issue has exactly
+	// one state label.
+	stateMappingScopedLabels = "scoped-labels"
+	// stateMappingLabels maps each Lighthouse ticket state to a
+	// plain label named after it, i.e., new.
+	stateMappingLabels = "labels"
+	// stateMappingCloseOnly only records whether a ticket is open
+	// or closed, by opening or closing its issue.
+	stateMappingCloseOnly = "close-only"
+	// stateMappingBoardLists is like stateMappingScopedLabels but
+	// also adds a list for each open state to the project's issue
+	// board.
+	stateMappingBoardLists = "board-lists"
+)
+
+// stateLabel returns the label recording Lighthouse ticket state
+// according to stateMapping, or false if states are not recorded as
+// labels.
+func stateLabel(stateKey, state string) (string, bool) {
+	state = strings.TrimSpace(state)
+	if len(state) == 0 {
+		return "", false
+	}
+	switch stateMapping {
+	case stateMappingCloseOnly:
+		return "", false
+	case stateMappingLabels:
+		return state, true
+	}
+	return stateKey + "::" + state, true
+}
+
+const (
+	// rawJSONAttachment preserves each ticket's original
+	// ticket.json as an issue attachment.
+	rawJSONAttachment = "attachment"
+	// rawJSONRepository preserves each ticket's original
+	// ticket.json as a file committed to the project repository.
+	rawJSONRepository = "repository"
+)
+
+// perfReport records the time taken and GitLab API calls made by
+// each phase of the migration, so operators can estimate the time
+// remaining for larger accounts.
+type perfReport struct {
+	mu sync.Mutex
+
+	Start           time.Time    `json:"start"`
+	DurationSeconds float64      `json:"duration_seconds"`
+	APICalls        int          `json:"api_calls"`
+	Failures        int          `json:"failures"`
+	Phases          []*perfPhase `json:"phases"`
+
+	current *perfPhase
+}
+
+// perfPhase records a single phase of the migration, i.e., creating
+// the issues of a single project.  Items counts the resources
+// successfully created.
+type perfPhase struct {
+	Phase           string    `json:"phase"`
+	Project         string    `json:"project,omitempty"`
+	Start           time.Time `json:"start"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	APICalls        int       `json:"api_calls"`
+	Failures        int       `json:"failures"`
+	Items           int       `json:"items"`
+	ItemsPerMinute  float64   `json:"items_per_minute"`
+}
+
+var perf = &perfReport{
+	Start:  time.Now(),
+	Phases: []*perfPhase{},
+}
+
+// begin ends the current phase and starts a new one.
+func (pr *perfReport) begin(phase, project string) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.endLocked()
+	pr.current = &perfPhase{
+		Phase:   phase,
+		Project: project,
+		Start:   time.Now(),
+	}
+	pr.Phases = append(pr.Phases, pr.current)
+}
+
+// end ends the current phase and updates the report's totals.
+func (pr *perfReport) end() {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.endLocked()
+	pr.DurationSeconds = time.Since(pr.Start).Seconds()
+}
+
+func (pr *perfReport) endLocked() {
+	if pr.current == nil {
+		return
+	}
+	pp := pr.current
+	pp.DurationSeconds = time.Since(pp.Start).Seconds()
+	if pp.DurationSeconds > 0 {
+		pp.ItemsPerMinute = float64(pp.Items) / (pp.DurationSeconds / 60)
+	}
+	pr.current = nil
+}
+
+// item counts a resource created by the current phase.
+func (pr *perfReport) item() {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	if pr.current != nil {
+		pr.current.Items++
+	}
+}
+
+// call records an API call, attributing it to the current phase.
+func (pr *perfReport) call(failed bool) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.APICalls++
+	if failed {
+		pr.Failures++
+	}
+	if pr.current != nil {
+		pr.current.APICalls++
+		if failed {
+			pr.current.Failures++
+		}
+	}
+}
+
+func writeReport(path string, pr *perfReport) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	buf, err := json.MarshalIndent(pr, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(buf, '\n'), 0644)
+}
+
+// perfTransport counts the GitLab API calls made through it in perf.
+// Calls which fail or receive an error response are counted as
+// failures.
+type perfTransport struct {
+	base http.RoundTripper
+}
+
+func (pt *perfTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := pt.base.RoundTrip(req)
+	perf.call(err != nil || resp.StatusCode >= 400)
+	return resp, err
+}
+
+// projectMapping records the GitLab project and issue IID's
+// created for a Lighthouse project and its tickets.
+type projectMapping struct {
+	LighthouseProjectID int    `json:"lighthouse_project_id"`
+	LighthouseProject   string `json:"lighthouse_project"`
+	GitLabProjectID     int    `json:"gitlab_project_id"`
+	GitLabProject       string `json:"gitlab_project"`
+	// Tickets maps Lighthouse ticket numbers to GitLab issue
+	// IID's.
+	Tickets map[int]int `json:"tickets"`
+}
+
+func writeMapping(path string, mapping []*projectMapping) error {
+	buf, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(buf, '\n'), 0644)
+}
+
+// readMapping reads a mapping file written by writeMapping.
+func readMapping(path string) ([]*projectMapping, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var mapping []*projectMapping
+	err = json.Unmarshal(buf, &mapping)
+	if err != nil {
+		return nil, err
+	}
+	for _, pm := range mapping {
+		if pm.Tickets == nil {
+			pm.Tickets = map[int]int{}
+		}
+	}
+	return mapping, nil
+}
+
+// lhDelta records the contents of the export migrated by an earlier
+// run, see -previous, and the changes export.Diff finds between it
+// and the current export, so that only what changed since is
+// migrated.
+type lhDelta struct {
+	users      map[int]bool
+	milestones map[int]*milestones.Milestone
+	// tickets maps project ID's to the project's tickets keyed by
+	// number.
+	tickets map[int]map[int]*lhTicket
+	// changed holds the milestones and tickets added or changed
+	// since the previous export, tickets whose attachments changed
+	// included.
+	changed map[lhDeltaKey]bool
+	// deleted maps project ID's to the numbers of the project's
+	// tickets removed since the previous export.
+	deleted map[int][]int
+}
+
+type lhDeltaKey struct {
+	kind      string
+	projectID int
+	id        int
+}
+
+func newLHDelta(previous, current *lhExport) *lhDelta {
+	d := &lhDelta{
+		users:      map[int]bool{},
+		milestones: map[int]*milestones.Milestone{},
+		tickets:    map[int]map[int]*lhTicket{},
+		changed:    map[lhDeltaKey]bool{},
+		deleted:    map[int][]int{},
+	}
+	for _, lhUser := range previous.users.list {
+		d.users[lhUser.ID] = true
+	}
+	for _, lhProject := range previous.projects.list {
+		for _, lhMilestone := range lhProject.milestones.list {
+			d.milestones[lhMilestone.ID] = lhMilestone
+		}
+		ts := map[int]*lhTicket{}
+		for _, lhTicket := range lhProject.tickets.list {
+			ts[lhTicket.Number] = lhTicket
+		}
+		d.tickets[lhProject.ID] = ts
+	}
+	for _, c := range export.Diff(previous.source, current.source) {
+		kind := c.Kind
+		switch {
+		case kind == export.KindProject:
+			continue
+		case kind == export.KindTicket && c.Change == export.Removed:
+			d.deleted[c.ProjectID] = append(d.deleted[c.ProjectID], c.ID)
+			continue
+		case c.Change == export.Removed && kind != export.KindAttachment:
+			continue
+		case kind == export.KindAttachment:
+			kind = export.KindTicket
+		}
+		d.changed[lhDeltaKey{kind, c.ProjectID, c.ID}] = true
+	}
+	for _, deleted := range d.deleted {
+		sort.Ints(deleted)
+	}
+	return d
+}
+
+// newUser reports whether the user was added since the previous
+// export.
+func (d *lhDelta) newUser(id int) bool {
+	return !d.users[id]
+}
+
+// milestone returns the previous version of lhMilestone, or nil if
+// it is new, and whether it changed since the previous export.
+func (d *lhDelta) milestone(lhMilestone *milestones.Milestone) (*milestones.Milestone, bool) {
+	prev, ok := d.milestones[lhMilestone.ID]
+	if !ok {
+		return nil, true
+	}
+	return prev, d.changed[lhDeltaKey{export.KindMilestone, lhMilestone.ProjectID, lhMilestone.ID}]
+}
+
+// ticket returns the previous version of lhTicket of project
+// projectID, or nil if it is new, and whether it changed since the
+// previous export.
+func (d *lhDelta) ticket(projectID int, lhTicket *lhTicket) (*lhTicket, bool) {
+	prev, ok := d.tickets[projectID][lhTicket.Number]
+	if !ok {
+		return nil, true
+	}
+	return prev, d.changed[lhDeltaKey{export.KindTicket, projectID, lhTicket.Number}]
+}
+
+// deletedTickets returns the numbers of the tickets of lhProject in
+// the previous export which no longer exist.
+func (d *lhDelta) deletedTickets(lhProject *lhProject) []int {
+	return d.deleted[lhProject.ID]
+}
+
+// existingMilestones returns the milestones of project pid keyed by
+// title.
+func existingMilestones(git *gitlab.Client, pid int) (map[string]*gitlab.Milestone, error) {
+	ms := map[string]*gitlab.Milestone{}
+	opt := &gitlab.ListMilestonesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100},
+	}
+	for {
+		page, resp, err := git.Milestones.ListMilestones(pid, opt)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range page {
+			ms[m.Title] = m
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	return ms, nil
+}
+
+// iidConflicts returns the IID's that importing lhTickets into
+// project pid would use that are already taken by existing issues,
+// along with the largest existing IID.
+func iidConflicts(git *gitlab.Client, pid int, lhTickets []*lhTicket) ([]int, int, error) {
+	wanted := map[int]bool{}
+	for _, lhTicket := range lhTickets {
+		wanted[lhTicket.Number+iidOffset] = true
+	}
+
+	var conflicts []int
+	maxIID := 0
+	opt := &gitlab.ListProjectIssuesOptions{
+		ListOptions: gitlab.ListOptions{PerPage: 100},
+	}
+	for {
+		is, resp, err := git.Issues.ListProjectIssues(pid, opt)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, i := range is {
+			if wanted[i.IID] {
+				conflicts = append(conflicts, i.IID)
+			}
+			if i.IID > maxIID {
+				maxIID = i.IID
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+	sort.Ints(conflicts)
+
+	return conflicts, maxIID, nil
+}
+
+// disableNotifications sets the global notification level of each
+// mapped GitLab user (and the user owning the API token) to
+// disabled so that creating issues, notes and memberships does not
+// flood users with email.  The returned function restores each
+// user's original notification level.
+func disableNotifications(git *gitlab.Client, me *gitlab.User) func() {
+	type saved struct {
+		user  *gitlab.User
+		level gitlab.NotificationLevelValue
+	}
+	var restore []saved
+
+	seen := map[int]bool{}
+	us := []*gitlab.User{me}
+	for _, u := range usersMap {
+		us = append(us, u)
+	}
+
+	for _, u := range us {
+		if u == nil || seen[u.ID] {
+			continue
+		}
+		seen[u.ID] = true
+		var options []gitlab.OptionFunc
+		if u.ID != me.ID {
+			options = append(options, gitlab.WithSudo(u.ID))
+		}
+		ns, _, err := git.NotificationSettings.GetGlobalSettings(options...)
+		if err != nil {
+			logFailure(severityWarning, "unable to get notification settings for user", u.Username, err)
+			continue
+		}
+		if ns.Level == gitlab.DisabledNotificationLevel {
+			continue
+		}
+		_, _, err = git.NotificationSettings.UpdateGlobalSettings(&gitlab.NotificationSettingsOptions{
+			Level: gitlab.NotificationLevel(gitlab.DisabledNotificationLevel),
+		}, options...)
+		if err != nil {
+			logFailure(severityWarning, "unable to disable notifications for user", u.Username, err)
+			continue
+		}
+		logProgress("disabled notifications for user", u.Username)
+		restore = append(restore, saved{user: u, level: ns.Level})
+	}
+
+	return func() {
+		for _, r := range restore {
+			var options []gitlab.OptionFunc
+			if r.user.ID != me.ID {
+				options = append(options, gitlab.WithSudo(r.user.ID))
+			}
+			_, _, err := git.NotificationSettings.UpdateGlobalSettings(&gitlab.NotificationSettingsOptions{
+				Level: gitlab.NotificationLevel(r.level),
+			}, options...)
+			if err != nil {
+				logFailure(severityWarning, "unable to restore notification level", r.level, "for user", r.user.Username, err)
+				continue
+			}
+			logProgress("restored notifications for user", r.user.Username)
+		}
+	}
+}
+
+func projectByID(id int) (*gitlab.Project, bool) {
+	if id == 0 {
+		return nil, false
+	}
+	p, ok := projectsMap[id]
+	if !ok || p == nil {
+		return nil, false
+	}
+	return p, true
+}
+
+func milestoneByID(id int) (*gitlab.Milestone, bool) {
+	if id == 0 {
+		return nil, false
+	}
+	m, ok := milestonesMap[id]
+	if !ok || m == nil {
+		return nil, false
+	}
+	return m, true
+}
+
+func issueByNumber(number int) (*gitlab.Issue, bool) {
+	if number == 0 {
+		return nil, false
+	}
+	i, ok := issuesMap[number]
+	if !ok || i == nil {
+		return nil, false
+	}
+	return i, true
+}
+
+func userByID(id int) (*gitlab.User, bool) {
+	if id == 0 {
+		return nil, false
+	}
+	u, ok := usersMap[id]
+	if !ok || u == nil {
+		return nil, false
+	}
+	return u, true
+}
+
+func userByUsername(username string) (*gitlab.User, bool) {
+	if len(username) == 0 {
+		return nil, false
+	}
+	u, ok := usersNameMap[username]
+	if !ok || u == nil {
+		return nil, false
+	}
+	return u, true
+}
+
+func withSudoByUserID(id int) []gitlab.OptionFunc {
+	var options []gitlab.OptionFunc
+	u, ok := userByID(id)
+	if ok {
+		options = append(options, gitlab.WithSudo(u.ID))
+	}
+	return options
+}
+
+func withSudoByUsername(username string) []gitlab.OptionFunc {
+	var options []gitlab.OptionFunc
+	u, ok := userByUsername(username)
+	if ok {
+		options = append(options, gitlab.WithSudo(u.ID))
+	}
+	return options
+}
+
+func lhUserToCreateUser(lhUser *lhUser, password string) (*gitlab.CreateUserOptions, []gitlab.OptionFunc, bool) {
+	var options []gitlab.OptionFunc
+	u, ok := userByID(lhUser.ID)
+	if !ok {
+		return nil, nil, false
+	}
+	opt := &gitlab.CreateUserOptions{
+		Email:            gitlab.String(u.Email),
+		Password:         gitlab.String(password),
+		Username:         gitlab.String(u.Username),
+		Name:             gitlab.String(u.Name),
+		ProjectsLimit:    gitlab.Int(u.ProjectsLimit),
+		Admin:            gitlab.Bool(u.IsAdmin),
+		CanCreateGroup:   gitlab.Bool(u.CanCreateGroup),
+		SkipConfirmation: gitlab.Bool(true),
+		External:         gitlab.Bool(u.External),
+	}
+	return opt, options, true
+}
+
+func lhProjectToCreateProject(lhProject *lhProject, lhMetadata []*lhProjectMetadata, metadata projectMetadataMapping) (*gitlab.CreateProjectOptions, []gitlab.OptionFunc, bool) {
+	var options []gitlab.OptionFunc
+	var name string
+	name = projects.SanitizeName(lhProject.Name)
+	var namespaceID *int
+	g, ok := groupsMap[name]
+	if ok {
+		namespaceID = gitlab.Int(g.ID)
+	}
+	path := lhProject.Permalink
+	if len(path) == 0 {
+		path = projects.Permalink(lhProject.Name)
+	}
+	opt := &gitlab.CreateProjectOptions{
+		Name:        gitlab.String(name),
+		Path:        gitlab.String(path),
+		NamespaceID: namespaceID,
+		Description: gitlab.String(lhtoGitLabMarkdown(lhProject.Description) + lhProjectMetadataToDescription(lhMetadata, metadata)),
+		Visibility:  gitlab.Visibility(gitlab.PrivateVisibility),
+	}
+	return opt, options, true
+}
+
+// projectMetadataMapping maps Lighthouse project metadata fields
+// which have no GitLab equivalent to where they are recorded:
+// "description" appends them to a footer in the project's
+// description, "label" creates a project label, "attribute" sets a
+// custom attribute (requires an administrator API token) and
+// "ignore" drops them.
+type projectMetadataMapping map[string]string
+
+var defaultProjectMetadataMapping = projectMetadataMapping{
+	"license":               "description",
+	"public":                "description",
+	"oss_readonly":          "description",
+	"default_assigned_user": "description",
+	"default_milestone":     "description",
+}
+
+func (m projectMetadataMapping) validate() error {
+	for field, target := range m {
+		if _, ok := defaultProjectMetadataMapping[field]; !ok {
+			return fmt.Errorf("unknown project metadata field %q", field)
+		}
+		switch target {
+		case "description", "label", "attribute", "ignore":
+		default:
+			return fmt.Errorf("invalid target %q for project metadata field %q, must be description, label, attribute or ignore", target, field)
+		}
+	}
+	return nil
+}
+
+// roleMapping maps the members of Lighthouse projects to the access
+// level they are given in the migrated GitLab project.  Users
+// overrides Roles, which overrides Default.
+type roleMapping struct {
+	// Default is the access level of members whose role isn't
+	// listed in Roles.
+	Default string `json:"default"`
+	// Roles maps Lighthouse membership roles to access levels.
+	Roles map[string]string `json:"roles"`
+	// Users maps Lighthouse user IDs or names to access levels.
+	Users map[string]string `json:"users"`
+}
+
+var defaultRoleMapping = roleMapping{
+	Default: "developer",
+	Roles: map[string]string{
+		"owner": "maintainer",
+		"admin": "maintainer",
+	},
+}
+
+var accessLevels = map[string]gitlab.AccessLevelValue{
+	"guest":      gitlab.GuestPermissions,
+	"reporter":   gitlab.ReporterPermissions,
+	"developer":  gitlab.DeveloperPermissions,
+	"maintainer": gitlab.MaintainerPermissions,
+}
+
+func (m *roleMapping) validate() error {
+	check := func(what, level string) error {
+		if _, ok := accessLevels[level]; !ok {
+			return fmt.Errorf("invalid access level %q for %s, must be guest, reporter, developer or maintainer", level, what)
+		}
+		return nil
+	}
+	err := check("default", m.Default)
+	if err != nil {
+		return err
+	}
+	for role, level := range m.Roles {
+		err = check(fmt.Sprintf("role %q", role), level)
+		if err != nil {
+			return err
+		}
+	}
+	for user, level := range m.Users {
+		err = check(fmt.Sprintf("user %q", user), level)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// accessLevel returns the access level of lhMembership's user.
+func (m *roleMapping) accessLevel(lhMembership *projects.Membership) gitlab.AccessLevelValue {
+	if level, ok := m.Users[strconv.Itoa(lhMembership.UserID)]; ok {
+		return accessLevels[level]
+	}
+	if lhMembership.User != nil {
+		if level, ok := m.Users[lhMembership.User.Name]; ok {
+			return accessLevels[level]
+		}
+	}
+	for role, level := range m.Roles {
+		if strings.EqualFold(role, lhMembership.Role) {
+			return accessLevels[level]
+		}
+	}
+	return accessLevels[m.Default]
+}
+
+// issueTemplates are Go templates, see text/template, which compute
+// the fields of migrated issues from an *issueTemplateData, for
+// example to prefix titles with their ticket number or add labels
+// based on the ticket's body.
+type issueTemplates struct {
+	// Title, if non-empty, replaces the issue's title.
+	Title string `json:"title"`
+	// Description, if non-empty, replaces the issue's
+	// description.  It is only executed when the issue is
+	// created.
+	Description string `json:"description"`
+	// Labels are each expanded to a comma-separated list of
+	// labels added to the issue's labels.  Empty labels are
+	// ignored, so a label can be added conditionally.
+	Labels []string `json:"labels"`
+
+	title, description *template.Template
+	labels             []*template.Template
+}
+
+// issueTemplateData is executed by issueTemplates.  Title,
+// Description and Labels are the fields the migration would
+// otherwise use and are replaced with the result of the templates.
+type issueTemplateData struct {
+	Ticket *tickets.Ticket
+	// Version is the ticket version being replayed, or nil when
+	// the issue is created.
+	Version *tickets.TicketVersion
+
+	Title       string
+	Description string
+	Labels      []string
+}
+
+// issueTemplateFuncs are the functions available to issueTemplates
+// in addition to text/template's builtins.
+var issueTemplateFuncs = template.FuncMap{
+	"match": func(pattern, s string) (bool, error) {
+		return regexp.MatchString(pattern, s)
+	},
+	"replace": func(pattern, repl, s string) (string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", err
+		}
+		return re.ReplaceAllString(s, repl), nil
+	},
+	"contains":  strings.Contains,
+	"hasPrefix": strings.HasPrefix,
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"trim":      strings.TrimSpace,
+	"join":      strings.Join,
+}
+
+func readIssueTemplates(path string) (*issueTemplates, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	it := &issueTemplates{}
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	err = dec.Decode(it)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read issue templates %s: %v", path, err)
+	}
+	parse := func(name, text string) (*template.Template, error) {
+		if len(text) == 0 {
+			return nil, nil
+		}
+		t, err := template.New(name).Funcs(issueTemplateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s issue template: %v", name, err)
+		}
+		return t, nil
+	}
+	it.title, err = parse("title", it.Title)
+	if err != nil {
+		return nil, err
+	}
+	it.description, err = parse("description", it.Description)
+	if err != nil {
+		return nil, err
 	}
-	return p, true
+	for i, text := range it.Labels {
+		t, err := parse("labels["+strconv.Itoa(i)+"]", text)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			it.labels = append(it.labels, t)
+		}
+	}
+	return it, nil
 }
 
-func milestoneByID(id int) (*gitlab.Milestone, bool) {
-	if id == 0 {
-		return nil, false
+// execute replaces data's Title, Description (when data.Version is
+// nil) and Labels with the result of executing its templates.
+func (it *issueTemplates) execute(data *issueTemplateData) error {
+	exec := func(t *template.Template) (string, error) {
+		buf := &bytes.Buffer{}
+		err := t.Execute(buf, data)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(buf.String()), nil
+	}
+	var (
+		title, description = data.Title, data.Description
+		labels             = append([]string(nil), data.Labels...)
+	)
+	if it.title != nil {
+		s, err := exec(it.title)
+		if err != nil {
+			return err
+		}
+		if len(s) == 0 {
+			return fmt.Errorf("title template produced an empty title")
+		}
+		title = s
 	}
-	m, ok := milestonesMap[id]
-	if !ok || m == nil {
-		return nil, false
+	if it.description != nil && data.Version == nil {
+		s, err := exec(it.description)
+		if err != nil {
+			return err
+		}
+		description = s
 	}
-	return m, true
+	for _, t := range it.labels {
+		s, err := exec(t)
+		if err != nil {
+			return err
+		}
+		for _, label := range strings.Split(s, ",") {
+			label = strings.TrimSpace(label)
+			if len(label) > 0 {
+				labels = append(labels, label)
+			}
+		}
+	}
+	data.Title, data.Description, data.Labels = title, description, labels
+	return nil
 }
 
-func issueByNumber(number int) (*gitlab.Issue, bool) {
-	if number == 0 {
-		return nil, false
-	}
-	i, ok := issuesMap[number]
-	if !ok || i == nil {
-		return nil, false
-	}
-	return i, true
+type lhProjectMetadata struct {
+	field string
+	name  string
+	value string
 }
 
-func userByID(id int) (*gitlab.User, bool) {
-	if id == 0 {
-		return nil, false
+func lhProjectToMetadata(lhProject *lhProject) []*lhProjectMetadata {
+	var md []*lhProjectMetadata
+	if len(lhProject.License) > 0 {
+		md = append(md, &lhProjectMetadata{"license", "License", lhProject.License})
 	}
-	u, ok := usersMap[id]
-	if !ok || u == nil {
-		return nil, false
+	if lhProject.Public {
+		md = append(md, &lhProjectMetadata{"public", "Public", "yes"})
 	}
-	return u, true
-}
-
-func userByUsername(username string) (*gitlab.User, bool) {
-	if len(username) == 0 {
-		return nil, false
+	if lhProject.OssReadonly {
+		md = append(md, &lhProjectMetadata{"oss_readonly", "Open source (read-only)", "yes"})
 	}
-	u, ok := usersNameMap[username]
-	if !ok || u == nil {
-		return nil, false
+	if id := lhProject.DefaultAssignedUserID; id != 0 {
+		value := strconv.Itoa(id)
+		if u, ok := userByID(id); ok {
+			value = "@" + u.Username
+		}
+		md = append(md, &lhProjectMetadata{"default_assigned_user", "Default assignee", value})
 	}
-	return u, true
-}
-
-func withSudoByUserID(id int) []gitlab.OptionFunc {
-	var options []gitlab.OptionFunc
-	u, ok := userByID(id)
-	if ok {
-		options = append(options, gitlab.WithSudo(u.ID))
+	if id := lhProject.DefaultMilestoneID; id != 0 {
+		value := strconv.Itoa(id)
+		for _, m := range lhProject.milestones.list {
+			if m.ID == id {
+				value = m.Title
+				break
+			}
+		}
+		md = append(md, &lhProjectMetadata{"default_milestone", "Default milestone", value})
 	}
-	return options
+	return md
 }
 
-func withSudoByUsername(username string) []gitlab.OptionFunc {
-	var options []gitlab.OptionFunc
-	u, ok := userByUsername(username)
-	if ok {
-		options = append(options, gitlab.WithSudo(u.ID))
+func lhProjectMetadataToDescription(lhMetadata []*lhProjectMetadata, metadata projectMetadataMapping) string {
+	var lines []string
+	for _, md := range lhMetadata {
+		if metadata[md.field] == "description" {
+			lines = append(lines, fmt.Sprintf("- %s: %s", md.name, md.value))
+		}
 	}
-	return options
+	if len(lines) == 0 {
+		return ""
+	}
+	return "\n\n---\n\nLighthouse project metadata:\n\n" + strings.Join(lines, "\n")
 }
 
-func lhUserToCreateUser(lhUser *lhUser, password string) (*gitlab.CreateUserOptions, []gitlab.OptionFunc, bool) {
-	var options []gitlab.OptionFunc
-	u, ok := userByID(lhUser.ID)
-	if !ok {
-		return nil, nil, false
-	}
-	opt := &gitlab.CreateUserOptions{
-		Email:            gitlab.String(u.Email),
-		Password:         gitlab.String(password),
-		Username:         gitlab.String(u.Username),
-		Name:             gitlab.String(u.Name),
-		ProjectsLimit:    gitlab.Int(u.ProjectsLimit),
-		Admin:            gitlab.Bool(u.IsAdmin),
-		CanCreateGroup:   gitlab.Bool(u.CanCreateGroup),
-		SkipConfirmation: gitlab.Bool(true),
-		External:         gitlab.Bool(u.External),
+func lhProjectMetadataToCreateLabels(lhMetadata []*lhProjectMetadata, metadata projectMetadataMapping) []*gitlab.CreateLabelOptions {
+	var opts []*gitlab.CreateLabelOptions
+	for _, md := range lhMetadata {
+		if metadata[md.field] != "label" {
+			continue
+		}
+		name := md.field + "::" + md.value
+		if md.value == "yes" {
+			name = md.field
+		}
+		opts = append(opts, &gitlab.CreateLabelOptions{
+			Name:        gitlab.String(name),
+			Color:       gitlab.String("#428BCA"),
+			Description: gitlab.String("Lighthouse project " + strings.ToLower(md.name)),
+		})
 	}
-	return opt, options, true
+	return opts
 }
 
-func lhProjectToCreateProject(lhProject *lhProject) (*gitlab.CreateProjectOptions, []gitlab.OptionFunc, bool) {
-	var options []gitlab.OptionFunc
-	var name string
-	name = sanitizeProjectName(lhProject.Name)
-	var namespaceID *int
-	g, ok := groupsMap[name]
-	if ok {
-		namespaceID = gitlab.Int(g.ID)
-	}
-	opt := &gitlab.CreateProjectOptions{
-		Name:        gitlab.String(name),
-		NamespaceID: namespaceID,
-		Description: gitlab.String(lhtoGitLabMarkdown(lhProject.Description)),
-		Visibility:  gitlab.Visibility(gitlab.PrivateVisibility),
+func lhProjectMetadataToCustomAttributes(lhMetadata []*lhProjectMetadata, metadata projectMetadataMapping) []gitlab.CustomAttribute {
+	var attrs []gitlab.CustomAttribute
+	for _, md := range lhMetadata {
+		if metadata[md.field] != "attribute" {
+			continue
+		}
+		attrs = append(attrs, gitlab.CustomAttribute{
+			Key:   "lighthouse_" + md.field,
+			Value: md.value,
+		})
 	}
-	return opt, options, true
+	return attrs
 }
 
 func lhProjectToCreateLabels(lhProject *lhProject, stateKey string) ([]*gitlab.CreateLabelOptions, []gitlab.OptionFunc, bool) {
@@ -535,6 +1960,44 @@ func lhProjectToCreateLabels(lhProject *lhProject, stateKey string) ([]*gitlab.C
 	return opts, options, true
 }
 
+// createStateBoardLists adds a list for each of lhProject's open
+// states to the issue board of project p, creating the board if p
+// has none.  labelIDs maps the names of the state labels created in
+// p to their ID's.  Closed states need no list, closed issues appear
+// in the board's Closed list.
+func createStateBoardLists(git *gitlab.Client, p *gitlab.Project, lhProject *lhProject, stateKey string, labelIDs map[string]int) {
+	boards, _, err := git.Boards.ListIssueBoards(p.ID, nil)
+	if err != nil {
+		logFailure(severityWarning, "unable to list issue boards in project", lhProject.Name, err)
+		return
+	}
+	var board *gitlab.IssueBoard
+	if len(boards) > 0 {
+		board = boards[0]
+	} else {
+		board, _, err = git.Boards.CreateIssueBoard(p.ID, &gitlab.CreateIssueBoardOptions{
+			Name: gitlab.String("Lighthouse"),
+		})
+		if err != nil {
+			logFailure(severityWarning, "unable to create issue board in project", lhProject.Name, err)
+			return
+		}
+	}
+	openLabels, _ := lhProjectStatesToCreateLabels(lhProject.OpenStates, stateKey)
+	for _, labelOpt := range openLabels {
+		id, ok := labelIDs[*labelOpt.Name]
+		if !ok {
+			continue
+		}
+		_, _, err = git.Boards.CreateIssueBoardList(p.ID, board.ID, &gitlab.CreateIssueBoardListOptions{
+			LabelID: gitlab.Int(id),
+		})
+		if err != nil {
+			logFailure(severityWarning, "unable to create issue board list", *labelOpt.Name, "in project", lhProject.Name, err)
+		}
+	}
+}
+
 var (
 	lhStateDefinitionRegexp = regexp.MustCompile(`^\s*(?P<name>[^/]+)/(?P<color>[0-9a-fA-F]+)\s*(#\s*(?P<description>.*)\s*)?$`)
 )
@@ -543,6 +2006,7 @@ func lhProjectStatesToCreateLabels(text, stateKey string) ([]*gitlab.CreateLabel
 	var opts []*gitlab.CreateLabelOptions
 	for _, line := range strings.Split(text, "\n") {
 		var name, color, description string
+		var ok bool
 
 		names := lhStateDefinitionRegexp.SubexpNames()
 		m := lhStateDefinitionRegexp.FindStringSubmatch(line)
@@ -553,7 +2017,7 @@ func lhProjectStatesToCreateLabels(text, stateKey string) ([]*gitlab.CreateLabel
 		for i := range m {
 			switch names[i] {
 			case "name":
-				name = stateKey + strings.TrimSpace(m[i])
+				name, ok = stateLabel(stateKey, m[i])
 			case "color":
 				c := m[i]
 				if len(c) == 3 {
@@ -577,6 +2041,9 @@ func lhProjectStatesToCreateLabels(text, stateKey string) ([]*gitlab.CreateLabel
 				}
 			}
 		}
+		if !ok {
+			continue
+		}
 		// color is mandatory, so pick a default
 		if len(color) == 0 {
 			color = "#428BCA"
@@ -591,7 +2058,7 @@ func lhProjectStatesToCreateLabels(text, stateKey string) ([]*gitlab.CreateLabel
 	return opts, true
 }
 
-func lhMembershipToAddProjectMember(lhMembership *projects.Membership) (*gitlab.AddProjectMemberOptions, []gitlab.OptionFunc, bool) {
+func lhMembershipToAddProjectMember(lhMembership *projects.Membership, roles *roleMapping) (*gitlab.AddProjectMemberOptions, []gitlab.OptionFunc, bool) {
 	var options []gitlab.OptionFunc
 	u, ok := userByID(lhMembership.UserID)
 	if !ok {
@@ -599,7 +2066,7 @@ func lhMembershipToAddProjectMember(lhMembership *projects.Membership) (*gitlab.
 	}
 	opt := &gitlab.AddProjectMemberOptions{
 		UserID:      gitlab.Int(u.ID),
-		AccessLevel: gitlab.AccessLevel(gitlab.MaintainerPermissions),
+		AccessLevel: gitlab.AccessLevel(roles.accessLevel(lhMembership)),
 	}
 	return opt, options, true
 }
@@ -608,12 +2075,11 @@ func lhMilestoneToCreateMilestone(lhMilestone *milestones.Milestone) (*gitlab.Cr
 	options := withSudoByUsername(lhMilestone.UserName)
 	var startDate, dueDate *gitlab.ISOTime
 	if lhMilestone.CreatedAt != nil {
-		d := gitlab.ISOTime(*lhMilestone.CreatedAt)
+		d := gitlab.ISOTime(lhMilestone.CreatedAt.Time)
 		startDate = &d
 	}
-	if lhMilestone.DueOn != nil &&
-		(lhMilestone.CreatedAt == nil || lhMilestone.DueOn.After(*lhMilestone.CreatedAt)) {
-		d := gitlab.ISOTime(*lhMilestone.DueOn)
+	if lhMilestone.DueOn != nil && lhMilestone.DueOnTime().After(lhMilestone.CreatedAtTime()) {
+		d := gitlab.ISOTime(lhMilestone.DueOn.Time)
 		dueDate = &d
 	}
 	opt := &gitlab.CreateMilestoneOptions{
@@ -642,13 +2108,109 @@ func lhMilestoneToUpdateMilestone(lhMilestone *milestones.Milestone) (*gitlab.Up
 	return opt, options, true
 }
 
+// lhMilestoneToUpdateChangedMilestone returns the update bringing a
+// milestone migrated by an earlier run, see -previous, up to date
+// with lhMilestone.
+func lhMilestoneToUpdateChangedMilestone(lhMilestone *milestones.Milestone) (*gitlab.UpdateMilestoneOptions, []gitlab.OptionFunc, bool) {
+	createOpt, options, ok := lhMilestoneToCreateMilestone(lhMilestone)
+	if !ok {
+		return nil, nil, false
+	}
+	updateOpt, _, ok := lhMilestoneToUpdateMilestone(lhMilestone)
+	if !ok {
+		return nil, nil, false
+	}
+	updateOpt.Title = createOpt.Title
+	updateOpt.Description = createOpt.Description
+	updateOpt.DueDate = createOpt.DueDate
+	return updateOpt, options, true
+}
+
+// lhProjectToCreateWikiPage returns the wiki home page of a migrated
+// project, which includes the project's description and license and
+// links to the wiki pages of its milestones.
+func lhProjectToCreateWikiPage(lhProject *lhProject, milestonePages []*gitlab.Wiki) *gitlab.CreateWikiPageOptions {
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "# %s\n\n", lhProject.Name)
+	if len(strings.TrimSpace(lhProject.Description)) > 0 {
+		fmt.Fprintf(buf, "%s\n\n", strings.TrimSpace(lhtoGitLabMarkdown(lhProject.Description)))
+	}
+	if len(lhProject.License) > 0 {
+		fmt.Fprintf(buf, "**License:** %s\n\n", lhProject.License)
+	}
+	if len(milestonePages) > 0 {
+		buf.WriteString("## Milestones\n\n")
+		for _, w := range milestonePages {
+			fmt.Fprintf(buf, "- [%s](%s)\n", path.Base(w.Title), w.Slug)
+		}
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(buf, "_Migrated from Lighthouse project %s._\n", lhProject.WebURL(lhAccount))
+	return &gitlab.CreateWikiPageOptions{
+		Title:   gitlab.String("home"),
+		Content: gitlab.String(buf.String()),
+		Format:  gitlab.String("markdown"),
+	}
+}
+
+// gitlabMilestoneReference returns GitLab's Markdown reference to the
+// milestone titled title, i.e., %"Release 1.0".  GitLab has no way to
+// escape double quotes in milestone references, so titles containing
+// them are returned as is.
+func gitlabMilestoneReference(title string) string {
+	if strings.Contains(title, `"`) {
+		return title
+	}
+	return `%"` + title + `"`
+}
+
+// lhMilestoneToCreateWikiPage returns a wiki page summarizing a
+// migrated milestone, which includes the milestone's goals and a
+// list of its tickets linked to their GitLab issues.  iids maps
+// Lighthouse ticket numbers to GitLab issue IID's.
+func lhMilestoneToCreateWikiPage(lhMilestone *milestones.Milestone, lhTickets []*lhTicket, iids map[int]int) *gitlab.CreateWikiPageOptions {
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "# %s\n\n", lhMilestone.Title)
+	fmt.Fprintf(buf, "Milestone: %s\n\n", gitlabMilestoneReference(lhMilestone.Title))
+	if lhMilestone.DueOn != nil {
+		fmt.Fprintf(buf, "**Due:** %s\n\n", lhMilestone.DueOn.Format("2006-01-02"))
+	}
+	if lhMilestone.CompletedAt != nil {
+		fmt.Fprintf(buf, "**Completed:** %s\n\n", lhMilestone.CompletedAt.Format("2006-01-02"))
+	}
+	if len(strings.TrimSpace(lhMilestone.Goals)) > 0 {
+		fmt.Fprintf(buf, "## Goals\n\n%s\n\n", strings.TrimSpace(lhtoGitLabMarkdown(lhMilestone.Goals)))
+	}
+	buf.WriteString("## Tickets\n\n")
+	n := 0
+	for _, lhTicket := range lhTickets {
+		if lhTicket.MilestoneID != lhMilestone.ID {
+			continue
+		}
+		iid, ok := iids[lhTicket.Number]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(buf, "- #%d %s (%s)\n", iid, lhTicket.Title, lhTicket.State)
+		n++
+	}
+	if n == 0 {
+		buf.WriteString("No tickets.\n")
+	}
+	return &gitlab.CreateWikiPageOptions{
+		Title:   gitlab.String("milestones/" + strings.ReplaceAll(lhMilestone.Title, "/", "-")),
+		Content: gitlab.String(buf.String()),
+		Format:  gitlab.String("markdown"),
+	}
+}
+
 func lhTicketToCreateIssue(lhTicket *lhTicket, stateKey string) (*gitlab.CreateIssueOptions, []gitlab.OptionFunc, bool) {
 	options := withSudoByUserID(lhTicket.CreatorID)
 
 	var title *string
 	title = gitlab.String(lhTicket.Title)
 	var description *string
-	description = gitlab.String(lhtoGitLabMarkdown(lhTicket.Body))
+	description = gitlab.String(changesets.LinkRevisions(lhtoGitLabMarkdown(lhTicket.Body), revisionURLs[lhTicket.ProjectID]) + lhTicketToFooter(lhTicket))
 	var assigneeIDs []int
 	if lhTicket.AssignedUserID == 0 {
 		assigneeIDs = append(assigneeIDs, 0)
@@ -671,7 +2233,7 @@ func lhTicketToCreateIssue(lhTicket *lhTicket, stateKey string) (*gitlab.CreateI
 	labels = lhTicketToLabels(lhTicket, stateKey)
 	var createdAt *time.Time
 	if lhTicket.CreatedAt != nil {
-		createdAt = lhTicket.CreatedAt
+		createdAt = &lhTicket.CreatedAt.Time
 	}
 
 	if len(lhTicket.Versions) > 0 {
@@ -684,8 +2246,23 @@ func lhTicketToCreateIssue(lhTicket *lhTicket, stateKey string) (*gitlab.CreateI
 		}
 	}
 
+	if issueMapping != nil {
+		data := &issueTemplateData{
+			Ticket:      lhTicket.Ticket,
+			Title:       *title,
+			Description: *description,
+			Labels:      labels,
+		}
+		err := issueMapping.execute(data)
+		if err != nil {
+			logFailure(severityWarning, "unable to execute issue templates for ticket", lhTicket.Number, err)
+		} else {
+			title, description, labels = gitlab.String(data.Title), gitlab.String(data.Description), data.Labels
+		}
+	}
+
 	opt := &gitlab.CreateIssueOptions{
-		IID:         gitlab.Int(lhTicket.Number),
+		IID:         gitlab.Int(lhTicket.Number + iidOffset),
 		Title:       title,
 		Description: description,
 		AssigneeIDs: assigneeIDs,
@@ -696,6 +2273,19 @@ func lhTicketToCreateIssue(lhTicket *lhTicket, stateKey string) (*gitlab.CreateI
 	return opt, options, true
 }
 
+// lhTicketToFooter returns a footer linking to lhTicket's original
+// Lighthouse URL.
+func lhTicketToFooter(lhTicket *lhTicket) string {
+	u := lhTicket.URL
+	if len(u) == 0 && len(lhAccount) > 0 {
+		u = lhTicket.WebURL(lhAccount)
+	}
+	if len(u) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\n---\n\n_Migrated from Lighthouse ticket [#%d](%s)_", lhTicket.Number, u)
+}
+
 func lhTicketVersionToUpdateIssue(lhVersion *tickets.TicketVersion, stateKey string) (*gitlab.UpdateIssueOptions, []gitlab.OptionFunc, bool) {
 	options := withSudoByUserID(lhVersion.UserID)
 	var title *string
@@ -727,7 +2317,7 @@ func lhTicketVersionToUpdateIssue(lhVersion *tickets.TicketVersion, stateKey str
 	}
 	var updatedAt *time.Time
 	if lhVersion.UpdatedAt != nil {
-		updatedAt = lhVersion.UpdatedAt
+		updatedAt = &lhVersion.UpdatedAt.Time
 	}
 	opt := &gitlab.UpdateIssueOptions{
 		Title:       title,
@@ -740,18 +2330,18 @@ func lhTicketVersionToUpdateIssue(lhVersion *tickets.TicketVersion, stateKey str
 	return opt, options, true
 }
 
-func lhTicketVersionToCreateIssueNote(lhVersion *tickets.TicketVersion, currentVersion bool, pfs []*gitlab.ProjectFile) (*gitlab.CreateIssueNoteOptions, []gitlab.OptionFunc, bool) {
+func lhTicketVersionToCreateIssueNote(lhVersion *tickets.TicketVersion, currentVersion bool, changes []*tickets.Change, pfs []*gitlab.ProjectFile) (*gitlab.CreateIssueNoteOptions, []gitlab.OptionFunc, bool) {
 	options := withSudoByUserID(lhVersion.UserID)
 	var createdAt *time.Time
 	if lhVersion.CreatedAt != nil {
-		createdAt = lhVersion.CreatedAt
+		createdAt = &lhVersion.CreatedAt.Time
 	}
-	var body string
+	body := lhChangesToMarkdown(changes)
 	if !currentVersion {
 		if len(body) > 0 {
 			body += "\n\n"
 		}
-		body += lhtoGitLabMarkdown(lhVersion.Body)
+		body += changesets.LinkRevisions(lhtoGitLabMarkdown(lhVersion.Body), revisionURLs[lhVersion.ProjectID])
 	}
 	for _, pf := range pfs {
 		if len(body) > 0 {
@@ -769,6 +2359,69 @@ func lhTicketVersionToCreateIssueNote(lhVersion *tickets.TicketVersion, currentV
 	return opt, options, true
 }
 
+// lhChangesToMarkdown returns a list describing the attribute changes
+// made by a Lighthouse ticket version.  Body changes are omitted since
+// a version's body is its comment.
+func lhChangesToMarkdown(changes []*tickets.Change) string {
+	lines := []string{}
+	for _, c := range changes {
+		var line string
+		switch c.Attribute {
+		case tickets.AttributeTitle:
+			line = fmt.Sprintf("changed title from **%s** to **%s**", c.From, c.To)
+		case tickets.AttributeState:
+			line = fmt.Sprintf("changed state from **%s** to **%s**", c.From, c.To)
+		case tickets.AttributeAssignedUser:
+			line = "unassigned"
+			if u, ok := userByID(c.ToID); ok {
+				line = "assigned to @" + u.Username
+			} else if c.ToID != 0 {
+				line = "changed assigned user"
+			}
+		case tickets.AttributeMilestone:
+			line = "removed milestone"
+			if m, ok := milestoneByID(c.ToID); ok {
+				line = "changed milestone to " + gitlabMilestoneReference(m.Title)
+			} else if c.ToID != 0 {
+				line = "changed milestone"
+			}
+		case tickets.AttributeTag:
+			switch {
+			case len(c.From) == 0:
+				line = fmt.Sprintf("added tags **%s**", c.To)
+			case len(c.To) == 0:
+				line = "removed tags"
+			default:
+				line = fmt.Sprintf("changed tags from **%s** to **%s**", c.From, c.To)
+			}
+		default:
+			continue
+		}
+		lines = append(lines, "- _"+line+"_")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func lhTicketToRawJSONIssueNote(lhTicket *lhTicket, link string) *gitlab.CreateIssueNoteOptions {
+	body := fmt.Sprintf("Original Lighthouse ticket #%d, including its version history: %s", lhTicket.Number, link)
+	return &gitlab.CreateIssueNoteOptions{
+		Body: gitlab.String(body),
+	}
+}
+
+func lhTicketToCreateFile(lhTicket *lhTicket, content []byte, dir, branch string) (string, *gitlab.CreateFileOptions) {
+	if len(branch) == 0 {
+		branch = "master"
+	}
+	filePath := path.Join(dir, strconv.Itoa(lhTicket.Number)+".json")
+	opt := &gitlab.CreateFileOptions{
+		Branch:        gitlab.String(branch),
+		Content:       gitlab.String(string(content)),
+		CommitMessage: gitlab.String(fmt.Sprintf("Add original Lighthouse ticket #%d", lhTicket.Number)),
+	}
+	return filePath, opt
+}
+
 func lhAttachmentToUploadFile(lhAttachment *lhAttachment) (string, []gitlab.OptionFunc, bool) {
 	options := withSudoByUserID(lhAttachment.UploaderID)
 	return lhAttachment.filename, options, true
@@ -779,16 +2432,15 @@ func lhTicketToLabels(lhTicket *lhTicket, stateKey string) gitlab.Labels {
 	for _, tag := range lhTicket.Tags {
 		labels = append(labels, tag.Tag.Name)
 	}
-	labels = append(labels, strings.Join([]string{stateKey, lhTicket.State}, "::"))
+	if label, ok := stateLabel(stateKey, lhTicket.State); ok {
+		labels = append(labels, label)
+	}
 	return labels
 }
 
 func lhTicketVersionToLabels(lhVersion *tickets.TicketVersion, stateKey string) gitlab.Labels {
 	var labels gitlab.Labels
-	r := strings.NewReader(lhVersion.Tag)
-	cr := csv.NewReader(r)
-	cr.Comma = ' '
-	record, err := cr.Read()
+	record, err := tickets.SplitKeywords(lhVersion.Tag)
 	if err != nil {
 		record = strings.Fields(lhVersion.Tag)
 	}
@@ -798,7 +2450,9 @@ func lhTicketVersionToLabels(lhVersion *tickets.TicketVersion, stateKey string)
 		}
 		labels = append(labels, r)
 	}
-	labels = append(labels, strings.Join([]string{stateKey, lhVersion.State}, "::"))
+	if label, ok := stateLabel(stateKey, lhVersion.State); ok {
+		labels = append(labels, label)
+	}
 	return labels
 }
 
@@ -833,10 +2487,13 @@ func lhtoGitLabMarkdown(text string) string {
 }
 
 type lhExport struct {
+	account  string
 	plan     *lighthouse.Plan
 	profile  *profiles.User
 	projects *lhProjects
 	users    *lhUsers
+	// source is the export as read by the export package.
+	source *export.Export
 }
 
 type lhProjects struct {
@@ -853,6 +2510,10 @@ type lhProject struct {
 
 type lhMilestones struct {
 	list []*milestones.Milestone
+
+	// attachments maps milestone IDs to the milestone's
+	// attachments.
+	attachments map[int][]*lhAttachment
 }
 
 type lhTickets struct {
@@ -862,6 +2523,8 @@ type lhTickets struct {
 type lhTicket struct {
 	*tickets.Ticket
 
+	// filename is the path of the ticket's original ticket.json.
+	filename    string
 	attachments lhAttachments
 }
 
@@ -891,31 +2554,56 @@ type lhFile struct {
 	r        io.Reader
 }
 
-func readLHExport(path string) (e *lhExport, tempDir string, err error) {
-	tempDir, err = ioutil.TempDir("", "lhtogitlab")
+// readLHExport reads the Lighthouse export at exportPath, which may be a
+// gzipped tarball or a directory it was extracted to, using the
+// export package.  Only the files needed on disk are extracted from
+// tarballs: attachments and avatars if attachments is true and each
+// ticket's original ticket.json if rawJSON is true.  cleanup removes
+// any extracted files.
+func readLHExport(exportPath string, attachments, rawJSON bool) (e *lhExport, cleanup func(), err error) {
+	exp, err := export.Open(exportPath)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, err
 	}
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	defer signal.Reset(os.Interrupt)
-
-	go func(c chan os.Signal) {
-		<-c
-		signal.Reset(os.Interrupt)
-		if len(tempDir) > 0 {
-			os.RemoveAll(tempDir)
+	needed := map[string]bool{}
+	for _, u := range exp.Users {
+		if attachments && len(u.Avatar) > 0 {
+			needed[u.Avatar] = true
 		}
-	}(c)
+	}
+	for _, p := range exp.Projects {
+		for _, as := range p.MilestoneAttachments {
+			for _, a := range as {
+				needed[a.Path] = attachments
+			}
+		}
+		for _, t := range p.Tickets {
+			for _, a := range t.Attachments {
+				needed[a.Path] = attachments
+			}
+			needed[path.Join(t.Dir, "ticket.json")] = rawJSON
+		}
+	}
+	dir, cleanup, err := exp.Extract(func(name string) bool { return needed[name] })
+	if err != nil {
+		return nil, nil, err
+	}
+	local := func(name string) string {
+		return filepath.Join(dir, filepath.FromSlash(name))
+	}
 
 	defer func() {
-		if err != nil && len(tempDir) > 0 {
-			os.RemoveAll(tempDir)
+		if err != nil {
+			cleanup()
 		}
 	}()
 
 	e = &lhExport{
+		source:  exp,
+		account: exp.Account,
+		plan:    exp.Plan,
+		profile: exp.Profile,
 		projects: &lhProjects{
 			list: []*lhProject{},
 		},
@@ -924,184 +2612,85 @@ func readLHExport(path string) (e *lhExport, tempDir string, err error) {
 		},
 	}
 
-	tgz := archiver.NewTarGz()
-	tgz.Tar.OverwriteExisting = true
-
-	err = tgz.Unarchive(path, tempDir)
-	if err != nil {
-		return nil, "", err
-	}
-
-	userDirs, err := filepath.Glob(filepath.Join(tempDir, "*", "users", "*"))
-	if err != nil {
-		return nil, "", err
-	}
-
-	for _, dir := range userDirs {
-		uf, err := os.Open(filepath.Join(dir, "user.json"))
-		if err != nil {
-			return nil, "", err
-		}
-		defer uf.Close()
-		dec := json.NewDecoder(uf)
+	for _, eu := range exp.Users {
 		u := &lhUser{
-			User:        &users.User{},
-			memberships: users.Memberships{},
+			User:        eu.User,
+			memberships: eu.Memberships,
 		}
-		err = dec.Decode(u.User)
-		if err != nil {
-			return nil, "", err
-		}
-		uf.Close()
-		mf, err := os.Open(filepath.Join(dir, "memberships.json"))
-		if err == nil {
-			defer mf.Close()
-			dec = json.NewDecoder(mf)
-			err = dec.Decode(&u.memberships)
+		if u.memberships == nil {
+			u.memberships = users.Memberships{}
+		}
+		if attachments && len(eu.Avatar) > 0 {
+			buf, err := ioutil.ReadFile(local(eu.Avatar))
 			if err != nil {
-				return nil, "", err
+				return nil, nil, err
 			}
-			mf.Close()
-		}
-		avatarPaths, err := filepath.Glob(filepath.Join(dir, "avatar.*"))
-		if err != nil {
-			return nil, "", err
-		}
-		if len(avatarPaths) != 0 {
 			u.avatar = &lhFile{
-				filename: filepath.Base(avatarPaths[0]),
-			}
-			buf, err := ioutil.ReadFile(avatarPaths[0])
-			if err != nil {
-				return nil, "", err
+				filename: path.Base(eu.Avatar),
+				r:        bytes.NewReader(buf),
 			}
-			u.avatar.r = bytes.NewReader(buf)
 		}
 		e.users.list = append(e.users.list, u)
 	}
-	sort.Slice(e.users.list, func(i, j int) bool { return e.users.list[i].ID < e.users.list[j].ID })
 
-	projectDirs, err := filepath.Glob(filepath.Join(tempDir, "*", "projects", "*"))
-	if err != nil {
-		return nil, "", err
-	}
-
-	for _, dir := range projectDirs {
-		pf, err := os.Open(filepath.Join(dir, "project.json"))
-		if err != nil {
-			return nil, "", err
-		}
-		defer pf.Close()
-		dec := json.NewDecoder(pf)
+	for _, ep := range exp.Projects {
 		p := &lhProject{
-			Project:     &projects.Project{},
+			Project:     ep.Project,
 			memberships: projects.Memberships{},
 			milestones: lhMilestones{
-				list: []*milestones.Milestone{},
+				list:        ep.Milestones,
+				attachments: map[int][]*lhAttachment{},
 			},
 			tickets: lhTickets{
 				list: []*lhTicket{},
 			},
 		}
-		err = dec.Decode(p.Project)
-		if err != nil {
-			return nil, "", err
-		}
-		pf.Close()
-		mf, err := os.Open(filepath.Join(dir, "memberships.json"))
-		if err == nil {
-			defer mf.Close()
-			var memberships projects.Memberships
-			dec = json.NewDecoder(mf)
-			err = dec.Decode(&memberships)
-			if err != nil {
-				return nil, "", err
-			}
-			mf.Close()
-			var unique projects.Memberships
-			seen := map[int]struct{}{}
-			for _, membership := range memberships {
-				if _, ok := seen[membership.UserID]; ok {
-					continue
-				}
-				unique = append(unique, membership)
-				seen[membership.UserID] = struct{}{}
+		if p.milestones.list == nil {
+			p.milestones.list = []*milestones.Milestone{}
+		}
+		seen := map[int]struct{}{}
+		for _, membership := range ep.Memberships {
+			if _, ok := seen[membership.UserID]; ok {
+				continue
 			}
-			p.memberships = unique
+			p.memberships = append(p.memberships, membership)
+			seen[membership.UserID] = struct{}{}
 		}
 
-		milestonePaths, err := filepath.Glob(filepath.Join(dir, "milestones", "*.json"))
-		if err != nil {
-			return nil, "", err
-		}
-		for _, milestonePath := range milestonePaths {
-			mf, err := os.Open(milestonePath)
-			if err != nil {
-				return nil, "", err
-			}
-			defer mf.Close()
-			dec = json.NewDecoder(mf)
-			m := &milestones.Milestone{}
-			err = dec.Decode(m)
-			if err != nil {
-				return nil, "", err
+		if attachments {
+			for id, as := range ep.MilestoneAttachments {
+				for _, a := range as {
+					p.milestones.attachments[id] = append(p.milestones.attachments[id], &lhAttachment{
+						Attachment: a.Attachment,
+						filename:   local(a.Path),
+					})
+				}
 			}
-			mf.Close()
-			p.milestones.list = append(p.milestones.list, m)
 		}
-		sort.Slice(p.milestones.list, func(i, j int) bool { return p.milestones.list[i].ID < p.milestones.list[j].ID })
 
-		ticketDirs, err := filepath.Glob(filepath.Join(dir, "tickets", "*"))
-		if err != nil {
-			return nil, "", err
-		}
-		for _, ticketDir := range ticketDirs {
-			tf, err := os.Open(filepath.Join(ticketDir, "ticket.json"))
-			if err != nil {
-				return nil, "", err
-			}
-			defer tf.Close()
-			dec := json.NewDecoder(tf)
+		for _, et := range ep.Tickets {
 			t := &lhTicket{
-				Ticket: &tickets.Ticket{},
+				Ticket: et.Ticket,
 				attachments: lhAttachments{
 					list: []*lhAttachment{},
 				},
 			}
-			err = dec.Decode(t.Ticket)
-			if err != nil {
-				return nil, "", err
-			}
-			tf.Close()
-			filenameMap := map[string]*tickets.Attachment{}
-			for _, a := range t.Attachments {
-				filenameMap[a.Attachment.Filename] = a.Attachment
-			}
-			attachmentPaths, err := filepath.Glob(filepath.Join(ticketDir, "*"))
-			if err != nil {
-				return nil, "", err
+			if rawJSON {
+				t.filename = local(path.Join(et.Dir, "ticket.json"))
 			}
-			for _, attachmentPath := range attachmentPaths {
-				if filepath.Base(attachmentPath) == "ticket.json" {
-					continue
-				}
-				a, ok := filenameMap[filepath.Base(attachmentPath)]
-				if !ok {
-					continue
-				}
-				attachment := &lhAttachment{
-					Attachment: a,
-					filename:   attachmentPath,
+			if attachments {
+				for _, a := range et.Attachments {
+					t.attachments.list = append(t.attachments.list, &lhAttachment{
+						Attachment: a.Attachment,
+						filename:   local(a.Path),
+					})
 				}
-				t.attachments.list = append(t.attachments.list, attachment)
 			}
 			p.tickets.list = append(p.tickets.list, t)
 		}
-		sort.Slice(p.tickets.list, func(i, j int) bool { return p.tickets.list[i].Number < p.tickets.list[j].Number })
 
 		e.projects.list = append(e.projects.list, p)
 	}
-	sort.Slice(e.projects.list, func(i, j int) bool { return e.projects.list[i].ID < e.projects.list[j].ID })
 
-	return e, tempDir, nil
+	return e, cleanup, nil
 }
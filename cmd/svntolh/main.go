@@ -122,7 +122,7 @@ func createChangeset(repoPath, revision, commitAuthor string) (*changesets.Chang
 		Title:     title,
 		Body:      body,
 		Revision:  revision,
-		ChangedAt: &commitTime,
+		ChangedAt: lighthouse.NewTime(commitTime),
 		Changes:   changesets.Changes{},
 	}
 
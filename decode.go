@@ -0,0 +1,128 @@
+package lighthouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// UnknownFieldsError is returned by *Service.Decode when
+// Service.DisallowUnknownFields is set and a response contains
+// fields which aren't modeled by the type it was decoded into.
+type UnknownFieldsError struct {
+	// Fields maps the name of each type containing unknown
+	// fields, i.e., "tickets.Ticket", to the sorted names of
+	// those fields.
+	Fields map[string][]string
+}
+
+func (e *UnknownFieldsError) Error() string {
+	resources := make([]string, 0, len(e.Fields))
+	for resource := range e.Fields {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	for i, resource := range resources {
+		resources[i] = resource + " (" + strings.Join(e.Fields[resource], ", ") + ")"
+	}
+	return "unknown fields in response: " + strings.Join(resources, ", ")
+}
+
+// Decode decodes the JSON response body r into v.  Service packages
+// decode every response with Decode, so Service.DisallowUnknownFields
+// and Service.UnknownFieldsFunc can be used to detect fields which
+// Lighthouse has added or renamed.  Unknown fields are still
+// preserved by the types which support it, see UnknownFields.
+func (s *Service) Decode(r io.Reader, v interface{}) error {
+	if !s.DisallowUnknownFields && s.UnknownFieldsFunc == nil {
+		dec := json.NewDecoder(r)
+		return dec.Decode(v)
+	}
+
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	err = dec.Decode(v)
+	if err != nil {
+		return err
+	}
+
+	var data interface{}
+	dec = json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if dec.Decode(&data) != nil {
+		return nil
+	}
+	found := map[string]map[string]bool{}
+	unknownFields(data, reflect.TypeOf(v), found)
+	if len(found) == 0 {
+		return nil
+	}
+
+	fields := map[string][]string{}
+	resources := make([]string, 0, len(found))
+	for resource, names := range found {
+		resources = append(resources, resource)
+		for name := range names {
+			fields[resource] = append(fields[resource], name)
+		}
+		sort.Strings(fields[resource])
+	}
+	sort.Strings(resources)
+	if s.UnknownFieldsFunc != nil {
+		for _, resource := range resources {
+			s.UnknownFieldsFunc(resource, fields[resource])
+		}
+	}
+	if s.DisallowUnknownFields {
+		return &UnknownFieldsError{Fields: fields}
+	}
+	return nil
+}
+
+// unknownFields records in found the names of the fields of each
+// JSON object in data which don't correspond to a field of the
+// struct type it is decoded into when decoding into t, keyed by
+// struct type name.  Values whose JSON representation doesn't match
+// t, i.e., those of types with their own UnmarshalJSON method, are
+// not examined.
+func unknownFields(data interface{}, t reflect.Type, found map[string]map[string]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch x := data.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Struct:
+			types := jsonFieldTypes(t)
+			for name, value := range x {
+				ft, ok := types[strings.ToLower(name)]
+				if ok {
+					unknownFields(value, ft, found)
+					continue
+				}
+				resource := t.String()
+				if found[resource] == nil {
+					found[resource] = map[string]bool{}
+				}
+				found[resource][name] = true
+			}
+		case reflect.Map:
+			for _, value := range x {
+				unknownFields(value, t.Elem(), found)
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, value := range x {
+				unknownFields(value, t.Elem(), found)
+			}
+		}
+	}
+}
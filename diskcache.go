@@ -0,0 +1,216 @@
+package lighthouse
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// DiskCache is an http.RoundTripper which caches GET responses
+// carrying an ETag or Last-Modified header in a directory on disk.
+// Cached responses are revalidated with If-None-Match or
+// If-Modified-Since, and a 304 Not Modified response is answered with
+// the cached body.  This allows an interrupted export to be re-run
+// while only re-downloading resources which have changed.
+//
+// DiskCache is typically used as a *Transport's Base so requests are
+// authenticated before they are cached.  Cache entries are keyed by
+// request URL with any API token removed, see RedactURL.
+type DiskCache struct {
+	// Dir is the directory cache entries are written to.  It is
+	// created if necessary.
+	Dir string
+
+	// Base specifies the mechanism by which individual HTTP
+	// requests are made.  If Base is nil, http.DefaultTransport
+	// is used.
+	Base http.RoundTripper
+}
+
+// diskCacheEntry is the metadata of a cached response, stored
+// alongside its body.
+type diskCacheEntry struct {
+	URL          string      `json:"url"`
+	ETag         string      `json:"etag"`
+	LastModified string      `json:"last_modified,omitempty"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header"`
+}
+
+func (dc *DiskCache) base() http.RoundTripper {
+	if dc.Base != nil {
+		return dc.Base
+	}
+	return http.DefaultTransport
+}
+
+// path returns the path of the cache entry for key without an
+// extension.
+func (dc *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dc.Dir, hex.EncodeToString(sum[:]))
+}
+
+func (dc *DiskCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheable(req) {
+		return dc.base().RoundTrip(req)
+	}
+
+	key := RedactURL(req.URL)
+	path := dc.path(key)
+	entry, cached := dc.read(path, key)
+
+	req2 := req
+	if cached {
+		req2 = conditionalRequest(req, entry.ETag, entry.LastModified)
+	}
+
+	resp, err := dc.base().RoundTrip(req2)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached && resp.StatusCode == http.StatusNotModified {
+		body, err := os.Open(path + ".body")
+		if err != nil {
+			// entry was removed, fetch it again
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			return dc.base().RoundTrip(req)
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		fi, err := body.Stat()
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		return &http.Response{
+			Status:        http.StatusText(entry.StatusCode),
+			StatusCode:    entry.StatusCode,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        entry.Header,
+			Body:          body,
+			ContentLength: fi.Size(),
+			Request:       req,
+		}, nil
+	}
+
+	etag, lastModified := validators(resp)
+	if resp.StatusCode != http.StatusOK || (len(etag) == 0 && len(lastModified) == 0) {
+		return resp, nil
+	}
+
+	err = os.MkdirAll(dc.Dir, 0700)
+	if err != nil {
+		return resp, nil
+	}
+	tmp, err := ioutil.TempFile(dc.Dir, "body")
+	if err != nil {
+		return resp, nil
+	}
+	resp.Body = &diskCacheBody{
+		body: resp.Body,
+		tmp:  tmp,
+		w:    bufio.NewWriter(tmp),
+		path: path,
+		entry: &diskCacheEntry{
+			URL:          key,
+			ETag:         etag,
+			LastModified: lastModified,
+			StatusCode:   resp.StatusCode,
+			Header:       resp.Header,
+		},
+	}
+	return resp, nil
+}
+
+// read returns the cache entry at path if it exists and is for key.
+func (dc *DiskCache) read(path, key string) (*diskCacheEntry, bool) {
+	buf, err := ioutil.ReadFile(path + ".json")
+	if err != nil {
+		return nil, false
+	}
+	entry := &diskCacheEntry{}
+	err = json.Unmarshal(buf, entry)
+	if err != nil || entry.URL != key || (len(entry.ETag) == 0 && len(entry.LastModified) == 0) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// diskCacheBody copies a response body to a temporary file as it is
+// read.  If the body is read to EOF without error, Close moves the
+// file into place and writes its cache entry.
+type diskCacheBody struct {
+	body  io.ReadCloser
+	tmp   *os.File
+	w     *bufio.Writer
+	path  string
+	entry *diskCacheEntry
+	eof   bool
+	err   error
+}
+
+func (db *diskCacheBody) Read(p []byte) (int, error) {
+	n, err := db.body.Read(p)
+	if n > 0 && db.err == nil {
+		_, db.err = db.w.Write(p[:n])
+	}
+	if err == io.EOF {
+		db.eof = true
+	} else if err != nil && db.err == nil {
+		db.err = err
+	}
+	return n, err
+}
+
+func (db *diskCacheBody) Close() error {
+	err := db.body.Close()
+	if db.tmp == nil {
+		return err
+	}
+	commit := db.eof && db.err == nil
+	if commit {
+		commit = db.w.Flush() == nil
+	}
+	db.tmp.Close()
+	if commit {
+		commit = db.commit() == nil
+	}
+	if !commit {
+		os.Remove(db.tmp.Name())
+	}
+	db.tmp = nil
+	return err
+}
+
+func (db *diskCacheBody) commit() error {
+	var b bytes.Buffer
+	err := json.NewEncoder(&b).Encode(db.entry)
+	if err != nil {
+		return err
+	}
+	// remove the old entry first so a crash never pairs new
+	// validators with an old body
+	os.Remove(db.path + ".json")
+	err = os.Rename(db.tmp.Name(), db.path+".body")
+	if err != nil {
+		return err
+	}
+	tmp := db.path + ".json.tmp"
+	err = ioutil.WriteFile(tmp, b.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, db.path+".json")
+}
@@ -0,0 +1,122 @@
+package lighthouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// DryRunHeader is set on the synthetic responses returned for
+// requests intercepted by Service.DryRun.  CheckResponse treats such
+// responses as successful whatever status was expected.
+const DryRunHeader = "X-Lighthouse-Dry-Run"
+
+// dryRunMethods are the methods intercepted when Service.DryRun is
+// set.
+var dryRunMethods = map[string]bool{
+	"POST":   true,
+	"PUT":    true,
+	"DELETE": true,
+}
+
+// isDryRun reports whether a request using method should be
+// intercepted instead of sent.
+func (s *Service) isDryRun(method string) bool {
+	return s.DryRun && dryRunMethods[strings.ToUpper(method)]
+}
+
+// dryRun logs req and returns a synthetic successful response
+// without sending it.  The response echoes JSON and XML request
+// bodies, so methods which decode the resource they created from
+// the response return what would have been sent.
+func (s *Service) dryRun(req *http.Request) (*http.Response, error) {
+	var buf []byte
+	if req.Body != nil {
+		var err error
+		buf, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	u, body := RedactURL(req.URL), dryRunBody(req.Header, buf)
+	if s.Logger != nil {
+		s.Logger.Info("api request dry run", "method", req.Method, "url", u, "body", body)
+	} else {
+		fmt.Fprintf(os.Stderr, "dry run: %s %s\n", req.Method, u)
+		if len(body) > 0 {
+			fmt.Fprintln(os.Stderr, body)
+		}
+	}
+
+	status := http.StatusOK
+	if req.Method == "POST" {
+		status = http.StatusCreated
+	}
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Request:    req,
+	}
+	resp.Header.Set(DryRunHeader, "true")
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if strings.HasSuffix(mediaType, "json") || strings.HasSuffix(mediaType, "xml") {
+		resp.Header.Set("Content-Type", req.Header.Get("Content-Type"))
+	} else {
+		buf = nil
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(buf))
+	resp.ContentLength = int64(len(buf))
+	return resp, nil
+}
+
+// dryRunBody returns buf decoded for logging: JSON is indented and
+// the parts of multipart forms, i.e., attachment uploads, are listed
+// in order.
+func dryRunBody(h http.Header, buf []byte) string {
+	mediaType, params, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	switch {
+	case len(buf) == 0:
+		return ""
+	case strings.HasSuffix(mediaType, "json") || len(mediaType) == 0 && json.Valid(buf):
+		out := &bytes.Buffer{}
+		if json.Indent(out, buf, "", "  ") == nil {
+			return Redact(out.String())
+		}
+	case strings.HasPrefix(mediaType, "multipart/"):
+		parts := []string{}
+		mr := multipart.NewReader(bytes.NewReader(buf), params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return logBody(h, buf)
+			}
+			pbuf, err := ioutil.ReadAll(p)
+			if err != nil {
+				return logBody(h, buf)
+			}
+			if len(p.FileName()) > 0 {
+				parts = append(parts, fmt.Sprintf("%s: <%d bytes %s>", p.FormName(), len(pbuf), p.FileName()))
+				continue
+			}
+			parts = append(parts, p.FormName()+": "+dryRunBody(http.Header(p.Header), pbuf))
+		}
+		return strings.Join(parts, "\n")
+	}
+	return logBody(h, buf)
+}
@@ -0,0 +1,137 @@
+package lighthouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxErrorMessageLength is the maximum length of a message extracted
+// from an HTML or plain text error body, whose contents may be an
+// entire error page.
+const maxErrorMessageLength = 200
+
+var (
+	htmlIgnoredRE = regexp.MustCompile(`(?is)<(head|script|style)\b.*?</(head|script|style)\s*>`)
+	htmlTagRE     = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// errorMessages returns the messages explaining why a request failed
+// found in body, the body of an error response with the given content
+// type.  JSON bodies are searched for strings such as
+// {"error": "..."} or Lighthouse's [["field", "message"]] validation
+// errors, XML bodies such as <errors><error>...</error></errors>
+// contribute the text of each element and HTML and plain text bodies
+// contribute their text with whitespace collapsed.
+func errorMessages(body []byte, contentType string) []string {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil
+	}
+
+	var value interface{}
+	if json.Unmarshal(body, &value) == nil {
+		return jsonErrorMessages(value)
+	}
+
+	head := body
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	isHTML := strings.Contains(contentType, "html") ||
+		bytes.Contains(bytes.ToLower(head), []byte("<html"))
+	if !isHTML && body[0] == '<' {
+		if msgs, ok := xmlErrorMessages(body); ok {
+			return msgs
+		}
+	}
+
+	text := string(body)
+	if isHTML {
+		text = htmlIgnoredRE.ReplaceAllString(text, " ")
+		text = html.UnescapeString(htmlTagRE.ReplaceAllString(text, " "))
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) == 0 {
+		return nil
+	}
+	if runes := []rune(text); len(runes) > maxErrorMessageLength {
+		text = string(runes[:maxErrorMessageLength]) + "..."
+	}
+	return []string{text}
+}
+
+// jsonErrorMessages returns the messages found in value, a decoded
+// JSON error body.
+func jsonErrorMessages(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if s := strings.TrimSpace(v); len(s) > 0 {
+			return []string{s}
+		}
+	case []interface{}:
+		var msgs []string
+		for _, elem := range v {
+			// [["field", "message"], ...]
+			if pair, ok := elem.([]interface{}); ok && len(pair) == 2 {
+				field, fok := pair[0].(string)
+				msg, mok := pair[1].(string)
+				if fok && mok {
+					msgs = append(msgs, strings.TrimSpace(field+" "+msg))
+					continue
+				}
+			}
+			msgs = append(msgs, jsonErrorMessages(elem)...)
+		}
+		return msgs
+	case map[string]interface{}:
+		var msgs []string
+		for _, key := range []string{"error", "errors", "message", "messages"} {
+			if field, ok := v[key]; ok {
+				msgs = append(msgs, jsonErrorMessages(field)...)
+			}
+		}
+		if len(msgs) > 0 || len(v) == 0 {
+			return msgs
+		}
+		// {"field": ["message", ...], ...}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			for _, msg := range jsonErrorMessages(v[key]) {
+				msgs = append(msgs, key+" "+msg)
+			}
+		}
+		return msgs
+	}
+	return nil
+}
+
+// xmlErrorMessages returns the text of each element of the XML error
+// body, and false if body is not well-formed XML.
+func xmlErrorMessages(body []byte) ([]string, bool) {
+	var msgs []string
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return msgs, true
+		}
+		if err != nil {
+			return nil, false
+		}
+		if cd, ok := tok.(xml.CharData); ok {
+			if s := strings.Join(strings.Fields(string(cd)), " "); len(s) > 0 {
+				msgs = append(msgs, s)
+			}
+		}
+	}
+}
@@ -0,0 +1,434 @@
+// Package events polls the activity of a Lighthouse project, i.e.,
+// new ticket versions, messages, message comments and changesets, and
+// delivers it as typed Events.  Lighthouse has no activity feed API,
+// so each poll lists the project's resources and compares them with
+// what earlier polls saw, delivering each event once.
+package events
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/messages"
+	"github.com/nwidger/lighthouse/tickets"
+)
+
+// DefaultInterval is the time between polls used by Events if
+// Poller.Interval is zero.
+const DefaultInterval = time.Minute
+
+// Kind is the kind of an Event.
+type Kind string
+
+const (
+	// TicketCreated is delivered for the first version of a
+	// ticket.
+	TicketCreated Kind = "ticket_created"
+	// TicketUpdated is delivered for each later version of a
+	// ticket, i.e., a comment or a change to its state, tags,
+	// assignee or milestone.
+	TicketUpdated Kind = "ticket_updated"
+	// MessageCreated is delivered for each new message.
+	MessageCreated Kind = "message_created"
+	// MessageCommented is delivered for each new comment on a
+	// message.
+	MessageCommented Kind = "message_commented"
+	// ChangesetCreated is delivered for each new changeset.
+	ChangesetCreated Kind = "changeset_created"
+)
+
+// Kinds lists every Kind.
+var Kinds = []Kind{TicketCreated, TicketUpdated, MessageCreated, MessageCommented, ChangesetCreated}
+
+// Event is a single change to a project.  Which resource fields are
+// set depends on Kind: Ticket and Version for TicketCreated and
+// TicketUpdated, Message for MessageCreated, Message and Comment for
+// MessageCommented and Changeset for ChangesetCreated.
+type Event struct {
+	Kind      Kind      `json:"kind"`
+	ProjectID int       `json:"project_id"`
+	Time      time.Time `json:"time"`
+
+	Ticket    *tickets.Ticket        `json:"ticket,omitempty"`
+	Version   *tickets.TicketVersion `json:"version,omitempty"`
+	Message   *messages.Message      `json:"message,omitempty"`
+	Comment   *messages.Comment      `json:"comment,omitempty"`
+	Changeset *changesets.Changeset  `json:"changeset,omitempty"`
+}
+
+// ID returns an identifier unique to e within its project, i.e.,
+// 'ticket/42/3' for version 3 of ticket 42.
+func (e *Event) ID() string {
+	switch {
+	case e.Version != nil:
+		return "ticket/" + strconv.Itoa(e.Version.Number) + "/" + strconv.Itoa(e.Version.Version)
+	case e.Comment != nil:
+		return "comment/" + strconv.Itoa(e.Comment.ID)
+	case e.Message != nil:
+		return "message/" + strconv.Itoa(e.Message.ID)
+	case e.Changeset != nil:
+		return "changeset/" + e.Changeset.Revision
+	}
+	return string(e.Kind)
+}
+
+// Poller polls a project for events.  The first poll records the
+// project's current activity without delivering it, unless Since is
+// set.  Poller must not be used concurrently.
+type Poller struct {
+	// Interval is the time between polls made by Events.  If
+	// Interval is zero, DefaultInterval is used.
+	Interval time.Duration
+
+	// Kinds, if non-empty, limits the events polled for.
+	// Resources are only listed if one of their kinds is
+	// included, i.e., messages are not listed unless Kinds
+	// includes MessageCreated or MessageCommented.
+	Kinds []Kind
+
+	// Since, if non-zero, causes the first poll to deliver the
+	// events which occurred at or after Since rather than only
+	// recording the project's current activity.
+	Since time.Time
+
+	// ErrorFunc, if non-nil, is called by Events with the error
+	// returned by each failed poll.  Events keeps polling after
+	// errors.
+	ErrorFunc func(err error)
+
+	s         *lighthouse.Service
+	projectID int
+
+	// ticketsSince is the latest update time of the tickets seen
+	// so far and ticketsSeen contains the tickets updated at or
+	// after it, by number.
+	ticketsPolled bool
+	ticketsSince  time.Time
+	ticketsSeen   map[int]*ticketSeen
+
+	// messageComments maps the IDs of the messages seen so far to
+	// their number of comments.
+	messagesPolled  bool
+	messageComments map[int]int
+
+	// revisions contains the revisions of the changesets in the
+	// latest page of changesets.
+	changesetsPolled bool
+	revisions        map[string]bool
+}
+
+// ticketSeen records the update time and, if known, latest version
+// of a ticket seen by a poll.
+type ticketSeen struct {
+	updated time.Time
+	version int
+}
+
+// NewPoller returns a *Poller for project projectID.
+func NewPoller(s *lighthouse.Service, projectID int) *Poller {
+	return &Poller{
+		s:               s,
+		projectID:       projectID,
+		ticketsSeen:     map[int]*ticketSeen{},
+		messageComments: map[int]int{},
+		revisions:       map[string]bool{},
+	}
+}
+
+func (p *Poller) polls(kinds ...Kind) bool {
+	if len(p.Kinds) == 0 {
+		return true
+	}
+	for _, k := range p.Kinds {
+		for _, kind := range kinds {
+			if k == kind {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// deliver reports whether an event of kind which occurred at t is
+// delivered by the current poll, where polled reports whether its
+// resource has been polled before.
+func (p *Poller) deliver(kind Kind, t *lighthouse.Time, polled bool) bool {
+	if !p.polls(kind) {
+		return false
+	}
+	if polled {
+		return true
+	}
+	if p.Since.IsZero() {
+		return false
+	}
+	return t != nil && !t.Before(p.Since)
+}
+
+// recording reports whether a poll of a resource, which has been
+// polled before if polled is set, only records the project's current
+// activity.
+func (p *Poller) recording(polled bool) bool {
+	return !polled && p.Since.IsZero()
+}
+
+func eventTime(t *lighthouse.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.Time
+}
+
+// Poll polls the project once and returns the events which occurred
+// since the previous poll, sorted by time.  If listing a resource
+// fails, the events of the resources polled so far are returned
+// along with the error, and the failed resource is polled again by
+// the next call to Poll.
+func (p *Poller) Poll(reqOpts ...lighthouse.RequestOption) ([]*Event, error) {
+	events := []*Event{}
+	var err error
+	if p.polls(TicketCreated, TicketUpdated) {
+		err = p.pollTickets(&events, reqOpts...)
+	}
+	if err == nil && p.polls(MessageCreated, MessageCommented) {
+		err = p.pollMessages(&events, reqOpts...)
+	}
+	if err == nil && p.polls(ChangesetCreated) {
+		err = p.pollChangesets(&events, reqOpts...)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+	return events, err
+}
+
+// pollTickets lists the tickets, open or closed, updated since the
+// latest update seen so far, most recently updated first, retrieving
+// the versions of those updated since they were last seen.
+func (p *Poller) pollTickets(events *[]*Event, reqOpts ...lighthouse.RequestOption) error {
+	since := p.ticketsSince
+	if !p.ticketsPolled && !p.Since.IsZero() {
+		since = p.Since
+	}
+	latest := since
+	found := []*Event{}
+	seen := map[int]*ticketSeen{}
+	ts := tickets.NewService(p.s, p.projectID)
+	opts := &tickets.ListOptions{
+		Query: "all sort:updated",
+		Limit: tickets.MaxLimit,
+	}
+	for page := 1; ; page++ {
+		opts.Page = page
+		list, err := ts.List(opts, reqOpts...)
+		if err != nil {
+			return err
+		}
+		// when recording, only the latest update is needed
+		done := len(list) < opts.Limit || p.recording(p.ticketsPolled)
+		for _, t := range list {
+			updated := eventTime(t.UpdatedAt)
+			if updated.Before(since) {
+				done = true
+				break
+			}
+			if updated.After(latest) {
+				latest = updated
+			}
+			prev := p.ticketsSeen[t.Number]
+			seen[t.Number] = &ticketSeen{updated: updated, version: t.Version}
+			// update times only have a precision of seconds,
+			// so the version is also compared if it is known
+			unchanged := prev != nil && !updated.After(prev.updated) && t.Version <= prev.version
+			if p.recording(p.ticketsPolled) || unchanged {
+				if prev != nil && prev.version > t.Version {
+					seen[t.Number].version = prev.version
+				}
+				continue
+			}
+			full := t
+			if len(full.Versions) == 0 {
+				full, err = ts.GetByNumber(t.Number, reqOpts...)
+				if err != nil {
+					return err
+				}
+			}
+			for _, v := range full.Versions {
+				if v.Version > seen[t.Number].version {
+					seen[t.Number].version = v.Version
+				}
+				switch {
+				case prev != nil && prev.version > 0:
+					if v.Version <= prev.version {
+						continue
+					}
+				case prev != nil:
+					if !eventTime(v.CreatedAt).After(prev.updated) {
+						continue
+					}
+				default:
+					// versions of tickets not seen
+					// before are only new if they
+					// occurred since
+					if eventTime(v.CreatedAt).Before(since) {
+						continue
+					}
+				}
+				kind := TicketUpdated
+				if v.Version == 1 {
+					kind = TicketCreated
+				}
+				if !p.deliver(kind, v.CreatedAt, p.ticketsPolled) {
+					continue
+				}
+				found = append(found, &Event{
+					Kind:      kind,
+					ProjectID: p.projectID,
+					Time:      eventTime(v.CreatedAt),
+					Ticket:    full,
+					Version:   v,
+				})
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	// tickets updated before latest can't be returned by the
+	// next poll, so only those updated since are remembered
+	p.ticketsSince = latest
+	p.ticketsSeen = map[int]*ticketSeen{}
+	for number, ts := range seen {
+		if !ts.updated.Before(latest) {
+			p.ticketsSeen[number] = ts
+		}
+	}
+	p.ticketsPolled = true
+	*events = append(*events, found...)
+	return nil
+}
+
+// pollMessages lists the project's messages, retrieving the comments
+// of those with new comments.
+func (p *Poller) pollMessages(events *[]*Event, reqOpts ...lighthouse.RequestOption) error {
+	found := []*Event{}
+	counts := map[int]int{}
+	ms := messages.NewService(p.s, p.projectID)
+	list, err := ms.List(reqOpts...)
+	if err != nil {
+		return err
+	}
+	for _, m := range list {
+		counts[m.ID] = m.CommentsCount
+		known, ok := p.messageComments[m.ID]
+		if !ok && p.deliver(MessageCreated, m.CreatedAt, p.messagesPolled) {
+			found = append(found, &Event{
+				Kind:      MessageCreated,
+				ProjectID: p.projectID,
+				Time:      eventTime(m.CreatedAt),
+				Message:   m,
+			})
+		}
+		if m.CommentsCount <= known || !p.polls(MessageCommented) || p.recording(p.messagesPolled) {
+			continue
+		}
+		full := m
+		if len(full.Comments) < m.CommentsCount {
+			full, err = ms.GetByID(m.ID, reqOpts...)
+			if err != nil {
+				return err
+			}
+		}
+		comments := append(messages.Comments(nil), full.Comments...)
+		sort.SliceStable(comments, func(i, j int) bool {
+			return eventTime(comments[i].CreatedAt).Before(eventTime(comments[j].CreatedAt))
+		})
+		for i, c := range comments {
+			if i < known || !p.deliver(MessageCommented, c.CreatedAt, p.messagesPolled) {
+				continue
+			}
+			found = append(found, &Event{
+				Kind:      MessageCommented,
+				ProjectID: p.projectID,
+				Time:      eventTime(c.CreatedAt),
+				Message:   full,
+				Comment:   c,
+			})
+		}
+	}
+	p.messageComments = counts
+	p.messagesPolled = true
+	*events = append(*events, found...)
+	return nil
+}
+
+// pollChangesets lists the latest page of the project's changesets.
+// Changesets are compared by revision rather than time since a
+// changeset's time is when it was committed, not when it was
+// pushed.
+func (p *Poller) pollChangesets(events *[]*Event, reqOpts ...lighthouse.RequestOption) error {
+	found := []*Event{}
+	revisions := map[string]bool{}
+	cs := changesets.NewService(p.s, p.projectID)
+	list, err := cs.List(nil, reqOpts...)
+	if err != nil {
+		return err
+	}
+	for _, c := range list {
+		revisions[c.Revision] = true
+		if p.revisions[c.Revision] || !p.deliver(ChangesetCreated, c.ChangedAt, p.changesetsPolled) {
+			continue
+		}
+		found = append(found, &Event{
+			Kind:      ChangesetCreated,
+			ProjectID: p.projectID,
+			Time:      eventTime(c.ChangedAt),
+			Changeset: c,
+		})
+	}
+	p.revisions = revisions
+	p.changesetsPolled = true
+	*events = append(*events, found...)
+	return nil
+}
+
+// Events polls the project every Interval, delivering each event on
+// the returned channel, until ctx is done.  The channel is closed
+// once polling stops.  Errors are passed to ErrorFunc.
+func (p *Poller) Events(ctx context.Context, reqOpts ...lighthouse.RequestOption) <-chan *Event {
+	ch := make(chan *Event)
+	interval := p.Interval
+	if interval == 0 {
+		interval = DefaultInterval
+	}
+	reqOpts = append([]lighthouse.RequestOption{lighthouse.WithContext(ctx)}, reqOpts...)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			events, err := p.Poll(reqOpts...)
+			for _, e := range events {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil && ctx.Err() == nil && p.ErrorFunc != nil {
+				p.ErrorFunc(err)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,51 @@
+package events_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/nwidger/lighthouse/events"
+	"github.com/nwidger/lighthouse/lighthousetest"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+)
+
+func ExamplePoller() {
+	srv := lighthousetest.NewServer()
+	defer srv.Close()
+
+	p := srv.AddProject(&projects.Project{Name: "Widgets"})
+	srv.AddTicket(p.ID, &tickets.Ticket{Title: "Crash on login"})
+
+	poller := events.NewPoller(srv.Service(), p.ID)
+	poller.Kinds = []events.Kind{events.TicketCreated, events.TicketUpdated}
+
+	// the first poll only records the project's current activity
+	evs, err := poller.Poll()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(len(evs), "events")
+
+	t := tickets.NewService(srv.Service(), p.ID)
+	_, err = t.Create(&tickets.Ticket{Title: "Add dark mode"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = t.Comment(1, "Fixed in 1.2.3")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	evs, err = poller.Poll()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, e := range evs {
+		fmt.Println(e.Kind, e.ID(), e.Ticket.Title)
+	}
+	// Unordered output:
+	// 0 events
+	// ticket_created ticket/2/1 Add dark mode
+	// ticket_updated ticket/1/2 Crash on login
+}
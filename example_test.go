@@ -1,10 +1,15 @@
 package lighthouse_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 
 	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/lighthousetest"
+	"github.com/nwidger/lighthouse/projects"
 	"github.com/nwidger/lighthouse/tickets"
 )
 
@@ -37,3 +42,82 @@ func ExampleNewService() {
 		fmt.Println(t.Number, t.Title, t.Tags, t.Priority, t.State)
 	}
 }
+
+func ExampleTime() {
+	var m struct {
+		CreatedAt *lighthouse.Time `json:"created_at"`
+		DueOn     *lighthouse.Time `json:"due_on"`
+	}
+	err := json.Unmarshal([]byte(`{"created_at":"2009/06/09 19:12:40 -0700","due_on":"2009-07-01"}`), &m)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(m.CreatedAt.UTC())
+
+	buf, err := json.Marshal(m)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(buf))
+	// Output:
+	// 2009-06-10 02:12:40 +0000 UTC
+	// {"created_at":"2009/06/09 19:12:40 -0700","due_on":"2009-07-01"}
+}
+
+func ExampleBatch() {
+	srv := lighthousetest.NewServer()
+	defer srv.Close()
+	p := srv.AddProject(&projects.Project{Name: "Widgets"})
+	srv.AddTicket(p.ID, &tickets.Ticket{Title: "Crash on login"})
+	srv.AddTicket(p.ID, &tickets.Ticket{Title: "Add dark mode"})
+
+	t := tickets.NewService(srv.Service(), p.ID)
+	numbers := []int{2, 3, 1}
+	results, err := lighthouse.NewBatch(4).Run(context.Background(), len(numbers), func(ctx context.Context, i int) (interface{}, error) {
+		return t.GetByNumber(numbers[i], lighthouse.WithContext(ctx))
+	})
+	for i, result := range results {
+		if tkt, ok := result.(*tickets.Ticket); ok && tkt != nil {
+			fmt.Println(numbers[i], tkt.Title)
+		}
+	}
+	var me *lighthouse.MultiError
+	if errors.As(err, &me) {
+		for _, bi := range me.Items {
+			fmt.Println(numbers[bi.Index], errors.Is(bi, lighthouse.ErrNotFound))
+		}
+	}
+	// Output:
+	// 2 Add dark mode
+	// 1 Crash on login
+	// 3 true
+}
+
+func ExampleMarshalCanonical() {
+	t := &tickets.Ticket{
+		Number:  42,
+		RawData: json.RawMessage(`{"b":1,"a":[2,{"d":null,"c":3}]}`),
+	}
+	buf, err := lighthouse.MarshalCanonical(map[string]interface{}{
+		"number":   t.Number,
+		"raw_data": t.RawData,
+		"tags":     t.Tags,
+	}, lighthouse.NullsOmitted)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(string(buf))
+	// Output:
+	// {
+	//   "number": 42,
+	//   "raw_data": {
+	//     "a": [
+	//       2,
+	//       {
+	//         "c": 3
+	//       }
+	//     ],
+	//     "b": 1
+	//   }
+	// }
+}
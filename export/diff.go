@@ -0,0 +1,224 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+const (
+	// Kinds of resources compared by Diff.
+	KindProject    = "project"
+	KindMilestone  = "milestone"
+	KindTicket     = "ticket"
+	KindAttachment = "attachment"
+
+	// Types of Change.
+	Added   = "added"
+	Changed = "changed"
+	Removed = "removed"
+)
+
+// Change is a difference between two exports found by Diff.
+type Change struct {
+	// Kind is one of KindProject, KindMilestone, KindTicket or
+	// KindAttachment.
+	Kind string `json:"kind"`
+	// Change is one of Added, Changed or Removed.
+	Change string `json:"change"`
+
+	ProjectID int    `json:"project_id"`
+	Project   string `json:"project"`
+
+	// ID identifies the resource within its project, i.e., its
+	// ID or, for tickets and their attachments, the ticket
+	// number.
+	ID int `json:"id"`
+	// Name is the resource's name, title or filename.
+	Name string `json:"name"`
+
+	// Fields lists the JSON fields of a changed resource whose
+	// values differ.
+	Fields []string `json:"fields,omitempty"`
+	// Versions is the number of versions added to (or, if
+	// negative, removed from) a changed ticket.
+	Versions int `json:"versions,omitempty"`
+}
+
+type Changes []*Change
+
+// Summary counts changes by kind and type, i.e.,
+// summary["ticket"]["added"].
+func (cs Changes) Summary() map[string]map[string]int {
+	summary := map[string]map[string]int{}
+	for _, c := range cs {
+		if summary[c.Kind] == nil {
+			summary[c.Kind] = map[string]int{}
+		}
+		summary[c.Kind][c.Change]++
+	}
+	return summary
+}
+
+// ignoredFields are the fields not compared by Diff, either because
+// they change whenever anything else does or because they are
+// compared separately.
+var ignoredFields = map[string]bool{
+	"updated_at":           true,
+	"versions":             true,
+	"attachments":          true,
+	"attachments_count":    true,
+	"version":              true,
+	"open_tickets_count":   true,
+	"tickets_count":        true,
+	"open_tickets_percent": true,
+	"body_html":            true,
+	"original_body_html":   true,
+	"latest_body":          true,
+	"raw_data":             true,
+}
+
+// changedFields returns the sorted names of the JSON fields of a and
+// b, which must be of the same type, whose values differ.
+func changedFields(a, b interface{}) []string {
+	fields := func(v interface{}) map[string]json.RawMessage {
+		m := map[string]json.RawMessage{}
+		buf, err := json.Marshal(v)
+		if err == nil {
+			json.Unmarshal(buf, &m)
+		}
+		return m
+	}
+	fa, fb := fields(a), fields(b)
+	changed := []string{}
+	for name, va := range fa {
+		if ignoredFields[name] {
+			continue
+		}
+		if vb, ok := fb[name]; !ok || !bytes.Equal(va, vb) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range fb {
+		if _, ok := fa[name]; !ok && !ignoredFields[name] {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// Diff returns the projects, milestones, tickets and ticket
+// attachments added, changed or removed between export from and
+// export to, i.e., a backup and a later backup of the same account.
+// Changes are grouped by project in order of project ID.  Tickets of
+// added or removed projects are not listed individually.
+func Diff(from, to *Export) Changes {
+	cs := Changes{}
+	ids := map[int]bool{}
+	for _, p := range from.Projects {
+		ids[p.ID] = true
+	}
+	for _, p := range to.Projects {
+		ids[p.ID] = true
+	}
+	sorted := make([]int, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Ints(sorted)
+
+	for _, id := range sorted {
+		pa, okA := from.Project(id)
+		pb, okB := to.Project(id)
+		switch {
+		case !okA:
+			cs = append(cs, &Change{Kind: KindProject, Change: Added, ProjectID: id, Project: pb.Name, ID: id, Name: pb.Name})
+		case !okB:
+			cs = append(cs, &Change{Kind: KindProject, Change: Removed, ProjectID: id, Project: pa.Name, ID: id, Name: pa.Name})
+		default:
+			cs = append(cs, diffProject(pa, pb)...)
+		}
+	}
+	return cs
+}
+
+// diffProject returns the changes between two versions of the same
+// project.
+func diffProject(pa, pb *Project) Changes {
+	cs := Changes{}
+	change := func(kind, typ string, id int, name string) *Change {
+		c := &Change{Kind: kind, Change: typ, ProjectID: pb.ID, Project: pb.Name, ID: id, Name: name}
+		cs = append(cs, c)
+		return c
+	}
+
+	if fields := changedFields(pa.Project, pb.Project); len(fields) > 0 {
+		change(KindProject, Changed, pb.ID, pb.Name).Fields = fields
+	}
+
+	milestones := map[int]bool{}
+	for _, mb := range pb.Milestones {
+		milestones[mb.ID] = true
+		found := false
+		for _, ma := range pa.Milestones {
+			if ma.ID != mb.ID {
+				continue
+			}
+			found = true
+			if fields := changedFields(ma, mb); len(fields) > 0 {
+				change(KindMilestone, Changed, mb.ID, mb.Title).Fields = fields
+			}
+			break
+		}
+		if !found {
+			change(KindMilestone, Added, mb.ID, mb.Title)
+		}
+	}
+	for _, ma := range pa.Milestones {
+		if !milestones[ma.ID] {
+			change(KindMilestone, Removed, ma.ID, ma.Title)
+		}
+	}
+
+	tickets := map[int]bool{}
+	for _, tb := range pb.Tickets {
+		tickets[tb.Number] = true
+		ta, ok := pa.Ticket(tb.Number)
+		if !ok {
+			change(KindTicket, Added, tb.Number, tb.Title)
+			for _, a := range tb.Attachments {
+				change(KindAttachment, Added, tb.Number, a.Filename)
+			}
+			continue
+		}
+		fields := changedFields(ta.Ticket, tb.Ticket)
+		versions := len(tb.Versions) - len(ta.Versions)
+		if len(fields) > 0 || versions != 0 {
+			c := change(KindTicket, Changed, tb.Number, tb.Title)
+			c.Fields, c.Versions = fields, versions
+		}
+		attachments := map[int]bool{}
+		for _, a := range ta.Attachments {
+			attachments[a.ID] = true
+		}
+		for _, a := range tb.Attachments {
+			if !attachments[a.ID] {
+				change(KindAttachment, Added, tb.Number, a.Filename)
+			}
+			delete(attachments, a.ID)
+		}
+		for _, a := range ta.Attachments {
+			if attachments[a.ID] {
+				change(KindAttachment, Removed, tb.Number, a.Filename)
+			}
+		}
+	}
+	for _, ta := range pa.Tickets {
+		if !tickets[ta.Number] {
+			change(KindTicket, Removed, ta.Number, ta.Title)
+		}
+	}
+
+	return cs
+}
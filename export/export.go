@@ -0,0 +1,497 @@
+// Package export reads Lighthouse account exports such as those
+// written by 'lh export'.  An export is a gzipped tarball (or a
+// directory it was extracted to) with the following layout:
+//
+//	ACCOUNT/plan.json
+//	ACCOUNT/profile.json
+//	ACCOUNT/projects/ID-PERMALINK/project.json
+//	ACCOUNT/projects/ID-PERMALINK/memberships.json
+//	ACCOUNT/projects/ID-PERMALINK/tags.json
+//	ACCOUNT/projects/ID-PERMALINK/bins/*.json
+//	ACCOUNT/projects/ID-PERMALINK/changesets/*.json
+//	ACCOUNT/projects/ID-PERMALINK/messages/*.json
+//	ACCOUNT/projects/ID-PERMALINK/milestones/*.json
+//	ACCOUNT/projects/ID-PERMALINK/milestones/ID-PERMALINK/ATTACHMENT
+//	ACCOUNT/projects/ID-PERMALINK/tickets/NUMBER-PERMALINK/ticket.json
+//	ACCOUNT/projects/ID-PERMALINK/tickets/NUMBER-PERMALINK/ATTACHMENT
+//	ACCOUNT/users/ID-NAME/user.json
+//	ACCOUNT/users/ID-NAME/memberships.json
+//	ACCOUNT/users/ID-NAME/avatar.EXT
+package export
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/changesets"
+	"github.com/nwidger/lighthouse/messages"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/profiles"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tags"
+	"github.com/nwidger/lighthouse/tickets"
+	"github.com/nwidger/lighthouse/users"
+)
+
+// Export is the metadata of a Lighthouse account export.  Attachment
+// and avatar contents are not read into memory, use ReadFile.
+type Export struct {
+	Account  string
+	Plan     *lighthouse.Plan
+	Profile  *profiles.User
+	Projects []*Project
+	Users    []*User
+
+	// path is the export archive or directory
+	path string
+}
+
+type Project struct {
+	*projects.Project
+
+	Memberships projects.Memberships
+	Tags        tags.Tags
+	Bins        bins.Bins
+	Changesets  changesets.Changesets
+	Messages    messages.Messages
+	Milestones  milestones.Milestones
+	Tickets     []*Ticket
+
+	// MilestoneAttachments maps milestone IDs to the milestone's
+	// attachments.
+	MilestoneAttachments map[int][]*Attachment
+
+	// Dir is the project's directory within the export.
+	Dir string
+}
+
+type Ticket struct {
+	*tickets.Ticket
+
+	Attachments []*Attachment
+
+	// Dir is the ticket's directory within the export.
+	Dir string
+}
+
+type Attachment struct {
+	*tickets.Attachment
+
+	// Path is the attachment's path within the export.
+	Path string
+}
+
+type User struct {
+	*users.User
+
+	Memberships users.Memberships
+
+	// Avatar is the path of the user's avatar within the export,
+	// if any.
+	Avatar string
+}
+
+// Open reads the export at path, which may be a gzipped tarball or a
+// directory an export was extracted to.
+func Open(path string) (*Export, error) {
+	e := &Export{
+		path: path,
+	}
+	r := newReader(e)
+	err := walk(path, func(name string, rd io.Reader) error {
+		return r.readFile(name, rd)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.finish()
+	return e, nil
+}
+
+// Project returns the project with the given ID.
+func (e *Export) Project(id int) (*Project, bool) {
+	for _, p := range e.Projects {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// User returns the user with the given ID.
+func (e *Export) User(id int) (*User, bool) {
+	for _, u := range e.Users {
+		if u.ID == id {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// Ticket returns the ticket with the given number.
+func (p *Project) Ticket(number int) (*Ticket, bool) {
+	for _, t := range p.Tickets {
+		if t.Number == number {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// ReadFile returns the contents of the file name, i.e., an
+// Attachment's Path, within the export.  For tarballs, this requires
+// reading the archive up to name.
+func (e *Export) ReadFile(name string) ([]byte, error) {
+	var data []byte
+	err := walk(e.path, func(n string, r io.Reader) error {
+		if n != name {
+			return nil
+		}
+		var err error
+		data, err = ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return errFound
+	})
+	if err == errFound {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no such file %q in export", name)
+}
+
+var errFound = fmt.Errorf("found")
+
+// Extract makes the files within the export for which keep returns
+// true, i.e., the Paths of the attachments to be uploaded elsewhere,
+// available on the local filesystem and returns the directory
+// containing them, in which each file's name is its slash-separated
+// name within the export.  If the export is a directory, it is
+// returned as is.  Otherwise only the files kept are extracted to a
+// new temporary directory in a single pass over the archive, so
+// operations which only need metadata take no temporary space.
+// cleanup removes any temporary directory and must be called once
+// the files are no longer needed.
+func (e *Export) Extract(keep func(name string) bool) (dir string, cleanup func(), err error) {
+	fi, err := os.Stat(e.path)
+	if err != nil {
+		return "", nil, err
+	}
+	if fi.IsDir() {
+		return e.path, func() {}, nil
+	}
+
+	dir, err = ioutil.TempDir("", "lighthouse-export")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	err = walk(e.path, func(name string, r io.Reader) error {
+		if !keep(name) || strings.HasPrefix(name, "../") {
+			return nil
+		}
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			return err
+		}
+		f, err := os.Create(p)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, r)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
+
+// walk calls fn with the slash-separated name and contents of each
+// regular file in the export at root.  If fn returns an error,
+// walking stops and the error is returned.
+func walk(root string, fn func(name string, r io.Reader) error) error {
+	fi, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !fi.Mode().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return fn(filepath.ToSlash(rel), f)
+		})
+	}
+
+	f, err := os.Open(root)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	z, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+	tr := tar.NewReader(z)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		err = fn(path.Clean(strings.TrimPrefix(hdr.Name, "./")), tr)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// reader builds an Export from the files of an export in any order.
+type reader struct {
+	e        *Export
+	projects map[string]*Project
+	tickets  map[string]*Ticket
+	users    map[string]*User
+	files    map[string][]string
+
+	// milestoneFiles maps project directories to milestone IDs
+	// to the paths of the milestone's attachments
+	milestoneFiles map[string]map[int][]string
+}
+
+func newReader(e *Export) *reader {
+	return &reader{
+		e:        e,
+		projects: map[string]*Project{},
+		tickets:  map[string]*Ticket{},
+		users:    map[string]*User{},
+		files:    map[string][]string{},
+
+		milestoneFiles: map[string]map[int][]string{},
+	}
+}
+
+func (r *reader) project(dir string) *Project {
+	p, ok := r.projects[dir]
+	if !ok {
+		p = &Project{Project: &projects.Project{}, Dir: dir}
+		r.projects[dir] = p
+	}
+	return p
+}
+
+func (r *reader) user(dir string) *User {
+	u, ok := r.users[dir]
+	if !ok {
+		u = &User{User: &users.User{}}
+		r.users[dir] = u
+	}
+	return u
+}
+
+func (r *reader) readFile(name string, rd io.Reader) error {
+	parts := strings.Split(name, "/")
+	if len(parts) < 2 {
+		return nil
+	}
+	r.e.Account = parts[0]
+
+	decode := func(v interface{}) error {
+		err := json.NewDecoder(rd).Decode(v)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		return nil
+	}
+
+	switch {
+	case len(parts) == 2 && parts[1] == "plan.json":
+		r.e.Plan = &lighthouse.Plan{}
+		return decode(r.e.Plan)
+	case len(parts) == 2 && parts[1] == "profile.json":
+		r.e.Profile = &profiles.User{}
+		return decode(r.e.Profile)
+	case len(parts) == 4 && parts[1] == "projects":
+		p := r.project(path.Join(parts[:3]...))
+		switch parts[3] {
+		case "project.json":
+			return decode(p.Project)
+		case "memberships.json":
+			return decode(&p.Memberships)
+		case "tags.json":
+			return decode(&p.Tags)
+		}
+	case len(parts) == 5 && parts[1] == "projects" && path.Ext(parts[4]) == ".json":
+		p := r.project(path.Join(parts[:3]...))
+		switch parts[3] {
+		case "bins":
+			b := &bins.Bin{}
+			p.Bins = append(p.Bins, b)
+			return decode(b)
+		case "changesets":
+			c := &changesets.Changeset{}
+			p.Changesets = append(p.Changesets, c)
+			return decode(c)
+		case "messages":
+			m := &messages.Message{}
+			p.Messages = append(p.Messages, m)
+			return decode(m)
+		case "milestones":
+			m := &milestones.Milestone{}
+			p.Milestones = append(p.Milestones, m)
+			return decode(m)
+		}
+	case len(parts) == 6 && parts[1] == "projects" && parts[3] == "milestones":
+		id, err := lighthouse.ID(strings.SplitN(parts[4], "-", 2)[0])
+		if err != nil {
+			return nil
+		}
+		dir := path.Join(parts[:3]...)
+		if r.milestoneFiles[dir] == nil {
+			r.milestoneFiles[dir] = map[int][]string{}
+		}
+		r.milestoneFiles[dir][id] = append(r.milestoneFiles[dir][id], name)
+		return nil
+	case len(parts) == 6 && parts[1] == "projects" && parts[3] == "tickets":
+		dir := path.Join(parts[:5]...)
+		if parts[5] != "ticket.json" {
+			r.files[dir] = append(r.files[dir], name)
+			return nil
+		}
+		t := &Ticket{Ticket: &tickets.Ticket{}, Dir: dir}
+		r.tickets[dir] = t
+		p := r.project(path.Join(parts[:3]...))
+		p.Tickets = append(p.Tickets, t)
+		return decode(t.Ticket)
+	case len(parts) == 4 && parts[1] == "users":
+		u := r.user(path.Join(parts[:3]...))
+		switch {
+		case parts[3] == "user.json":
+			return decode(u.User)
+		case parts[3] == "memberships.json":
+			return decode(&u.Memberships)
+		case strings.HasPrefix(parts[3], "avatar."):
+			u.Avatar = name
+		}
+	}
+
+	return nil
+}
+
+// finish matches attachments to tickets and sorts everything by ID.
+func (r *reader) finish() {
+	for dir, t := range r.tickets {
+		byName := map[string]string{}
+		for _, name := range r.files[dir] {
+			byName[path.Base(name)] = name
+		}
+		for _, a := range t.Ticket.Attachments {
+			if a == nil || a.Attachment == nil {
+				continue
+			}
+			name, ok := byName[a.Attachment.Filename]
+			if !ok {
+				continue
+			}
+			t.Attachments = append(t.Attachments, &Attachment{
+				Attachment: a.Attachment,
+				Path:       name,
+			})
+		}
+	}
+
+	for dir, files := range r.milestoneFiles {
+		p := r.project(dir)
+		for _, m := range p.Milestones {
+			byName := map[string]string{}
+			for _, name := range files[m.ID] {
+				byName[path.Base(name)] = name
+			}
+			for _, a := range m.Attachments {
+				if a == nil || a.Attachment == nil {
+					continue
+				}
+				name, ok := byName[a.Attachment.Filename]
+				if !ok {
+					continue
+				}
+				if p.MilestoneAttachments == nil {
+					p.MilestoneAttachments = map[int][]*Attachment{}
+				}
+				p.MilestoneAttachments[m.ID] = append(p.MilestoneAttachments[m.ID], &Attachment{
+					Attachment: a.Attachment,
+					Path:       name,
+				})
+			}
+		}
+	}
+
+	for _, p := range r.projects {
+		if p.ID == 0 {
+			continue
+		}
+		sort.Slice(p.Bins, func(i, j int) bool { return p.Bins[i].ID < p.Bins[j].ID })
+		sort.Slice(p.Changesets, func(i, j int) bool {
+			return after(p.Changesets[i].ChangedAt, p.Changesets[j].ChangedAt)
+		})
+		sort.Slice(p.Messages, func(i, j int) bool { return p.Messages[i].ID < p.Messages[j].ID })
+		sort.Slice(p.Milestones, func(i, j int) bool { return p.Milestones[i].ID < p.Milestones[j].ID })
+		sort.Slice(p.Tickets, func(i, j int) bool { return p.Tickets[i].Number < p.Tickets[j].Number })
+		r.e.Projects = append(r.e.Projects, p)
+	}
+	sort.Slice(r.e.Projects, func(i, j int) bool { return r.e.Projects[i].ID < r.e.Projects[j].ID })
+
+	for _, u := range r.users {
+		if u.ID == 0 {
+			continue
+		}
+		r.e.Users = append(r.e.Users, u)
+	}
+	sort.Slice(r.e.Users, func(i, j int) bool { return r.e.Users[i].ID < r.e.Users[j].ID })
+}
+
+// after reports whether a is after b, treating nil as the zero time.
+func after(a, b *lighthouse.Time) bool {
+	if a == nil || b == nil {
+		return a != nil
+	}
+	return a.After(b.Time)
+}
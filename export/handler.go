@@ -0,0 +1,238 @@
+package export
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/nwidger/lighthouse/search"
+	"github.com/nwidger/lighthouse/tickets"
+)
+
+// Handler returns an http.Handler serving the read-only parts of the
+// Lighthouse API from e, so the service packages can be used without
+// network access, i.e., after an account is shut down.  Ticket
+// listings are searched using the search package with Me set to the
+// export's profile.  Requests other than GET fail with 405 Method
+// Not Allowed.
+func (e *Export) Handler() http.Handler {
+	return http.HandlerFunc(e.serveHTTP)
+}
+
+// Transport returns an http.RoundTripper which answers requests
+// using e.Handler without making any network requests.
+func (e *Export) Transport() http.RoundTripper {
+	return &handlerTransport{h: e.Handler()}
+}
+
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (ht *handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	ht.h.ServeHTTP(w, req)
+	resp := w.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+func (e *Export) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "export is read-only", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasSuffix(r.URL.Path, ".json") {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(r.URL.Path, ".json"), "/"), "/")
+	v, ok := e.route(parts, r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+type object map[string]interface{}
+
+// list wraps each item of a list response in an object with key
+// name, i.e., {"tickets": [{"ticket": {...}}]}.
+func list(listName, name string, n int, item func(i int) interface{}) object {
+	items := make([]object, 0, n)
+	for i := 0; i < n; i++ {
+		items = append(items, object{name: item(i)})
+	}
+	return object{listName: items}
+}
+
+// page returns the range of n items on the requested page.  If no
+// page is requested, defaultPage is used, where page 0 means all
+// items.
+func page(r *http.Request, n, limit, defaultPage int) (int, int) {
+	p, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if p <= 0 {
+		p = defaultPage
+	}
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if p <= 0 {
+		return 0, n
+	}
+	start, end := (p-1)*limit, p*limit
+	if start > n {
+		start = n
+	}
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+func (e *Export) route(parts []string, r *http.Request) (interface{}, bool) {
+	switch {
+	case len(parts) == 1 && parts[0] == "profile":
+		if e.Profile == nil {
+			return nil, false
+		}
+		return object{"user": e.Profile}, true
+	case len(parts) == 1 && parts[0] == "projects":
+		return list("projects", "project", len(e.Projects), func(i int) interface{} {
+			return e.Projects[i].Project
+		}), true
+	case len(parts) >= 2 && parts[0] == "projects":
+		id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, false
+		}
+		p, ok := e.Project(id)
+		if !ok {
+			return nil, false
+		}
+		return e.routeProject(p, parts[2:], r)
+	case len(parts) >= 2 && parts[0] == "users":
+		id, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, false
+		}
+		u, ok := e.User(id)
+		if !ok {
+			return nil, false
+		}
+		switch {
+		case len(parts) == 2:
+			return object{"user": u.User}, true
+		case len(parts) == 3 && parts[2] == "memberships":
+			return list("memberships", "membership", len(u.Memberships), func(i int) interface{} {
+				return u.Memberships[i]
+			}), true
+		}
+	}
+	return nil, false
+}
+
+func (e *Export) routeProject(p *Project, parts []string, r *http.Request) (interface{}, bool) {
+	if len(parts) == 0 {
+		return object{"project": p.Project}, true
+	}
+	id := ""
+	if len(parts) == 2 {
+		id = parts[1]
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "memberships":
+		return list("memberships", "membership", len(p.Memberships), func(i int) interface{} {
+			return p.Memberships[i]
+		}), true
+	case len(parts) == 1 && parts[0] == "tags":
+		return list("tags", "tag", len(p.Tags), func(i int) interface{} {
+			return p.Tags[i]
+		}), true
+	case len(parts) == 1 && parts[0] == "bins":
+		return list("ticket_bins", "ticket_bin", len(p.Bins), func(i int) interface{} {
+			return p.Bins[i]
+		}), true
+	case len(parts) == 2 && parts[0] == "bins":
+		for _, b := range p.Bins {
+			if strconv.Itoa(b.ID) == id {
+				return object{"ticket_bin": b}, true
+			}
+		}
+	case len(parts) == 1 && parts[0] == "changesets":
+		start, end := page(r, len(p.Changesets), 30, 0)
+		cs := p.Changesets[start:end]
+		return list("changesets", "changeset", len(cs), func(i int) interface{} {
+			return cs[i]
+		}), true
+	case len(parts) == 2 && parts[0] == "changesets":
+		for _, c := range p.Changesets {
+			if c.Revision == id {
+				return object{"changeset": c}, true
+			}
+		}
+	case len(parts) == 1 && parts[0] == "messages":
+		return list("messages", "message", len(p.Messages), func(i int) interface{} {
+			return p.Messages[i]
+		}), true
+	case len(parts) == 2 && parts[0] == "messages":
+		for _, m := range p.Messages {
+			if strconv.Itoa(m.ID) == id {
+				return object{"message": m}, true
+			}
+		}
+	case len(parts) == 1 && parts[0] == "milestones":
+		start, end := page(r, len(p.Milestones), 30, 0)
+		ms := p.Milestones[start:end]
+		return list("milestones", "milestone", len(ms), func(i int) interface{} {
+			return ms[i]
+		}), true
+	case len(parts) == 2 && parts[0] == "milestones":
+		for _, m := range p.Milestones {
+			if strconv.Itoa(m.ID) == id {
+				return object{"milestone": m}, true
+			}
+		}
+	case len(parts) == 1 && parts[0] == "tickets":
+		ts, err := e.searchTickets(p, r.URL.Query().Get("q"))
+		if err != nil {
+			return nil, false
+		}
+		start, end := page(r, len(ts), tickets.DefaultLimit, 1)
+		ts = ts[start:end]
+		return list("tickets", "ticket", len(ts), func(i int) interface{} {
+			return ts[i]
+		}), true
+	case len(parts) == 2 && parts[0] == "tickets":
+		number, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, false
+		}
+		if t, ok := p.Ticket(number); ok {
+			return object{"ticket": t.Ticket}, true
+		}
+	}
+	return nil, false
+}
+
+// searchTickets returns p's tickets matching query, sorted as
+// Lighthouse would.
+func (e *Export) searchTickets(p *Project, query string) (tickets.Tickets, error) {
+	ts := make(tickets.Tickets, 0, len(p.Tickets))
+	for _, t := range p.Tickets {
+		ts = append(ts, t.Ticket)
+	}
+	q, err := search.Parse(query)
+	if err != nil {
+		return nil, err
+	}
+	if e.Profile != nil {
+		q.Me = e.Profile.Name
+	}
+	return q.Filter(ts), nil
+}
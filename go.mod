@@ -1,21 +1,32 @@
 module github.com/nwidger/lighthouse
 
-go 1.12
+go 1.21
 
 require (
-	github.com/dsnet/compress v0.0.1 // indirect
-	github.com/fatih/color v1.7.0 // indirect
-	github.com/frankban/quicktest v1.11.3 // indirect
-	github.com/golang/snappy v0.0.2 // indirect
-	github.com/mattn/go-colorable v0.1.2 // indirect
-	github.com/mholt/archiver v3.1.1+incompatible
-	github.com/nwaples/rardecode v1.1.0 // indirect
 	github.com/nwidger/jsoncolor v0.0.0-20170215171346-75a6de4340e5
-	github.com/pierrec/lz4 v2.6.0+incompatible // indirect
 	github.com/spf13/cobra v0.0.4
+	github.com/spf13/pflag v1.0.3
 	github.com/spf13/viper v1.4.0
-	github.com/ulikunitz/xz v0.5.9 // indirect
 	github.com/xanzy/go-gitlab v0.19.1-0.20190802071242-3fb3d1729bb7
-	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8 // indirect
 	golang.org/x/time v0.0.0-20191024005414-555d28b269f0
+	gopkg.in/yaml.v2 v2.2.2
+)
+
+require (
+	github.com/fatih/color v1.7.0 // indirect
+	github.com/fsnotify/fsnotify v1.4.7 // indirect
+	github.com/google/go-querystring v1.0.0 // indirect
+	github.com/hashicorp/hcl v1.0.0 // indirect
+	github.com/magiconair/properties v1.8.0 // indirect
+	github.com/mattn/go-colorable v0.1.2 // indirect
+	github.com/mattn/go-isatty v0.0.8 // indirect
+	github.com/mitchellh/mapstructure v1.1.2 // indirect
+	github.com/pelletier/go-toml v1.2.0 // indirect
+	github.com/spf13/afero v1.1.2 // indirect
+	github.com/spf13/cast v1.3.0 // indirect
+	github.com/spf13/jwalterweatherman v1.0.0 // indirect
+	golang.org/x/net v0.0.0-20190522155817-f3200d17e092 // indirect
+	golang.org/x/oauth2 v0.0.0-20181106182150-f42d05182288 // indirect
+	golang.org/x/sys v0.0.0-20190222072716-a9d3bda3a223 // indirect
+	golang.org/x/text v0.3.0 // indirect
 )
@@ -0,0 +1,122 @@
+// Package crud implements the requests shared by the resource
+// services: listing, getting, creating, updating and deleting the
+// resources at a path.  Lighthouse wraps each resource in an object
+// keyed by its name, i.e., {"ticket": {...}}, and each element of a
+// list the same way, i.e., {"tickets": [{"ticket": {...}}, ...]}.
+// The functions here wrap and unwrap resources given their name, so
+// a single implementation serves every resource while each service
+// keeps its typed API.  Every request goes through
+// *lighthouse.Service, so request options, Service.DryRun and strict
+// decoding apply everywhere.
+package crud
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/nwidger/lighthouse"
+)
+
+// Do makes a method request to path with req, if non-nil, encoded as
+// the JSON request body and checks that the response has status
+// expected.  If resp is non-nil, the response body is decoded into
+// it.
+func Do(s *lighthouse.Service, method, path string, req interface{}, expected int, resp interface{}, reqOpts ...lighthouse.RequestOption) error {
+	var body io.Reader
+	if req != nil {
+		buf := &bytes.Buffer{}
+		enc := json.NewEncoder(buf)
+		err := enc.Encode(req)
+		if err != nil {
+			return err
+		}
+		body = buf
+	}
+
+	r, err := s.RoundTrip(method, path, body, reqOpts...)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	err = lighthouse.CheckResponse(r, expected)
+	if err != nil {
+		return err
+	}
+
+	if resp == nil {
+		return nil
+	}
+	return s.Decode(r.Body, resp)
+}
+
+// Wrap returns v wrapped in an object keyed by name, i.e.,
+// {"ticket": v}, as Lighthouse expects request bodies.
+func Wrap(name string, v interface{}) map[string]interface{} {
+	return map[string]interface{}{name: v}
+}
+
+// List returns the list of name resources at path, which Lighthouse
+// keys by the plural of name, i.e., "tickets" for "ticket".
+func List[T any](s *lighthouse.Service, path, name string, reqOpts ...lighthouse.RequestOption) ([]*T, error) {
+	items, err := Send[[]map[string]*T](s, "GET", path, nil, http.StatusOK, name+"s", nil, reqOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	vs := make([]*T, 0, len(*items))
+	for _, item := range *items {
+		vs = append(vs, item[name])
+	}
+	return vs, nil
+}
+
+// Get returns the name resource at path.
+func Get[T any](s *lighthouse.Service, path, name string, reqOpts ...lighthouse.RequestOption) (*T, error) {
+	return Send[T](s, "GET", path, nil, http.StatusOK, name, nil, reqOpts...)
+}
+
+// Create creates the name resource req at path and decodes the
+// created resource into v, which is returned.  If v is nil, a new T
+// is allocated.  Fields of v missing from the response are left
+// unchanged.
+func Create[T any](s *lighthouse.Service, path, name string, req interface{}, v *T, reqOpts ...lighthouse.RequestOption) (*T, error) {
+	return Send(s, "POST", path, Wrap(name, req), http.StatusCreated, name, v, reqOpts...)
+}
+
+// Update updates the name resource at path with req.
+func Update[T any](s *lighthouse.Service, path, name string, req *T, reqOpts ...lighthouse.RequestOption) error {
+	return Do(s, "PUT", path, Wrap(name, req), http.StatusOK, nil, reqOpts...)
+}
+
+// Delete deletes the resource at path.
+func Delete(s *lighthouse.Service, path string, reqOpts ...lighthouse.RequestOption) error {
+	return Do(s, "DELETE", path, nil, http.StatusOK, nil, reqOpts...)
+}
+
+// Send is like Do but decodes the value of the response's name
+// field into v, which is returned.  If v is nil, a new T is
+// allocated.  v is left unchanged if the response has no such field,
+// i.e., for a dry run which echoes a request wrapped under another
+// name.
+func Send[T any](s *lighthouse.Service, method, path string, req interface{}, expected int, name string, v *T, reqOpts ...lighthouse.RequestOption) (*T, error) {
+	if v == nil {
+		v = new(T)
+	}
+	var wrapper map[string]json.RawMessage
+	err := Do(s, method, path, req, expected, &wrapper, reqOpts...)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := wrapper[name]
+	if !ok {
+		return v, nil
+	}
+	err = s.Decode(bytes.NewReader(raw), v)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -11,9 +11,15 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/time/rate"
@@ -52,6 +58,13 @@ type Transport struct {
 	// Email and password to use for authentication.
 	Email, Password string
 
+	// AuthHosts lists additional hostnames to which credentials
+	// are sent.  Credentials are always sent to
+	// *.lighthouseapp.com.  This is useful when requests are
+	// routed through a proxy or fake server, see
+	// NewServiceWithBaseURL.
+	AuthHosts []string
+
 	// Base specifies the mechanism by which individual HTTP
 	// requests are made.  If Base is nil, http.DefaultTransport
 	// is used.
@@ -67,13 +80,18 @@ type Transport struct {
 	// ignored.
 	RateLimitBurstSize int
 
-	limiter *rate.Limiter
+	limiterOnce sync.Once
+	limiter     *rate.Limiter
 }
 
+// rateLimiter is safe to call from multiple goroutines so that
+// concurrent requests, i.e., from a Pool, share a single limiter.
 func (t *Transport) rateLimiter() *rate.Limiter {
-	if t.limiter == nil && t.RateLimitInterval != time.Duration(0) {
-		t.limiter = newLimiter(t.RateLimitInterval, t.RateLimitBurstSize)
-	}
+	t.limiterOnce.Do(func() {
+		if t.RateLimitInterval != time.Duration(0) {
+			t.limiter = newLimiter(t.RateLimitInterval, t.RateLimitBurstSize)
+		}
+	})
 	return t.limiter
 }
 
@@ -90,7 +108,10 @@ func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	// don't add Lighthouse credentials to request if we're not
 	// talking to Lighthouse (for example, if we get redirected to
 	// an S3 URL when downloading a ticket attachment)
-	if strings.HasSuffix(req.URL.Hostname(), ".lighthouseapp.com") {
+	// a token set by WithToken takes precedence
+	if t.authenticate(req.URL) && len(req.Header.Get("X-LighthouseToken")) == 0 {
+		RegisterSecret(t.Token)
+		RegisterSecret(t.Password)
 		if len(t.Token) > 0 {
 			if t.TokenAsBasicAuth {
 				req2.SetBasicAuth(t.Token, "x")
@@ -115,7 +136,123 @@ func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 		}
 	}
 
-	return t.base().RoundTrip(req2)
+	resp, err := t.base().RoundTrip(req2)
+	if err != nil {
+		return nil, redactError(err)
+	}
+	// req2 may contain the API token in its URL, don't expose it
+	// via the response
+	resp.Request = req
+	return resp, nil
+}
+
+func (t *Transport) authenticate(u *url.URL) bool {
+	host := u.Hostname()
+	if strings.HasSuffix(host, ".lighthouseapp.com") {
+		return true
+	}
+	for _, h := range t.AuthHosts {
+		if strings.EqualFold(host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	tokenParameterRegexp = regexp.MustCompile(`((?:_token|token|migration_token)=)[^&#\s"']+`)
+	// tokenPathRegexp matches tokens in paths, i.e.,
+	// '/tokens/TOKEN.json' as requested by tokens.Service.Get.
+	tokenPathRegexp = regexp.MustCompile(`(/tokens/)[^/?#.\s"']+`)
+	// tokenFieldRegexp matches tokens in JSON and XML bodies,
+	// i.e., the response to tokens.Service.Get.
+	tokenFieldRegexp = regexp.MustCompile(`("(?:_token|token|migration_token)"\s*:\s*"|<(?:token|migration-token)(?:\s[^>]*)?>)[^"<]*`)
+)
+
+// minSecretLength is the length below which RegisterSecret ignores
+// values, so that short passwords such as the 'x' sent with
+// TokenAsBasicAuth don't cause ordinary text to be redacted.
+const minSecretLength = 8
+
+var secrets struct {
+	sync.RWMutex
+	values map[string]bool
+}
+
+// RegisterSecret causes Redact to replace value wherever it appears.
+// API tokens and passwords sent by a *Transport and tokens passed to
+// WithToken and WithMigrationToken are registered automatically.
+// Values shorter than 8 characters are ignored.
+func RegisterSecret(value string) {
+	if len(value) < minSecretLength {
+		return
+	}
+	secrets.RLock()
+	ok := secrets.values[value]
+	secrets.RUnlock()
+	if ok {
+		return
+	}
+	secrets.Lock()
+	if secrets.values == nil {
+		secrets.values = map[string]bool{}
+	}
+	secrets.values[value] = true
+	secrets.Unlock()
+}
+
+// Redact replaces API tokens in s with 'REDACTED': the values of
+// token URL parameters ('_token', 'token' and 'migration_token'),
+// tokens in '/tokens/TOKEN' paths, token fields of JSON and XML
+// bodies and any value registered with RegisterSecret.  Loggers and
+// error messages which may include request URLs or bodies should pass
+// them through Redact so API tokens are never exposed.
+func Redact(s string) string {
+	s = tokenParameterRegexp.ReplaceAllString(s, "${1}REDACTED")
+	s = tokenPathRegexp.ReplaceAllString(s, "${1}REDACTED")
+	s = tokenFieldRegexp.ReplaceAllString(s, "${1}REDACTED")
+	secrets.RLock()
+	defer secrets.RUnlock()
+	for value := range secrets.values {
+		s = strings.Replace(s, value, "REDACTED", -1)
+	}
+	return s
+}
+
+// RedactURL returns u as a string with API tokens redacted, see
+// Redact.
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return Redact(u.String())
+}
+
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (re *redactedError) Error() string { return re.msg }
+
+func (re *redactedError) Unwrap() error { return re.err }
+
+// redactError returns err with API tokens redacted from its message.
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if ue, ok := err.(*url.Error); ok {
+		ue2 := *ue
+		ue2.URL = Redact(ue.URL)
+		ue2.Err = redactError(ue.Err)
+		return &ue2
+	}
+	msg := err.Error()
+	if redacted := Redact(msg); redacted != msg {
+		return &redactedError{err: err, msg: redacted}
+	}
+	return err
 }
 
 // cloneRequest returns a clone of the provided *http.Request.
@@ -202,17 +339,172 @@ type Service struct {
 	// RateLimitMaxRetryAfter is ignored if RateLimitRetryRequests
 	// is not set.
 	RateLimitMaxRetryAfter time.Duration
+
+	// MaxRequests, if non-zero, limits the number of HTTP
+	// requests (including retries) *Service.RoundTrip will make.
+	// Once the limit is reached, *Service.RoundTrip returns
+	// ErrMaxRequestsExceeded without making a request.
+	MaxRequests int
+
+	// Logger, if non-nil, records the method, URL, status,
+	// latency and attempt number of every request, see
+	// LogMiddleware.  If LogBodies is also set, request and
+	// response bodies are logged at debug level.
+	Logger    Logger
+	LogBodies bool
+
+	// Format selects the format of the endpoints used by
+	// *Service.RoundTrip, either FormatJSON or FormatXML.  If
+	// Format is FormatXML, requests for .json paths are sent to
+	// the equivalent .xml path, request bodies are converted with
+	// JSONToXML and successful responses are converted with
+	// XMLToJSON, as are validation errors, so the service
+	// packages work unchanged.  Attachment uploads use
+	// FormatPath and WriteFormFields to do the same.  Fields
+	// such as raw_data and original_body are returned as
+	// Lighthouse renders them in XML.  If Format is empty,
+	// FormatJSON is used.
+	Format string
+
+	// DryRun, if set, intercepts POST, PUT and DELETE requests
+	// instead of sending them.  Each intercepted request's
+	// method, URL and decoded body are logged with Logger, or
+	// written to standard error if Logger is nil, and a synthetic
+	// successful response is returned, see DryRunHeader.  GET
+	// requests are sent as usual and intercepted requests do not
+	// count towards MaxRequests.
+	DryRun bool
+
+	// Cache, if non-nil, answers GET requests with fresh cached
+	// responses instead of making a request, and is invalidated
+	// by successful POST, PUT and DELETE requests, see
+	// ResponseCache.  Cached responses do not count towards
+	// MaxRequests.
+	Cache *ResponseCache
+
+	// Breaker, if non-nil, fails requests with ErrCircuitOpen
+	// without making them while Lighthouse appears to be
+	// unavailable, see CircuitBreaker.  Rejected requests do not
+	// count towards MaxRequests.
+	Breaker *CircuitBreaker
+
+	// DisableSingleflight, if set, stops *Service.RoundTrip from
+	// sharing a single request between concurrent callers making
+	// identical GET requests, i.e., goroutines calling GetByName
+	// for the same project at once.  Requests are identical if
+	// they have the same URL and headers.
+	DisableSingleflight bool
+
+	// DisallowUnknownFields, if set, causes *Service.Decode to
+	// return an *UnknownFieldsError if a response contains fields
+	// which aren't modeled by the type it is decoded into.  The
+	// response is still decoded.
+	DisallowUnknownFields bool
+	// UnknownFieldsFunc, if non-nil, is called by *Service.Decode
+	// for each type of resource in a response with fields which
+	// aren't modeled by that type, i.e., "tickets.Ticket", along
+	// with the sorted names of the unknown fields.
+	UnknownFieldsFunc func(resource string, fields []string)
+
+	requests   int64
+	middleware []Middleware
+	flightsMu  sync.Mutex
+	flights    map[string]*flight
+	// err is returned by every request, see NewService.
+	err error
+}
+
+// ErrMaxRequestsExceeded is returned by *Service.RoundTrip when
+// making a request would exceed Service.MaxRequests.
+var ErrMaxRequestsExceeded = fmt.Errorf("maximum number of API requests exceeded")
+
+// Requests returns the number of HTTP requests made by
+// *Service.RoundTrip.
+func (s *Service) Requests() int {
+	return int(atomic.LoadInt64(&s.requests))
 }
 
 func BasePath(account string) string {
 	return fmt.Sprintf("https://%s.lighthouseapp.com", account)
 }
 
-func NewService(account string, client *http.Client) *Service {
+// WebURL returns the Lighthouse web URL of the path elements elem in
+// account, i.e., WebURL("acme", "projects", "1-widgets").  account
+// may instead be a base URL such as that given to
+// NewServiceWithBaseURL, which is used in place of
+// 'https://ACCOUNT.lighthouseapp.com'.
+func WebURL(account string, elem ...string) string {
+	base := BasePath(account)
+	if strings.Contains(account, "://") {
+		base = strings.TrimSuffix(account, "/")
+	}
+	return base + "/" + strings.Join(elem, "/")
+}
+
+// Slug returns 'ID-PERMALINK', the form used to identify resources in
+// Lighthouse web URLs, or just ID if permalink is empty.
+func Slug(id int, permalink string) string {
+	if len(permalink) == 0 {
+		return strconv.Itoa(id)
+	}
+	return strconv.Itoa(id) + "-" + permalink
+}
+
+// String returns a pointer to v, for setting optional fields such
+// as those of tickets.TicketUpdate.
+func String(v string) *string {
+	return &v
+}
+
+// Int returns a pointer to v, for setting optional fields such as
+// those of tickets.TicketUpdate.
+func Int(v int) *int {
+	return &v
+}
+
+// NewService returns a *Service for account which makes requests
+// with client.  opts configure the *http.Transport at the end of
+// client's Transport chain, i.e., the Base of a *Transport, which is
+// replaced by a configured clone.  If that transport is a
+// RoundTripper other than *http.Transport, every request made by the
+// *Service fails.
+func NewService(account string, client *http.Client, opts ...ServiceOption) *Service {
 	return &Service{
 		BasePath: BasePath(account),
 		Client:   client,
+		err:      configureTransport(client, opts),
+	}
+}
+
+// NewServiceWithBaseURL returns a *Service which sends requests to
+// baseURL rather than 'https://ACCOUNT.lighthouseapp.com', for
+// example to route requests through a caching proxy, corporate
+// gateway or fake server.  baseURL may include a path prefix.  If
+// client.Transport is a *Transport, baseURL's host is added to its
+// AuthHosts so requests are authenticated.  opts are applied as by
+// NewService.
+func NewServiceWithBaseURL(baseURL string, client *http.Client, opts ...ServiceOption) (*Service, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.Scheme) == 0 || len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid base URL %q, must include scheme and host", baseURL)
+	}
+	if len(u.RawQuery) > 0 || len(u.Fragment) > 0 {
+		return nil, fmt.Errorf("invalid base URL %q, must not include query or fragment", baseURL)
+	}
+	if t, ok := client.Transport.(*Transport); ok {
+		t.AuthHosts = append(t.AuthHosts, u.Hostname())
 	}
+	err = configureTransport(client, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Service{
+		BasePath: strings.TrimSuffix(u.String(), "/"),
+		Client:   client,
+	}, nil
 }
 
 type Plan struct {
@@ -235,9 +527,9 @@ func (pr *planResponse) decode(r io.Reader) error {
 
 // Get account plan details.  Undocumented, see
 // http://help.lighthouseapp.com/discussions/api-developers/1100-check-if-using-free-plan.
-func (s *Service) Plan() (*Plan, error) {
+func (s *Service) Plan(reqOpts ...RequestOption) (*Plan, error) {
 	// using XML because JSON endpoint returns 406 Not Acceptable
-	resp, err := s.RoundTrip("GET", s.BasePath+"/plan.xml", nil)
+	resp, err := s.RoundTrip("GET", s.BasePath+"/plan.xml", nil, reqOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -257,13 +549,106 @@ func (s *Service) Plan() (*Plan, error) {
 	return presp.Plan, nil
 }
 
-func (s *Service) RoundTrip(method, path string, body io.Reader) (*http.Response, error) {
+// Middleware wraps the http.RoundTripper used to make requests, see
+// Service.Use.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an adapter allowing an ordinary function to be
+// used as an http.RoundTripper, i.e., when writing Middleware.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Use adds middleware which sees every request made through s,
+// including those made by the services of the other packages created
+// from s.  Middleware wraps s.Client's Transport, so it sees requests
+// before credentials are added.  The first middleware added is the
+// outermost.  Use must not be called concurrently with requests.
+func (s *Service) Use(mw ...Middleware) {
+	s.middleware = append(s.middleware, mw...)
+}
+
+// Do sends req using s.Client, passing it through any middleware
+// added with Use.  Unlike RoundTrip, Do does not retry rate-limited
+// requests or count towards MaxRequests.
+func (s *Service) Do(req *http.Request) (*http.Response, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.isDryRun(req.Method) {
+		return s.dryRun(req)
+	}
+	c := *s.Client
+	c.CheckRedirect = checkRedirect(s.Client.CheckRedirect)
+	if len(s.middleware) > 0 || s.Logger != nil {
+		rt := c.Transport
+		if rt == nil {
+			rt = http.DefaultTransport
+		}
+		if s.Logger != nil {
+			rt = LogMiddleware(s.Logger, s.LogBodies)(rt)
+		}
+		for i := len(s.middleware) - 1; i >= 0; i-- {
+			rt = s.middleware[i](rt)
+		}
+		c.Transport = rt
+	}
+	resp, err := c.Do(req)
+	if err == nil && s.Cache != nil && req.Method != "GET" &&
+		resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		// invalidate here rather than in RoundTrip so writes
+		// made with Do, i.e., attachment uploads, are seen
+		s.Cache.Invalidate(req.URL)
+	}
+	return resp, err
+}
+
+// checkRedirect returns a redirect policy which removes the
+// X-LighthouseToken header set by WithToken from redirects to other
+// hosts, i.e., an attachment download redirected to S3, just as
+// http.Client removes Authorization headers, before applying the
+// policy next.  If next is nil, http.Client's default policy of
+// following up to 10 redirects is used.
+func checkRedirect(next func(req *http.Request, via []*http.Request) error) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) > 0 && !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+			req.Header.Del("X-LighthouseToken")
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
+
+// RoundTrip makes a request to path, applying each of reqOpts to the
+// request in order.  Unless DisableSingleflight is set, concurrent
+// identical GET requests are made only once.
+func (s *Service) RoundTrip(method, path string, body io.Reader, reqOpts ...RequestOption) (*http.Response, error) {
+	if method == "GET" && body == nil && !s.DisableSingleflight {
+		return s.roundTripShared(path, reqOpts...)
+	}
+	return s.roundTrip(method, path, body, reqOpts...)
+}
+
+func (s *Service) roundTrip(method, path string, body io.Reader, reqOpts ...RequestOption) (*http.Response, error) {
 	var (
 		buf  []byte
 		err  error
 		resp *http.Response
 	)
 
+	// checked before the dry run too, a misconfigured Service
+	// must not appear to succeed
+	if s.err != nil {
+		return nil, s.err
+	}
+
 	if body != nil {
 		buf, err = ioutil.ReadAll(body)
 		if err != nil {
@@ -271,6 +656,31 @@ func (s *Service) RoundTrip(method, path string, body io.Reader) (*http.Response
 		}
 	}
 
+	if s.isDryRun(method) {
+		req, err := http.NewRequest(method, path, bytes.NewReader(buf))
+		if err != nil {
+			return nil, err
+		}
+		for _, opt := range reqOpts {
+			req = opt(req)
+		}
+		if len(buf) > 0 && len(req.Header.Get("Content-Type")) == 0 {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return s.dryRun(req)
+	}
+
+	convertXML := false
+	if s.Format == FormatXML {
+		path, convertXML = xmlPath(path)
+		if convertXML && len(buf) > 0 {
+			buf, err = JSONToXML(bytes.NewReader(buf))
+			if err != nil {
+				return nil, fmt.Errorf("unable to convert request body to XML: %v", err)
+			}
+		}
+	}
+
 	attempts := 1
 	maxRetryAfter := time.Duration(0)
 	if s.RateLimitRetryRequests {
@@ -293,6 +703,17 @@ func (s *Service) RoundTrip(method, path string, body io.Reader) (*http.Response
 		if err != nil {
 			return nil, err
 		}
+		for _, opt := range reqOpts {
+			req = opt(req)
+		}
+		if s.Cache != nil {
+			if cached := s.Cache.get(req); cached != nil {
+				return cached, nil
+			}
+		}
+		if s.Logger != nil {
+			req = withAttempt(req, attempt)
+		}
 
 		if len(req.Header.Get("Content-Type")) == 0 {
 			switch filepath.Ext(req.URL.Path) {
@@ -303,9 +724,28 @@ func (s *Service) RoundTrip(method, path string, body io.Reader) (*http.Response
 			}
 		}
 
-		resp, err = s.Client.Do(req)
+		n := atomic.AddInt64(&s.requests, 1)
+		if s.MaxRequests > 0 && n > int64(s.MaxRequests) {
+			atomic.AddInt64(&s.requests, -1)
+			return nil, ErrMaxRequestsExceeded
+		}
+
+		// The budget is checked first so that a half-open trial
+		// request allowed by the breaker is always recorded.
+		if s.Breaker != nil {
+			err = s.Breaker.allow()
+			if err != nil {
+				atomic.AddInt64(&s.requests, -1)
+				return nil, err
+			}
+		}
+
+		resp, err = s.Do(req)
+		if s.Breaker != nil {
+			s.Breaker.record(resp, err)
+		}
 		if err != nil {
-			return nil, err
+			return nil, redactError(err)
 		}
 
 		if !s.RateLimitRetryRequests ||
@@ -323,14 +763,73 @@ func (s *Service) RoundTrip(method, path string, body io.Reader) (*http.Response
 				}
 			}
 		}
+		if s.Logger != nil {
+			s.Logger.Info("api request rate limited", "method", method, "url", Redact(path),
+				"attempt", attempt, "retry_after", retryAfter)
+		}
 		if retryAfter != time.Duration(0) {
 			<-time.After(retryAfter + (5 * time.Second))
 		}
 	}
 
+	if convertXML {
+		err = convertXMLResponse(resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Cache != nil {
+		err = s.Cache.update(resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return resp, nil
 }
 
+// convertXMLResponse replaces resp's XML body with the equivalent
+// JSON, see XMLToJSON.  Error responses are only converted if they
+// are validation errors, see xmlErrorsToJSON, other error bodies
+// such as HTML error pages are left as is for CheckResponse.
+func convertXMLResponse(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		converted, ok := xmlErrorsToJSON(data)
+		if !ok {
+			resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+			return nil
+		}
+		data = converted
+		resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+		resp.ContentLength = int64(len(data))
+		resp.Header.Set("Content-Type", "application/json")
+		resp.Header.Del("Content-Length")
+		return nil
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		data, err = XMLToJSON(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("unable to convert XML response: %v", err)
+		}
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Type", "application/json")
+	resp.Header.Del("Content-Length")
+	return nil
+}
+
 type ErrUnprocessable struct {
 	Field   string
 	Message string
@@ -390,62 +889,147 @@ func (eus ErrUnprocessables) Error() string {
 	return msg
 }
 
-type ErrUnexpectedResponse struct {
+// Sentinel errors matched by errors.Is against the *ErrorResponse
+// returned by CheckResponse.
+var (
+	// ErrUnauthorized matches 401 Unauthorized and 403 Forbidden
+	// responses.
+	ErrUnauthorized = fmt.Errorf("unauthorized")
+	// ErrNotFound matches 404 Not Found responses.
+	ErrNotFound = fmt.Errorf("not found")
+	// ErrValidation matches 422 Unprocessable Entity responses,
+	// whose ErrorResponse.Unprocessables lists the invalid
+	// fields.
+	ErrValidation = fmt.Errorf("validation failed")
+	// ErrRateLimited matches 429 Too Many Requests responses.
+	ErrRateLimited = fmt.Errorf("rate limited")
+	// ErrServer matches 5xx responses.
+	ErrServer = fmt.Errorf("server error")
+)
+
+// ErrorResponse is returned by CheckResponse when a response does not
+// have the expected status code.  Use errors.Is with ErrUnauthorized,
+// ErrNotFound, ErrValidation, ErrRateLimited or ErrServer to check for
+// common failures, or errors.As to inspect the response.
+type ErrorResponse struct {
+	// StatusCode is the status code of the response.
+	StatusCode int
+
+	// Method and URL describe the request.  URL has any API
+	// token redacted.
+	Method string
+	URL    string
+
 	// The expected StatusCode
 	ExpectedCode int
 
 	// Resp.Body will always be closed.
 	Resp *http.Response
 
-	// BodyContents will contain the contents of Resp.Body if
-	// Unprocessables is nil.
+	// BodyContents contains the contents of Resp.Body.
 	BodyContents []byte
 
 	// Unprocessables will not be nil if Resp.StatusCode was 422
-	// StatusUnprocessableEntity.
+	// StatusUnprocessableEntity and the body could be parsed.
 	Unprocessables ErrUnprocessables
+
+	// Messages contains the messages explaining the failure found
+	// in BodyContents if Unprocessables is nil, such as the
+	// error of a JSON or XML error document or the text of an
+	// HTML or plain text error page.
+	Messages []string
 }
 
-func newErrUnexpectedResponse(resp *http.Response, expected int) error {
+// ErrUnexpectedResponse is the former name of ErrorResponse.
+//
+// Deprecated: use ErrorResponse.
+type ErrUnexpectedResponse = ErrorResponse
+
+func newErrorResponse(resp *http.Response, expected int) error {
 	var err error
 
 	defer resp.Body.Close()
 
-	eur := &ErrUnexpectedResponse{
+	er := &ErrorResponse{
+		StatusCode:   resp.StatusCode,
 		ExpectedCode: expected,
 		Resp:         resp,
 	}
-
-	if resp.StatusCode != StatusUnprocessableEntity {
-		eur.BodyContents, err = ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return err
+	if resp.Request != nil {
+		er.Method = resp.Request.Method
+		if resp.Request.URL != nil {
+			er.URL = RedactURL(resp.Request.URL)
 		}
-	} else {
-		dec := json.NewDecoder(resp.Body)
-		eur.Unprocessables = ErrUnprocessables{}
+	}
 
-		err = dec.Decode(&eur.Unprocessables)
-		if err != nil {
-			return err
+	er.BodyContents, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == StatusUnprocessableEntity {
+		data := er.BodyContents
+		// requests made with Do rather than RoundTrip, i.e.,
+		// attachment uploads, aren't converted from XML
+		if converted, ok := xmlErrorsToJSON(data); ok {
+			data = converted
 		}
+		unprocessables := ErrUnprocessables{}
+		if json.Unmarshal(data, &unprocessables) == nil {
+			er.Unprocessables = unprocessables
+		}
+	}
+	if er.Unprocessables == nil {
+		er.Messages = errorMessages(er.BodyContents, resp.Header.Get("Content-Type"))
 	}
 
-	return eur
+	return er
 }
 
-func (eir *ErrUnexpectedResponse) Error() string {
-	if eir.Unprocessables != nil {
-		return eir.Unprocessables.Error()
+func (er *ErrorResponse) Error() string {
+	if er.Unprocessables != nil {
+		return Redact(er.Unprocessables.Error())
 	}
 
-	return fmt.Sprintf("expected %d %s response, received %s",
-		eir.ExpectedCode, http.StatusText(eir.ExpectedCode), eir.Resp.Status)
+	status := strconv.Itoa(er.StatusCode) + " " + http.StatusText(er.StatusCode)
+	if er.Resp != nil && len(er.Resp.Status) > 0 {
+		status = er.Resp.Status
+	}
+	msg := fmt.Sprintf("expected %d %s response, received %s",
+		er.ExpectedCode, http.StatusText(er.ExpectedCode), status)
+	if len(er.Method) > 0 && len(er.URL) > 0 {
+		msg = er.Method + " " + er.URL + ": " + msg
+	}
+	if len(er.Messages) > 0 {
+		msg += ": " + Redact(strings.Join(er.Messages, "; "))
+	}
+	return msg
 }
 
+// Is reports whether er matches target, one of ErrUnauthorized,
+// ErrNotFound, ErrValidation, ErrRateLimited or ErrServer.
+func (er *ErrorResponse) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return er.StatusCode == http.StatusUnauthorized || er.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return er.StatusCode == http.StatusNotFound
+	case ErrValidation:
+		return er.StatusCode == StatusUnprocessableEntity
+	case ErrRateLimited:
+		return er.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return er.StatusCode >= 500 && er.StatusCode <= 599
+	}
+	return false
+}
+
+// CheckResponse returns an *ErrorResponse if resp's status code is
+// not expected.  Synthetic responses to requests intercepted by
+// Service.DryRun are always successful.
 func CheckResponse(resp *http.Response, expected int) error {
-	if resp.StatusCode != expected {
-		return newErrUnexpectedResponse(resp, expected)
+	if resp.StatusCode != expected && len(resp.Header.Get(DryRunHeader)) == 0 {
+		return newErrorResponse(resp, expected)
 	}
 	return nil
 }
@@ -457,3 +1041,140 @@ func ID(idStr string) (int, error) {
 	}
 	return int(id), nil
 }
+
+// UnknownFields holds the fields of a JSON object which are not
+// modeled by the struct it was decoded into, so they can be
+// preserved when the struct is encoded again.  This keeps exports
+// lossless when Lighthouse adds fields to its responses.
+type UnknownFields map[string]json.RawMessage
+
+// UnmarshalWithUnknown unmarshals the JSON object data into v, which
+// must be a pointer to a struct, and returns any fields of data not
+// corresponding to a field of v.  Types implementing
+// json.Unmarshaler should pass a pointer to a method-less alias of
+// themselves as v to avoid infinite recursion.
+func UnmarshalWithUnknown(data []byte, v interface{}) (UnknownFields, error) {
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		// not an object, i.e., null
+		return nil, nil
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(v))
+	var unknown UnknownFields
+	for name, value := range fields {
+		if known[strings.ToLower(name)] {
+			continue
+		}
+		if unknown == nil {
+			unknown = UnknownFields{}
+		}
+		unknown[name] = value
+	}
+
+	return unknown, nil
+}
+
+// MarshalWithUnknown marshals v, which must be a struct or pointer
+// to a struct, as a JSON object and appends the fields in unknown
+// which do not correspond to a field of v, sorted by name.  Types
+// implementing json.Marshaler should pass a method-less alias of
+// themselves as v to avoid infinite recursion.
+func MarshalWithUnknown(v interface{}, unknown UnknownFields) ([]byte, error) {
+	buf, err := json.Marshal(v)
+	if err != nil || len(unknown) == 0 {
+		return buf, err
+	}
+	buf = bytes.TrimSpace(buf)
+	if len(buf) < 2 || buf[0] != '{' || buf[len(buf)-1] != '}' {
+		return buf, nil
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(v))
+	names := make([]string, 0, len(unknown))
+	for name := range unknown {
+		if !known[strings.ToLower(name)] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	out := &bytes.Buffer{}
+	out.Write(buf[:len(buf)-1])
+	empty := len(bytes.TrimSpace(buf[1:len(buf)-1])) == 0
+	for _, name := range names {
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		value := unknown[name]
+		if len(value) == 0 {
+			value = json.RawMessage("null")
+		}
+		if !empty {
+			out.WriteByte(',')
+		}
+		empty = false
+		out.Write(key)
+		out.WriteByte(':')
+		out.Write(value)
+	}
+	out.WriteByte('}')
+
+	return out.Bytes(), nil
+}
+
+// jsonFieldNames returns the lowercased JSON names of the fields of
+// struct type t, including promoted fields of embedded structs.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	for name := range jsonFieldTypes(t) {
+		names[name] = true
+	}
+	return names
+}
+
+// jsonFieldTypes maps the lowercased JSON names of the fields of
+// struct type t, including promoted fields of embedded structs, to
+// their types.
+func jsonFieldTypes(t reflect.Type) map[string]reflect.Type {
+	types := map[string]reflect.Type{}
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			name := strings.Split(tag, ",")[0]
+			if name == "-" && !strings.HasPrefix(tag, "-,") {
+				continue
+			}
+			if f.Anonymous && len(name) == 0 {
+				walk(f.Type)
+				continue
+			}
+			if len(f.PkgPath) > 0 {
+				continue
+			}
+			if len(name) == 0 {
+				name = f.Name
+			}
+			if _, ok := types[strings.ToLower(name)]; !ok {
+				types[strings.ToLower(name)] = f.Type
+			}
+		}
+	}
+	walk(t)
+	return types
+}
@@ -0,0 +1,41 @@
+package lighthousetest_test
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/nwidger/lighthouse/lighthousetest"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+)
+
+func ExampleNewServer() {
+	srv := lighthousetest.NewServer()
+	defer srv.Close()
+
+	p := srv.AddProject(&projects.Project{Name: "Widgets"})
+	srv.AddTicket(p.ID, &tickets.Ticket{Title: "Crash on login", Tag: "bug"})
+	srv.AddTicket(p.ID, &tickets.Ticket{Title: "Add dark mode", State: "open"})
+
+	t := tickets.NewService(srv.Service(), p.ID)
+	tkt, err := t.Create(&tickets.Ticket{Title: "Typo in footer", Tag: "bug"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = t.AddAttachment(tkt, "screenshot.txt", strings.NewReader("footr"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ts, err := t.ListAll(&tickets.ListOptions{Query: "tagged:bug sort:-number"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, tkt := range ts {
+		fmt.Println(tkt.Number, tkt.Title, tkt.AttachmentsCount)
+	}
+	// Output:
+	// 1 Crash on login 0
+	// 3 Typo in footer 1
+}
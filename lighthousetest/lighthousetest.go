@@ -0,0 +1,722 @@
+// Package lighthousetest provides an in-memory fake of the Lighthouse
+// API for use in tests.
+//
+// A *Server implements enough of the API for the projects, tickets
+// and milestones packages: listing, getting, creating, updating and
+// deleting projects, tickets and milestones, paginated and searchable
+// ticket listings, and attachment uploads, downloads and deletions.  Other
+// requests fail with 404 Not Found.
+package lighthousetest
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/milestones"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/search"
+	"github.com/nwidger/lighthouse/tickets"
+)
+
+// DefaultToken is the API token accepted by a Server created by
+// NewServer and used by the *lighthouse.Service returned by
+// Server.Service.
+const DefaultToken = "lighthousetest"
+
+// milestonesPerPage is the number of milestones returned per page.
+const milestonesPerPage = 30
+
+// Server is a fake Lighthouse API server backed by memory.  Its
+// methods are safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	// Token is the API token requests must include, either in
+	// the X-LighthouseToken header or the _token query parameter.
+	// If Token is empty, requests are not authenticated.
+	Token string
+
+	mu          sync.Mutex
+	nextID      int
+	projects    []*project
+	attachments map[string]*attachment
+}
+
+type project struct {
+	*projects.Project
+
+	tickets    tickets.Tickets
+	milestones milestones.Milestones
+}
+
+type attachment struct {
+	contentType string
+	data        []byte
+}
+
+// NewServer starts and returns a new Server with no projects.  The
+// caller should call Close when finished to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		Token:       DefaultToken,
+		nextID:      1,
+		attachments: map[string]*attachment{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Service returns a *lighthouse.Service which sends requests to s
+// authenticated with s.Token.
+func (s *Server) Service() *lighthouse.Service {
+	svc, err := lighthouse.NewServiceWithBaseURL(s.URL, lighthouse.NewClient(s.Token))
+	if err != nil {
+		panic(err)
+	}
+	return svc
+}
+
+func (s *Server) id() int {
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+// AddProject adds p to s, assigning it an ID if it has none, and
+// returns it.
+func (s *Server) AddProject(p *projects.Project) *projects.Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addProject(p)
+}
+
+func (s *Server) addProject(p *projects.Project) *projects.Project {
+	if p.ID == 0 {
+		p.ID = s.id()
+	}
+	if len(p.Permalink) == 0 {
+		p.Permalink = projects.Permalink(p.Name)
+	}
+	if len(p.OpenStatesList) == 0 {
+		p.OpenStatesList = projects.StatesList{"new", "open"}
+	}
+	if len(p.ClosedStatesList) == 0 {
+		p.ClosedStatesList = projects.StatesList{"resolved", "hold", "invalid"}
+	}
+	if p.CreatedAt == nil {
+		now := time.Now().UTC()
+		p.CreatedAt = lighthouse.NewTime(now)
+	}
+	s.projects = append(s.projects, &project{Project: p})
+	return p
+}
+
+// AddTicket adds t to project projectID, assigning it the next
+// ticket number if it has none, and returns it.  AddTicket returns
+// nil if there is no such project.
+func (s *Server) AddTicket(projectID int, t *tickets.Ticket) *tickets.Ticket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.project(projectID)
+	if p == nil {
+		return nil
+	}
+	return s.addTicket(p, t)
+}
+
+func (s *Server) addTicket(p *project, t *tickets.Ticket) *tickets.Ticket {
+	if t.Number == 0 {
+		for _, other := range p.tickets {
+			if other.Number > t.Number {
+				t.Number = other.Number
+			}
+		}
+		t.Number++
+	}
+	now := time.Now().UTC()
+	t.ProjectID = p.ID
+	if len(t.State) == 0 {
+		t.State = "new"
+	}
+	t.Closed = p.isClosed(t.State)
+	if t.CreatedAt == nil {
+		t.CreatedAt = lighthouse.NewTime(now)
+	}
+	if t.UpdatedAt == nil {
+		t.UpdatedAt = t.CreatedAt
+	}
+	if len(t.OriginalBody) == 0 {
+		t.OriginalBody = t.Body
+	}
+	t.LatestBody = t.Body
+	t.URL = s.URL + "/projects/" + strconv.Itoa(p.ID) + "/tickets/" + strconv.Itoa(t.Number)
+	if len(t.Versions) == 0 {
+		t.Versions = tickets.TicketVersions{newVersion(t)}
+	}
+	t.Version = len(t.Versions)
+	p.tickets = append(p.tickets, t)
+	return t
+}
+
+func newVersion(t *tickets.Ticket) *tickets.TicketVersion {
+	return &tickets.TicketVersion{
+		AssignedUserID: t.AssignedUserID,
+		Body:           t.Body,
+		Closed:         t.Closed,
+		CreatedAt:      t.UpdatedAt,
+		CreatorID:      t.CreatorID,
+		MilestoneID:    t.MilestoneID,
+		Number:         t.Number,
+		ProjectID:      t.ProjectID,
+		State:          t.State,
+		Tag:            t.Tag,
+		Title:          t.Title,
+		UpdatedAt:      t.UpdatedAt,
+		UserID:         t.UserID,
+		Version:        t.Version + 1,
+		WatchersIDs:    t.WatchersIDs,
+		URL:            t.URL,
+	}
+}
+
+// AddMilestone adds m to project projectID, assigning it an ID if it
+// has none, and returns it.  AddMilestone returns nil if there is no
+// such project.
+func (s *Server) AddMilestone(projectID int, m *milestones.Milestone) *milestones.Milestone {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.project(projectID)
+	if p == nil {
+		return nil
+	}
+	return s.addMilestone(p, m)
+}
+
+func (s *Server) addMilestone(p *project, m *milestones.Milestone) *milestones.Milestone {
+	if m.ID == 0 {
+		m.ID = s.id()
+	}
+	m.ProjectID = p.ID
+	if len(m.Permalink) == 0 {
+		m.Permalink = projects.Permalink(m.Title)
+	}
+	if m.CreatedAt == nil {
+		now := time.Now().UTC()
+		m.CreatedAt = lighthouse.NewTime(now)
+	}
+	m.URL = s.URL + "/projects/" + strconv.Itoa(p.ID) + "/milestones/" + strconv.Itoa(m.ID)
+	p.milestones = append(p.milestones, m)
+	return m
+}
+
+func (p *project) isClosed(state string) bool {
+	for _, cs := range p.ClosedStatesList {
+		if strings.EqualFold(cs, state) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) project(id int) *project {
+	for _, p := range s.projects {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func (p *project) ticket(number int) *tickets.Ticket {
+	for _, t := range p.tickets {
+		if t.Number == number {
+			return t
+		}
+	}
+	return nil
+}
+
+func (p *project) milestone(id int) *milestones.Milestone {
+	for _, m := range p.milestones {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+// object is a JSON object response.
+type object map[string]interface{}
+
+// list wraps each item of a list response in an object with key
+// name, i.e., {"tickets": [{"ticket": {...}}]}.
+func list(listName, name string, n int, item func(i int) interface{}) object {
+	items := make([]object, 0, n)
+	for i := 0; i < n; i++ {
+		items = append(items, object{name: item(i)})
+	}
+	return object{listName: items}
+}
+
+// page returns the range of n items on the requested page.  Pages
+// start at 1, which is returned if no page is requested.
+func page(r *http.Request, n, limit int) (int, int) {
+	p, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if p <= 0 {
+		p = 1
+	}
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	start, end := (p-1)*limit, p*limit
+	if start > n {
+		start = n
+	}
+	if end > n {
+		end = n
+	}
+	return start, end
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if len(s.Token) == 0 {
+		return true
+	}
+	return r.Header.Get("X-LighthouseToken") == s.Token || r.URL.Query().Get("_token") == s.Token
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "Access denied", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if strings.HasPrefix(r.URL.Path, "/attachments/") && r.Method == "DELETE" {
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/attachments/"), ".json"))
+		if err != nil || !s.deleteAttachment(id) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/attachments/") {
+		a, ok := s.attachments[r.URL.Path]
+		if !ok || r.Method != "GET" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", a.contentType)
+		w.Write(a.data)
+		return
+	}
+
+	if !strings.HasSuffix(r.URL.Path, ".json") {
+		http.NotFound(w, r)
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimSuffix(r.URL.Path, ".json"), "/"), "/")
+	if len(parts) == 0 || parts[0] != "projects" {
+		http.NotFound(w, r)
+		return
+	}
+
+	code, v := s.routeProjects(r, parts[1:])
+	if v == nil {
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// deleteAttachment deletes the attachment with the given ID from the
+// ticket or milestone it was uploaded to and returns whether it
+// existed.
+func (s *Server) deleteAttachment(id int) bool {
+	remove := func(as []*tickets.AttachmentResponse) ([]*tickets.AttachmentResponse, bool) {
+		for i, a := range as {
+			if a.Attachment != nil && a.Attachment.ID == id {
+				return append(as[:i], as[i+1:]...), true
+			}
+		}
+		return as, false
+	}
+	found := false
+	for _, p := range s.projects {
+		for _, t := range p.tickets {
+			var ok bool
+			if t.Attachments, ok = remove(t.Attachments); ok {
+				t.AttachmentsCount--
+				found = true
+			}
+		}
+		for _, m := range p.milestones {
+			var ok bool
+			if m.Attachments, ok = remove(m.Attachments); ok {
+				m.AttachmentsCount--
+				found = true
+			}
+		}
+	}
+	prefix := "/attachments/" + strconv.Itoa(id) + "/"
+	for u := range s.attachments {
+		if strings.HasPrefix(u, prefix) {
+			delete(s.attachments, u)
+			found = true
+		}
+	}
+	return found
+}
+
+// routeProjects handles requests for /projects/PARTS.json and returns
+// the response status code and body, or a nil body if the request
+// failed.
+func (s *Server) routeProjects(r *http.Request, parts []string) (int, interface{}) {
+	if len(parts) == 0 {
+		switch r.Method {
+		case "GET":
+			return http.StatusOK, list("projects", "project", len(s.projects), func(i int) interface{} {
+				return s.projects[i].Project
+			})
+		case "POST":
+			p := &projects.Project{}
+			if !decode(r, "project", p) {
+				return http.StatusUnprocessableEntity, nil
+			}
+			return http.StatusCreated, object{"project": s.addProject(p)}
+		}
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return http.StatusNotFound, nil
+	}
+	p := s.project(id)
+	if p == nil {
+		return http.StatusNotFound, nil
+	}
+
+	switch {
+	case len(parts) == 1:
+		switch r.Method {
+		case "GET":
+			return http.StatusOK, object{"project": p.Project}
+		case "PUT":
+			if !decode(r, "project", p.Project) {
+				return http.StatusUnprocessableEntity, nil
+			}
+			p.ID = id
+			if len(p.OpenStates) > 0 {
+				p.OpenStatesList = strings.Split(p.OpenStates, ",")
+			}
+			if len(p.ClosedStates) > 0 {
+				p.ClosedStatesList = strings.Split(p.ClosedStates, ",")
+			}
+			return http.StatusOK, object{"project": p.Project}
+		case "DELETE":
+			for i, other := range s.projects {
+				if other == p {
+					s.projects = append(s.projects[:i], s.projects[i+1:]...)
+					break
+				}
+			}
+			return http.StatusOK, object{}
+		}
+		return http.StatusMethodNotAllowed, nil
+	case parts[1] == "tickets":
+		return s.routeTickets(r, p, parts[2:])
+	case parts[1] == "milestones":
+		return s.routeMilestones(r, p, parts[2:])
+	}
+	return http.StatusNotFound, nil
+}
+
+func (s *Server) routeTickets(r *http.Request, p *project, parts []string) (int, interface{}) {
+	if len(parts) == 0 {
+		switch r.Method {
+		case "GET":
+			q, err := search.Parse(r.URL.Query().Get("q"))
+			if err != nil {
+				return http.StatusUnprocessableEntity, nil
+			}
+			ts := q.Filter(p.tickets)
+			start, end := page(r, len(ts), tickets.DefaultLimit)
+			ts = ts[start:end]
+			return http.StatusOK, list("tickets", "ticket", len(ts), func(i int) interface{} {
+				return ts[i]
+			})
+		case "POST":
+			tc := &tickets.TicketCreate{}
+			if !decode(r, "ticket", tc) || len(tc.Title) == 0 {
+				return http.StatusUnprocessableEntity, nil
+			}
+			t := &tickets.Ticket{
+				Title:          tc.Title,
+				Body:           tc.Body,
+				State:          tc.State,
+				AssignedUserID: tc.AssignedUserID,
+				MilestoneID:    tc.MilestoneID,
+				Tag:            tc.Tag,
+				CreatorID:      tc.CreatorID,
+				UserID:         tc.CreatorID,
+				CreatedAt:      tc.CreatedAt,
+				WatchersIDs:    tc.MultipleWatchers,
+			}
+			return http.StatusCreated, object{"ticket": s.addTicket(p, t)}
+		}
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	number, err := tickets.Number(parts[0])
+	if err != nil || len(parts) > 1 {
+		return http.StatusNotFound, nil
+	}
+	t := p.ticket(number)
+	if t == nil {
+		return http.StatusNotFound, nil
+	}
+
+	switch r.Method {
+	case "GET":
+		return http.StatusOK, object{"ticket": t}
+	case "PUT":
+		// like Lighthouse, only the fields present in the
+		// request are changed
+		fields := map[string]json.RawMessage{}
+		files, ok := s.decodeUpdate(r, "ticket", &fields)
+		if !ok {
+			return http.StatusUnprocessableEntity, nil
+		}
+		update := &tickets.Ticket{}
+		buf, err := json.Marshal(fields)
+		if err != nil || json.Unmarshal(buf, update) != nil {
+			return http.StatusUnprocessableEntity, nil
+		}
+		has := func(name string) bool {
+			_, ok := fields[name]
+			return ok
+		}
+		now := time.Now().UTC()
+		for _, a := range files {
+			a.ProjectID = p.ID
+			t.Attachments = append(t.Attachments, &tickets.AttachmentResponse{Attachment: a})
+			t.AttachmentsCount++
+		}
+		if len(update.Title) > 0 {
+			t.Title = update.Title
+		}
+		if len(update.State) > 0 {
+			t.State = update.State
+			t.Closed = p.isClosed(t.State)
+		}
+		if has("assigned_user_id") {
+			t.AssignedUserID = update.AssignedUserID
+		}
+		if has("milestone_id") {
+			t.MilestoneID = update.MilestoneID
+		}
+		if has("tag") {
+			t.Tag = update.Tag
+		}
+		if has("multiple_watchers") {
+			watchers := []int{}
+			if json.Unmarshal(fields["multiple_watchers"], &watchers) != nil {
+				return http.StatusUnprocessableEntity, nil
+			}
+			t.WatchersIDs = watchers
+		}
+		t.Body = update.Body
+		if len(update.Body) > 0 {
+			t.LatestBody = update.Body
+		}
+		t.UpdatedAt = lighthouse.NewTime(now)
+		t.Versions = append(t.Versions, newVersion(t))
+		t.Version = len(t.Versions)
+		return http.StatusOK, object{"ticket": t}
+	case "DELETE":
+		for i, other := range p.tickets {
+			if other == t {
+				p.tickets = append(p.tickets[:i], p.tickets[i+1:]...)
+				break
+			}
+		}
+		return http.StatusOK, object{}
+	}
+	return http.StatusMethodNotAllowed, nil
+}
+
+func (s *Server) routeMilestones(r *http.Request, p *project, parts []string) (int, interface{}) {
+	if len(parts) == 0 {
+		switch r.Method {
+		case "GET":
+			ms := make(milestones.Milestones, len(p.milestones))
+			copy(ms, p.milestones)
+			sort.SliceStable(ms, func(i, j int) bool { return ms[i].CompletedAt == nil && ms[j].CompletedAt != nil })
+			start, end := page(r, len(ms), milestonesPerPage)
+			ms = ms[start:end]
+			return http.StatusOK, list("milestones", "milestone", len(ms), func(i int) interface{} {
+				return ms[i]
+			})
+		case "POST":
+			m := &milestones.Milestone{}
+			if !decode(r, "milestone", m) || len(m.Title) == 0 {
+				return http.StatusUnprocessableEntity, nil
+			}
+			return http.StatusCreated, object{"milestone": s.addMilestone(p, m)}
+		}
+		return http.StatusMethodNotAllowed, nil
+	}
+
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return http.StatusNotFound, nil
+	}
+	m := p.milestone(id)
+	if m == nil {
+		return http.StatusNotFound, nil
+	}
+
+	if len(parts) == 2 && r.Method == "PUT" {
+		switch parts[1] {
+		case "close":
+			now := time.Now().UTC()
+			m.CompletedAt = lighthouse.NewTime(now)
+			return http.StatusOK, object{"milestone": m}
+		case "open":
+			m.CompletedAt = nil
+			return http.StatusOK, object{"milestone": m}
+		}
+	}
+	if len(parts) > 1 {
+		return http.StatusNotFound, nil
+	}
+
+	switch r.Method {
+	case "GET":
+		return http.StatusOK, object{"milestone": m}
+	case "PUT":
+		update := &milestones.Milestone{}
+		files, ok := s.decodeUpdate(r, "milestone", update)
+		if !ok {
+			return http.StatusUnprocessableEntity, nil
+		}
+		for _, a := range files {
+			a.ProjectID = p.ID
+			m.Attachments = append(m.Attachments, &tickets.AttachmentResponse{Attachment: a})
+			m.AttachmentsCount++
+		}
+		if len(update.Title) > 0 {
+			m.Title = update.Title
+			m.Permalink = projects.Permalink(m.Title)
+		}
+		m.Goals = update.Goals
+		m.DueOn = update.DueOn
+		now := time.Now().UTC()
+		m.UpdatedAt = lighthouse.NewTime(now)
+		return http.StatusOK, object{"milestone": m}
+	case "DELETE":
+		for i, other := range p.milestones {
+			if other == m {
+				p.milestones = append(p.milestones[:i], p.milestones[i+1:]...)
+				break
+			}
+		}
+		return http.StatusOK, object{}
+	}
+	return http.StatusMethodNotAllowed, nil
+}
+
+// decode decodes the JSON request body {"name": {...}} into v.
+func decode(r *http.Request, name string, v interface{}) bool {
+	return decodeJSON(r.Body, name, v)
+}
+
+func decodeJSON(r io.Reader, name string, v interface{}) bool {
+	var req map[string]json.RawMessage
+	err := json.NewDecoder(r).Decode(&req)
+	if err != nil {
+		return false
+	}
+	data, ok := req[name]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// decodeUpdate decodes the body of a PUT request into v.  The body is
+// either JSON or, when uploading attachments, a multipart form
+// containing a JSON part and one or more NAME[attachment][] file
+// parts, which are stored by s and returned.
+func (s *Server) decodeUpdate(r *http.Request, name string, v interface{}) ([]*tickets.Attachment, bool) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, decode(r, name, v)
+	}
+
+	var (
+		files   []*tickets.Attachment
+		decoded bool
+	)
+	mr := multipart.NewReader(r.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false
+		}
+		if part.FormName() != name+"[attachment][]" {
+			if !decodeJSON(part, name, v) {
+				return nil, false
+			}
+			decoded = true
+			continue
+		}
+		data, err := ioutil.ReadAll(part)
+		if err != nil {
+			return nil, false
+		}
+		now := time.Now().UTC()
+		a := &tickets.Attachment{
+			ID:          s.id(),
+			Filename:    path.Base(part.FileName()),
+			ContentType: part.Header.Get("Content-Type"),
+			Size:        len(data),
+			CreatedAt:   lighthouse.NewTime(now),
+		}
+		if len(a.ContentType) == 0 || a.ContentType == "application/octet-stream" {
+			if ct := mime.TypeByExtension(path.Ext(a.Filename)); len(ct) > 0 {
+				a.ContentType = ct
+			}
+		}
+		u := "/attachments/" + strconv.Itoa(a.ID) + "/" + a.Filename
+		a.URL = s.URL + u
+		s.attachments[u] = &attachment{
+			contentType: a.ContentType,
+			data:        data,
+		}
+		files = append(files, a)
+	}
+	return files, decoded
+}
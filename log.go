@@ -0,0 +1,102 @@
+package lighthouse
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Logger records the API calls made by a Service, see
+// Service.Logger.  *slog.Logger satisfies Logger.
+type Logger interface {
+	Info(msg string, args ...interface{})
+	Debug(msg string, args ...interface{})
+}
+
+type attemptKey struct{}
+
+// LogMiddleware returns Middleware which logs the method, URL,
+// status and latency of each request with logger at info level.  If
+// bodies is true, request and response bodies are also logged at
+// debug level.  API tokens are redacted from URLs and bodies, see
+// Redact, but bodies may contain other account data.
+//
+// Service.Logger adds LogMiddleware to every request automatically,
+// LogMiddleware is exported so other HTTP clients, i.e., those of
+// migration tools, can log requests the same way.
+func LogMiddleware(logger Logger, bodies bool) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			RegisterSecret(req.Header.Get("X-LighthouseToken"))
+			u := RedactURL(req.URL)
+			if bodies && req.Body != nil {
+				buf, err := ioutil.ReadAll(req.Body)
+				req.Body.Close()
+				if err != nil {
+					return nil, err
+				}
+				req = cloneRequest(req) // per http.RoundTripper contract
+				req.Body = ioutil.NopCloser(bytes.NewReader(buf))
+				logger.Debug("api request body", "method", req.Method, "url", u,
+					"body", logBody(req.Header, buf))
+			}
+
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			args := []interface{}{
+				"method", req.Method,
+				"url", u,
+			}
+			if attempt, ok := req.Context().Value(attemptKey{}).(int); ok {
+				args = append(args, "attempt", attempt)
+			}
+			args = append(args, "latency", time.Since(start))
+			if err != nil {
+				logger.Info("api request failed", append(args, "error", Redact(err.Error()))...)
+				return nil, err
+			}
+			logger.Info("api request", append(args, "status", resp.StatusCode)...)
+
+			if bodies {
+				buf, err := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if err != nil {
+					return nil, err
+				}
+				resp.Body = ioutil.NopCloser(bytes.NewReader(buf))
+				logger.Debug("api response body", "method", req.Method, "url", u,
+					"status", resp.StatusCode, "body", logBody(resp.Header, buf))
+			}
+			return resp, nil
+		})
+	}
+}
+
+// logBody returns buf as a string with API tokens redacted if it is
+// text, otherwise a description of its size and content type.
+func logBody(h http.Header, buf []byte) string {
+	ctype := h.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(ctype)
+	switch {
+	case len(buf) == 0:
+		return ""
+	case len(ctype) == 0,
+		strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "xml"),
+		mediaType == "application/x-www-form-urlencoded":
+		return Redact(string(buf))
+	}
+	return fmt.Sprintf("<%d bytes %s>", len(buf), mediaType)
+}
+
+// withAttempt returns req with attempt recorded in its context for
+// LogMiddleware.
+func withAttempt(req *http.Request, attempt int) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), attemptKey{}, attempt))
+}
@@ -3,16 +3,14 @@
 package messages
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/internal/crud"
+	"github.com/nwidger/lighthouse/tickets"
 )
 
 type Service struct {
@@ -28,24 +26,24 @@ func NewService(s *lighthouse.Service, projectID int) *Service {
 }
 
 type Comment struct {
-	AllAttachmentsCount int        `json:"all_attachments_count"`
-	AttachmentsCount    int        `json:"attachments_count"`
-	Body                string     `json:"body"`
-	BodyHTML            string     `json:"body_html"`
-	CommentsCount       int        `json:"comments_count"`
-	CreatedAt           *time.Time `json:"created_at"`
-	ID                  int        `json:"id"`
-	Integer             int        `json:"integer"`
-	MilestoneID         int        `json:"milestone_id"`
-	ParentID            int        `json:"parent_id"`
-	Permalink           string     `json:"permalink"`
-	ProjectID           int        `json:"project_id"`
-	Title               string     `json:"title"`
-	Token               string     `json:"token"`
-	UpdatedAt           *time.Time `json:"updated_at"`
-	UserID              int        `json:"user_id"`
-	UserName            string     `json:"user_name"`
-	URL                 string     `json:"url"`
+	AllAttachmentsCount int              `json:"all_attachments_count"`
+	AttachmentsCount    int              `json:"attachments_count"`
+	Body                string           `json:"body"`
+	BodyHTML            string           `json:"body_html"`
+	CommentsCount       int              `json:"comments_count"`
+	CreatedAt           *lighthouse.Time `json:"created_at"`
+	ID                  int              `json:"id"`
+	Integer             int              `json:"integer"`
+	MilestoneID         int              `json:"milestone_id"`
+	ParentID            int              `json:"parent_id"`
+	Permalink           string           `json:"permalink"`
+	ProjectID           int              `json:"project_id"`
+	Title               string           `json:"title"`
+	Token               string           `json:"token"`
+	UpdatedAt           *lighthouse.Time `json:"updated_at"`
+	UserID              int              `json:"user_id"`
+	UserName            string           `json:"user_name"`
+	URL                 string           `json:"url"`
 }
 
 type Comments []*Comment
@@ -55,35 +53,52 @@ type CommentCreate struct {
 	Title string `json:"title"`
 }
 
-type commentRequest struct {
-	Comment interface{} `json:"comment"`
+type Message struct {
+	AllAttachmentsCount int              `json:"all_attachments_count"`
+	AttachmentsCount    int              `json:"attachments_count"`
+	Body                string           `json:"body"`
+	BodyHTML            string           `json:"body_html"`
+	CommentsCount       int              `json:"comments_count"`
+	CreatedAt           *lighthouse.Time `json:"created_at"`
+	ID                  int              `json:"id"`
+	Integer             int              `json:"integer"`
+	MilestoneID         int              `json:"milestone_id"`
+	ParentID            int              `json:"parent_id"`
+	Permalink           string           `json:"permalink"`
+	ProjectID           int              `json:"project_id"`
+	Title               string           `json:"title"`
+	Token               string           `json:"token"`
+	UpdatedAt           *lighthouse.Time `json:"updated_at"`
+	UserID              int              `json:"user_id"`
+	UserName            string           `json:"user_name"`
+	URL                 string           `json:"url"`
+	Comments            Comments         `json:"comments"`
+
+	// Unknown holds any fields returned by Lighthouse which
+	// aren't modeled above so they are preserved when the message
+	// is encoded again.
+	Unknown lighthouse.UnknownFields `json:"-"`
+}
+
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	unknown, err := lighthouse.UnmarshalWithUnknown(data, (*message)(m))
+	if err != nil {
+		return err
+	}
+	m.Unknown = unknown
+	return nil
 }
 
-func (cr *commentRequest) Encode(w io.Writer) error {
-	enc := json.NewEncoder(w)
-	return enc.Encode(cr)
+func (m *Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	return lighthouse.MarshalWithUnknown((*message)(m), m.Unknown)
 }
 
-type Message struct {
-	AllAttachmentsCount int        `json:"all_attachments_count"`
-	AttachmentsCount    int        `json:"attachments_count"`
-	Body                string     `json:"body"`
-	BodyHTML            string     `json:"body_html"`
-	CommentsCount       int        `json:"comments_count"`
-	CreatedAt           *time.Time `json:"created_at"`
-	ID                  int        `json:"id"`
-	Integer             int        `json:"integer"`
-	MilestoneID         int        `json:"milestone_id"`
-	ParentID            int        `json:"parent_id"`
-	Permalink           string     `json:"permalink"`
-	ProjectID           int        `json:"project_id"`
-	Title               string     `json:"title"`
-	Token               string     `json:"token"`
-	UpdatedAt           *time.Time `json:"updated_at"`
-	UserID              int        `json:"user_id"`
-	UserName            string     `json:"user_name"`
-	URL                 string     `json:"url"`
-	Comments            Comments   `json:"comments"`
+// WebURL returns the canonical web URL of m in account, for use when
+// m.URL is unavailable, i.e., for messages read from older exports.
+func (m *Message) WebURL(account string) string {
+	return lighthouse.WebURL(account, "projects", strconv.Itoa(m.ProjectID), "messages", lighthouse.Slug(m.ID, m.Permalink))
 }
 
 type Messages []*Message
@@ -91,6 +106,12 @@ type Messages []*Message
 type MessageCreate struct {
 	Body  string `json:"body"`
 	Title string `json:"title"`
+
+	// Messages accept the same notification parameters as
+	// tickets, see
+	// http://help.lighthouseapp.com/discussions/api-developers/196-change-ticket-notifications
+	NotifyAll        *bool `json:"notify_all,omitempty"`
+	MultipleWatchers []int `json:"multiple_watchers,omitempty"`
 }
 
 type MessageUpdate struct {
@@ -98,110 +119,38 @@ type MessageUpdate struct {
 	Title string `json:"title"`
 }
 
-type messageRequest struct {
-	Message interface{} `json:"message"`
-}
-
-func (mr *messageRequest) Encode(w io.Writer) error {
-	enc := json.NewEncoder(w)
-	return enc.Encode(mr)
-}
-
-type messageResponse struct {
-	Message *Message `json:"message"`
-}
-
-func (mr *messageResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(mr)
+func (s *Service) List(reqOpts ...lighthouse.RequestOption) (Messages, error) {
+	return crud.List[Message](s.s, s.basePath+".json", "message", reqOpts...)
 }
 
-type messagesResponse struct {
-	Messages []*messageResponse `json:"messages"`
-}
-
-func (msr *messagesResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(msr)
-}
-
-func (msr *messagesResponse) messages() Messages {
-	ms := make(Messages, 0, len(msr.Messages))
-	for _, m := range msr.Messages {
-		ms = append(ms, m.Message)
-	}
-
-	return ms
-}
-
-func (s *Service) List() (Messages, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+".json", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
-	}
-
-	msresp := &messagesResponse{}
-	err = msresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return msresp.messages(), nil
-}
-
-func (s *Service) New() (*Message, error) {
-	return s.get("new")
+func (s *Service) New(reqOpts ...lighthouse.RequestOption) (*Message, error) {
+	return s.get("new", reqOpts...)
 }
 
 // Only the fields in MessageUpdate can be set.
-func (s *Service) Update(m *Message) error {
-	mreq := &messageRequest{
-		Message: &MessageUpdate{
-			Body:  m.Body,
-			Title: m.Title,
-		},
-	}
-
-	buf := &bytes.Buffer{}
-	err := mreq.Encode(buf)
-	if err != nil {
-		return err
-	}
-
-	resp, err := s.s.RoundTrip("PUT", s.basePath+"/"+strconv.Itoa(m.ID)+".json", buf)
-	if err != nil {
-		return err
+func (s *Service) Update(m *Message, reqOpts ...lighthouse.RequestOption) error {
+	mu := &MessageUpdate{
+		Body:  m.Body,
+		Title: m.Title,
 	}
-	defer resp.Body.Close()
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return crud.Update(s.s, s.basePath+"/"+strconv.Itoa(m.ID)+".json", "message", mu, reqOpts...)
 }
 
-func (s *Service) Get(idOrTitle string) (*Message, error) {
+func (s *Service) Get(idOrTitle string, reqOpts ...lighthouse.RequestOption) (*Message, error) {
 	id, err := lighthouse.ID(idOrTitle)
 	if err == nil {
-		return s.GetByID(id)
+		return s.GetByID(id, reqOpts...)
 	}
-	return s.GetByTitle(idOrTitle)
+	return s.GetByTitle(idOrTitle, reqOpts...)
 }
 
-func (s *Service) GetByID(id int) (*Message, error) {
-	return s.get(strconv.Itoa(id))
+func (s *Service) GetByID(id int, reqOpts ...lighthouse.RequestOption) (*Message, error) {
+	return s.get(strconv.Itoa(id), reqOpts...)
 }
 
-func (s *Service) GetByTitle(title string) (*Message, error) {
-	ms, err := s.List()
+func (s *Service) GetByTitle(title string, reqOpts ...lighthouse.RequestOption) (*Message, error) {
+	ms, err := s.List(reqOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -214,147 +163,144 @@ func (s *Service) GetByTitle(title string) (*Message, error) {
 	return nil, fmt.Errorf("no such message %q", title)
 }
 
-func (s *Service) get(id string) (*Message, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+"/"+id+".json", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+func (s *Service) get(id string, reqOpts ...lighthouse.RequestOption) (*Message, error) {
+	return crud.Get[Message](s.s, s.basePath+"/"+id+".json", "message", reqOpts...)
+}
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
-	}
+// Only the fields in MessageCreate can be set.
+func (s *Service) Create(m *Message, reqOpts ...lighthouse.RequestOption) (*Message, error) {
+	return s.CreateWithOptions(m, nil, reqOpts...)
+}
 
-	mresp := &messageResponse{}
-	err = mresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
+// CreateWithOptions is like Create but controls who is notified of
+// the new message, for example to create messages during an import
+// without emailing every project member.  opts may be nil.
+func (s *Service) CreateWithOptions(m *Message, opts *tickets.NotifyOptions, reqOpts ...lighthouse.RequestOption) (*Message, error) {
+	mc := &MessageCreate{
+		Body:  m.Body,
+		Title: m.Title,
+	}
+	if opts != nil {
+		mc.NotifyAll = opts.NotifyAll
+		mc.MultipleWatchers = opts.MultipleWatchers
 	}
 
-	return mresp.Message, nil
+	return crud.Create(s.s, s.basePath+".json", "message", mc, m, reqOpts...)
 }
 
-// Only the fields in MessageCreate can be set.
-func (s *Service) Create(m *Message) (*Message, error) {
-	mreq := &messageRequest{
-		Message: &MessageCreate{
-			Body:  m.Body,
-			Title: m.Title,
-		},
-	}
-
-	buf := &bytes.Buffer{}
-	err := mreq.Encode(buf)
-	if err != nil {
-		return nil, err
+// Only the fields in CommentCreate can be set.
+func (s *Service) CreateComment(idOrTitle string, c *Comment, reqOpts ...lighthouse.RequestOption) (*Message, error) {
+	id, err := lighthouse.ID(idOrTitle)
+	if err == nil {
+		return s.CreateCommentByID(id, c, reqOpts...)
 	}
+	return s.CreateCommentByTitle(idOrTitle, c, reqOpts...)
+}
 
-	resp, err := s.s.RoundTrip("POST", s.basePath+".json", buf)
-	if err != nil {
-		return nil, err
+// Only the fields in CommentCreate can be set.
+func (s *Service) CreateCommentByID(id int, c *Comment, reqOpts ...lighthouse.RequestOption) (*Message, error) {
+	cc := &CommentCreate{
+		Body:  c.Body,
+		Title: c.Title,
 	}
-	defer resp.Body.Close()
 
-	err = lighthouse.CheckResponse(resp, http.StatusCreated)
-	if err != nil {
-		return nil, err
-	}
+	// Lighthouse responds with the whole message, not the comment.
+	return crud.Send[Message](s.s, "POST", s.basePath+"/"+strconv.Itoa(id)+"/comments.json", crud.Wrap("comment", cc), http.StatusCreated, "message", nil, reqOpts...)
+}
 
-	mresp := &messageResponse{
-		Message: m,
-	}
-	err = mresp.decode(resp.Body)
+// Only the fields in CommentCreate can be set.
+func (s *Service) CreateCommentByTitle(title string, c *Comment, reqOpts ...lighthouse.RequestOption) (*Message, error) {
+	m, err := s.GetByTitle(title, reqOpts...)
 	if err != nil {
 		return nil, err
 	}
-
-	return m, nil
+	return s.CreateCommentByID(m.ID, c, reqOpts...)
 }
 
-// Only the fields in CommentCreate can be set.
-func (s *Service) CreateComment(idOrTitle string, c *Comment) (*Message, error) {
+func (s *Service) Delete(idOrTitle string, reqOpts ...lighthouse.RequestOption) error {
 	id, err := lighthouse.ID(idOrTitle)
 	if err == nil {
-		return s.CreateCommentByID(id, c)
+		return s.DeleteByID(id, reqOpts...)
 	}
-	return s.CreateCommentByTitle(idOrTitle, c)
+	return s.DeleteByTitle(idOrTitle, reqOpts...)
 }
 
-// Only the fields in CommentCreate can be set.
-func (s *Service) CreateCommentByID(id int, c *Comment) (*Message, error) {
-	creq := &commentRequest{
-		Comment: &CommentCreate{
-			Body:  c.Body,
-			Title: c.Title,
-		},
-	}
+func (s *Service) DeleteByID(id int, reqOpts ...lighthouse.RequestOption) error {
+	return crud.Delete(s.s, s.basePath+"/"+strconv.Itoa(id)+".json", reqOpts...)
+}
 
-	buf := &bytes.Buffer{}
-	err := creq.Encode(buf)
+func (s *Service) DeleteByTitle(title string, reqOpts ...lighthouse.RequestOption) error {
+	m, err := s.GetByTitle(title, reqOpts...)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return s.DeleteByID(m.ID, reqOpts...)
+}
 
-	resp, err := s.s.RoundTrip("POST", s.basePath+"/"+strconv.Itoa(id)+"/comments.json", buf)
-	if err != nil {
-		return nil, err
+// Ticket returns a new ticket built from message m and its comment
+// thread.  The ticket's title is the message's title and its body is
+// the message's body followed by each of its comments.
+func Ticket(m *Message) *tickets.Ticket {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "Converted from message %q", m.Title)
+	if len(m.URL) > 0 {
+		fmt.Fprintf(b, " (%s)", m.URL)
+	}
+	b.WriteString("\n\n")
+	b.WriteString(strings.TrimSpace(m.Body))
+	for _, c := range m.Comments {
+		if c == nil || c.ID == m.ID || len(strings.TrimSpace(c.Body)) == 0 {
+			continue
+		}
+		b.WriteString("\n\n---\n\n")
+		if len(c.UserName) > 0 {
+			fmt.Fprintf(b, "%s", c.UserName)
+			if c.CreatedAt != nil {
+				fmt.Fprintf(b, " on %s", c.CreatedAt.Format("2006-01-02 15:04"))
+			}
+			b.WriteString(" wrote:\n\n")
+		}
+		b.WriteString(strings.TrimSpace(c.Body))
+	}
+	return &tickets.Ticket{
+		Title:       m.Title,
+		Body:        b.String(),
+		MilestoneID: m.MilestoneID,
 	}
-	defer resp.Body.Close()
+}
 
-	err = lighthouse.CheckResponse(resp, http.StatusCreated)
+// ConvertToTicket creates a ticket using ts from the message
+// identified by idOrTitle and its comment thread.  If comment is
+// true, a comment linking to the new ticket is added to the message.
+// Lighthouse does not allow messages to be closed, so the comment is
+// the only indication on the message that it was converted.
+func (s *Service) ConvertToTicket(idOrTitle string, ts *tickets.Service, opts *tickets.NotifyOptions, comment bool, reqOpts ...lighthouse.RequestOption) (*tickets.Ticket, error) {
+	m, err := s.Get(idOrTitle, reqOpts...)
 	if err != nil {
 		return nil, err
 	}
-
-	m := &Message{}
-	mresp := &messageResponse{
-		Message: m,
-	}
-	err = mresp.decode(resp.Body)
+	// messages returned by GetByTitle do not include comments
+	m, err = s.GetByID(m.ID, reqOpts...)
 	if err != nil {
 		return nil, err
 	}
 
-	return m, nil
-}
-
-// Only the fields in CommentCreate can be set.
-func (s *Service) CreateCommentByTitle(title string, c *Comment) (*Message, error) {
-	m, err := s.GetByTitle(title)
+	t, err := ts.CreateWithOptions(Ticket(m), opts, reqOpts...)
 	if err != nil {
 		return nil, err
 	}
-	return s.CreateCommentByID(m.ID, c)
-}
-
-func (s *Service) Delete(idOrTitle string) error {
-	id, err := lighthouse.ID(idOrTitle)
-	if err == nil {
-		return s.DeleteByID(id)
+	if !comment {
+		return t, nil
 	}
-	return s.DeleteByTitle(idOrTitle)
-}
 
-func (s *Service) DeleteByID(id int) error {
-	resp, err := s.s.RoundTrip("DELETE", s.basePath+"/"+strconv.Itoa(id)+".json", nil)
-	if err != nil {
-		return err
+	body := fmt.Sprintf("Converted to ticket #%d", t.Number)
+	if len(t.URL) > 0 {
+		body += ": " + t.URL
 	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
+	_, err = s.CreateCommentByID(m.ID, &Comment{Body: body}, reqOpts...)
 	if err != nil {
-		return err
+		return t, err
 	}
 
-	return nil
-}
-
-func (s *Service) DeleteByTitle(title string) error {
-	m, err := s.GetByTitle(title)
-	if err != nil {
-		return err
-	}
-	return s.DeleteByID(m.ID)
+	return t, nil
 }
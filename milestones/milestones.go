@@ -5,100 +5,124 @@ package milestones
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/internal/crud"
+	"github.com/nwidger/lighthouse/tickets"
 )
 
 type Service struct {
-	basePath string
-	s        *lighthouse.Service
+	basePath  string
+	projectID int
+	s         *lighthouse.Service
 }
 
 func NewService(s *lighthouse.Service, projectID int) *Service {
 	return &Service{
-		basePath: s.BasePath + "/projects/" + strconv.Itoa(projectID) + "/milestones",
-		s:        s,
+		basePath:  s.BasePath + "/projects/" + strconv.Itoa(projectID) + "/milestones",
+		projectID: projectID,
+		s:         s,
 	}
 }
 
 type Milestone struct {
-	AttachmentsCount int        `json:"attachments_count"`
-	CompletedAt      *time.Time `json:"completed_at"`
-	CreatedAt        *time.Time `json:"created_at"`
-	DueOn            *time.Time `json:"due_on"`
-	Goals            string     `json:"goals"`
-	GoalsHTML        string     `json:"goals_html"`
-	ID               int        `json:"id"`
-	MaxPoints        int        `json:"max_points"`
-	OpenTicketsCount int        `json:"open_tickets_count"`
-	Permalink        string     `json:"permalink"`
-	PointsClosed     int        `json:"points_closed"`
-	PointsOpen       int        `json:"points_open"`
-	Position         int        `json:"position"`
-	ProjectID        int        `json:"project_id"`
-	TicketsCount     int        `json:"tickets_count"`
-	Title            string     `json:"title"`
-	UpdatedAt        *time.Time `json:"updated_at"`
-	URL              string     `json:"url"`
-	UserName         string     `json:"user_name"`
+	AttachmentsCount int              `json:"attachments_count"`
+	CompletedAt      *lighthouse.Time `json:"completed_at"`
+	CreatedAt        *lighthouse.Time `json:"created_at"`
+	DueOn            *lighthouse.Time `json:"due_on"`
+	Goals            string           `json:"goals"`
+	GoalsHTML        string           `json:"goals_html"`
+	ID               int              `json:"id"`
+	MaxPoints        int              `json:"max_points"`
+	OpenTicketsCount int              `json:"open_tickets_count"`
+	Permalink        string           `json:"permalink"`
+	PointsClosed     int              `json:"points_closed"`
+	PointsOpen       int              `json:"points_open"`
+	Position         int              `json:"position"`
+	ProjectID        int              `json:"project_id"`
+	TicketsCount     int              `json:"tickets_count"`
+	Title            string           `json:"title"`
+	UpdatedAt        *lighthouse.Time `json:"updated_at"`
+	URL              string           `json:"url"`
+	UserName         string           `json:"user_name"`
+
+	// Attachments are the files attached to the milestone, i.e.,
+	// spec documents.  Use GetAttachment to download them.
+	Attachments []*tickets.AttachmentResponse `json:"attachments,omitempty"`
+
+	// Unknown holds any fields returned by Lighthouse which
+	// aren't modeled above so they are preserved when the milestone
+	// is encoded again.
+	Unknown lighthouse.UnknownFields `json:"-"`
 }
 
-type Milestones []*Milestone
-
-type MilestoneCreate struct {
-	Goals string     `json:"goals"`
-	Title string     `json:"title"`
-	DueOn *time.Time `json:"due_on"`
+func (m *Milestone) UnmarshalJSON(data []byte) error {
+	type milestone Milestone
+	unknown, err := lighthouse.UnmarshalWithUnknown(data, (*milestone)(m))
+	if err != nil {
+		return err
+	}
+	m.Unknown = unknown
+	return nil
 }
 
-type MilestoneUpdate struct {
-	Goals string     `json:"goals"`
-	Title string     `json:"title"`
-	DueOn *time.Time `json:"due_on"`
+func (m *Milestone) MarshalJSON() ([]byte, error) {
+	type milestone Milestone
+	return lighthouse.MarshalWithUnknown((*milestone)(m), m.Unknown)
 }
 
-type milestoneRequest struct {
-	Milestone interface{} `json:"milestone"`
+// CreatedAtTime returns the time the milestone was created, or the
+// zero time if it is unknown.
+func (m *Milestone) CreatedAtTime() time.Time {
+	return m.CreatedAt.OrZero()
 }
 
-func (mr *milestoneRequest) Encode(w io.Writer) error {
-	enc := json.NewEncoder(w)
-	return enc.Encode(mr)
+// UpdatedAtTime returns the time the milestone was last updated, or
+// the zero time if it is unknown.
+func (m *Milestone) UpdatedAtTime() time.Time {
+	return m.UpdatedAt.OrZero()
 }
 
-type milestoneResponse struct {
-	Milestone *Milestone `json:"milestone"`
+// DueOnTime returns the milestone's due date, or the zero time if it
+// has none.
+func (m *Milestone) DueOnTime() time.Time {
+	return m.DueOn.OrZero()
 }
 
-func (mr *milestoneResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(mr)
+// CompletedAtTime returns the time the milestone was completed, or
+// the zero time if it is not completed.
+func (m *Milestone) CompletedAtTime() time.Time {
+	return m.CompletedAt.OrZero()
 }
 
-type milestonesResponse struct {
-	Milestones []*milestoneResponse `json:"milestones"`
+// WebURL returns the canonical web URL of m in account, for use when
+// m.URL is unavailable.
+func (m *Milestone) WebURL(account string) string {
+	return lighthouse.WebURL(account, "projects", strconv.Itoa(m.ProjectID), "milestones", lighthouse.Slug(m.ID, m.Permalink))
 }
 
-func (msr *milestonesResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(msr)
-}
+type Milestones []*Milestone
 
-func (msr *milestonesResponse) milestones() Milestones {
-	ms := make(Milestones, 0, len(msr.Milestones))
-	for _, m := range msr.Milestones {
-		ms = append(ms, m.Milestone)
-	}
+type MilestoneCreate struct {
+	Goals string           `json:"goals"`
+	Title string           `json:"title"`
+	DueOn *lighthouse.Time `json:"due_on"`
+}
 
-	return ms
+type MilestoneUpdate struct {
+	Goals string           `json:"goals"`
+	Title string           `json:"title"`
+	DueOn *lighthouse.Time `json:"due_on"`
 }
 
 type ListOptions struct {
@@ -107,31 +131,38 @@ type ListOptions struct {
 }
 
 // ListAll repeatedly calls List and returns all pages.  ListAll
-// ignores opts.Page.
-func (s *Service) ListAll(opts *ListOptions) (Milestones, error) {
+// ignores opts.Page.  If an error occurs, the pages retrieved so far
+// are returned along with the error.
+func (s *Service) ListAll(opts *ListOptions, reqOpts ...lighthouse.RequestOption) (Milestones, error) {
+	ms := Milestones{}
+	err := s.Pages(opts, func(p Milestones) {
+		ms = append(ms, p...)
+	}, reqOpts...).All()
+	return ms, err
+}
+
+// Pages returns a *lighthouse.Pager which calls List for each page
+// and passes the page's milestones to fn.  Pages ignores opts.Page.
+func (s *Service) Pages(opts *ListOptions, fn func(Milestones), reqOpts ...lighthouse.RequestOption) *lighthouse.Pager {
 	realOpts := ListOptions{}
 	if opts != nil {
 		realOpts = *opts
 	}
 
-	ms := Milestones{}
-
-	for realOpts.Page = 1; ; realOpts.Page++ {
-		p, err := s.List(&realOpts)
+	return lighthouse.NewPager(func(page int) (int, error) {
+		realOpts.Page = page
+		p, err := s.List(&realOpts, reqOpts...)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
-		if len(p) == 0 {
-			break
+		if len(p) > 0 {
+			fn(p)
 		}
-
-		ms = append(ms, p...)
-	}
-
-	return ms, nil
+		return len(p), nil
+	})
 }
 
-func (s *Service) List(opts *ListOptions) (Milestones, error) {
+func (s *Service) List(opts *ListOptions, reqOpts ...lighthouse.RequestOption) (Milestones, error) {
 	path := s.basePath + ".json"
 	if opts != nil {
 		u, err := url.Parse(path)
@@ -146,74 +177,38 @@ func (s *Service) List(opts *ListOptions) (Milestones, error) {
 		path = u.String()
 	}
 
-	resp, err := s.s.RoundTrip("GET", path, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
-	}
-
-	msresp := &milestonesResponse{}
-	err = msresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return msresp.milestones(), nil
+	return crud.List[Milestone](s.s, path, "milestone", reqOpts...)
 }
 
-func (s *Service) New() (*Milestone, error) {
-	return s.get("new")
+func (s *Service) New(reqOpts ...lighthouse.RequestOption) (*Milestone, error) {
+	return s.get("new", reqOpts...)
 }
 
 // Only the fields in MilestoneUpdate can be set.
-func (s *Service) Update(m *Milestone) error {
-	mreq := &milestoneRequest{
-		Milestone: &MilestoneUpdate{
-			Goals: m.Goals,
-			Title: m.Title,
-			DueOn: m.DueOn,
-		},
-	}
-
-	buf := &bytes.Buffer{}
-	err := mreq.Encode(buf)
-	if err != nil {
-		return err
-	}
-
-	resp, err := s.s.RoundTrip("PUT", s.basePath+"/"+strconv.Itoa(m.ID)+".json", buf)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return err
+func (s *Service) Update(m *Milestone, reqOpts ...lighthouse.RequestOption) error {
+	mu := &MilestoneUpdate{
+		Goals: m.Goals,
+		Title: m.Title,
+		DueOn: m.DueOn,
 	}
 
-	return nil
+	return crud.Update(s.s, s.basePath+"/"+strconv.Itoa(m.ID)+".json", "milestone", mu, reqOpts...)
 }
 
-func (s *Service) Get(idOrTitle string) (*Milestone, error) {
+func (s *Service) Get(idOrTitle string, reqOpts ...lighthouse.RequestOption) (*Milestone, error) {
 	id, err := lighthouse.ID(idOrTitle)
 	if err == nil {
-		return s.GetByID(id)
+		return s.GetByID(id, reqOpts...)
 	}
-	return s.GetByTitle(idOrTitle)
+	return s.GetByTitle(idOrTitle, reqOpts...)
 }
 
-func (s *Service) GetByID(id int) (*Milestone, error) {
-	return s.get(strconv.Itoa(id))
+func (s *Service) GetByID(id int, reqOpts ...lighthouse.RequestOption) (*Milestone, error) {
+	return s.get(strconv.Itoa(id), reqOpts...)
 }
 
-func (s *Service) GetByTitle(title string) (*Milestone, error) {
-	ms, err := s.ListAll(&ListOptions{})
+func (s *Service) GetByTitle(title string, reqOpts ...lighthouse.RequestOption) (*Milestone, error) {
+	ms, err := s.ListAll(&ListOptions{}, reqOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -226,75 +221,98 @@ func (s *Service) GetByTitle(title string) (*Milestone, error) {
 	return nil, fmt.Errorf("no such milestone %q", title)
 }
 
-func (s *Service) get(id string) (*Milestone, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+"/"+id+".json", nil)
-	if err != nil {
-		return nil, err
+func (s *Service) get(id string, reqOpts ...lighthouse.RequestOption) (*Milestone, error) {
+	return crud.Get[Milestone](s.s, s.basePath+"/"+id+".json", "milestone", reqOpts...)
+}
+
+// Only the fields in MilestoneCreate can be set.
+func (s *Service) Create(m *Milestone, reqOpts ...lighthouse.RequestOption) (*Milestone, error) {
+	mc := &MilestoneCreate{
+		Goals: m.Goals,
+		Title: m.Title,
+		DueOn: m.DueOn,
 	}
-	defer resp.Body.Close()
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
+	return crud.Create(s.s, s.basePath+".json", "milestone", mc, m, reqOpts...)
+}
+
+// ListAttachments returns the attachments of the milestone
+// identified by idOrTitle.
+func (s *Service) ListAttachments(idOrTitle string, reqOpts ...lighthouse.RequestOption) (tickets.Attachments, error) {
+	m, err := s.Get(idOrTitle, reqOpts...)
 	if err != nil {
 		return nil, err
 	}
-
-	mresp := &milestoneResponse{}
-	err = mresp.decode(resp.Body)
+	// milestones returned by GetByTitle do not include
+	// attachments
+	m, err = s.GetByID(m.ID, reqOpts...)
 	if err != nil {
 		return nil, err
 	}
-
-	return mresp.Milestone, nil
+	as := make(tickets.Attachments, 0, len(m.Attachments))
+	for _, a := range m.Attachments {
+		if a != nil && a.Attachment != nil {
+			as = append(as, a.Attachment)
+		}
+	}
+	return as, nil
 }
 
-// Only the fields in MilestoneCreate can be set.
-func (s *Service) Create(m *Milestone) (*Milestone, error) {
-	mreq := &milestoneRequest{
-		Milestone: &MilestoneCreate{
-			Goals: m.Goals,
-			Title: m.Title,
-			DueOn: m.DueOn,
-		},
+func (s *Service) GetAttachment(a *tickets.Attachment, reqOpts ...lighthouse.RequestOption) (io.ReadCloser, error) {
+	resp, err := s.s.RoundTrip("GET", a.URL, nil, reqOpts...)
+	if err != nil {
+		return nil, err
 	}
 
-	buf := &bytes.Buffer{}
-	err := mreq.Encode(buf)
+	err = lighthouse.CheckResponse(resp, http.StatusOK)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := s.s.RoundTrip("POST", s.basePath+".json", buf)
+	return resp.Body, nil
+}
+
+// Only the fields in MilestoneUpdate are sent along with the
+// attachment.
+func (s *Service) AddAttachment(m *Milestone, filename string, r io.Reader, reqOpts ...lighthouse.RequestOption) error {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	attachmentPart, err := w.CreateFormFile("milestone[attachment][]", filepath.Base(filename))
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer resp.Body.Close()
 
-	err = lighthouse.CheckResponse(resp, http.StatusCreated)
+	_, err = io.Copy(attachmentPart, r)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	mresp := &milestoneResponse{
-		Milestone: m,
+	mu := &MilestoneUpdate{
+		Goals: m.Goals,
+		Title: m.Title,
+		DueOn: m.DueOn,
 	}
-	err = mresp.decode(resp.Body)
+
+	err = s.s.WriteFormFields(w, crud.Wrap("milestone", mu))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return m, nil
-}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
 
-func (s *Service) Close(idOrTitle string) error {
-	id, err := lighthouse.ID(idOrTitle)
-	if err == nil {
-		return s.CloseByID(id)
+	req, err := http.NewRequest("PUT", s.s.FormatPath(s.basePath+"/"+strconv.Itoa(m.ID)+".json"), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	for _, opt := range reqOpts {
+		req = opt(req)
 	}
-	return s.CloseByTitle(idOrTitle)
-}
 
-func (s *Service) CloseByID(id int) error {
-	resp, err := s.s.RoundTrip("PUT", s.basePath+"/"+strconv.Itoa(id)+"/close.json", nil)
+	resp, err := s.s.Do(req)
 	if err != nil {
 		return err
 	}
@@ -308,72 +326,182 @@ func (s *Service) CloseByID(id int) error {
 	return nil
 }
 
-func (s *Service) CloseByTitle(title string) error {
-	m, err := s.GetByTitle(title)
-	if err != nil {
-		return err
-	}
-	return s.CloseByID(m.ID)
-}
-
-func (s *Service) Open(idOrTitle string) error {
+func (s *Service) Close(idOrTitle string, reqOpts ...lighthouse.RequestOption) error {
 	id, err := lighthouse.ID(idOrTitle)
 	if err == nil {
-		return s.OpenByID(id)
+		return s.CloseByID(id, reqOpts...)
 	}
-	return s.OpenByTitle(idOrTitle)
+	return s.CloseByTitle(idOrTitle, reqOpts...)
+}
+
+func (s *Service) CloseByID(id int, reqOpts ...lighthouse.RequestOption) error {
+	return crud.Do(s.s, "PUT", s.basePath+"/"+strconv.Itoa(id)+"/close.json", nil, http.StatusOK, nil, reqOpts...)
 }
 
-func (s *Service) OpenByID(id int) error {
-	resp, err := s.s.RoundTrip("PUT", s.basePath+"/"+strconv.Itoa(id)+"/open.json", nil)
+func (s *Service) CloseByTitle(title string, reqOpts ...lighthouse.RequestOption) error {
+	m, err := s.GetByTitle(title, reqOpts...)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	return s.CloseByID(m.ID, reqOpts...)
+}
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return err
+func (s *Service) Open(idOrTitle string, reqOpts ...lighthouse.RequestOption) error {
+	id, err := lighthouse.ID(idOrTitle)
+	if err == nil {
+		return s.OpenByID(id, reqOpts...)
 	}
+	return s.OpenByTitle(idOrTitle, reqOpts...)
+}
 
-	return nil
+func (s *Service) OpenByID(id int, reqOpts ...lighthouse.RequestOption) error {
+	return crud.Do(s.s, "PUT", s.basePath+"/"+strconv.Itoa(id)+"/open.json", nil, http.StatusOK, nil, reqOpts...)
 }
 
-func (s *Service) OpenByTitle(title string) error {
-	m, err := s.GetByTitle(title)
+func (s *Service) OpenByTitle(title string, reqOpts ...lighthouse.RequestOption) error {
+	m, err := s.GetByTitle(title, reqOpts...)
 	if err != nil {
 		return err
 	}
-	return s.OpenByID(m.ID)
+	return s.OpenByID(m.ID, reqOpts...)
 }
 
-func (s *Service) Delete(idOrTitle string) error {
+func (s *Service) Delete(idOrTitle string, reqOpts ...lighthouse.RequestOption) error {
 	id, err := lighthouse.ID(idOrTitle)
 	if err == nil {
-		return s.DeleteByID(id)
+		return s.DeleteByID(id, reqOpts...)
 	}
-	return s.DeleteByTitle(idOrTitle)
+	return s.DeleteByTitle(idOrTitle, reqOpts...)
 }
 
-func (s *Service) DeleteByID(id int) error {
-	resp, err := s.s.RoundTrip("DELETE", s.basePath+"/"+strconv.Itoa(id)+".json", nil)
+func (s *Service) DeleteByID(id int, reqOpts ...lighthouse.RequestOption) error {
+	return crud.Delete(s.s, s.basePath+"/"+strconv.Itoa(id)+".json", reqOpts...)
+}
+
+func (s *Service) DeleteByTitle(title string, reqOpts ...lighthouse.RequestOption) error {
+	m, err := s.GetByTitle(title, reqOpts...)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	return s.DeleteByID(m.ID, reqOpts...)
+}
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return err
+// NormalizeTitle returns a normalized form of a milestone title used
+// to detect duplicates.  Case, whitespace, a leading 'v' or
+// 'version' before a version number and trailing '.0' components
+// are ignored, so 'v1.0', 'V1.0', 'Version 1' and '1.0' are all
+// considered the same.
+func NormalizeTitle(title string) string {
+	n := strings.Join(strings.Fields(strings.ToLower(title)), "")
+	for _, prefix := range []string{"version", "v"} {
+		if strings.HasPrefix(n, prefix) && len(n) > len(prefix) &&
+			n[len(prefix)] >= '0' && n[len(prefix)] <= '9' {
+			n = n[len(prefix):]
+			break
+		}
+	}
+	for strings.HasSuffix(n, ".0") {
+		n = strings.TrimSuffix(n, ".0")
 	}
+	return n
+}
 
-	return nil
+// Duplicates is a group of milestones with the same normalized
+// title, see NormalizeTitle.
+type Duplicates struct {
+	// Canonical is the milestone the duplicates' tickets should
+	// be merged into.
+	Canonical *Milestone `json:"canonical"`
+	// Duplicates are the remaining milestones in the group.
+	Duplicates Milestones `json:"duplicates"`
+	// Tickets are the numbers of the tickets moved to Canonical
+	// by Merge.
+	Tickets []int `json:"tickets,omitempty"`
 }
 
-func (s *Service) DeleteByTitle(title string) error {
-	m, err := s.GetByTitle(title)
-	if err != nil {
-		return err
+// FindDuplicates groups ms by normalized title and returns the
+// groups containing more than one milestone.  In each group, the
+// milestone with the most tickets is chosen as canonical, with ties
+// going to the oldest milestone.
+func FindDuplicates(ms Milestones) []*Duplicates {
+	groups := map[string]Milestones{}
+	keys := []string{}
+	for _, m := range ms {
+		key := NormalizeTitle(m.Title)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], m)
 	}
-	return s.DeleteByID(m.ID)
+
+	dups := []*Duplicates{}
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+		sort.SliceStable(group, func(i, j int) bool {
+			if group[i].TicketsCount != group[j].TicketsCount {
+				return group[i].TicketsCount > group[j].TicketsCount
+			}
+			return group[i].ID < group[j].ID
+		})
+		dups = append(dups, &Duplicates{
+			Canonical:  group[0],
+			Duplicates: group[1:],
+		})
+	}
+
+	return dups
+}
+
+// Merge moves the tickets of each of d.Duplicates to d.Canonical
+// and, if closeDuplicates is true, closes the duplicates.  Tickets
+// are updated without notifying project members.  The numbers of
+// the moved tickets are stored in d.Tickets.  If dryRun is true,
+// d.Tickets is populated but no changes are made.
+func (s *Service) Merge(d *Duplicates, closeDuplicates, dryRun bool, reqOpts ...lighthouse.RequestOption) error {
+	ts := tickets.NewService(s.s, s.projectID)
+	notifyAll := false
+	opts := &tickets.NotifyOptions{
+		NotifyAll: &notifyAll,
+	}
+
+	d.Tickets = nil
+
+	for _, m := range d.Duplicates {
+		// the milestone keyword matches by title, which may
+		// also match the canonical milestone, so only move
+		// tickets actually assigned to the duplicate
+		matches, err := ts.ListAll(&tickets.ListOptions{
+			Query: "milestone:" + tickets.QuoteKeyword(m.Title),
+			Limit: tickets.MaxLimit,
+		}, reqOpts...)
+		if err != nil {
+			return err
+		}
+		for _, t := range matches {
+			if t.MilestoneID != m.ID {
+				continue
+			}
+			d.Tickets = append(d.Tickets, t.Number)
+			if dryRun {
+				continue
+			}
+			t.MilestoneID = d.Canonical.ID
+			err = ts.UpdateWithOptions(t, opts, reqOpts...)
+			if err != nil {
+				return err
+			}
+		}
+		if dryRun || !closeDuplicates {
+			continue
+		}
+		err = s.CloseByID(m.ID, reqOpts...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
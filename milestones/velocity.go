@@ -0,0 +1,124 @@
+package milestones
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+)
+
+// MilestoneVelocity is the points progress of a milestone, see
+// Velocity.
+type MilestoneVelocity struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+
+	PointsOpen   int `json:"points_open"`
+	PointsClosed int `json:"points_closed"`
+	MaxPoints    int `json:"max_points"`
+
+	// Completion is the fraction of MaxPoints which are closed,
+	// between 0 and 1.
+	Completion float64 `json:"completion"`
+
+	// Start is when the milestone was created and End when it
+	// was completed, or the time the report was made for if it
+	// is incomplete.
+	Start *lighthouse.Time `json:"start"`
+	End   *lighthouse.Time `json:"end"`
+
+	// Completed reports whether the milestone is complete.
+	Completed bool `json:"completed"`
+
+	// Velocity is the number of points closed per week between
+	// Start and End.
+	Velocity float64 `json:"velocity"`
+}
+
+// VelocityReport is the velocity of a project's milestones, see
+// Velocity.
+type VelocityReport struct {
+	// Milestones are the milestones with points, completed
+	// milestones first in order of completion followed by
+	// incomplete milestones in order of creation.
+	Milestones []*MilestoneVelocity `json:"milestones"`
+
+	// Average is the mean velocity of the completed milestones.
+	Average float64 `json:"average"`
+
+	// Trend is the change in velocity from one completed
+	// milestone to the next, fitted by least squares.  A
+	// positive trend means the project is speeding up.  It is
+	// zero if fewer than two milestones are complete.
+	Trend float64 `json:"trend"`
+}
+
+// Velocity reports the velocity of each of ms which has points,
+// measured in points closed per week, along with the average
+// velocity of the completed milestones and its trend.  Incomplete
+// milestones are measured up to now and do not count towards the
+// average or trend.  Milestones without points or a creation time
+// are skipped.
+func Velocity(ms Milestones, now time.Time) *VelocityReport {
+	report := &VelocityReport{
+		Milestones: []*MilestoneVelocity{},
+	}
+
+	for _, m := range ms {
+		max := m.MaxPoints
+		if max == 0 {
+			max = m.PointsOpen + m.PointsClosed
+		}
+		if max == 0 || m.CreatedAt == nil || m.CreatedAt.IsZero() {
+			continue
+		}
+		mv := &MilestoneVelocity{
+			ID:           m.ID,
+			Title:        m.Title,
+			PointsOpen:   m.PointsOpen,
+			PointsClosed: m.PointsClosed,
+			MaxPoints:    max,
+			Completion:   float64(m.PointsClosed) / float64(max),
+			Start:        m.CreatedAt,
+			End:          lighthouse.NewTime(now),
+		}
+		if m.CompletedAt != nil && !m.CompletedAt.IsZero() {
+			mv.End, mv.Completed = m.CompletedAt, true
+		}
+		if weeks := mv.End.Sub(mv.Start.Time).Hours() / (24 * 7); weeks > 0 {
+			mv.Velocity = float64(mv.PointsClosed) / weeks
+		}
+		report.Milestones = append(report.Milestones, mv)
+	}
+
+	mvs := report.Milestones
+	sort.SliceStable(mvs, func(i, j int) bool {
+		if mvs[i].Completed != mvs[j].Completed {
+			return mvs[i].Completed
+		}
+		if mvs[i].Completed {
+			return mvs[i].End.Before(mvs[j].End.Time)
+		}
+		return mvs[i].Start.Before(mvs[j].Start.Time)
+	})
+
+	// least squares fit of velocity against the index of each
+	// completed milestone
+	n, sumX, sumY, sumXY, sumXX := 0.0, 0.0, 0.0, 0.0, 0.0
+	for _, mv := range mvs {
+		if !mv.Completed {
+			break
+		}
+		x, y := n, mv.Velocity
+		sumX, sumY, sumXY, sumXX = sumX+x, sumY+y, sumXY+x*y, sumXX+x*x
+		n++
+	}
+	if n > 0 {
+		report.Average = sumY / n
+	}
+	if n > 1 {
+		report.Trend = (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	}
+
+	return report
+}
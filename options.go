@@ -0,0 +1,57 @@
+package lighthouse
+
+import (
+	"context"
+	"net/http"
+)
+
+// RequestOption modifies the request made by a single service method
+// call.  Options are passed variadically to service methods, i.e.,
+//
+//	t, err := ticketsService.GetByNumber(42, lighthouse.WithContext(ctx))
+//
+// and are applied in order to each request the method makes.
+type RequestOption func(req *http.Request) *http.Request
+
+// WithContext makes the request with ctx, so it is aborted if ctx is
+// canceled.
+func WithContext(ctx context.Context) RequestOption {
+	return func(req *http.Request) *http.Request {
+		return req.WithContext(ctx)
+	}
+}
+
+// WithHeader sets the header key to value.
+func WithHeader(key, value string) RequestOption {
+	return func(req *http.Request) *http.Request {
+		req.Header.Set(key, value)
+		return req
+	}
+}
+
+// WithQueryParam sets the URL parameter key to value.
+func WithQueryParam(key, value string) RequestOption {
+	return func(req *http.Request) *http.Request {
+		values := req.URL.Query()
+		values.Set(key, value)
+		req.URL.RawQuery = values.Encode()
+		return req
+	}
+}
+
+// WithToken authenticates the request with the API token token
+// instead of the credentials of the service's Transport, for example
+// to make a single call as an account owner.  The token is not sent
+// if the request is redirected to another host.
+func WithToken(token string) RequestOption {
+	RegisterSecret(token)
+	return WithHeader("X-LighthouseToken", token)
+}
+
+// WithMigrationToken sends token as the 'migration_token' URL
+// parameter, which Lighthouse requires of account owners when
+// BulkEdit moves tickets between projects.
+func WithMigrationToken(token string) RequestOption {
+	RegisterSecret(token)
+	return WithQueryParam("migration_token", token)
+}
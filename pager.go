@@ -0,0 +1,88 @@
+package lighthouse
+
+// PageFunc fetches page number page, starting at 1, and returns the
+// number of items on it.  An empty page marks the end of the list.
+type PageFunc func(page int) (n int, err error)
+
+// Pager steps through the pages of a paginated list one request at a
+// time.  Services return a *Pager whose PageFunc passes each page to
+// a caller-supplied callback, which allows large lists to be
+// processed as they are fetched.  Typical use is:
+//
+//	p := ticketsService.Pages(opts, func(ts tickets.Tickets) {
+//		// handle page
+//	})
+//	for p.Next() {
+//		if done {
+//			break
+//		}
+//	}
+//	if err := p.Err(); err != nil {
+//		// handle error
+//	}
+type Pager struct {
+	fetch PageFunc
+
+	// Progress, if non-nil, is called after each non-empty page
+	// is fetched with the page number and the total number of
+	// items fetched so far.
+	Progress func(page, items int)
+
+	page  int
+	items int
+	done  bool
+	err   error
+}
+
+// NewPager returns a *Pager which fetches pages using fetch.
+func NewPager(fetch PageFunc) *Pager {
+	return &Pager{
+		fetch: fetch,
+	}
+}
+
+// Next fetches the next page.  It returns false once an empty page
+// is fetched or an error occurs, after which Err should be checked.
+func (p *Pager) Next() bool {
+	if p.done {
+		return false
+	}
+	n, err := p.fetch(p.page + 1)
+	if err != nil {
+		p.done, p.err = true, err
+		return false
+	}
+	if n == 0 {
+		p.done = true
+		return false
+	}
+	p.page++
+	p.items += n
+	if p.Progress != nil {
+		p.Progress(p.page, p.items)
+	}
+	return true
+}
+
+// Page returns the number of the last page fetched, or 0 if no page
+// has been fetched.
+func (p *Pager) Page() int {
+	return p.page
+}
+
+// Items returns the total number of items fetched so far.
+func (p *Pager) Items() int {
+	return p.items
+}
+
+// Err returns the error, if any, that stopped Next.
+func (p *Pager) Err() error {
+	return p.err
+}
+
+// All calls Next until there are no pages left and returns Err.
+func (p *Pager) All() error {
+	for p.Next() {
+	}
+	return p.Err()
+}
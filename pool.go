@@ -0,0 +1,116 @@
+package lighthouse
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// DefaultPoolWorkers controls the default number of jobs a Pool
+// runs at once.
+const DefaultPoolWorkers = 4
+
+// Pool runs jobs concurrently using a bounded number of workers.
+// Requests made by jobs through a *Service whose client uses a
+// *Transport are rate limited by the transport, so a Pool never
+// exceeds the transport's rate limit regardless of Workers.
+type Pool struct {
+	// Workers controls the maximum number of jobs run at once.
+	// If Workers is not positive, DefaultPoolWorkers is used.
+	Workers int
+
+	// Limiter, if non-nil, is waited on before each job is
+	// started.  This is useful for jobs which do not make
+	// requests through a rate limited *Transport.
+	Limiter *rate.Limiter
+
+	// StopOnError controls whether Run stops starting new jobs
+	// once a job has returned an error.  Jobs already running
+	// are allowed to finish.
+	StopOnError bool
+
+	// Progress, if non-nil, is called after each job finishes
+	// with the number of jobs finished so far and the total
+	// number of jobs.  Calls to Progress are serialized.
+	Progress func(done, total int)
+}
+
+// NewPool returns a *Pool using workers workers.
+func NewPool(workers int) *Pool {
+	return &Pool{
+		Workers: workers,
+	}
+}
+
+// Run calls fn once for each index in [0, n), running up to
+// p.Workers calls at once, and waits for them to finish.  If any
+// calls return an error, Run returns a *MultiError whose items are
+// indexed by job.  If ctx is canceled, no new jobs are started and
+// ctx.Err() is returned once running jobs have finished.
+func (p *Pool) Run(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	workers := p.Workers
+	if workers <= 0 {
+		workers = DefaultPoolWorkers
+	}
+	if workers > n {
+		workers = n
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu   sync.Mutex
+		br   = &BatchResult{}
+		done int
+		wg   sync.WaitGroup
+	)
+
+	jobs := make(chan int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				err := fn(ctx, i)
+
+				mu.Lock()
+				br.Add(i, err)
+				if err != nil && p.StopOnError {
+					cancel()
+				}
+				done++
+				if p.Progress != nil {
+					p.Progress(done, n)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var ctxErr error
+dispatch:
+	for i := 0; i < n; i++ {
+		if p.Limiter != nil {
+			err := p.Limiter.Wait(ctx)
+			if err != nil {
+				ctxErr = ctx.Err()
+				break
+			}
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			ctxErr = ctx.Err()
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := br.Err(); err != nil {
+		return err
+	}
+	return ctxErr
+}
@@ -3,11 +3,8 @@
 package profiles
 
 import (
-	"encoding/json"
-	"io"
-	"net/http"
-
 	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/internal/crud"
 )
 
 type Service struct {
@@ -29,31 +26,6 @@ type User struct {
 	Website string `json:"website"`
 }
 
-type userResponse struct {
-	User *User `json:"user"`
-}
-
-func (ur *userResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(ur)
-}
-func (s *Service) Get() (*User, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+".json", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
-	}
-
-	uresp := &userResponse{}
-	err = uresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return uresp.User, nil
+func (s *Service) Get(reqOpts ...lighthouse.RequestOption) (*User, error) {
+	return crud.Get[User](s.s, s.basePath+".json", "user", reqOpts...)
 }
@@ -3,16 +3,14 @@
 package projects
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"strconv"
 	"strings"
-	"time"
+	"unicode"
 
 	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/internal/crud"
 )
 
 type Service struct {
@@ -70,57 +68,83 @@ type Membership struct {
 	UserID  int    `json:"user_id"`
 	User    *User  `json:"user"`
 	Account string `json:"account"`
+	Role    string `json:"role,omitempty"`
 }
 
-type Memberships []*Membership
+type MembershipCreate struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role,omitempty"`
+}
 
-type membershipResponse struct {
-	Membership *Membership `json:"membership"`
+type MembershipUpdate struct {
+	Role string `json:"role"`
 }
 
-type membershipsResponse struct {
-	Memberships []*membershipResponse `json:"memberships"`
+type Memberships []*Membership
+
+type Project struct {
+	Archived               bool             `json:"archived"`
+	ClosedStates           string           `json:"closed_states"`
+	CreatedAt              *lighthouse.Time `json:"created_at"`
+	DefaultAssignedUserID  int              `json:"default_assigned_user_id"`
+	DefaultMilestoneID     int              `json:"default_milestone_id"`
+	DefaultTicketText      string           `json:"default_ticket_text"`
+	Description            string           `json:"description"`
+	DescriptionHTML        string           `json:"description_html"`
+	EnablePoints           bool             `json:"enable_points"`
+	Hidden                 bool             `json:"hidden"`
+	ID                     int              `json:"id"`
+	License                string           `json:"license"`
+	Name                   string           `json:"name"`
+	OpenStates             string           `json:"open_states"`
+	OpenTicketsCount       int              `json:"open_tickets_count"`
+	OssReadonly            bool             `json:"oss_readonly"`
+	Permalink              string           `json:"permalink"`
+	PointsScale            string           `json:"points_scale"`
+	Public                 bool             `json:"public"`
+	SendChangesetsToEvents bool             `json:"send_changesets_to_events"`
+	TodosCompleted         Todos            `json:"todos_completed"`
+	UpdatedAt              *lighthouse.Time `json:"updated_at"`
+	OpenStatesList         StatesList       `json:"open_states_list"`
+	ClosedStatesList       StatesList       `json:"closed_states_list"`
+
+	// Unknown holds any fields returned by Lighthouse which
+	// aren't modeled above so they are preserved when the project
+	// is encoded again.
+	Unknown lighthouse.UnknownFields `json:"-"`
+}
+
+func (p *Project) UnmarshalJSON(data []byte) error {
+	type project Project
+	unknown, err := lighthouse.UnmarshalWithUnknown(data, (*project)(p))
+	if err != nil {
+		return err
+	}
+	p.Unknown = unknown
+	return nil
 }
 
-func (psr *membershipsResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(psr)
+func (p *Project) MarshalJSON() ([]byte, error) {
+	type project Project
+	return lighthouse.MarshalWithUnknown((*project)(p), p.Unknown)
 }
 
-func (psr *membershipsResponse) memberships() Memberships {
-	ps := make(Memberships, 0, len(psr.Memberships))
-	for _, p := range psr.Memberships {
-		ps = append(ps, p.Membership)
+// WebURL returns the canonical web URL of p in account.
+func (p *Project) WebURL(account string) string {
+	permalink := p.Permalink
+	if len(permalink) == 0 && len(p.Name) > 0 {
+		permalink = Permalink(p.Name)
 	}
-
-	return ps
+	return lighthouse.WebURL(account, "projects", lighthouse.Slug(p.ID, permalink))
 }
 
-type Project struct {
-	Archived               bool       `json:"archived"`
-	ClosedStates           string     `json:"closed_states"`
-	CreatedAt              *time.Time `json:"created_at"`
-	DefaultAssignedUserID  int        `json:"default_assigned_user_id"`
-	DefaultMilestoneID     int        `json:"default_milestone_id"`
-	DefaultTicketText      string     `json:"default_ticket_text"`
-	Description            string     `json:"description"`
-	DescriptionHTML        string     `json:"description_html"`
-	EnablePoints           bool       `json:"enable_points"`
-	Hidden                 bool       `json:"hidden"`
-	ID                     int        `json:"id"`
-	License                string     `json:"license"`
-	Name                   string     `json:"name"`
-	OpenStates             string     `json:"open_states"`
-	OpenTicketsCount       int        `json:"open_tickets_count"`
-	OssReadonly            bool       `json:"oss_readonly"`
-	Permalink              string     `json:"permalink"`
-	PointsScale            string     `json:"points_scale"`
-	Public                 bool       `json:"public"`
-	SendChangesetsToEvents bool       `json:"send_changesets_to_events"`
-	TodosCompleted         Todos      `json:"todos_completed"`
-	UpdatedAt              string     `json:"updated_at"`
-	OpenStatesList         StatesList `json:"open_states_list"`
-	ClosedStatesList       StatesList `json:"closed_states_list"`
+// IntegrationSettings returns the integration settings of p.
+// Modifying the returned settings does not modify p.
+func (p *Project) IntegrationSettings() *IntegrationSettings {
+	sendChangesetsToEvents := p.SendChangesetsToEvents
+	return &IntegrationSettings{
+		SendChangesetsToEvents: &sendChangesetsToEvents,
+	}
 }
 
 type Projects []*Project
@@ -132,82 +156,41 @@ type ProjectCreate struct {
 }
 
 type ProjectUpdate struct {
-	Archived bool   `json:"archived"`
-	Name     string `json:"name"`
-	Public   bool   `json:"public"`
-}
-
-type projectRequest struct {
-	Project interface{} `json:"project"`
-}
-
-func (pr *projectRequest) Encode(w io.Writer) error {
-	enc := json.NewEncoder(w)
-	return enc.Encode(pr)
-}
-
-type projectResponse struct {
-	Project *Project `json:"project"`
+	Archived               bool   `json:"archived"`
+	Name                   string `json:"name"`
+	Public                 bool   `json:"public"`
+	OpenStates             string `json:"open_states,omitempty"`
+	ClosedStates           string `json:"closed_states,omitempty"`
+	SendChangesetsToEvents *bool  `json:"send_changesets_to_events,omitempty"`
 }
 
-func (pr *projectResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(pr)
+// IntegrationSettings are the settings of a project controlling how
+// it integrates with source control and other services.  Only the
+// settings which are non-nil are sent by UpdateIntegrationSettings.
+type IntegrationSettings struct {
+	// SendChangesetsToEvents, if true, lists the project's
+	// changesets in its activity stream and events.
+	SendChangesetsToEvents *bool `json:"send_changesets_to_events,omitempty"`
 }
 
-type projectsResponse struct {
-	Projects []*projectResponse `json:"projects"`
+func (s *Service) List(reqOpts ...lighthouse.RequestOption) (Projects, error) {
+	return crud.List[Project](s.s, s.basePath+".json", "project", reqOpts...)
 }
 
-func (psr *projectsResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(psr)
-}
-
-func (psr *projectsResponse) projects() Projects {
-	ps := make(Projects, 0, len(psr.Projects))
-	for _, p := range psr.Projects {
-		ps = append(ps, p.Project)
-	}
-
-	return ps
-}
-
-func (s *Service) List() (Projects, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+".json", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
-	}
-
-	psresp := &projectsResponse{}
-	err = psresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return psresp.projects(), nil
-}
-
-func (s *Service) Get(idOrName string) (*Project, error) {
+func (s *Service) Get(idOrName string, reqOpts ...lighthouse.RequestOption) (*Project, error) {
 	id, err := lighthouse.ID(idOrName)
 	if err == nil {
-		return s.GetByID(id)
+		return s.GetByID(id, reqOpts...)
 	}
-	return s.GetByName(idOrName)
+	return s.GetByName(idOrName, reqOpts...)
 }
 
-func (s *Service) GetByID(id int) (*Project, error) {
-	return s.get(strconv.Itoa(id))
+func (s *Service) GetByID(id int, reqOpts ...lighthouse.RequestOption) (*Project, error) {
+	return s.get(strconv.Itoa(id), reqOpts...)
 }
 
-func (s *Service) GetByName(name string) (*Project, error) {
-	ps, err := s.List()
+func (s *Service) GetByName(name string, reqOpts ...lighthouse.RequestOption) (*Project, error) {
+	ps, err := s.List(reqOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -217,166 +200,171 @@ func (s *Service) GetByName(name string) (*Project, error) {
 			return p, nil
 		}
 	}
+	// also allow projects to be referred to by permalink,
+	// i.e., 'widgets-inc' for 'Widgets, Inc.'
+	for _, p := range ps {
+		if lower == p.Permalink {
+			return p, nil
+		}
+	}
 	return nil, fmt.Errorf("no such project %q", name)
 }
 
-func (s *Service) New() (*Project, error) {
-	return s.get("new")
-}
-
-func (s *Service) get(id string) (*Project, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+"/"+id+".json", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
+// Permalink returns the permalink Lighthouse generates for a
+// project named name: letters and digits are lowercased and each
+// run of other characters is replaced with a single '-'.  The
+// result is also a valid GitLab project path.
+func Permalink(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+// SanitizeName returns name with any characters not permitted in
+// GitLab project names removed.  GitLab project names may contain
+// only letters, digits, '_', '.', '-', '+' and spaces and must start
+// with a letter, digit or '_'.
+func SanitizeName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '_':
+		case r == '.', r == '-', r == '+', r == ' ':
+			if b.Len() == 0 {
+				continue
+			}
+		default:
+			continue
+		}
+		b.WriteRune(r)
 	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
 
-	presp := &projectResponse{}
-	err = presp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
+func (s *Service) New(reqOpts ...lighthouse.RequestOption) (*Project, error) {
+	return s.get("new", reqOpts...)
+}
 
-	return presp.Project, nil
+func (s *Service) get(id string, reqOpts ...lighthouse.RequestOption) (*Project, error) {
+	return crud.Get[Project](s.s, s.basePath+"/"+id+".json", "project", reqOpts...)
 }
 
 // Only the fields in ProjectCreate can be set.
-func (s *Service) Create(p *Project) (*Project, error) {
-	preq := &projectRequest{
-		Project: &ProjectCreate{
-			Archived: p.Archived,
-			Name:     p.Name,
-			Public:   p.Public,
-		},
-	}
-
-	buf := &bytes.Buffer{}
-	err := preq.Encode(buf)
-	if err != nil {
-		return nil, err
+func (s *Service) Create(p *Project, reqOpts ...lighthouse.RequestOption) (*Project, error) {
+	pc := &ProjectCreate{
+		Archived: p.Archived,
+		Name:     p.Name,
+		Public:   p.Public,
 	}
 
-	resp, err := s.s.RoundTrip("POST", s.basePath+".json", buf)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusCreated)
-	if err != nil {
-		return nil, err
-	}
-
-	presp := &projectResponse{
-		Project: p,
-	}
-	err = presp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return p, nil
+	return crud.Create(s.s, s.basePath+".json", "project", pc, p, reqOpts...)
 }
 
 // Only the fields in ProjectUpdate can be set.
-func (s *Service) Update(p *Project) error {
-	preq := &projectRequest{
-		Project: &ProjectUpdate{
-			Archived: p.Archived,
-			Name:     p.Name,
-			Public:   p.Public,
-		},
+// SendChangesetsToEvents is left unchanged, use
+// UpdateIntegrationSettings to change it.
+func (s *Service) Update(p *Project, reqOpts ...lighthouse.RequestOption) error {
+	pu := &ProjectUpdate{
+		Archived:     p.Archived,
+		Name:         p.Name,
+		Public:       p.Public,
+		OpenStates:   p.OpenStates,
+		ClosedStates: p.ClosedStates,
 	}
 
-	buf := &bytes.Buffer{}
-	err := preq.Encode(buf)
-	if err != nil {
-		return err
-	}
+	return crud.Update(s.s, s.basePath+"/"+strconv.Itoa(p.ID)+".json", "project", pu, reqOpts...)
+}
 
-	resp, err := s.s.RoundTrip("PUT", s.basePath+"/"+strconv.Itoa(p.ID)+".json", buf)
+// IntegrationSettings returns the integration settings of project
+// idOrName.
+func (s *Service) IntegrationSettings(idOrName string, reqOpts ...lighthouse.RequestOption) (*IntegrationSettings, error) {
+	p, err := s.Get(idOrName, reqOpts...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return err
-	}
+	return p.IntegrationSettings(), nil
+}
 
-	return nil
+// UpdateIntegrationSettings changes the integration settings of
+// project id to is, leaving its other settings unchanged.
+func (s *Service) UpdateIntegrationSettings(id int, is *IntegrationSettings, reqOpts ...lighthouse.RequestOption) error {
+	return crud.Update(s.s, s.basePath+"/"+strconv.Itoa(id)+".json", "project", is, reqOpts...)
 }
 
-func (s *Service) Delete(idOrName string) error {
+func (s *Service) Delete(idOrName string, reqOpts ...lighthouse.RequestOption) error {
 	id, err := lighthouse.ID(idOrName)
 	if err == nil {
-		return s.DeleteByID(id)
+		return s.DeleteByID(id, reqOpts...)
 	}
-	return s.DeleteByName(idOrName)
+	return s.DeleteByName(idOrName, reqOpts...)
 }
 
-func (s *Service) DeleteByID(id int) error {
-	resp, err := s.s.RoundTrip("DELETE", s.basePath+"/"+strconv.Itoa(id)+".json", nil)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return err
-	}
-
-	return nil
+func (s *Service) DeleteByID(id int, reqOpts ...lighthouse.RequestOption) error {
+	return crud.Delete(s.s, s.basePath+"/"+strconv.Itoa(id)+".json", reqOpts...)
 }
 
-func (s *Service) DeleteByName(name string) error {
-	p, err := s.GetByName(name)
+func (s *Service) DeleteByName(name string, reqOpts ...lighthouse.RequestOption) error {
+	p, err := s.GetByName(name, reqOpts...)
 	if err != nil {
 		return err
 	}
-	return s.DeleteByID(p.ID)
+	return s.DeleteByID(p.ID, reqOpts...)
 }
 
-func (s *Service) Memberships(idOrName string) (Memberships, error) {
+func (s *Service) Memberships(idOrName string, reqOpts ...lighthouse.RequestOption) (Memberships, error) {
 	id, err := lighthouse.ID(idOrName)
 	if err == nil {
-		return s.MembershipsByID(id)
+		return s.MembershipsByID(id, reqOpts...)
 	}
-	return s.MembershipsByName(idOrName)
+	return s.MembershipsByName(idOrName, reqOpts...)
 }
 
-func (s *Service) MembershipsByName(name string) (Memberships, error) {
-	p, err := s.GetByName(name)
+func (s *Service) MembershipsByName(name string, reqOpts ...lighthouse.RequestOption) (Memberships, error) {
+	p, err := s.GetByName(name, reqOpts...)
 	if err != nil {
 		return nil, err
 	}
-	return s.MembershipsByID(p.ID)
+	return s.MembershipsByID(p.ID, reqOpts...)
 }
 
-func (s *Service) MembershipsByID(id int) (Memberships, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+"/"+strconv.Itoa(id)+"/memberships.json", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+func (s *Service) MembershipsByID(id int, reqOpts ...lighthouse.RequestOption) (Memberships, error) {
+	return crud.List[Membership](s.s, s.basePath+"/"+strconv.Itoa(id)+"/memberships.json", "membership", reqOpts...)
+}
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
+// AddMembership adds the user m.UserID to project id with the role
+// m.Role.  Only the fields in MembershipCreate can be set.
+func (s *Service) AddMembership(id int, m *Membership, reqOpts ...lighthouse.RequestOption) (*Membership, error) {
+	mc := &MembershipCreate{
+		UserID: m.UserID,
+		Role:   m.Role,
 	}
 
-	psresp := &membershipsResponse{}
-	err = psresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
+	return crud.Create(s.s, s.basePath+"/"+strconv.Itoa(id)+"/memberships.json", "membership", mc, m, reqOpts...)
+}
+
+// UpdateMembership changes the role of membership m.ID in project
+// id.  Only the fields in MembershipUpdate can be set.
+func (s *Service) UpdateMembership(id int, m *Membership, reqOpts ...lighthouse.RequestOption) error {
+	mu := &MembershipUpdate{
+		Role: m.Role,
 	}
 
-	return psresp.memberships(), nil
+	return crud.Update(s.s, s.basePath+"/"+strconv.Itoa(id)+"/memberships/"+strconv.Itoa(m.ID)+".json", "membership", mu, reqOpts...)
+}
+
+// RemoveMembership removes membership membershipID from project id.
+func (s *Service) RemoveMembership(id, membershipID int, reqOpts ...lighthouse.RequestOption) error {
+	return crud.Delete(s.s, s.basePath+"/"+strconv.Itoa(id)+"/memberships/"+strconv.Itoa(membershipID)+".json", reqOpts...)
 }
@@ -0,0 +1,275 @@
+package lighthouse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// RecorderMode controls whether a Recorder records or replays
+// requests.
+type RecorderMode int
+
+const (
+	// RecorderReplay answers requests from the cassette without
+	// making any network requests.  Requests which weren't
+	// recorded fail.
+	RecorderReplay RecorderMode = iota
+	// RecorderRecord makes requests using Base and records them
+	// in the cassette, which is written by Save.
+	RecorderRecord
+)
+
+// Interaction is a request and its response recorded by a Recorder.
+// API tokens are redacted from the URL, response headers and bodies,
+// see Redact, and request headers are not recorded, so cassettes are
+// safe to commit.
+type Interaction struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	RequestBody string      `json:"request_body,omitempty"`
+	StatusCode  int         `json:"status_code"`
+	Header      http.Header `json:"header"`
+	Body        string      `json:"body"`
+	// Base64 reports whether Body is base64 encoded, which is
+	// the case for binary responses such as attachments.
+	Base64 bool `json:"base64,omitempty"`
+}
+
+type cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Recorder is an http.RoundTripper which records API interactions to
+// a cassette file and replays them later, so tests of code using the
+// service packages can run deterministically without network
+// access.
+//
+// Like DiskCache, Recorder is typically used as a *Transport's Base
+// so requests are authenticated before they are recorded.  When
+// replaying, requests are matched by method, URL with any API token
+// redacted, see RedactURL, and request body.  Each recorded
+// interaction is used once, in order, except that the last matching
+// interaction is reused once the others are used up.
+type Recorder struct {
+	// Path is the path of the cassette file.
+	Path string
+
+	// Mode controls whether requests are recorded or replayed.
+	Mode RecorderMode
+
+	// Base specifies the mechanism by which individual HTTP
+	// requests are made when recording.  If Base is nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewRecorder returns a *Recorder using the cassette at path.  In
+// RecorderReplay mode, the cassette is read immediately.
+func NewRecorder(path string, mode RecorderMode) (*Recorder, error) {
+	r := &Recorder{
+		Path: path,
+		Mode: mode,
+	}
+	if mode != RecorderReplay {
+		return r, nil
+	}
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &cassette{}
+	err = json.Unmarshal(buf, c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cassette %s: %v", path, err)
+	}
+	r.interactions = c.Interactions
+	r.used = make([]bool, len(c.Interactions))
+	return r, nil
+}
+
+func (r *Recorder) base() http.RoundTripper {
+	if r.Base != nil {
+		return r.Base
+	}
+	return http.DefaultTransport
+}
+
+// redactBody returns buf with any API tokens redacted.
+func redactBody(buf []byte) string {
+	return Redact(string(buf))
+}
+
+// registerCredentials registers the API token req is authenticated
+// with, see RegisterSecret, so that it is redacted from the cassette
+// wherever it appears, even if req was not authenticated by a
+// *Transport.
+func registerCredentials(req *http.Request) {
+	RegisterSecret(req.Header.Get("X-LighthouseToken"))
+	if user, password, ok := req.BasicAuth(); ok {
+		if password == "x" {
+			// TokenAsBasicAuth
+			RegisterSecret(user)
+		}
+		RegisterSecret(password)
+	}
+}
+
+// textBody reports whether a body with Content-Type header value
+// ctype is text which can be recorded as-is.
+func textBody(ctype string) bool {
+	mediaType, _, _ := mime.ParseMediaType(ctype)
+	return len(ctype) == 0 ||
+		strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") ||
+		mediaType == "application/x-www-form-urlencoded"
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	registerCredentials(req)
+	method, u, body := req.Method, RedactURL(req.URL), ""
+	if len(reqBody) > 0 && textBody(req.Header.Get("Content-Type")) {
+		body = redactBody(reqBody)
+	}
+
+	if r.Mode == RecorderReplay {
+		in, ok := r.match(method, u, body)
+		if !ok {
+			return nil, fmt.Errorf("no recorded interaction for %s %s", method, u)
+		}
+		data := []byte(in.Body)
+		if in.Base64 {
+			var err error
+			data, err = base64.StdEncoding.DecodeString(in.Body)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.StatusCode, http.StatusText(in.StatusCode)),
+			StatusCode:    in.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Header.Clone(),
+			Body:          ioutil.NopCloser(bytes.NewReader(data)),
+			ContentLength: int64(len(data)),
+			Request:       req,
+		}, nil
+	}
+
+	req2 := cloneRequest(req)
+	if reqBody != nil {
+		req2.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+	resp, err := r.base().RoundTrip(req2)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	in := &Interaction{
+		Method:      method,
+		URL:         u,
+		RequestBody: body,
+		StatusCode:  resp.StatusCode,
+		Header:      resp.Header.Clone(),
+	}
+	in.Header.Del("Set-Cookie")
+	for _, values := range in.Header {
+		for i, value := range values {
+			values[i] = Redact(value)
+		}
+	}
+	if textBody(resp.Header.Get("Content-Type")) {
+		in.Body = redactBody(data)
+	} else {
+		in.Body, in.Base64 = base64.StdEncoding.EncodeToString(data), true
+	}
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, in)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+// match returns the first unused interaction matching the request,
+// or the last matching interaction if all are used.
+func (r *Recorder) match(method, u, body string) (*Interaction, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	last := -1
+	for i, in := range r.interactions {
+		if in.Method != method || in.URL != u || in.RequestBody != body {
+			continue
+		}
+		if !r.used[i] {
+			r.used[i] = true
+			return in, true
+		}
+		last = i
+	}
+	if last < 0 {
+		return nil, false
+	}
+	return r.interactions[last], true
+}
+
+// Interactions returns the interactions recorded or loaded so far.
+func (r *Recorder) Interactions() []*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Interaction(nil), r.interactions...)
+}
+
+// Save writes the recorded interactions to the cassette file.  Save
+// does nothing in RecorderReplay mode.
+func (r *Recorder) Save() error {
+	if r.Mode == RecorderReplay {
+		return nil
+	}
+	r.mu.Lock()
+	buf, err := json.MarshalIndent(&cassette{Interactions: r.interactions}, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.Path, append(buf, '\n'), 0644)
+}
+
+// RecorderModeFromEnv returns RecorderRecord if the environment
+// variable name is set to a non-empty value, otherwise
+// RecorderReplay.  This allows tests to re-record their cassettes,
+// i.e., by running 'LH_RECORD=1 go test'.
+func RecorderModeFromEnv(name string) RecorderMode {
+	if len(os.Getenv(name)) > 0 {
+		return RecorderRecord
+	}
+	return RecorderReplay
+}
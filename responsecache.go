@@ -0,0 +1,273 @@
+package lighthouse
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is the amount of time a response is served from a
+// *ResponseCache if ResponseCache.TTL is zero.
+const DefaultCacheTTL = time.Minute
+
+// ResponseCache caches successful GET responses for a fixed amount
+// of time, see Service.Cache.  Unlike MemoryCache and DiskCache,
+// which revalidate every response with Lighthouse, a fresh response
+// is returned without making a request, so helpers such as
+// GetByName which list every resource on each call become cheap.
+//
+// A successful POST, PUT or DELETE made through the *Service
+// invalidates the cached responses for the written resource, its
+// sub-resources and the collection containing it, i.e., updating
+// /projects/1/tickets/42.json invalidates
+// /projects/1/tickets/42.json and /projects/1/tickets.json with any
+// query.  Writes made by other clients are not seen until the cached
+// responses expire.
+//
+// Responses are keyed by request URL and the API token sent with
+// the request, see WithToken, so responses are not shared between
+// requests made with different tokens.  The token a *Transport adds
+// is not part of the key, so services authenticating as different
+// users should not share a *ResponseCache.  ResponseCache is safe for
+// concurrent use.
+type ResponseCache struct {
+	// TTL is the amount of time a response is served from the
+	// cache.  If TTL is zero, DefaultCacheTTL is used.
+	TTL time.Duration
+
+	// Dir, if set, is a directory responses are also written to,
+	// so they survive restarts until they expire.  It is created
+	// if necessary and read in full the first time the cache is
+	// used.
+	Dir string
+
+	mu      sync.Mutex
+	loaded  bool
+	entries map[string]*responseCacheEntry
+}
+
+// responseCacheEntry is a cached response, which is also the format
+// of the files written to ResponseCache.Dir.
+type responseCacheEntry struct {
+	// Key is the hashed key of the response, see cacheKey, and
+	// URL its request URL with any API token redacted.
+	Key        string      `json:"key"`
+	URL        string      `json:"url"`
+	Expires    time.Time   `json:"expires"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+func (rc *ResponseCache) ttl() time.Duration {
+	if rc.TTL > 0 {
+		return rc.TTL
+	}
+	return DefaultCacheTTL
+}
+
+// path returns the path of the file in Dir holding the response for
+// key.
+func (rc *ResponseCache) path(key string) string {
+	return filepath.Join(rc.Dir, key+".response")
+}
+
+// cacheKey returns the key of the response to req, which includes
+// the credentials set on req, i.e., by WithToken or
+// WithMigrationToken, so that responses are not shared between
+// requests made with different tokens.  The key is hashed so that it
+// can be written to Dir without exposing them.
+func cacheKey(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.URL.String() + "\n" +
+		req.Header.Get("X-LighthouseToken") + "\n" +
+		req.Header.Get("Authorization")))
+	return hex.EncodeToString(sum[:])
+}
+
+// load reads the unexpired responses in Dir, removing expired ones.
+// rc.mu must be held.
+func (rc *ResponseCache) load() {
+	if rc.loaded {
+		return
+	}
+	rc.loaded = true
+	if rc.entries == nil {
+		rc.entries = map[string]*responseCacheEntry{}
+	}
+	if len(rc.Dir) == 0 {
+		return
+	}
+	paths, err := filepath.Glob(filepath.Join(rc.Dir, "*.response"))
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, p := range paths {
+		buf, err := ioutil.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		entry := &responseCacheEntry{}
+		err = json.Unmarshal(buf, entry)
+		if err != nil || !now.Before(entry.Expires) || len(entry.Key) == 0 || rc.path(entry.Key) != p {
+			os.Remove(p)
+			continue
+		}
+		rc.entries[entry.Key] = entry
+	}
+}
+
+// get returns the cached response to req, or nil if there is no
+// fresh response.
+func (rc *ResponseCache) get(req *http.Request) *http.Response {
+	if !cacheable(req) {
+		return nil
+	}
+	key := cacheKey(req)
+
+	rc.mu.Lock()
+	rc.load()
+	entry, ok := rc.entries[key]
+	if ok && !time.Now().Before(entry.Expires) {
+		rc.remove(key)
+		ok = false
+	}
+	rc.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	return &http.Response{
+		Status:        http.StatusText(entry.StatusCode),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        entry.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req,
+	}
+}
+
+// update caches resp if it is a successful response to a GET
+// request.
+func (rc *ResponseCache) update(resp *http.Response) error {
+	req := resp.Request
+	if req == nil || req.Method != "GET" || resp.StatusCode != http.StatusOK || !cacheable(req) {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	entry := &responseCacheEntry{
+		Key:        cacheKey(req),
+		URL:        RedactURL(req.URL),
+		Expires:    time.Now().Add(rc.ttl()),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.load()
+	rc.entries[entry.Key] = entry
+	if len(rc.Dir) > 0 {
+		rc.write(entry)
+	}
+	return nil
+}
+
+// write writes entry to Dir, ignoring errors since the cache is only
+// an optimization.  rc.mu must be held.
+func (rc *ResponseCache) write(entry *responseCacheEntry) {
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	err = os.MkdirAll(rc.Dir, 0700)
+	if err != nil {
+		return
+	}
+	tmp, err := ioutil.TempFile(rc.Dir, "response")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(buf)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), rc.path(entry.Key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+// remove removes the response for key.  rc.mu must be held.
+func (rc *ResponseCache) remove(key string) {
+	delete(rc.entries, key)
+	if len(rc.Dir) > 0 {
+		os.Remove(rc.path(key))
+	}
+}
+
+// Invalidate removes the cached responses for the resource at u, its
+// sub-resources and the collection containing it.
+func (rc *ResponseCache) Invalidate(u *url.URL) {
+	resource, collection := resourcePaths(u.Path)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.load()
+	for key, entry := range rc.entries {
+		cu, err := url.Parse(entry.URL)
+		if err != nil || cu.Host != u.Host {
+			continue
+		}
+		p, _ := resourcePaths(cu.Path)
+		if p == resource || p == collection || strings.HasPrefix(p, resource+"/") {
+			rc.remove(key)
+		}
+	}
+}
+
+// Clear removes every cached response.
+func (rc *ResponseCache) Clear() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.load()
+	for key := range rc.entries {
+		rc.remove(key)
+	}
+}
+
+// resourcePaths returns p without its extension and the path of the
+// collection containing it, i.e., /projects/1/tickets/42.json is
+// resource /projects/1/tickets/42 in collection /projects/1/tickets.
+// A path which does not end in an ID, such as the path tickets are
+// created at, is its own collection.
+func resourcePaths(p string) (resource, collection string) {
+	resource = strings.TrimSuffix(p, path.Ext(p))
+	collection = resource
+	if base := path.Base(resource); len(base) > 0 && base[0] >= '0' && base[0] <= '9' {
+		collection = path.Dir(resource)
+	}
+	return resource, collection
+}
@@ -0,0 +1,33 @@
+package search_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/nwidger/lighthouse/search"
+	"github.com/nwidger/lighthouse/tickets"
+)
+
+func ExampleParse() {
+	// Tickets may come from an export or a previous call to
+	// tickets.Service.ListAll.
+	ts := tickets.Tickets{
+		{Number: 1, Title: "Crash on startup", State: "open", Tag: "bug", MilestoneTitle: "v1.2", AssignedUserName: "Jane Doe"},
+		{Number: 2, Title: "Add dark mode", State: "new", Tag: "feature", MilestoneTitle: "v1.2"},
+		{Number: 3, Title: "Crash on exit", State: "resolved", Closed: true, Tag: "bug", MilestoneTitle: "v1.1"},
+	}
+
+	// Parse a query using the same syntax as the Lighthouse web
+	// interface.
+	// http://help.lighthouseapp.com/kb/getting-started/how-do-i-search-for-tickets
+	q, err := search.Parse(`responsible:me milestone:v1.2 tagged:bug state:open sort:number`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	q.Me = "Jane Doe"
+
+	for _, t := range q.Filter(ts) {
+		fmt.Println(t.Number, t.Title)
+	}
+	// Output: 1 Crash on startup
+}
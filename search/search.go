@@ -0,0 +1,515 @@
+// Package search parses Lighthouse ticket search queries and
+// evaluates them against in-memory tickets, so exports and other
+// local ticket collections can be searched using the same queries
+// (and saved bins) as the Lighthouse web interface.  See
+// http://help.lighthouseapp.com/kb/getting-started/how-do-i-search-for-tickets.
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/tickets"
+)
+
+// Term is a single 'keyword:value' pair or, if Keyword is empty, a
+// bare word matched against the ticket's title, body and tags.
+type Term struct {
+	Keyword string
+	Value   string
+	Negate  bool
+}
+
+func (t *Term) String() string {
+	value := t.Value
+	if strings.ContainsAny(value, " \t\"") {
+		value = strconv.Quote(value)
+	}
+	if len(t.Keyword) == 0 {
+		return value
+	}
+	prefix := ""
+	if t.Negate {
+		prefix = "not-"
+	}
+	return prefix + t.Keyword + ":" + value
+}
+
+// Query is a parsed search query.  A ticket matches a query if it
+// matches every bare word and, for each keyword, at least one of
+// the values given for that keyword.
+type Query struct {
+	Terms []*Term
+
+	// Sort is the value of the 'sort' keyword, if any.
+	Sort string
+
+	// Me is the name of the current user, used to evaluate
+	// values of 'me'.
+	Me string
+
+	// Now is used to evaluate relative dates.  If zero, the
+	// current time is used.
+	Now time.Time
+}
+
+var keywordAliases = map[string]string{
+	"assigned": "responsible",
+	"reported": "reported_by",
+	"tag":      "tagged",
+	"tags":     "tagged",
+	"creator":  "reported_by",
+	"reporter": "reported_by",
+}
+
+// Keywords lists the keywords understood by Match.
+var Keywords = []string{
+	"created",
+	"milestone",
+	"number",
+	"reported_by",
+	"responsible",
+	"sort",
+	"state",
+	"tagged",
+	"updated",
+	"watched",
+}
+
+// Parse parses a search query.
+func Parse(q string) (*Query, error) {
+	words, err := split(q)
+	if err != nil {
+		return nil, err
+	}
+
+	query := &Query{}
+	for _, word := range words {
+		term := &Term{Value: word}
+		if idx := strings.Index(word, ":"); idx > 0 {
+			keyword := strings.ToLower(word[:idx])
+			if strings.HasPrefix(keyword, "not-") {
+				term.Negate = true
+				keyword = strings.TrimPrefix(keyword, "not-")
+			}
+			if alias, ok := keywordAliases[keyword]; ok {
+				keyword = alias
+			}
+			if !validKeyword(keyword) {
+				return nil, fmt.Errorf("unknown search keyword %q, expected one of %s", keyword, strings.Join(Keywords, ", "))
+			}
+			term.Keyword = keyword
+			term.Value = word[idx+1:]
+		}
+		if term.Keyword == "sort" {
+			query.Sort = strings.ToLower(term.Value)
+			continue
+		}
+		query.Terms = append(query.Terms, term)
+	}
+
+	return query, nil
+}
+
+func validKeyword(keyword string) bool {
+	for _, k := range Keywords {
+		if k == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// split splits q into words, see tickets.SplitKeywords.
+func split(q string) ([]string, error) {
+	words, err := tickets.SplitKeywords(q)
+	if err != nil {
+		return nil, fmt.Errorf("unterminated quote in query %q", q)
+	}
+	return words, nil
+}
+
+func (q *Query) String() string {
+	parts := make([]string, 0, len(q.Terms)+1)
+	for _, t := range q.Terms {
+		parts = append(parts, t.String())
+	}
+	if len(q.Sort) > 0 {
+		parts = append(parts, "sort:"+q.Sort)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (q *Query) now() time.Time {
+	if q.Now.IsZero() {
+		return time.Now()
+	}
+	return q.Now
+}
+
+// Match reports whether t matches q.
+func (q *Query) Match(t *tickets.Ticket) bool {
+	if t == nil {
+		return false
+	}
+
+	// values for the same keyword are OR'd together, different
+	// keywords are AND'd together
+	matched := map[string]bool{}
+	seen := map[string]bool{}
+
+	for _, term := range q.Terms {
+		if len(term.Keyword) == 0 {
+			if !matchText(t, term.Value) {
+				return false
+			}
+			continue
+		}
+		key := term.Keyword
+		if term.Negate {
+			key = "not-" + key
+			if q.matchTerm(t, term) {
+				return false
+			}
+			continue
+		}
+		seen[key] = true
+		if q.matchTerm(t, term) {
+			matched[key] = true
+		}
+	}
+
+	for key := range seen {
+		if !matched[key] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Filter returns the tickets in ts matching q, sorted according to
+// q.Sort.
+func (q *Query) Filter(ts tickets.Tickets) tickets.Tickets {
+	matches := tickets.Tickets{}
+	for _, t := range ts {
+		if q.Match(t) {
+			matches = append(matches, t)
+		}
+	}
+	q.SortTickets(matches)
+	return matches
+}
+
+// SortTickets sorts ts according to q.Sort.  As with Lighthouse,
+// tickets are sorted by last update by default.
+func (q *Query) SortTickets(ts tickets.Tickets) {
+	var less func(a, b *tickets.Ticket) bool
+	switch strings.TrimPrefix(q.Sort, "-") {
+	case "number":
+		less = func(a, b *tickets.Ticket) bool { return a.Number > b.Number }
+	case "created":
+		less = func(a, b *tickets.Ticket) bool { return after(a.CreatedAt, b.CreatedAt) }
+	case "priority", "importance":
+		less = func(a, b *tickets.Ticket) bool { return a.Priority < b.Priority }
+	case "milestone":
+		less = func(a, b *tickets.Ticket) bool { return a.MilestoneOrder < b.MilestoneOrder }
+	case "state":
+		less = func(a, b *tickets.Ticket) bool { return a.State < b.State }
+	case "title":
+		less = func(a, b *tickets.Ticket) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }
+	case "responsible", "assigned":
+		less = func(a, b *tickets.Ticket) bool {
+			return strings.ToLower(a.AssignedUserName) < strings.ToLower(b.AssignedUserName)
+		}
+	default:
+		less = func(a, b *tickets.Ticket) bool { return after(a.UpdatedAt, b.UpdatedAt) }
+	}
+	reverse := strings.HasPrefix(q.Sort, "-")
+	sort.SliceStable(ts, func(i, j int) bool {
+		if reverse {
+			return less(ts[j], ts[i])
+		}
+		return less(ts[i], ts[j])
+	})
+}
+
+func after(a, b *lighthouse.Time) bool {
+	switch {
+	case a == nil:
+		return false
+	case b == nil:
+		return true
+	}
+	return a.After(b.Time)
+}
+
+func matchText(t *tickets.Ticket, word string) bool {
+	word = strings.ToLower(word)
+	if word == "all" {
+		// matches every ticket, open or closed
+		return true
+	}
+	for _, s := range []string{t.Title, t.Body, t.LatestBody, t.OriginalBody, t.Tag} {
+		if strings.Contains(strings.ToLower(s), word) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *Query) matchTerm(t *tickets.Ticket, term *Term) bool {
+	value := strings.ToLower(term.Value)
+
+	switch term.Keyword {
+	case "state":
+		switch value {
+		case "open":
+			return !t.Closed
+		case "closed":
+			return t.Closed
+		}
+		return strings.EqualFold(t.State, value)
+	case "responsible":
+		return q.matchUser(t.AssignedUserID, t.AssignedUserName, value)
+	case "reported_by":
+		return q.matchUser(t.CreatorID, t.CreatorName, value)
+	case "watched":
+		if value != "me" || len(q.Me) == 0 {
+			return false
+		}
+		// watcher names aren't included in tickets, so we
+		// can only tell if the current user is watching a
+		// ticket they reported or are responsible for
+		return q.matchUser(t.AssignedUserID, t.AssignedUserName, value) ||
+			q.matchUser(t.CreatorID, t.CreatorName, value)
+	case "milestone":
+		if value == "none" {
+			return t.MilestoneID == 0
+		}
+		if id, err := strconv.Atoi(value); err == nil && id == t.MilestoneID {
+			return true
+		}
+		return strings.EqualFold(t.MilestoneTitle, value)
+	case "tagged":
+		for _, tag := range ticketTags(t) {
+			if strings.EqualFold(tag, value) {
+				return true
+			}
+		}
+		return false
+	case "number":
+		return matchNumber(t.Number, value)
+	case "created":
+		return q.matchDate(t.CreatedAt, value)
+	case "updated":
+		return q.matchDate(t.UpdatedAt, value)
+	}
+
+	return false
+}
+
+func (q *Query) matchUser(id int, name, value string) bool {
+	switch value {
+	case "none":
+		return id == 0
+	case "me":
+		value = strings.ToLower(q.Me)
+		if len(value) == 0 {
+			return false
+		}
+	}
+	if n, err := strconv.Atoi(value); err == nil {
+		return n == id
+	}
+	name = strings.ToLower(name)
+	if name == value {
+		return true
+	}
+	// like users.Service.GetByName, allow matching on first name
+	if idx := strings.Index(name, " "); idx != -1 && name[:idx] == value {
+		return true
+	}
+	return false
+}
+
+// ticketTags returns t's tags, using the Tags list if present and
+// otherwise splitting the space-separated Tag string (quoted tags
+// may contain spaces).
+func ticketTags(t *tickets.Ticket) []string {
+	if len(t.Tags) > 0 {
+		tags := make([]string, 0, len(t.Tags))
+		for _, tr := range t.Tags {
+			if tr != nil && tr.Tag != nil {
+				tags = append(tags, tr.Tag.Name)
+			}
+		}
+		return tags
+	}
+	tags, err := split(t.Tag)
+	if err != nil {
+		return strings.Fields(t.Tag)
+	}
+	return tags
+}
+
+// matchNumber matches a ticket number against 'N', '>N', '<N' or
+// 'N-M'.
+func matchNumber(number int, value string) bool {
+	switch {
+	case strings.HasPrefix(value, ">"):
+		n, err := strconv.Atoi(value[1:])
+		return err == nil && number > n
+	case strings.HasPrefix(value, "<"):
+		n, err := strconv.Atoi(value[1:])
+		return err == nil && number < n
+	case strings.Contains(value, "-"):
+		parts := strings.SplitN(value, "-", 2)
+		lo, err1 := strconv.Atoi(parts[0])
+		hi, err2 := strconv.Atoi(parts[1])
+		return err1 == nil && err2 == nil && number >= lo && number <= hi
+	}
+	n, err := strconv.Atoi(value)
+	return err == nil && number == n
+}
+
+// matchDate matches t against 'today', 'yesterday', 'last week',
+// 'last month', 'YYYY-MM-DD', '>YYYY-MM-DD' or '<YYYY-MM-DD'.
+func (q *Query) matchDate(t *lighthouse.Time, value string) bool {
+	if t == nil {
+		return false
+	}
+
+	now := q.now()
+	day := func(tm time.Time) time.Time {
+		y, m, d := tm.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, tm.Location())
+	}
+	today := day(now)
+	tt := t.In(now.Location())
+
+	switch value {
+	case "today":
+		return !tt.Before(today)
+	case "yesterday":
+		return !tt.Before(today.AddDate(0, 0, -1)) && tt.Before(today)
+	case "last week", "this week":
+		return !tt.Before(today.AddDate(0, 0, -7))
+	case "last month", "this month":
+		return !tt.Before(today.AddDate(0, -1, 0))
+	}
+
+	op := ""
+	if strings.HasPrefix(value, ">") || strings.HasPrefix(value, "<") {
+		op, value = value[:1], value[1:]
+	}
+	d, err := time.ParseInLocation("2006-01-02", value, now.Location())
+	if err != nil {
+		return false
+	}
+
+	switch op {
+	case ">":
+		return !tt.Before(d.AddDate(0, 0, 1))
+	case "<":
+		return tt.Before(d)
+	}
+	return !tt.Before(d) && tt.Before(d.AddDate(0, 0, 1))
+}
+
+// Score returns the relevance of t to q's bare words, for ranking
+// tickets gathered from several searches.  Words found in the title
+// count more than words found in the tags, which count more than
+// words found in the body.  Score does not check whether t matches
+// q.
+func (q *Query) Score(t *tickets.Ticket) int {
+	if t == nil {
+		return 0
+	}
+	score := 0
+	for _, term := range q.Terms {
+		if len(term.Keyword) > 0 {
+			continue
+		}
+		word := strings.ToLower(term.Value)
+		if strings.Contains(strings.ToLower(t.Title), word) {
+			score += 3
+		}
+		for _, tag := range ticketTags(t) {
+			if strings.EqualFold(tag, word) {
+				score += 2
+				break
+			}
+		}
+		for _, s := range []string{t.Body, t.LatestBody, t.OriginalBody} {
+			if strings.Contains(strings.ToLower(s), word) {
+				score++
+				break
+			}
+		}
+	}
+	return score
+}
+
+// Result is a ticket found by a search spanning several projects.
+type Result struct {
+	*tickets.Ticket
+
+	ProjectName string `json:"project_name"`
+	Score       int    `json:"score"`
+
+	// Account is the name of the project's account when searching
+	// several accounts, otherwise it is empty.
+	Account string `json:"account,omitempty"`
+}
+
+// MarshalJSON encodes r as its ticket with the additional
+// project_name, score and, if set, account fields.
+func (r *Result) MarshalJSON() ([]byte, error) {
+	buf, err := json.Marshal(r.Ticket)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(buf, &fields)
+	if err != nil {
+		return nil, err
+	}
+	fields["project_name"], _ = json.Marshal(r.ProjectName)
+	fields["score"], _ = json.Marshal(r.Score)
+	if len(r.Account) > 0 {
+		fields["account"], _ = json.Marshal(r.Account)
+	}
+	return json.Marshal(fields)
+}
+
+type Results []*Result
+
+// Rank sorts rs according to q.Sort or, if q has no sort, by Score
+// with ties broken by last update.
+func (q *Query) Rank(rs Results) {
+	if len(q.Sort) > 0 {
+		ts := make(tickets.Tickets, 0, len(rs))
+		byTicket := make(map[*tickets.Ticket]*Result, len(rs))
+		for _, r := range rs {
+			ts = append(ts, r.Ticket)
+			byTicket[r.Ticket] = r
+		}
+		q.SortTickets(ts)
+		for i, t := range ts {
+			rs[i] = byTicket[t]
+		}
+		return
+	}
+	sort.SliceStable(rs, func(i, j int) bool {
+		if rs[i].Score != rs[j].Score {
+			return rs[i].Score > rs[j].Score
+		}
+		return after(rs[i].UpdatedAt, rs[j].UpdatedAt)
+	})
+}
@@ -0,0 +1,125 @@
+package lighthouse
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// flight is a GET request made by one caller of *Service.RoundTrip
+// on behalf of every concurrent caller making an identical request,
+// see Service.DisableSingleflight.
+type flight struct {
+	// done is closed once resp or err is set
+	done chan struct{}
+	// waiters is the number of other callers waiting for the
+	// response, guarded by Service.flightsMu
+	waiters int
+
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+// flightKey returns the key identifying requests identical to req,
+// which includes its headers so requests made with different
+// credentials, see WithToken, are not shared.
+func flightKey(req *http.Request) string {
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(req.URL.String())
+	for _, name := range names {
+		b.WriteString("\n" + name + ": " + strings.Join(req.Header[name], ", "))
+	}
+	return b.String()
+}
+
+// roundTripShared makes the GET request to path made by
+// *Service.RoundTrip, sharing a single request between concurrent
+// callers making identical requests.  Callers which arrive once the
+// response headers have been received make their own request.  If
+// no other caller is waiting, the response is returned as is,
+// otherwise its body is read into memory so each caller receives a
+// copy.
+func (s *Service) roundTripShared(path string, reqOpts ...RequestOption) (*http.Response, error) {
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range reqOpts {
+		req = opt(req)
+	}
+	key := flightKey(req)
+
+	s.flightsMu.Lock()
+	if f, ok := s.flights[key]; ok {
+		f.waiters++
+		s.flightsMu.Unlock()
+		return s.waitFlight(f, req.Context(), path, reqOpts...)
+	}
+	f := &flight{done: make(chan struct{})}
+	if s.flights == nil {
+		s.flights = map[string]*flight{}
+	}
+	s.flights[key] = f
+	s.flightsMu.Unlock()
+
+	resp, err := s.roundTrip("GET", path, nil, reqOpts...)
+
+	s.flightsMu.Lock()
+	delete(s.flights, key)
+	waiters := f.waiters
+	s.flightsMu.Unlock()
+
+	if waiters == 0 || err != nil {
+		f.err = err
+		close(f.done)
+		return resp, err
+	}
+
+	f.body, f.err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	f.resp = resp
+	close(f.done)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.response(resp.Request), nil
+}
+
+// waitFlight waits for f, started by another caller, and returns a
+// copy of its response.  If f failed because the other caller's
+// context was canceled, the request is made again, shared with the
+// other callers waiting for f.
+func (s *Service) waitFlight(f *flight, ctx context.Context, path string, reqOpts ...RequestOption) (*http.Response, error) {
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		if errors.Is(f.err, context.Canceled) || errors.Is(f.err, context.DeadlineExceeded) {
+			return s.roundTripShared(path, reqOpts...)
+		}
+		return nil, f.err
+	}
+	return f.response(f.resp.Request), nil
+}
+
+// response returns a copy of f's response to req with its own body.
+func (f *flight) response(req *http.Request) *http.Response {
+	resp := *f.resp
+	resp.Header = f.resp.Header.Clone()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(f.body))
+	resp.ContentLength = int64(len(f.body))
+	resp.Request = req
+	return &resp
+}
@@ -0,0 +1,116 @@
+// Package tags provides access to a project's ticket tags via the
+// Lighthouse API.  http://help.lighthouseapp.com/kb/api/tickets.
+package tags
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/internal/crud"
+	"github.com/nwidger/lighthouse/tickets"
+)
+
+type Service struct {
+	basePath  string
+	projectID int
+	s         *lighthouse.Service
+}
+
+func NewService(s *lighthouse.Service, projectID int) *Service {
+	return &Service{
+		basePath:  s.BasePath + "/projects/" + strconv.Itoa(projectID) + "/tags",
+		projectID: projectID,
+		s:         s,
+	}
+}
+
+type Tag struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type Tags []*Tag
+
+// List returns the tags used by the project's tickets.
+func (s *Service) List(reqOpts ...lighthouse.RequestOption) (Tags, error) {
+	return crud.List[Tag](s.s, s.basePath+".json", "tag", reqOpts...)
+}
+
+func (s *Service) Get(idOrName string, reqOpts ...lighthouse.RequestOption) (*Tag, error) {
+	id, err := lighthouse.ID(idOrName)
+	if err == nil {
+		return s.GetByID(id, reqOpts...)
+	}
+	return s.GetByName(idOrName, reqOpts...)
+}
+
+func (s *Service) GetByID(id int, reqOpts ...lighthouse.RequestOption) (*Tag, error) {
+	ts, err := s.List(reqOpts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range ts {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("no such tag %d", id)
+}
+
+func (s *Service) GetByName(name string, reqOpts ...lighthouse.RequestOption) (*Tag, error) {
+	ts, err := s.List(reqOpts...)
+	if err != nil {
+		return nil, err
+	}
+	lower := strings.ToLower(name)
+	for _, t := range ts {
+		if strings.ToLower(t.Name) == lower {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("no such tag %q", name)
+}
+
+// Rename replaces tag old with tag new on every ticket tagged old.
+// If new is already in use the two are merged, see Merge.
+func (s *Service) Rename(old, new string, preview bool, reqOpts ...lighthouse.RequestOption) ([]int, error) {
+	return s.Merge([]string{old}, new, preview, reqOpts...)
+}
+
+// Merge replaces each of tags from with tag into on every ticket
+// tagged with it, using tickets.Service.TagByQuery.  The numbers of
+// the affected tickets are returned.  If preview is true, the
+// affected tickets are returned but no changes are made.
+func (s *Service) Merge(from []string, into string, preview bool, reqOpts ...lighthouse.RequestOption) ([]int, error) {
+	into = strings.TrimSpace(into)
+	if len(into) == 0 {
+		return nil, fmt.Errorf("must supply tag to merge into")
+	}
+
+	t := tickets.NewService(s.s, s.projectID)
+	seen := map[int]bool{}
+	numbers := []int{}
+	for _, tag := range from {
+		tag = strings.TrimSpace(tag)
+		if len(tag) == 0 || strings.EqualFold(tag, into) {
+			continue
+		}
+		// TagCommand's 'tagged:' keyword doubles as a query
+		// matching tickets with the tag
+		query := tickets.TagCommand([]string{tag}, nil)
+		ns, err := t.TagByQuery(query, []string{into}, []string{tag}, preview, reqOpts...)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range ns {
+			if !seen[n] {
+				seen[n] = true
+				numbers = append(numbers, n)
+			}
+		}
+	}
+
+	return numbers, nil
+}
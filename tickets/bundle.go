@@ -0,0 +1,266 @@
+package tickets
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+)
+
+// ExportBundle writes ticket number, its versions and the contents of
+// its attachments to w as a gzipped tarball with the layout
+//
+//	NUMBER-PERMALINK/ticket.json
+//	NUMBER-PERMALINK/versions.json
+//	NUMBER-PERMALINK/attachments/FILENAME
+//
+// which can be shared with someone who doesn't have access to the
+// project.  Attachments which no longer exist are skipped.
+func (s *Service) ExportBundle(number int, w io.Writer, reqOpts ...lighthouse.RequestOption) error {
+	t, err := s.GetByNumber(number, reqOpts...)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	z := gzip.NewWriter(w)
+	tw := tar.NewWriter(z)
+
+	writeFile := func(name string, data []byte) error {
+		return writeBundleFile(tw, name, data, now)
+	}
+	writeJSON := func(name string, v interface{}) error {
+		data, err := lighthouse.MarshalCanonical(v, lighthouse.NullsExplicit)
+		if err != nil {
+			return err
+		}
+		return writeFile(name, data)
+	}
+
+	base := fmt.Sprintf("%d-%s", t.Number, t.Permalink)
+	err = writeJSON(path.Join(base, "ticket.json"), t)
+	if err != nil {
+		return err
+	}
+	versions := t.Versions
+	if versions == nil {
+		versions = TicketVersions{}
+	}
+	err = writeJSON(path.Join(base, "versions.json"), versions)
+	if err != nil {
+		return err
+	}
+
+	for _, ar := range t.Attachments {
+		a := ar.Attachment
+		if a == nil {
+			continue
+		}
+		rc, err := s.GetAttachment(a, reqOpts...)
+		if errors.Is(err, lighthouse.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("attachment %q: %v", a.Filename, err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("attachment %q: %v", a.Filename, err)
+		}
+		err = writeFile(path.Join(base, "attachments", path.Base(a.Filename)), data)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+func writeBundleFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0644,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// Bundle is a ticket bundle written by ExportBundle.
+type Bundle struct {
+	Ticket      *Ticket
+	Versions    TicketVersions
+	Attachments []*BundleAttachment
+}
+
+// BundleAttachment is an attachment included in a Bundle.
+type BundleAttachment struct {
+	Filename string
+	Data     []byte
+}
+
+// ReadBundle reads a ticket bundle written by ExportBundle from r.
+func ReadBundle(r io.Reader) (*Bundle, error) {
+	z, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	b := &Bundle{}
+	tr := tar.NewReader(z)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		parts := strings.Split(path.Clean(hdr.Name), "/")
+		switch {
+		case len(parts) == 2 && parts[1] == "ticket.json":
+			b.Ticket = &Ticket{}
+			err = json.Unmarshal(data, b.Ticket)
+		case len(parts) == 2 && parts[1] == "versions.json":
+			err = json.Unmarshal(data, &b.Versions)
+		case len(parts) == 3 && parts[1] == "attachments":
+			b.Attachments = append(b.Attachments, &BundleAttachment{
+				Filename: parts[2],
+				Data:     data,
+			})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", hdr.Name, err)
+		}
+	}
+	if b.Ticket == nil {
+		return nil, fmt.Errorf("not a ticket bundle, missing ticket.json")
+	}
+	if b.Versions == nil {
+		b.Versions = b.Ticket.Versions
+	}
+	return b, nil
+}
+
+// ImportOptions controls how ImportBundle recreates a ticket.
+type ImportOptions struct {
+	// Users maps the IDs of users in the bundle to the IDs of
+	// users in the destination account.  The ticket's assigned
+	// user and watchers are only kept if they are mapped.
+	Users map[int]int
+
+	// MilestoneID, if non-zero, is the milestone of the new
+	// ticket.
+	MilestoneID int
+
+	// NotifyAll controls whether project members are notified
+	// of the new ticket, see NotifyOptions.
+	NotifyAll *bool
+}
+
+// ImportBundle creates a new ticket from b.  The new ticket has the
+// bundled ticket's title, state and tags, and its body is the
+// bundled ticket's body followed by each comment from its versions,
+// since the original authors and times cannot be preserved.  The
+// bundle's attachments are then added to the new ticket.
+func (s *Service) ImportBundle(b *Bundle, opts *ImportOptions, reqOpts ...lighthouse.RequestOption) (*Ticket, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	bt := b.Ticket
+	t := &Ticket{
+		Title:          bt.Title,
+		Body:           bundleBody(b),
+		State:          bt.State,
+		Tag:            bt.Tag,
+		AssignedUserID: opts.Users[bt.AssignedUserID],
+		MilestoneID:    opts.MilestoneID,
+	}
+	notify := &NotifyOptions{
+		NotifyAll: opts.NotifyAll,
+	}
+	for _, id := range bt.WatchersIDs {
+		if mapped, ok := opts.Users[id]; ok {
+			notify.MultipleWatchers = append(notify.MultipleWatchers, mapped)
+		}
+	}
+
+	nt, err := s.CreateWithOptions(t, notify, reqOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(b.Attachments) == 0 {
+		return nt, nil
+	}
+	files := make([]AttachmentUpload, 0, len(b.Attachments))
+	for _, a := range b.Attachments {
+		files = append(files, AttachmentUpload{Filename: a.Filename, Reader: bytes.NewReader(a.Data)})
+	}
+	// AddAttachments sends the ticket's body as a comment, don't
+	// post the imported body again
+	at := *nt
+	at.Body = ""
+	err = s.AddAttachments(&at, files, reqOpts...)
+	if err != nil {
+		return nt, fmt.Errorf("created ticket %d but unable to add attachments: %v", nt.Number, err)
+	}
+	return nt, nil
+}
+
+// bundleBody returns the body of the ticket recreated from b.
+func bundleBody(b *Bundle) string {
+	t := b.Ticket
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "Imported from ticket #%d", t.Number)
+	if len(t.URL) > 0 {
+		fmt.Fprintf(sb, " (%s)", t.URL)
+	}
+	sb.WriteString("\n\n")
+	body := t.OriginalBody
+	if len(body) == 0 && len(b.Versions) > 0 {
+		body = b.Versions[0].Body
+	}
+	sb.WriteString(strings.TrimSpace(body))
+	for i, v := range b.Versions {
+		if i == 0 || v == nil || len(strings.TrimSpace(v.Body)) == 0 {
+			continue
+		}
+		sb.WriteString("\n\n---\n\n")
+		if len(v.UserName) > 0 {
+			fmt.Fprintf(sb, "%s", v.UserName)
+			if v.CreatedAt != nil {
+				fmt.Fprintf(sb, " on %s", v.CreatedAt.Format("2006-01-02 15:04"))
+			}
+			sb.WriteString(" wrote:\n\n")
+		}
+		sb.WriteString(strings.TrimSpace(v.Body))
+	}
+	return strings.TrimSpace(sb.String())
+}
@@ -0,0 +1,89 @@
+package tickets
+
+import "github.com/nwidger/lighthouse"
+
+// Attribute is a ticket attribute which a version may change.
+type Attribute string
+
+const (
+	AttributeTitle        Attribute = "title"
+	AttributeState        Attribute = "state"
+	AttributeAssignedUser Attribute = "assigned_user"
+	AttributeMilestone    Attribute = "milestone"
+	AttributeTag          Attribute = "tag"
+	// AttributeBody is the body of a version, i.e., the comment
+	// made with it, so consecutive versions usually differ in
+	// body whenever the later one has a comment.
+	AttributeBody Attribute = "body"
+)
+
+// Change is a change to a single ticket attribute.
+type Change struct {
+	Attribute Attribute `json:"attribute"`
+
+	// From and To are the old and new values of state, title, tag
+	// and body changes.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	// FromID and ToID are the old and new user or milestone IDs
+	// of assigned_user and milestone changes, 0 if none.
+	FromID int `json:"from_id,omitempty"`
+	ToID   int `json:"to_id,omitempty"`
+}
+
+// Diff returns the changes from version a to version b, in the order
+// title, state, assigned user, milestone, tag and body.
+func Diff(a, b *TicketVersion) []*Change {
+	changes := []*Change{}
+	if a.Title != b.Title {
+		changes = append(changes, &Change{Attribute: AttributeTitle, From: a.Title, To: b.Title})
+	}
+	if a.State != b.State {
+		changes = append(changes, &Change{Attribute: AttributeState, From: a.State, To: b.State})
+	}
+	if a.AssignedUserID != b.AssignedUserID {
+		changes = append(changes, &Change{Attribute: AttributeAssignedUser, FromID: a.AssignedUserID, ToID: b.AssignedUserID})
+	}
+	if a.MilestoneID != b.MilestoneID {
+		changes = append(changes, &Change{Attribute: AttributeMilestone, FromID: a.MilestoneID, ToID: b.MilestoneID})
+	}
+	if a.Tag != b.Tag {
+		changes = append(changes, &Change{Attribute: AttributeTag, From: a.Tag, To: b.Tag})
+	}
+	if a.Body != b.Body {
+		changes = append(changes, &Change{Attribute: AttributeBody, From: a.Body, To: b.Body})
+	}
+	return changes
+}
+
+// VersionChanges are the changes made by a ticket version.
+type VersionChanges struct {
+	Version   int              `json:"version"`
+	UserID    int              `json:"user_id"`
+	UserName  string           `json:"user_name"`
+	CreatedAt *lighthouse.Time `json:"created_at"`
+	Changes   []*Change        `json:"changes"`
+}
+
+// Changelog returns the changes made by each of vs, which must be in
+// order from oldest to newest as in Ticket.Versions.  Entry i of the
+// changelog is the diff from version i-1 to version i, so the first
+// entry, the version which opened the ticket, has no changes.
+func (vs TicketVersions) Changelog() []*VersionChanges {
+	changelog := make([]*VersionChanges, 0, len(vs))
+	for i, v := range vs {
+		vc := &VersionChanges{
+			Version:   v.Version,
+			UserID:    v.UserID,
+			UserName:  v.UserName,
+			CreatedAt: v.CreatedAt,
+			Changes:   []*Change{},
+		}
+		if i > 0 {
+			vc.Changes = Diff(vs[i-1], v)
+		}
+		changelog = append(changelog, vc)
+	}
+	return changelog
+}
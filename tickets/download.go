@@ -0,0 +1,152 @@
+package tickets
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/nwidger/lighthouse"
+)
+
+// SizeError is returned by DownloadAttachments when the number of
+// bytes downloaded for an attachment doesn't match the response's
+// Content-Length or the attachment's Size.
+type SizeError struct {
+	Attachment *Attachment
+	Got        int64
+	Expected   int64
+}
+
+func (se *SizeError) Error() string {
+	return fmt.Sprintf("%s: downloaded %d bytes, expected %d", se.Attachment.Filename, se.Got, se.Expected)
+}
+
+// DownloadOptions controls how DownloadAttachments downloads and
+// writes attachments.
+type DownloadOptions struct {
+	// Workers controls the maximum number of attachments
+	// downloaded at once.  If Workers is not positive,
+	// lighthouse.DefaultPoolWorkers is used.
+	Workers int
+
+	// Create, if non-nil, returns the writer the contents of
+	// attachment a are written to.  If the writer is also an
+	// io.Closer, it is closed once the attachment is written.
+	// Create may be called from several goroutines at once.
+	Create func(a *Attachment) (io.Writer, error)
+
+	// Dir is the directory attachments are written to if Create
+	// is nil, each to a file named ID-FILENAME so attachments
+	// with the same filename don't collide.  Files of failed
+	// downloads are removed.
+	Dir string
+
+	// Progress, if non-nil, is called after each attachment
+	// finishes, successfully or not, with the attachment, the
+	// number of attachments finished so far and the total number
+	// of attachments.  Calls to Progress are serialized.
+	Progress func(a *Attachment, done, total int)
+}
+
+// DownloadAttachments downloads the contents of as, i.e., the
+// attachments of a ticket or of every ticket in a project, using a
+// bounded pool of workers, and writes each to the writer returned by
+// opts.Create or to a file in opts.Dir.  The number of bytes
+// downloaded is checked against the response's Content-Length and
+// the attachment's Size.  If any attachments fail, the rest are
+// still downloaded and a *lighthouse.MultiError is returned whose
+// items are indexed by position in as.
+func (s *Service) DownloadAttachments(as Attachments, opts *DownloadOptions, reqOpts ...lighthouse.RequestOption) error {
+	realOpts := DownloadOptions{}
+	if opts != nil {
+		realOpts = *opts
+	}
+	create := realOpts.Create
+	if create == nil {
+		create = func(a *Attachment) (io.Writer, error) {
+			return os.Create(AttachmentPath(realOpts.Dir, a))
+		}
+	}
+
+	var (
+		mu     sync.Mutex
+		done   int
+		result = &lighthouse.BatchResult{}
+	)
+	lighthouse.NewPool(realOpts.Workers).Run(context.Background(), len(as), func(ctx context.Context, i int) error {
+		created, err := s.downloadAttachment(as[i], create, reqOpts...)
+		if err != nil && created && realOpts.Create == nil {
+			os.Remove(AttachmentPath(realOpts.Dir, as[i]))
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			result.Add(i, err)
+		}
+		done++
+		if realOpts.Progress != nil {
+			realOpts.Progress(as[i], done, len(as))
+		}
+		return err
+	})
+	return result.Err()
+}
+
+// AttachmentPath returns the path of the file in dir which
+// DownloadAttachments writes a to.
+func AttachmentPath(dir string, a *Attachment) string {
+	return filepath.Join(dir, strconv.Itoa(a.ID)+"-"+filepath.Base(a.Filename))
+}
+
+// downloadAttachment downloads a and writes it to the writer
+// returned by create, returning whether create was called.
+func (s *Service) downloadAttachment(a *Attachment, create func(a *Attachment) (io.Writer, error), reqOpts ...lighthouse.RequestOption) (bool, error) {
+	resp, err := s.getAttachment(a, reqOpts...)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	w, err := create(a)
+	if err != nil {
+		return false, err
+	}
+	n, err := io.Copy(w, resp.Body)
+	if c, ok := w.(io.Closer); ok {
+		cerr := c.Close()
+		if err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return true, err
+	}
+
+	switch {
+	case resp.ContentLength >= 0 && n != resp.ContentLength:
+		return true, &SizeError{Attachment: a, Got: n, Expected: resp.ContentLength}
+	case a.Size > 0 && n != int64(a.Size):
+		return true, &SizeError{Attachment: a, Got: n, Expected: int64(a.Size)}
+	}
+	return true, nil
+}
+
+func (s *Service) getAttachment(a *Attachment, reqOpts ...lighthouse.RequestOption) (*http.Response, error) {
+	resp, err := s.s.RoundTrip("GET", a.URL, nil, reqOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lighthouse.CheckResponse(resp, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,86 @@
+package tickets_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/lighthousetest"
+	"github.com/nwidger/lighthouse/projects"
+	"github.com/nwidger/lighthouse/tickets"
+)
+
+func ExampleService_CreateIdempotent() {
+	srv := lighthousetest.NewServer()
+	defer srv.Close()
+
+	p := srv.AddProject(&projects.Project{Name: "Widgets"})
+
+	// simulate a create which Lighthouse receives but whose
+	// response is lost, i.e., to a gateway timeout
+	s := srv.Service()
+	failed := false
+	s.Use(func(next http.RoundTripper) http.RoundTripper {
+		return lighthouse.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			if err != nil || req.Method != "POST" || failed {
+				return resp, err
+			}
+			failed = true
+			resp.Body.Close()
+			return &http.Response{
+				Status:     "504 Gateway Timeout",
+				StatusCode: http.StatusGatewayTimeout,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+				Request:    req,
+			}, nil
+		})
+	})
+
+	t := tickets.NewService(s, p.ID)
+	tkt, err := t.CreateIdempotent(&tickets.Ticket{
+		Title: "Crash on login",
+		State: "resolved",
+		Tag:   "bug",
+	}, &tickets.IdempotentOptions{
+		Key:  "import-42",
+		Wait: time.Millisecond,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(tkt.Number, tkt.Title, tkt.Tag)
+
+	ts, err := t.ListAll(&tickets.ListOptions{Query: "all"})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(len(ts), "ticket")
+	// Output:
+	// 1 Crash on login bug
+	// 1 ticket
+}
+
+func ExampleSplitKeywords() {
+	tag := strings.Join([]string{
+		tickets.QuoteKeyword("bug"),
+		tickets.QuoteKeyword("needs review"),
+		tickets.QuoteKeyword(`say "hi"`),
+	}, " ")
+	words, err := tickets.SplitKeywords(tag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, word := range words {
+		fmt.Println(word)
+	}
+	// Output:
+	// bug
+	// needs review
+	// say "hi"
+}
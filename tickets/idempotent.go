@@ -0,0 +1,201 @@
+package tickets
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+)
+
+const (
+	// DefaultIdempotentAttempts is the number of attempts made by
+	// CreateIdempotent if IdempotentOptions.Attempts is zero.
+	DefaultIdempotentAttempts = 3
+
+	// DefaultIdempotentWait is the time CreateIdempotent waits
+	// between attempts if IdempotentOptions.Wait is zero.
+	DefaultIdempotentWait = 2 * time.Second
+)
+
+// IdempotencyTagPrefix prefixes the tag CreateIdempotent uses to mark
+// the tickets it creates until their creation is confirmed.
+const IdempotencyTagPrefix = "idempotency-"
+
+// IdempotencyTag returns the tag marking a ticket created by
+// CreateIdempotent with key.
+func IdempotencyTag(key string) string {
+	return IdempotencyTagPrefix + key
+}
+
+type IdempotentOptions struct {
+	// Key identifies the ticket being created.  Callers which
+	// persist Key, i.e., alongside an import's progress, can call
+	// CreateIdempotent again with the same Key after a crash
+	// during CreateIdempotent without creating a duplicate.  Once
+	// CreateIdempotent returns the ticket no longer carries Key,
+	// so callers should then persist the ticket's number instead.
+	// If empty, a random key is generated.
+	Key string
+
+	// Attempts is the maximum number of attempts to create the
+	// ticket.  Defaults to DefaultIdempotentAttempts.
+	Attempts int
+
+	// Wait is the time to wait between attempts.  Defaults to
+	// DefaultIdempotentWait.
+	Wait time.Duration
+
+	// Notify controls notifications and watchers as in
+	// CreateWithOptions.
+	Notify *NotifyOptions
+}
+
+// CreateIdempotent is like CreateWithOptions but can be retried
+// safely.  The ticket is tagged with IdempotencyTag(opts.Key) and,
+// before each attempt after a failed one, every ticket, open or
+// closed, is searched for the tag in case the failed attempt created
+// the ticket after all, i.e., if the request timed out after
+// Lighthouse received it.  If the ticket is found it is returned
+// instead of creating another.  Attempts are only retried after
+// network errors and 5xx responses, not after the request's context
+// is done or the circuit breaker opens.  Once the ticket is created
+// or found the tag is removed again without notifying anyone, so it
+// doesn't linger in the project's tags.  If that fails, the ticket
+// is returned along with the error.
+//
+// Lighthouse indexes new tickets for searching promptly but not
+// instantly, so opts.Wait should be at least a couple of seconds.
+func (s *Service) CreateIdempotent(t *Ticket, opts *IdempotentOptions, reqOpts ...lighthouse.RequestOption) (*Ticket, error) {
+	if opts == nil {
+		opts = &IdempotentOptions{}
+	}
+	key, attempts, wait := opts.Key, opts.Attempts, opts.Wait
+	if attempts <= 0 {
+		attempts = DefaultIdempotentAttempts
+	}
+	if wait <= 0 {
+		wait = DefaultIdempotentWait
+	}
+	// a caller supplied key may have been used by an earlier
+	// run, a generated one can't have been
+	check := len(key) > 0
+	if !check {
+		buf := make([]byte, 16)
+		_, err := rand.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		key = hex.EncodeToString(buf)
+	}
+	marker := IdempotencyTag(key)
+
+	tc := newTicketCreate(t, opts.Notify)
+	tc.Tag = strings.TrimSpace(tc.Tag + " " + marker)
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(wait)
+		}
+		if check {
+			existing, ferr := s.findIdempotent(marker, reqOpts...)
+			if ferr != nil {
+				return nil, ferr
+			}
+			if existing != nil {
+				return s.removeIdempotencyTag(existing, marker, reqOpts...)
+			}
+		}
+		var created *Ticket
+		created, err = s.create(tc, t, reqOpts...)
+		if err == nil {
+			return s.removeIdempotencyTag(created, marker, reqOpts...)
+		}
+		if !retryableCreate(err) {
+			return nil, err
+		}
+		check = true
+	}
+
+	// the last attempt may also have created the ticket
+	time.Sleep(wait)
+	existing, ferr := s.findIdempotent(marker, reqOpts...)
+	if ferr == nil && existing != nil {
+		return s.removeIdempotencyTag(existing, marker, reqOpts...)
+	}
+	return nil, err
+}
+
+// findIdempotent returns the ticket tagged marker, or nil if there is
+// none.
+func (s *Service) findIdempotent(marker string, reqOpts ...lighthouse.RequestOption) (*Ticket, error) {
+	// 'all' so the ticket is found even if it was created in a
+	// closed state, i.e., by an import
+	ts, err := s.List(&ListOptions{
+		Query: "all " + TagCommand([]string{marker}, nil),
+		Limit: 1,
+	}, reqOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(ts) == 0 {
+		return nil, nil
+	}
+	return ts[0], nil
+}
+
+// removeIdempotencyTag removes the tag marker from ticket t once its
+// creation is confirmed, returning t with its tags updated.
+func (s *Service) removeIdempotencyTag(t *Ticket, marker string, reqOpts ...lighthouse.RequestOption) (*Ticket, error) {
+	words, err := SplitKeywords(t.Tag)
+	if err != nil {
+		words = strings.Fields(t.Tag)
+	}
+	tags := []string{}
+	for _, tag := range words {
+		if !strings.EqualFold(tag, marker) {
+			tags = append(tags, QuoteKeyword(tag))
+		}
+	}
+	tag, notify := strings.Join(tags, " "), false
+	err = s.UpdatePartial(t.Number, &TicketUpdate{
+		Tag:       &tag,
+		NotifyAll: &notify,
+	}, reqOpts...)
+	if err != nil {
+		return t, fmt.Errorf("created ticket %d but unable to remove tag %s: %v", t.Number, marker, err)
+	}
+	t.Tag = tag
+	trs := make([]*TagResponse, 0, len(t.Tags))
+	for _, tr := range t.Tags {
+		if tr == nil || tr.Tag == nil || !strings.EqualFold(tr.Tag.Name, marker) {
+			trs = append(trs, tr)
+		}
+	}
+	t.Tags = trs
+	return t, nil
+}
+
+// retryableCreate reports whether a failed create may be retried.
+// Waiting won't help if the request budget is spent, the circuit
+// breaker is open or the request's context is done.
+func retryableCreate(err error) bool {
+	switch {
+	case errors.Is(err, lighthouse.ErrMaxRequestsExceeded),
+		errors.Is(err, lighthouse.ErrCircuitOpen),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return false
+	}
+	var er *lighthouse.ErrorResponse
+	if errors.As(err, &er) {
+		return er.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package tickets
+
+import (
+	"sort"
+
+	"github.com/nwidger/lighthouse"
+)
+
+// NumberPlan describes how the tickets of an import which should keep
+// their original numbers fit into a project, see PlanNumbers.
+type NumberPlan struct {
+	// Collisions lists the wanted numbers already used by tickets
+	// in the project, sorted.
+	Collisions []int
+
+	// Max is the highest ticket number in the project, zero if it
+	// has no tickets.
+	Max int
+
+	// Offset is the smallest offset which, added to every wanted
+	// number, avoids every existing ticket.  It is zero if there
+	// are no Collisions.
+	Offset int
+
+	// Mapping maps each wanted number to a free number.  Numbers
+	// which don't collide map to themselves, colliding numbers
+	// map to numbers after both Max and the highest wanted
+	// number, in order.
+	Mapping map[int]int
+}
+
+// PlanNumbers detects which of numbers, the ticket numbers an import
+// wants to use, are already used in the project before importing
+// anything, and proposes an offset or mapping avoiding them.  Every
+// ticket in the project, open or closed, is listed, since the order
+// of search results can't be relied upon to stop early.
+func (s *Service) PlanNumbers(numbers []int, reqOpts ...lighthouse.RequestOption) (*NumberPlan, error) {
+	plan := &NumberPlan{
+		Mapping: map[int]int{},
+	}
+	if len(numbers) == 0 {
+		return plan, nil
+	}
+
+	wanted := map[int]bool{}
+	max := numbers[0]
+	for _, n := range numbers {
+		wanted[n] = true
+		if n > max {
+			max = n
+		}
+	}
+
+	existing := map[int]bool{}
+	opts := &ListOptions{
+		Query: "all sort:number",
+		Limit: MaxLimit,
+	}
+	for page := 1; ; page++ {
+		opts.Page = page
+		ts, err := s.List(opts, reqOpts...)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range ts {
+			if t.Number > plan.Max {
+				plan.Max = t.Number
+			}
+			if existing[t.Number] {
+				continue
+			}
+			existing[t.Number] = true
+			if wanted[t.Number] {
+				plan.Collisions = append(plan.Collisions, t.Number)
+			}
+		}
+		if len(ts) < opts.Limit {
+			break
+		}
+	}
+	sort.Ints(plan.Collisions)
+
+	if len(plan.Collisions) > 0 {
+		// an offset of plan.Max always works since every wanted
+		// number is positive
+	offsets:
+		for plan.Offset = 1; plan.Offset < plan.Max; plan.Offset++ {
+			for n := range wanted {
+				if existing[n+plan.Offset] {
+					continue offsets
+				}
+			}
+			break
+		}
+	}
+
+	next := plan.Max
+	if max > next {
+		next = max
+	}
+	sorted := make([]int, 0, len(wanted))
+	for n := range wanted {
+		sorted = append(sorted, n)
+	}
+	sort.Ints(sorted)
+	for _, n := range sorted {
+		if !existing[n] {
+			plan.Mapping[n] = n
+			continue
+		}
+		next++
+		plan.Mapping[n] = next
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,107 @@
+package tickets
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/bins"
+	"github.com/nwidger/lighthouse/profiles"
+	"github.com/nwidger/lighthouse/projects"
+)
+
+// Preset is a named ticket search query taken from a ticket bin.
+type Preset struct {
+	Name      string `json:"name"`
+	Query     string `json:"query"`
+	ProjectID int    `json:"project_id"`
+	BinID     int    `json:"bin_id"`
+	Global    bool   `json:"global"`
+}
+
+// Presets is the set of ticket bins visible to a user across an
+// account's projects.  Presets can be cached locally as JSON so
+// queries can be looked up by bin name without listing every
+// project's bins.
+type Presets struct {
+	UserID    int       `json:"user_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Presets   []*Preset `json:"presets"`
+}
+
+// SyncPresets returns the ticket bins of every project in the
+// account which are visible to the current user, i.e., the user's
+// own bins and any shared or global bins.
+func SyncPresets(s *lighthouse.Service) (*Presets, error) {
+	u, err := profiles.NewService(s).Get()
+	if err != nil {
+		return nil, err
+	}
+	ps, err := projects.NewService(s).List()
+	if err != nil {
+		return nil, err
+	}
+
+	presets := &Presets{
+		UserID:    u.ID,
+		UpdatedAt: time.Now().UTC(),
+		Presets:   []*Preset{},
+	}
+	for _, p := range ps {
+		bs, err := bins.NewService(s, p.ID).List()
+		if err != nil {
+			return nil, fmt.Errorf("project %q: %v", p.Name, err)
+		}
+		for _, b := range bs {
+			if b.UserID != u.ID && !b.Shared && !b.Global {
+				continue
+			}
+			presets.Presets = append(presets.Presets, &Preset{
+				Name:      b.Name,
+				Query:     b.Query,
+				ProjectID: p.ID,
+				BinID:     b.ID,
+				Global:    b.Global,
+			})
+		}
+	}
+	return presets, nil
+}
+
+// Lookup returns the preset with the given name, compared
+// case-insensitively, for the project projectID.  Bins belonging to
+// projectID are preferred over global bins from other projects.
+func (ps *Presets) Lookup(name string, projectID int) (*Preset, bool) {
+	var global *Preset
+	for _, p := range ps.Presets {
+		if !strings.EqualFold(p.Name, name) {
+			continue
+		}
+		if p.ProjectID == projectID {
+			return p, true
+		}
+		if p.Global && global == nil {
+			global = p
+		}
+	}
+	return global, global != nil
+}
+
+// Names returns the names of the presets available to projectID.
+func (ps *Presets) Names(projectID int) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, p := range ps.Presets {
+		if p.ProjectID != projectID && !p.Global {
+			continue
+		}
+		key := strings.ToLower(p.Name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, p.Name)
+	}
+	return names
+}
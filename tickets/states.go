@@ -0,0 +1,123 @@
+package tickets
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/projects"
+)
+
+// State is a ticket state, i.e., 'new' or 'resolved'.  Each project
+// defines its own open and closed states, see States.
+type State string
+
+// States are the open and closed ticket states of a project, used to
+// validate and normalize states before creating or updating tickets.
+// Lighthouse does not reject unknown states, it creates them, so a
+// misspelled state silently becomes a new open state.
+type States struct {
+	Open   []State
+	Closed []State
+}
+
+// NewStates returns the states of project p.
+func NewStates(p *projects.Project) *States {
+	ss := &States{}
+	for _, state := range p.OpenStatesList {
+		ss.Open = append(ss.Open, State(state))
+	}
+	for _, state := range p.ClosedStatesList {
+		ss.Closed = append(ss.Closed, State(state))
+	}
+	return ss
+}
+
+// States fetches the states of the service's project.
+func (s *Service) States(reqOpts ...lighthouse.RequestOption) (*States, error) {
+	p, err := projects.NewService(s.s).GetByID(s.projectID, reqOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return NewStates(p), nil
+}
+
+// InvalidStateError is returned when a state is not one of a
+// project's states.
+type InvalidStateError struct {
+	State string
+	// Valid lists the states which would have been accepted.
+	Valid []State
+	// Closed is set if only closed states were accepted.
+	Closed bool
+}
+
+func (ise *InvalidStateError) Error() string {
+	valid := make([]string, 0, len(ise.Valid))
+	for _, state := range ise.Valid {
+		valid = append(valid, string(state))
+	}
+	what := "state"
+	if ise.Closed {
+		what = "closed state"
+	}
+	return fmt.Sprintf("invalid %s %q, must be one of: %s", what, ise.State, strings.Join(valid, ", "))
+}
+
+// Normalize returns the project's spelling of state, which is
+// matched case-insensitively and ignoring surrounding whitespace
+// against both open and closed states.  If state is not one of the
+// project's states, an *InvalidStateError is returned.
+func (ss *States) Normalize(state string) (State, error) {
+	all := append(append([]State{}, ss.Open...), ss.Closed...)
+	if match, ok := findState(all, state); ok {
+		return match, nil
+	}
+	return "", &InvalidStateError{State: state, Valid: all}
+}
+
+// NormalizeClosed is like Normalize but only accepts closed states.
+func (ss *States) NormalizeClosed(state string) (State, error) {
+	if match, ok := findState(ss.Closed, state); ok {
+		return match, nil
+	}
+	return "", &InvalidStateError{State: state, Valid: ss.Closed, Closed: true}
+}
+
+// IsOpen reports whether state is one of the project's open states.
+func (ss *States) IsOpen(state string) bool {
+	_, ok := findState(ss.Open, state)
+	return ok
+}
+
+// IsClosed reports whether state is one of the project's closed
+// states.
+func (ss *States) IsClosed(state string) bool {
+	_, ok := findState(ss.Closed, state)
+	return ok
+}
+
+// Validate normalizes the state of t in place.  An empty state is
+// left alone, Lighthouse uses the project's default state for new
+// tickets and leaves the state of updated tickets unchanged.
+func (ss *States) Validate(t *Ticket) error {
+	if len(t.State) == 0 {
+		return nil
+	}
+	state, err := ss.Normalize(t.State)
+	if err != nil {
+		return err
+	}
+	t.State = string(state)
+	return nil
+}
+
+func findState(states []State, state string) (State, bool) {
+	state = strings.TrimSpace(state)
+	for _, s := range states {
+		if strings.EqualFold(string(s), state) {
+			return s, true
+		}
+	}
+	return "", false
+}
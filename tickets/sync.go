@@ -0,0 +1,162 @@
+package tickets
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nwidger/lighthouse"
+)
+
+// syncAttempts is the number of times ListUpdatedSince lists tickets
+// when tickets are updated while they are being listed.
+const syncAttempts = 3
+
+// Cursor records how far an incremental sync has progressed, see
+// ListUpdatedSince.  Cursors are meant to be persisted as JSON
+// between runs.  The zero Cursor lists every ticket.
+type Cursor struct {
+	// UpdatedAt is the update time of the most recently updated
+	// ticket returned so far.
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Numbers are the numbers of the returned tickets whose
+	// update time is UpdatedAt.  Lighthouse only records update
+	// times to the second, so other tickets may later be found
+	// with the same update time.  Those are returned by the next
+	// sync while these are skipped.
+	Numbers []int `json:"numbers,omitempty"`
+}
+
+func (c *Cursor) seen(t *Ticket) bool {
+	if t.UpdatedAt == nil || !t.UpdatedAt.Equal(c.UpdatedAt) {
+		return false
+	}
+	for _, number := range c.Numbers {
+		if number == t.Number {
+			return true
+		}
+	}
+	return false
+}
+
+// ListUpdatedSince returns the tickets matching query (which may be
+// empty) updated since cursor, which may be nil, sorted from least
+// to most recently updated, along with a cursor to pass to the next
+// call.  Lighthouse only lists open tickets unless a query filters
+// on state, so if query contains neither "all" nor a state: term,
+// "all" is added to it so that closed tickets are synced as well.
+//
+// ListUpdatedSince is safe for incremental sync.  Tickets updated in
+// the same second as the cursor are returned unless the cursor
+// records them as already returned.  Tickets are listed most
+// recently updated first, so a ticket updated while the list is
+// being paged through moves to the first page and can cause others
+// to be skipped.  ListUpdatedSince detects this by checking the most
+// recently updated ticket once it has finished and lists the tickets
+// again, up to three times.  If tickets are still changing, the
+// tickets found are returned with the original cursor, so the next
+// call lists them again rather than risk missing any.
+func (s *Service) ListUpdatedSince(query string, cursor *Cursor, reqOpts ...lighthouse.RequestOption) (Tickets, *Cursor, error) {
+	if cursor == nil {
+		cursor = &Cursor{}
+	}
+	if !hasStateTerm(query) {
+		query = "all " + query
+	}
+	query = strings.TrimSpace(query + " sort:updated")
+
+	found := map[int]*Ticket{}
+	stable := false
+	for attempt := 0; attempt < syncAttempts && !stable; attempt++ {
+		var newest *Ticket
+		done := false
+		p := s.Pages(&ListOptions{
+			Query: query,
+			Limit: MaxLimit,
+		}, func(ts Tickets) {
+			if newest == nil {
+				newest = ts[0]
+			}
+			for _, t := range ts {
+				if t.UpdatedAt != nil && t.UpdatedAt.Before(cursor.UpdatedAt) {
+					done = true
+					return
+				}
+				if cursor.seen(t) {
+					continue
+				}
+				if prev, ok := found[t.Number]; ok && !updatedAfter(t, prev) {
+					continue
+				}
+				found[t.Number] = t
+			}
+		}, reqOpts...)
+		for !done && p.Next() {
+		}
+		if err := p.Err(); err != nil {
+			return nil, cursor, err
+		}
+
+		// the most recently updated ticket is unchanged unless
+		// a ticket was updated while listing
+		check, err := s.List(&ListOptions{Query: query, Limit: 1}, reqOpts...)
+		if err != nil {
+			return nil, cursor, err
+		}
+		stable = len(check) == 0 ||
+			(newest != nil && check[0].Number == newest.Number && !updatedAfter(check[0], newest))
+	}
+
+	ts := make(Tickets, 0, len(found))
+	for _, t := range found {
+		ts = append(ts, t)
+	}
+	sort.SliceStable(ts, func(i, j int) bool {
+		if updatedAfter(ts[j], ts[i]) {
+			return true
+		}
+		if updatedAfter(ts[i], ts[j]) {
+			return false
+		}
+		return ts[i].Number < ts[j].Number
+	})
+
+	if !stable || len(ts) == 0 {
+		return ts, cursor, nil
+	}
+
+	next := &Cursor{}
+	last := ts[len(ts)-1]
+	if last.UpdatedAt != nil {
+		next.UpdatedAt = last.UpdatedAt.Time
+	}
+	if next.UpdatedAt.Equal(cursor.UpdatedAt) {
+		next.Numbers = append(next.Numbers, cursor.Numbers...)
+	}
+	for _, t := range ts {
+		if t.UpdatedAt != nil && t.UpdatedAt.Equal(next.UpdatedAt) {
+			next.Numbers = append(next.Numbers, t.Number)
+		}
+	}
+	return ts, next, nil
+}
+
+// updatedAfter reports whether a was updated after b.
+func updatedAfter(a, b *Ticket) bool {
+	if a.UpdatedAt == nil || b.UpdatedAt == nil {
+		return a.UpdatedAt != nil
+	}
+	return a.UpdatedAt.After(b.UpdatedAt.Time)
+}
+
+// hasStateTerm reports whether query contains "all" or a state: term.
+func hasStateTerm(query string) bool {
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		word = strings.TrimPrefix(word, "-")
+		if word == "all" || strings.HasPrefix(word, "state:") {
+			return true
+		}
+	}
+	return false
+}
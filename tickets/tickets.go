@@ -4,19 +4,24 @@ package tickets
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
-	"net/textproto"
 	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/internal/crud"
+	"github.com/nwidger/lighthouse/projects"
 )
 
 const (
@@ -25,14 +30,16 @@ const (
 )
 
 type Service struct {
-	basePath string
-	s        *lighthouse.Service
+	basePath  string
+	projectID int
+	s         *lighthouse.Service
 }
 
 func NewService(s *lighthouse.Service, projectID int) *Service {
 	return &Service{
-		basePath: s.BasePath + "/projects/" + strconv.Itoa(projectID) + "/tickets",
-		s:        s,
+		basePath:  s.BasePath + "/projects/" + strconv.Itoa(projectID) + "/tickets",
+		projectID: projectID,
+		s:         s,
 	}
 }
 
@@ -52,22 +59,87 @@ type TagsResponse struct {
 }
 
 type Attachment struct {
-	AttachmentFileProcessing bool       `json:"attachment_file_processing"`
-	Code                     string     `json:"code"`
-	ContentType              string     `json:"content_type"`
-	CreatedAt                *time.Time `json:"created_at"`
-	Filename                 string     `json:"filename"`
-	Height                   int        `json:"height"`
-	ID                       int        `json:"id"`
-	ProjectID                int        `json:"project_id"`
-	Size                     int        `json:"size"`
-	UploaderID               int        `json:"uploader_id"`
-	Width                    int        `json:"width"`
-	URL                      string     `json:"url"`
+	AttachmentFileProcessing bool             `json:"attachment_file_processing"`
+	Code                     string           `json:"code"`
+	ContentType              string           `json:"content_type"`
+	CreatedAt                *lighthouse.Time `json:"created_at"`
+	Filename                 string           `json:"filename"`
+	Height                   int              `json:"height"`
+	ID                       int              `json:"id"`
+	ProjectID                int              `json:"project_id"`
+	Size                     int              `json:"size"`
+	UploaderID               int              `json:"uploader_id"`
+	Width                    int              `json:"width"`
+	URL                      string           `json:"url"`
+}
+
+// CreatedAtTime returns the time the attachment was created, or the
+// zero time if it is unknown.
+func (a *Attachment) CreatedAtTime() time.Time {
+	return a.CreatedAt.OrZero()
+}
+
+// IsImage reports whether the attachment is an image, based on its
+// content type or, failing that, its filename extension.
+func (a *Attachment) IsImage() bool {
+	contentType := a.ContentType
+	if len(contentType) == 0 {
+		contentType = mime.TypeByExtension(filepath.Ext(a.Filename))
+	}
+	return strings.HasPrefix(contentType, "image/")
+}
+
+// Markdown returns a Markdown embed for the attachment.  Images are
+// embedded inline, other attachments are linked.  If src is empty,
+// the attachment's URL is used, otherwise src should be the path to
+// the attachment, i.e., within an export.
+func (a *Attachment) Markdown(src string) string {
+	if len(src) == 0 {
+		src = a.URL
+	}
+	r := strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`)
+	text := r.Replace(a.Filename)
+	src = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(src)
+	if a.IsImage() {
+		return "![" + text + "](" + src + ")"
+	}
+	return "[" + text + "](" + src + ")"
+}
+
+// HTML returns an HTML embed for the attachment.  Images are
+// embedded inline as a link to the full-size image, including their
+// width and height if known, other attachments are linked.  If src
+// is empty, the attachment's URL is used, otherwise src should be
+// the path to the attachment, i.e., within an export.
+func (a *Attachment) HTML(src string) string {
+	if len(src) == 0 {
+		src = a.URL
+	}
+	src, name := html.EscapeString(src), html.EscapeString(a.Filename)
+	if !a.IsImage() {
+		return `<a href="` + src + `">` + name + `</a>`
+	}
+	img := `<img src="` + src + `" alt="` + name + `"`
+	if a.Width > 0 && a.Height > 0 {
+		img += ` width="` + strconv.Itoa(a.Width) + `" height="` + strconv.Itoa(a.Height) + `"`
+	}
+	img += `>`
+	return `<a href="` + src + `">` + img + `</a>`
 }
 
 type Attachments []*Attachment
 
+// Images returns the attachments which are images.
+func (as Attachments) Images() Attachments {
+	images := Attachments{}
+	for _, a := range as {
+		if a != nil && a.IsImage() {
+			images = append(images, a)
+		}
+	}
+	return images
+}
+
 type AttachmentResponse struct {
 	Attachment *Attachment `json:"attachment"`
 }
@@ -144,7 +216,7 @@ type TicketVersion struct {
 	Body               string              `json:"body"`
 	BodyHTML           string              `json:"body_html"`
 	Closed             bool                `json:"closed"`
-	CreatedAt          *time.Time          `json:"created_at"`
+	CreatedAt          *lighthouse.Time    `json:"created_at"`
 	CreatorID          int                 `json:"creator_id"`
 	DiffableAttributes *DiffableAttributes `json:"diffable_attributes,omitempty"`
 	Importance         int                 `json:"importance"`
@@ -153,12 +225,12 @@ type TicketVersion struct {
 	Number             int                 `json:"number"`
 	Permalink          string              `json:"permalink"`
 	ProjectID          int                 `json:"project_id"`
-	RawData            []byte              `json:"raw_data"`
+	RawData            json.RawMessage     `json:"raw_data"`
 	Spam               bool                `json:"spam"`
 	State              string              `json:"state,omitempty"`
 	Tag                string              `json:"tag"`
 	Title              string              `json:"title"`
-	UpdatedAt          *time.Time          `json:"updated_at"`
+	UpdatedAt          *lighthouse.Time    `json:"updated_at"`
 	UserID             int                 `json:"user_id"`
 	Version            int                 `json:"version"`
 	WatchersIDs        []int               `json:"watchers_ids"`
@@ -167,6 +239,47 @@ type TicketVersion struct {
 	URL                string              `json:"url"`
 	Priority           int                 `json:"priority"`
 	StateColor         string              `json:"state_color"`
+
+	// Unknown holds any fields returned by Lighthouse which
+	// aren't modeled above so they are preserved when the ticket version
+	// is encoded again.
+	Unknown lighthouse.UnknownFields `json:"-"`
+}
+
+func (tv *TicketVersion) UnmarshalJSON(data []byte) error {
+	type ticketVersion TicketVersion
+	// versions converted from XML are wrapped in a single-field
+	// object named after their element, see lighthouse.XMLToJSON,
+	// while a version's own version field is a number
+	var wrapped map[string]json.RawMessage
+	if json.Unmarshal(data, &wrapped) == nil && len(wrapped) == 1 {
+		if v, ok := wrapped["version"]; ok && len(v) > 0 && v[0] == '{' {
+			data = v
+		}
+	}
+	unknown, err := lighthouse.UnmarshalWithUnknown(data, (*ticketVersion)(tv))
+	if err != nil {
+		return err
+	}
+	tv.Unknown = unknown
+	return nil
+}
+
+func (tv *TicketVersion) MarshalJSON() ([]byte, error) {
+	type ticketVersion TicketVersion
+	return lighthouse.MarshalWithUnknown((*ticketVersion)(tv), tv.Unknown)
+}
+
+// CreatedAtTime returns the time the ticket version was created, or
+// the zero time if it is unknown.
+func (tv *TicketVersion) CreatedAtTime() time.Time {
+	return tv.CreatedAt.OrZero()
+}
+
+// UpdatedAtTime returns the time the ticket version was updated, or
+// the zero time if it is unknown.
+func (tv *TicketVersion) UpdatedAtTime() time.Time {
+	return tv.UpdatedAt.OrZero()
 }
 
 type TicketVersions []*TicketVersion
@@ -177,21 +290,21 @@ type Ticket struct {
 	Body             string                `json:"body"`
 	BodyHTML         string                `json:"body_html"`
 	Closed           bool                  `json:"closed"`
-	CreatedAt        *time.Time            `json:"created_at"`
+	CreatedAt        *lighthouse.Time      `json:"created_at"`
 	CreatorID        int                   `json:"creator_id"`
 	Importance       int                   `json:"importance"`
-	MilestoneDueOn   *time.Time            `json:"milestone_due_on"`
+	MilestoneDueOn   *lighthouse.Time      `json:"milestone_due_on"`
 	MilestoneID      int                   `json:"milestone_id"`
 	MilestoneOrder   int                   `json:"milestone_order"`
 	Number           int                   `json:"number"`
 	Permalink        string                `json:"permalink"`
 	ProjectID        int                   `json:"project_id"`
-	RawData          []byte                `json:"raw_data"`
+	RawData          json.RawMessage       `json:"raw_data"`
 	Spam             bool                  `json:"spam"`
 	State            string                `json:"state,omitempty"`
 	Tag              string                `json:"tag"`
 	Title            string                `json:"title"`
-	UpdatedAt        *time.Time            `json:"updated_at"`
+	UpdatedAt        *lighthouse.Time      `json:"updated_at"`
 	UserID           int                   `json:"user_id"`
 	Version          int                   `json:"version"`
 	WatchersIDs      []int                 `json:"watchers_ids"`
@@ -210,6 +323,93 @@ type Ticket struct {
 	AlphabeticalTags AlphabeticalTags      `json:"alphabetical_tags"`
 	Versions         TicketVersions        `json:"versions"`
 	Attachments      []*AttachmentResponse `json:"attachments"`
+
+	// Unknown holds any fields returned by Lighthouse which
+	// aren't modeled above so they are preserved when the ticket
+	// is encoded again.
+	Unknown lighthouse.UnknownFields `json:"-"`
+}
+
+func (t *Ticket) UnmarshalJSON(data []byte) error {
+	type ticket Ticket
+	unknown, err := lighthouse.UnmarshalWithUnknown(data, (*ticket)(t))
+	if err != nil {
+		return err
+	}
+	t.Unknown = unknown
+	return nil
+}
+
+func (t *Ticket) MarshalJSON() ([]byte, error) {
+	type ticket Ticket
+	return lighthouse.MarshalWithUnknown((*ticket)(t), t.Unknown)
+}
+
+// CreatedAtTime returns the time the ticket was created, or the zero
+// time if it is unknown.
+func (t *Ticket) CreatedAtTime() time.Time {
+	return t.CreatedAt.OrZero()
+}
+
+// UpdatedAtTime returns the time the ticket was last updated, or the
+// zero time if it is unknown.
+func (t *Ticket) UpdatedAtTime() time.Time {
+	return t.UpdatedAt.OrZero()
+}
+
+// MilestoneDueOnTime returns the due date of the ticket's milestone,
+// or the zero time if it has none.
+func (t *Ticket) MilestoneDueOnTime() time.Time {
+	return t.MilestoneDueOn.OrZero()
+}
+
+// WebURL returns the canonical web URL of t in account, for use when
+// t.URL is unavailable.
+func (t *Ticket) WebURL(account string) string {
+	return lighthouse.WebURL(account, "projects", strconv.Itoa(t.ProjectID), "tickets", lighthouse.Slug(t.Number, t.Permalink))
+}
+
+// Patch merges the JSON object data into t, changing only the fields
+// present in data.  data may only contain the fields which Update
+// sends, i.e., title, body, state, assigned_user_id, milestone_id and
+// tag, since changes to other fields would be silently dropped.
+func (t *Ticket) Patch(data []byte) error {
+	patch := &struct {
+		Title          *string `json:"title"`
+		Body           *string `json:"body"`
+		State          *string `json:"state"`
+		AssignedUserID *int    `json:"assigned_user_id"`
+		MilestoneID    *int    `json:"milestone_id"`
+		Tag            *string `json:"tag"`
+	}{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(patch)
+	if err != nil {
+		return fmt.Errorf("invalid patch: %v, only title, body, state, assigned_user_id, milestone_id and tag can be updated", err)
+	}
+	if dec.More() {
+		return fmt.Errorf("invalid patch: unexpected data after JSON object")
+	}
+	if patch.Title != nil {
+		t.Title = *patch.Title
+	}
+	if patch.Body != nil {
+		t.Body = *patch.Body
+	}
+	if patch.State != nil {
+		t.State = *patch.State
+	}
+	if patch.AssignedUserID != nil {
+		t.AssignedUserID = *patch.AssignedUserID
+	}
+	if patch.MilestoneID != nil {
+		t.MilestoneID = *patch.MilestoneID
+	}
+	if patch.Tag != nil {
+		t.Tag = *patch.Tag
+	}
+	return nil
 }
 
 type Tickets []*Ticket
@@ -226,49 +426,81 @@ type TicketCreate struct {
 	// http://help.lighthouseapp.com/discussions/api-developers/196-change-ticket-notifications
 	NotifyAll        *bool `json:"notify_all,omitempty"`
 	MultipleWatchers []int `json:"multiple_watchers,omitempty"`
+
+	// Undocumented, used by account migrations to preserve a
+	// ticket's original creator and creation time.  These are
+	// only honored if MigrationToken is set to the API token of
+	// an account owner, otherwise Lighthouse ignores them and
+	// the ticket is created by the authenticated user at the
+	// current time.  See CreateWithCreator.
+	CreatorID      int              `json:"user_id,omitempty"`
+	CreatedAt      *lighthouse.Time `json:"created_at,omitempty"`
+	MigrationToken string           `json:"migration_token,omitempty"`
 }
 
+// TicketUpdate is sent by Update and UpdatePartial.  Only fields
+// which are non-nil are sent, so Lighthouse leaves the others
+// unchanged, i.e., set only MilestoneID to move a ticket to another
+// milestone.  Set AssignedUserID or MilestoneID to 0 to unassign the
+// ticket or remove it from its milestone.  Body, if set, is added as
+// a comment.
 type TicketUpdate struct {
-	*Ticket
-
-	NotifyAll        *bool `json:"notify_all,omitempty"`
+	Title          *string `json:"title,omitempty"`
+	Body           *string `json:"body,omitempty"`
+	State          *string `json:"state,omitempty"`
+	AssignedUserID *int    `json:"assigned_user_id,omitempty"`
+	MilestoneID    *int    `json:"milestone_id,omitempty"`
+	Tag            *string `json:"tag,omitempty"`
+
+	NotifyAll *bool `json:"notify_all,omitempty"`
+	// If non-nil, MultipleWatchers replaces the ticket's watchers
+	// and may be empty to remove every watcher.
 	MultipleWatchers []int `json:"multiple_watchers,omitempty"`
 }
 
-type ticketRequest struct {
-	Ticket interface{} `json:"ticket"`
-}
-
-func (mr *ticketRequest) Encode(w io.Writer) error {
-	enc := json.NewEncoder(w)
-	return enc.Encode(mr)
-}
-
-type ticketResponse struct {
-	Ticket *Ticket `json:"ticket"`
-}
-
-func (mr *ticketResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(mr)
+func (tu *TicketUpdate) MarshalJSON() ([]byte, error) {
+	type ticketUpdate TicketUpdate
+	// shadows ticketUpdate's MultipleWatchers so an empty,
+	// non-nil slice is sent
+	v := &struct {
+		*ticketUpdate
+		MultipleWatchers *[]int `json:"multiple_watchers,omitempty"`
+	}{
+		ticketUpdate: (*ticketUpdate)(tu),
+	}
+	if tu.MultipleWatchers != nil {
+		v.MultipleWatchers = &tu.MultipleWatchers
+	}
+	return json.Marshal(v)
 }
 
-type ticketsResponse struct {
-	Tickets []*ticketResponse `json:"tickets"`
-}
+// TicketComment is sent by Comment, it carries only the comment and
+// its notification options.
+type TicketComment struct {
+	Body string `json:"body"`
 
-func (msr *ticketsResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(msr)
+	NotifyAll        *bool `json:"notify_all,omitempty"`
+	MultipleWatchers []int `json:"multiple_watchers,omitempty"`
 }
 
-func (msr *ticketsResponse) tickets() Tickets {
-	ms := make(Tickets, 0, len(msr.Tickets))
-	for _, m := range msr.Tickets {
-		ms = append(ms, m.Ticket)
+// newTicketUpdate returns a TicketUpdate setting every field of t
+// which can be updated.
+func newTicketUpdate(t *Ticket, opts *NotifyOptions) *TicketUpdate {
+	tu := &TicketUpdate{
+		Title:          &t.Title,
+		Body:           &t.Body,
+		AssignedUserID: &t.AssignedUserID,
+		MilestoneID:    &t.MilestoneID,
+		Tag:            &t.Tag,
 	}
-
-	return ms
+	if len(t.State) > 0 {
+		tu.State = &t.State
+	}
+	if opts != nil {
+		tu.NotifyAll = opts.NotifyAll
+		tu.MultipleWatchers = opts.MultipleWatchers
+	}
+	return tu
 }
 
 type bulkEditRequest struct {
@@ -277,11 +509,6 @@ type bulkEditRequest struct {
 	MigrationToken string `json:"migration_token,omitempty"`
 }
 
-func (br *bulkEditRequest) Encode(w io.Writer) error {
-	enc := json.NewEncoder(w)
-	return enc.Encode(br)
-}
-
 type ListOptions struct {
 	// Search query, see
 	// http://help.lighthouseapp.com/faqs/getting-started/how-do-i-search-for-tickets.
@@ -296,7 +523,7 @@ type ListOptions struct {
 	Page int
 }
 
-func (s *Service) List(opts *ListOptions) (Tickets, error) {
+func (s *Service) List(opts *ListOptions, reqOpts ...lighthouse.RequestOption) (Tickets, error) {
 	path := s.basePath + ".json"
 	if opts != nil {
 		u, err := url.Parse(path)
@@ -317,252 +544,480 @@ func (s *Service) List(opts *ListOptions) (Tickets, error) {
 		path = u.String()
 	}
 
-	resp, err := s.s.RoundTrip("GET", path, nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
-	}
-
-	tsresp := &ticketsResponse{}
-	err = tsresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return tsresp.tickets(), nil
+	return crud.List[Ticket](s.s, path, "ticket", reqOpts...)
 }
 
 // ListAll repeatedly calls List and returns all pages.  ListAll
-// ignores opts.Page.
-func (s *Service) ListAll(opts *ListOptions) (Tickets, error) {
+// ignores opts.Page.  If an error occurs, the pages retrieved so far
+// are returned along with the error.
+func (s *Service) ListAll(opts *ListOptions, reqOpts ...lighthouse.RequestOption) (Tickets, error) {
+	ts := Tickets{}
+	err := s.Pages(opts, func(p Tickets) {
+		ts = append(ts, p...)
+	}, reqOpts...).All()
+	return ts, err
+}
+
+// Pages returns a *lighthouse.Pager which calls List for each page
+// and passes the page's tickets to fn.  Pages ignores opts.Page.
+func (s *Service) Pages(opts *ListOptions, fn func(Tickets), reqOpts ...lighthouse.RequestOption) *lighthouse.Pager {
 	realOpts := ListOptions{}
 	if opts != nil {
 		realOpts = *opts
 	}
 
-	ts := Tickets{}
-
-	for realOpts.Page = 1; ; realOpts.Page++ {
-		p, err := s.List(&realOpts)
+	return lighthouse.NewPager(func(page int) (int, error) {
+		realOpts.Page = page
+		p, err := s.List(&realOpts, reqOpts...)
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
-		if len(p) == 0 {
-			break
+		if len(p) > 0 {
+			fn(p)
 		}
+		return len(p), nil
+	})
+}
 
-		ts = append(ts, p...)
-	}
+// Iterator steps through the tickets of a list one at a time,
+// fetching each page only once the tickets of the previous page have
+// been consumed, so at most one page is held in memory.  Typical use
+// is:
+//
+//	it := ticketsService.Iter(opts)
+//	for it.Next() {
+//		t := it.Ticket()
+//		// handle ticket, break to stop early
+//	}
+//	if err := it.Err(); err != nil {
+//		// handle error
+//	}
+type Iterator struct {
+	pager *lighthouse.Pager
+	page  Tickets
+	t     *Ticket
+}
 
-	return ts, nil
+// Iter returns an *Iterator over the tickets matching opts.  Iter
+// ignores opts.Page.  No request is made until Next is called.
+func (s *Service) Iter(opts *ListOptions, reqOpts ...lighthouse.RequestOption) *Iterator {
+	it := &Iterator{}
+	it.pager = s.Pages(opts, func(p Tickets) {
+		it.page = p
+	}, reqOpts...)
+	return it
 }
 
-// Only the fields in TicketUpdate can be set.
-func (s *Service) Update(t *Ticket) error {
-	treq := &ticketRequest{
-		Ticket: &TicketUpdate{
-			Ticket: t,
-		},
+// Next advances to the next ticket, fetching the next page if the
+// current one is exhausted.  It returns false once there are no
+// tickets left or an error occurs, after which Err should be checked.
+func (it *Iterator) Next() bool {
+	if len(it.page) == 0 && !it.pager.Next() {
+		it.t = nil
+		return false
 	}
+	it.t, it.page = it.page[0], it.page[1:]
+	return true
+}
 
-	buf := &bytes.Buffer{}
-	err := treq.Encode(buf)
-	if err != nil {
-		return err
+// Ticket returns the ticket Next advanced to.
+func (it *Iterator) Ticket() *Ticket {
+	return it.t
+}
+
+// Pager returns the *lighthouse.Pager fetching the iterator's pages,
+// for example to set its Progress callback.
+func (it *Iterator) Pager() *lighthouse.Pager {
+	return it.pager
+}
+
+// Err returns the error, if any, that stopped Next.
+func (it *Iterator) Err() error {
+	return it.pager.Err()
+}
+
+// Each calls fn for each ticket matching opts, fetching pages lazily
+// as with Iter, until fn returns false or there are no tickets left.
+// Each ignores opts.Page.  If fetching a page fails, Each stops and
+// returns the error.
+func (s *Service) Each(opts *ListOptions, fn func(t *Ticket) bool, reqOpts ...lighthouse.RequestOption) error {
+	it := s.Iter(opts, reqOpts...)
+	for it.Next() {
+		if !fn(it.Ticket()) {
+			break
+		}
 	}
+	return it.Err()
+}
 
-	resp, err := s.s.RoundTrip("PUT", s.basePath+"/"+strconv.Itoa(t.Number)+".json", buf)
-	if err != nil {
-		return err
+// ListAllConcurrent is like ListAll but fetches up to workers pages
+// at once using a *lighthouse.Pool.  If workers is not positive,
+// lighthouse.DefaultPoolWorkers is used.  Since the number of pages
+// isn't known in advance, up to workers-1 requests beyond the last
+// page may be made.  If any pages fail, the tickets of the pages
+// before the first failure are returned along with a
+// *lighthouse.MultiError recording each failed page by page number.
+func (s *Service) ListAllConcurrent(opts *ListOptions, workers int, reqOpts ...lighthouse.RequestOption) (Tickets, error) {
+	realOpts := ListOptions{}
+	if opts != nil {
+		realOpts = *opts
+	}
+	if workers <= 0 {
+		workers = lighthouse.DefaultPoolWorkers
 	}
-	defer resp.Body.Close()
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return err
+	ts := Tickets{}
+	pool := lighthouse.NewPool(workers)
+
+	for first := 1; ; first += workers {
+		pages := make([]Tickets, workers)
+		errs := make([]error, workers)
+		pool.Run(context.Background(), workers, func(ctx context.Context, i int) error {
+			pageOpts := realOpts
+			pageOpts.Page = first + i
+			pages[i], errs[i] = s.List(&pageOpts, reqOpts...)
+			return errs[i]
+		})
+		result := &lighthouse.BatchResult{}
+		for i, err := range errs {
+			if err != nil {
+				result.Add(first+i, err)
+			}
+		}
+		for i, p := range pages {
+			if errs[i] != nil {
+				return ts, result.Err()
+			}
+			if len(p) == 0 {
+				return ts, nil
+			}
+			ts = append(ts, p...)
+		}
 	}
+}
 
-	return nil
+// NotifyOptions controls who is notified of a ticket change.  See
+// http://help.lighthouseapp.com/discussions/api-developers/196-change-ticket-notifications.
+type NotifyOptions struct {
+	// If non-nil, NotifyAll controls whether all project members
+	// are notified of the change.  Set to false to suppress
+	// notification emails, for example during bulk imports.
+	NotifyAll *bool
+
+	// If non-nil, MultipleWatchers replaces the ticket's watchers
+	// with the given user IDs.
+	MultipleWatchers []int
 }
 
-func (s *Service) New() (*Ticket, error) {
-	return s.get("new")
+// Only the fields in TicketUpdate can be set.
+func (s *Service) Update(t *Ticket, reqOpts ...lighthouse.RequestOption) error {
+	return s.UpdateWithOptions(t, nil, reqOpts...)
 }
 
-// Get ticket using ticket number string, possibly prefixed by #
-func (s *Service) Get(numberStr string) (*Ticket, error) {
-	number, err := Number(numberStr)
+// UpdateWithOptions is like Update but allows controlling
+// notifications and watchers.  Only the fields in TicketUpdate can
+// be set.
+func (s *Service) UpdateWithOptions(t *Ticket, opts *NotifyOptions, reqOpts ...lighthouse.RequestOption) error {
+	return crud.Update(s.s, s.basePath+"/"+strconv.Itoa(t.Number)+".json", "ticket", newTicketUpdate(t, opts), reqOpts...)
+}
+
+// UpdatePartial changes only the fields of ticket number which are
+// set in tu, leaving its other fields unchanged without having to
+// fetch the ticket first.
+func (s *Service) UpdatePartial(number int, tu *TicketUpdate, reqOpts ...lighthouse.RequestOption) error {
+	return crud.Update(s.s, s.basePath+"/"+strconv.Itoa(number)+".json", "ticket", tu, reqOpts...)
+}
+
+// Watchers returns the IDs of the users watching ticket number.
+func (s *Service) Watchers(number int, reqOpts ...lighthouse.RequestOption) ([]int, error) {
+	t, err := s.GetByNumber(number, reqOpts...)
 	if err != nil {
 		return nil, err
 	}
-	return s.GetByNumber(number)
+	return t.WatchersIDs, nil
 }
 
-func (s *Service) GetByNumber(number int) (*Ticket, error) {
-	return s.get(strconv.Itoa(number))
+// SetWatchers replaces the watchers of ticket number with userIDs,
+// which may be empty to remove every watcher.
+func (s *Service) SetWatchers(number int, userIDs []int, reqOpts ...lighthouse.RequestOption) error {
+	return s.SetWatchersWithOptions(number, userIDs, nil, reqOpts...)
 }
 
-func (s *Service) get(number string) (*Ticket, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+"/"+number+".json", nil)
-	if err != nil {
-		return nil, err
+// SetWatchersWithOptions is like SetWatchers but also controls who is
+// notified of the change.  opts.MultipleWatchers is ignored.
+func (s *Service) SetWatchersWithOptions(number int, userIDs []int, opts *NotifyOptions, reqOpts ...lighthouse.RequestOption) error {
+	tu := &TicketUpdate{
+		MultipleWatchers: append([]int{}, userIDs...),
 	}
-	defer resp.Body.Close()
+	if opts != nil {
+		tu.NotifyAll = opts.NotifyAll
+	}
+	return s.UpdatePartial(number, tu, reqOpts...)
+}
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
+// AddWatcher adds userID to the watchers of ticket number, fetching
+// its current watchers first so they are kept.  It does nothing if
+// userID is already watching the ticket.
+func (s *Service) AddWatcher(number, userID int, reqOpts ...lighthouse.RequestOption) error {
+	watchers, err := s.Watchers(number, reqOpts...)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	for _, id := range watchers {
+		if id == userID {
+			return nil
+		}
 	}
+	return s.SetWatchers(number, append(watchers, userID), reqOpts...)
+}
 
-	tresp := &ticketResponse{}
-	err = tresp.decode(resp.Body)
+// RemoveWatcher removes userID from the watchers of ticket number,
+// fetching its current watchers first so the others are kept.  It
+// does nothing if userID isn't watching the ticket.
+func (s *Service) RemoveWatcher(number, userID int, reqOpts ...lighthouse.RequestOption) error {
+	watchers, err := s.Watchers(number, reqOpts...)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	kept := make([]int, 0, len(watchers))
+	for _, id := range watchers {
+		if id != userID {
+			kept = append(kept, id)
+		}
+	}
+	if len(kept) == len(watchers) {
+		return nil
+	}
+	return s.SetWatchers(number, kept, reqOpts...)
+}
 
-	return tresp.Ticket, nil
+// CloseWith closes ticket number by changing its state to state,
+// which must be one of the project's closed states.  If it isn't,
+// an error listing the valid closed states is returned before the
+// ticket is modified.
+func (s *Service) CloseWith(number int, state string, reqOpts ...lighthouse.RequestOption) error {
+	return s.CloseWithOptions(number, state, nil, reqOpts...)
 }
 
-// Only the fields in TicketCreate can be set.
-func (s *Service) Create(t *Ticket) (*Ticket, error) {
-	treq := &ticketRequest{
-		Ticket: &TicketCreate{
-			Title:          t.Title,
-			Body:           t.Body,
-			State:          t.State,
-			AssignedUserID: t.AssignedUserID,
-			MilestoneID:    t.MilestoneID,
-			Tag:            t.Tag,
-		},
-	}
-
-	buf := &bytes.Buffer{}
-	err := treq.Encode(buf)
+// CloseWithOptions is like CloseWith but also controls who is
+// notified of the change.
+func (s *Service) CloseWithOptions(number int, state string, opts *NotifyOptions, reqOpts ...lighthouse.RequestOption) error {
+	ss, err := s.States(reqOpts...)
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	resp, err := s.s.RoundTrip("POST", s.basePath+".json", buf)
+	closedState, err := ss.NormalizeClosed(state)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer resp.Body.Close()
 
-	err = lighthouse.CheckResponse(resp, http.StatusCreated)
-	if err != nil {
-		return nil, err
+	tu := &TicketUpdate{
+		State: lighthouse.String(string(closedState)),
 	}
+	if opts != nil {
+		tu.NotifyAll = opts.NotifyAll
+		tu.MultipleWatchers = opts.MultipleWatchers
+	}
+	return s.UpdatePartial(number, tu, reqOpts...)
+}
+
+// Comment adds body as a comment on ticket number.  Unlike Update,
+// only the comment is sent, so the ticket's other fields are left as
+// they are even if they were changed since the ticket was last
+// retrieved.
+func (s *Service) Comment(number int, body string, reqOpts ...lighthouse.RequestOption) error {
+	return s.CommentWithOptions(number, body, nil, reqOpts...)
+}
 
-	tresp := &ticketResponse{
-		Ticket: t,
+// CommentWithOptions is like Comment but also controls who is
+// notified of the comment.
+func (s *Service) CommentWithOptions(number int, body string, opts *NotifyOptions, reqOpts ...lighthouse.RequestOption) error {
+	tc := &TicketComment{
+		Body: body,
 	}
-	err = tresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
+	if opts != nil {
+		tc.NotifyAll = opts.NotifyAll
+		tc.MultipleWatchers = opts.MultipleWatchers
 	}
+	return crud.Update(s.s, s.basePath+"/"+strconv.Itoa(number)+".json", "ticket", tc, reqOpts...)
+}
 
-	return t, nil
+func (s *Service) New(reqOpts ...lighthouse.RequestOption) (*Ticket, error) {
+	return s.get("new", reqOpts...)
 }
 
-// Delete ticket using ticket number string, possibly prefixed by #
-func (s *Service) Delete(numberStr string) error {
+// Get ticket using ticket number string, possibly prefixed by #
+func (s *Service) Get(numberStr string, reqOpts ...lighthouse.RequestOption) (*Ticket, error) {
 	number, err := Number(numberStr)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return s.DeleteByNumber(number)
+	return s.GetByNumber(number, reqOpts...)
 }
 
-func (s *Service) DeleteByNumber(number int) error {
-	resp, err := s.s.RoundTrip("DELETE", s.basePath+"/"+strconv.Itoa(number)+".json", nil)
-	if err != nil {
-		return err
+func (s *Service) GetByNumber(number int, reqOpts ...lighthouse.RequestOption) (*Ticket, error) {
+	return s.get(strconv.Itoa(number), reqOpts...)
+}
+
+func (s *Service) get(number string, reqOpts ...lighthouse.RequestOption) (*Ticket, error) {
+	return crud.Get[Ticket](s.s, s.basePath+"/"+number+".json", "ticket", reqOpts...)
+}
+
+// Only the fields in TicketCreate can be set.
+func (s *Service) Create(t *Ticket, reqOpts ...lighthouse.RequestOption) (*Ticket, error) {
+	return s.CreateWithOptions(t, nil, reqOpts...)
+}
+
+// CreateWithOptions is like Create but allows controlling
+// notifications and watchers.  Only the fields in TicketCreate can
+// be set.
+func (s *Service) CreateWithOptions(t *Ticket, opts *NotifyOptions, reqOpts ...lighthouse.RequestOption) (*Ticket, error) {
+	return s.create(newTicketCreate(t, opts), t, reqOpts...)
+}
+
+// CreateWithCreator is like CreateWithOptions but also attempts to
+// preserve t.CreatorID and t.CreatedAt, for example when importing
+// tickets from another account.  migrationToken must be the API
+// token of an account owner, otherwise Lighthouse silently ignores
+// the creator fields.  Callers should compare the returned ticket's
+// CreatorID against the requested one to detect this.
+func (s *Service) CreateWithCreator(t *Ticket, opts *NotifyOptions, migrationToken string, reqOpts ...lighthouse.RequestOption) (*Ticket, error) {
+	tc := newTicketCreate(t, opts)
+	tc.CreatorID = t.CreatorID
+	tc.CreatedAt = t.CreatedAt
+	tc.MigrationToken = migrationToken
+	return s.create(tc, t, reqOpts...)
+}
+
+func newTicketCreate(t *Ticket, opts *NotifyOptions) *TicketCreate {
+	tc := &TicketCreate{
+		Title:          t.Title,
+		Body:           t.Body,
+		State:          t.State,
+		AssignedUserID: t.AssignedUserID,
+		MilestoneID:    t.MilestoneID,
+		Tag:            t.Tag,
 	}
-	defer resp.Body.Close()
+	if opts != nil {
+		tc.NotifyAll = opts.NotifyAll
+		tc.MultipleWatchers = opts.MultipleWatchers
+	}
+	return tc
+}
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
+func (s *Service) create(tc *TicketCreate, t *Ticket, reqOpts ...lighthouse.RequestOption) (*Ticket, error) {
+	return crud.Create(s.s, s.basePath+".json", "ticket", tc, t, reqOpts...)
+}
+
+// Delete ticket using ticket number string, possibly prefixed by #
+func (s *Service) Delete(numberStr string, reqOpts ...lighthouse.RequestOption) error {
+	number, err := Number(numberStr)
 	if err != nil {
 		return err
 	}
+	return s.DeleteByNumber(number, reqOpts...)
+}
 
-	return nil
+func (s *Service) DeleteByNumber(number int, reqOpts ...lighthouse.RequestOption) error {
+	return crud.Delete(s.s, s.basePath+"/"+strconv.Itoa(number)+".json", reqOpts...)
 }
 
-func (s *Service) GetAttachment(a *Attachment) (io.ReadCloser, error) {
-	resp, err := s.s.RoundTrip("GET", a.URL, nil)
+func (s *Service) GetAttachment(a *Attachment, reqOpts ...lighthouse.RequestOption) (io.ReadCloser, error) {
+	resp, err := s.getAttachment(a, reqOpts...)
 	if err != nil {
 		return nil, err
 	}
+	return resp.Body, nil
+}
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
-	}
+// DeleteAttachment deletes attachment a from the ticket or milestone
+// it was uploaded to.
+func (s *Service) DeleteAttachment(a *Attachment, reqOpts ...lighthouse.RequestOption) error {
+	return s.DeleteAttachmentByID(a.ID, reqOpts...)
+}
 
-	return resp.Body, nil
+// DeleteAttachmentByID deletes the attachment with the given ID.
+// Attachments belong to the account rather than a project, so
+// Lighthouse's destroy endpoint is outside the ticket's path.
+func (s *Service) DeleteAttachmentByID(id int, reqOpts ...lighthouse.RequestOption) error {
+	return crud.Delete(s.s, s.s.BasePath+"/attachments/"+strconv.Itoa(id)+".json", reqOpts...)
 }
 
-func (s *Service) AddAttachment(t *Ticket, filename string, r io.Reader) error {
-	body := &bytes.Buffer{}
-	w := multipart.NewWriter(body)
-	attachmentPart, err := w.CreateFormFile("ticket[attachment][]", filepath.Base(filename))
-	if err != nil {
-		return err
-	}
+func (s *Service) AddAttachment(t *Ticket, filename string, r io.Reader, reqOpts ...lighthouse.RequestOption) error {
+	return s.AddAttachments(t, []AttachmentUpload{{Filename: filename, Reader: r}}, reqOpts...)
+}
 
-	_, err = io.Copy(attachmentPart, r)
-	if err != nil {
-		return err
-	}
+// AttachmentUpload is a file to attach to a ticket with
+// AddAttachments.
+type AttachmentUpload struct {
+	// Filename is the attachment's filename, only its base name
+	// is sent.
+	Filename string
 
-	h := make(textproto.MIMEHeader)
-	h.Set("Content-Disposition", `form-data; name="json"`)
-	h.Set("Content-Type", "application/json")
+	// Reader supplies the attachment's contents.
+	Reader io.Reader
+}
 
-	ticketPart, err := w.CreatePart(h)
+// AddAttachments attaches files to ticket t in a single request,
+// along with any changes to the fields in TicketUpdate.  The
+// multipart request body is streamed as it is sent, so the files are
+// never held in memory.  Since the body can't be replayed, the request
+// is not retried if it is rate limited.
+func (s *Service) AddAttachments(t *Ticket, files []AttachmentUpload, reqOpts ...lighthouse.RequestOption) error {
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(s.writeAttachmentsForm(w, t, files))
+	}()
+
+	req, err := http.NewRequest("PUT", s.s.FormatPath(s.basePath+"/"+strconv.Itoa(t.Number)+".json"), pr)
 	if err != nil {
+		pr.Close()
 		return err
 	}
-
-	treq := &ticketRequest{
-		Ticket: &TicketUpdate{
-			Ticket: t,
-		},
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	for _, opt := range reqOpts {
+		req = opt(req)
 	}
 
-	err = treq.Encode(ticketPart)
+	resp, err := s.s.Do(req)
+	// unblock the writer if the request failed before the body
+	// was fully read
+	pr.Close()
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
-	err = w.Close()
+	err = lighthouse.CheckResponse(resp, http.StatusOK)
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("PUT", s.basePath+"/"+strconv.Itoa(t.Number)+".json", body)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", w.FormDataContentType())
+	return nil
+}
 
-	resp, err := s.s.Client.Do(req)
-	if err != nil {
-		return err
+// writeAttachmentsForm writes a multipart form containing files and
+// ticket t to w.
+func (s *Service) writeAttachmentsForm(w *multipart.Writer, t *Ticket, files []AttachmentUpload) error {
+	for _, file := range files {
+		attachmentPart, err := w.CreateFormFile("ticket[attachment][]", filepath.Base(file.Filename))
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(attachmentPart, file.Reader)
+		if err != nil {
+			return err
+		}
 	}
-	defer resp.Body.Close()
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
+	err := s.s.WriteFormFields(w, crud.Wrap("ticket", newTicketUpdate(t, nil)))
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return w.Close()
 }
 
 type BulkEditOptions struct {
@@ -585,31 +1040,183 @@ type BulkEditOptions struct {
 // Undocumented, see
 // https://lighthouse.tenderapp.com/kb/ticket-workflow/how-do-i-update-tickets-with-keywords
 // and http://pastie.org/460585.
-func (s *Service) BulkEdit(opts *BulkEditOptions) error {
+func (s *Service) BulkEdit(opts *BulkEditOptions, reqOpts ...lighthouse.RequestOption) error {
 	breq := &bulkEditRequest{
 		Query:          opts.Query,
 		Command:        opts.Command,
 		MigrationToken: opts.MigrationToken,
 	}
 
-	buf := &bytes.Buffer{}
-	err := breq.Encode(buf)
+	// unlike other POST requests, bulk edits respond with 200 OK
+	return crud.Do(s.s, "POST", strings.TrimSuffix(s.basePath, "/tickets")+"/bulk_edit.json", breq, http.StatusOK, nil, reqOpts...)
+}
+
+// MoveToProject moves ticket number to the project target, given by
+// ID or name, using BulkEdit's 'project' keyword.  migrationToken
+// must be the API token of a user with access to target, see
+// BulkEditOptions.  The ticket is renumbered in target, use
+// GetByNumber on a service for target to find it.  The target
+// project is returned.
+func (s *Service) MoveToProject(number int, target string, migrationToken string, reqOpts ...lighthouse.RequestOption) (*projects.Project, error) {
+	if len(migrationToken) == 0 {
+		return nil, fmt.Errorf("must supply migration token")
+	}
+	p, err := projects.NewService(s.s).Get(target, reqOpts...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if p.ID == s.projectID {
+		return nil, fmt.Errorf("ticket %d is already in project %s", number, p.Name)
 	}
 
-	resp, err := s.s.RoundTrip("POST", strings.TrimSuffix(s.basePath, "/tickets")+"/bulk_edit.json", buf)
+	err = s.BulkEdit(&BulkEditOptions{
+		Query:          strconv.Itoa(number),
+		Command:        "project:" + QuoteKeyword(p.Name),
+		MigrationToken: migrationToken,
+	}, reqOpts...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
+	return p, nil
+}
+
+// TagByQuery adds addTags to and removes removeTags from all tickets
+// matching query using BulkEdit.  The numbers of the affected
+// tickets are returned.  If preview is true, the affected tickets
+// are returned but no changes are made.
+func (s *Service) TagByQuery(query string, addTags, removeTags []string, preview bool, reqOpts ...lighthouse.RequestOption) ([]int, error) {
+	if len(query) == 0 {
+		return nil, fmt.Errorf("must supply query")
+	}
+
+	command := TagCommand(addTags, removeTags)
+	if len(command) == 0 {
+		return nil, fmt.Errorf("must supply tags to add or remove")
+	}
+
+	ts, err := s.ListAll(&ListOptions{
+		Query: query,
+		Limit: MaxLimit,
+	}, reqOpts...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	numbers := make([]int, 0, len(ts))
+	for _, t := range ts {
+		numbers = append(numbers, t.Number)
+	}
+
+	if preview || len(numbers) == 0 {
+		return numbers, nil
+	}
+
+	err = s.BulkEdit(&BulkEditOptions{
+		Query:   query,
+		Command: command,
+	}, reqOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return numbers, nil
+}
+
+// ListStale returns the open tickets matching query (which may be
+// empty) that have not been updated since before.
+func (s *Service) ListStale(query string, before time.Time, reqOpts ...lighthouse.RequestOption) (Tickets, error) {
+	ts, err := s.ListAll(&ListOptions{
+		Query: strings.TrimSpace("state:open " + query),
+		Limit: MaxLimit,
+	}, reqOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	stale := Tickets{}
+	for _, t := range ts {
+		if t.UpdatedAt != nil && t.UpdatedAt.Before(before) {
+			stale = append(stale, t)
+		}
+	}
+
+	return stale, nil
+}
+
+// TagCommand returns a BulkEdit command which adds addTags and
+// removes removeTags.  Removed tags are prefixed with a minus sign.
+func TagCommand(addTags, removeTags []string) string {
+	keywords := []string{}
+	for _, tag := range addTags {
+		tag = strings.TrimSpace(tag)
+		if len(tag) == 0 {
+			continue
+		}
+		keywords = append(keywords, "tagged:"+QuoteKeyword(tag))
+	}
+	for _, tag := range removeTags {
+		tag = strings.TrimSpace(tag)
+		if len(tag) == 0 {
+			continue
+		}
+		keywords = append(keywords, "tagged:"+QuoteKeyword("-"+tag))
+	}
+	return strings.Join(keywords, " ")
+}
+
+// QuoteKeyword returns value quoted for use as the value of a search
+// keyword, i.e., "milestone:"+QuoteKeyword(title), if it contains
+// spaces or quotes.
+func QuoteKeyword(value string) string {
+	if strings.ContainsAny(value, " \t\"") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// SplitKeywords splits s, a search query or a ticket's Tag string,
+// into words, undoing QuoteKeyword.  Double quotes may be used to
+// include whitespace in a word or a keyword's value, i.e.,
+// 'milestone:"XYZ v9"' or '"needs review" bug', and within them a
+// backslash escapes a quote or backslash.  An error is returned if a
+// quote is unterminated.
+func SplitKeywords(s string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quoted  bool
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quoted:
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case unicode.IsSpace(r) && !quoted:
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
 }
 
 // Return ticket number from string, possibly prefixed with #
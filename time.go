@@ -0,0 +1,139 @@
+package lighthouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TimeLayouts are the layouts, tried in order, which Time accepts
+// when unmarshalling.  The API returns RFC 3339 timestamps, but XML
+// responses, older exports and hand-edited archives also contain
+// Ruby's Time#to_s format, timestamps without a time zone (taken to
+// be UTC) and bare dates.  Fractional seconds are accepted with any
+// layout containing seconds.
+var TimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05 -0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05 MST",
+	"2006/01/02 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+var fractionalSecondsRegexp = regexp.MustCompile(`:\d\d[.,](\d+)`)
+
+// Time is a time.Time which unmarshals from any of TimeLayouts and
+// marshals in the layout it was unmarshalled from, so resources read
+// from an archive are written back unchanged.  Times which were not
+// unmarshalled, i.e., those set by callers, marshal as RFC 3339.
+type Time struct {
+	time.Time
+
+	// layout is the layout the time was parsed with, or
+	// emptyLayout if it was an empty string.
+	layout string
+}
+
+// emptyLayout records that a Time was unmarshalled from an empty
+// string.
+const emptyLayout = "\x00"
+
+// NewTime returns a *Time for t, marshalled as RFC 3339.
+func NewTime(t time.Time) *Time {
+	return &Time{Time: t}
+}
+
+// OrZero returns the time.Time of t, or the zero time if t is nil.
+// Resources returned by Lighthouse or read from malformed exports may
+// be missing times, so use OrZero rather than dereferencing them.
+func (t *Time) OrZero() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.Time
+}
+
+// ParseTime parses s using the first of TimeLayouts which accepts
+// it.
+func ParseTime(s string) (Time, error) {
+	s = strings.TrimSpace(s)
+	fraction := ""
+	if m := fractionalSecondsRegexp.FindStringSubmatch(s); m != nil {
+		fraction = "." + strings.Repeat("0", len(m[1]))
+	}
+	for _, layout := range TimeLayouts {
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			continue
+		}
+		if len(fraction) > 0 && strings.Contains(layout, ":05") {
+			layout = strings.Replace(layout, ":05", ":05"+fraction, 1)
+		}
+		return Time{Time: t, layout: layout}, nil
+	}
+	return Time{}, fmt.Errorf("unable to parse time %q", s)
+}
+
+// Layout returns the layout t was parsed with, or the empty string
+// if t was not parsed.
+func (t Time) Layout() string {
+	if t.layout == emptyLayout {
+		return ""
+	}
+	return t.layout
+}
+
+// String formats t in the layout it was parsed with.
+func (t Time) String() string {
+	switch t.layout {
+	case "":
+		return t.Time.Format(time.RFC3339)
+	case emptyLayout:
+		if t.IsZero() {
+			return ""
+		}
+		return t.Time.Format(time.RFC3339)
+	}
+	return t.Time.Format(t.layout)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t Time) MarshalJSON() ([]byte, error) {
+	if len(t.layout) == 0 {
+		return t.Time.MarshalJSON()
+	}
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.  null leaves t
+// unchanged and an empty string unmarshals as the zero time.
+func (t *Time) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("unable to parse time %s: %v", data, err)
+	}
+	if len(strings.TrimSpace(s)) == 0 {
+		*t = Time{layout: emptyLayout}
+		return nil
+	}
+	parsed, err := ParseTime(s)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
@@ -3,12 +3,8 @@
 package tokens
 
 import (
-	"encoding/json"
-	"io"
-	"net/http"
-	"time"
-
 	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/internal/crud"
 )
 
 type Service struct {
@@ -24,40 +20,14 @@ func NewService(s *lighthouse.Service) *Service {
 }
 
 type Token struct {
-	CreatedAt *time.Time `json:"created_at"`
-	Note      string     `json:"note"`
-	ProjectID int        `json:"project_id"`
-	ReadOnly  bool       `json:"read_only"`
-	Token     string     `json:"token"`
-	UserID    int        `json:"user_id"`
-}
-
-type tokenResponse struct {
-	Token *Token `json:"token"`
+	CreatedAt *lighthouse.Time `json:"created_at"`
+	Note      string           `json:"note"`
+	ProjectID int              `json:"project_id"`
+	ReadOnly  bool             `json:"read_only"`
+	Token     string           `json:"token"`
+	UserID    int              `json:"user_id"`
 }
 
-func (pr *tokenResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(pr)
-}
-
-func (s *Service) Get(tokenStr string) (*Token, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+"/"+tokenStr+".json", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
-	}
-
-	tresp := &tokenResponse{}
-	err = tresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return tresp.Token, nil
+func (s *Service) Get(tokenStr string, reqOpts ...lighthouse.RequestOption) (*Token, error) {
+	return crud.Get[Token](s.s, s.basePath+"/"+tokenStr+".json", "token", reqOpts...)
 }
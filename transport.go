@@ -0,0 +1,89 @@
+package lighthouse
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ServiceOption configures the *http.Transport which makes the
+// requests of a *Service, see NewService.  Options are applied in
+// order.
+type ServiceOption func(t *http.Transport)
+
+// WithProxy sends requests through the HTTP or HTTPS proxy at proxy
+// instead of the proxy given by the HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY environment variables.  If proxy is nil, no proxy is used.
+func WithProxy(proxy *url.URL) ServiceOption {
+	return func(t *http.Transport) {
+		t.Proxy = http.ProxyURL(proxy)
+	}
+}
+
+// WithRootCAs verifies server certificates using the root
+// certificate authorities in pool instead of the system's, for
+// example to trust the certificate authority of a proxy which
+// intercepts TLS connections.  Use x509.SystemCertPool to add to the
+// system's certificate authorities rather than replace them.
+func WithRootCAs(pool *x509.CertPool) ServiceOption {
+	return func(t *http.Transport) {
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+}
+
+// WithTLSConfig makes TLS connections using a copy of config, for
+// example to present a client certificate.  It replaces the TLS
+// configuration set by any earlier WithRootCAs.
+func WithTLSConfig(config *tls.Config) ServiceOption {
+	return func(t *http.Transport) {
+		t.TLSClientConfig = config.Clone()
+	}
+}
+
+// configureTransport applies opts to the *http.Transport at the end
+// of client's chain of RoundTrippers, following the Base of each
+// *Transport, *DiskCache, *MemoryCache and *Recorder.  The
+// *http.Transport is cloned first, so http.DefaultTransport and
+// transports shared with other clients are not modified.  A nil
+// transport or Base is replaced by a clone of http.DefaultTransport.
+func configureTransport(client *http.Client, opts []ServiceOption) error {
+	if len(opts) == 0 {
+		return nil
+	}
+	rt := &client.Transport
+	for {
+		switch t := (*rt).(type) {
+		case *Transport:
+			rt = &t.Base
+			continue
+		case *DiskCache:
+			rt = &t.Base
+			continue
+		case *MemoryCache:
+			rt = &t.Base
+			continue
+		case *Recorder:
+			rt = &t.Base
+			continue
+		}
+		break
+	}
+	if *rt == nil {
+		*rt = http.DefaultTransport
+	}
+	t, ok := (*rt).(*http.Transport)
+	if !ok {
+		return fmt.Errorf("unable to apply service options to transport of type %T, expected *http.Transport", *rt)
+	}
+	t = t.Clone()
+	for _, opt := range opts {
+		opt(t)
+	}
+	*rt = t
+	return nil
+}
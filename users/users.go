@@ -3,7 +3,6 @@
 package users
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,6 +12,7 @@ import (
 	"time"
 
 	"github.com/nwidger/lighthouse"
+	"github.com/nwidger/lighthouse/internal/crud"
 	"github.com/nwidger/lighthouse/projects"
 )
 
@@ -107,28 +107,6 @@ type Membership struct {
 
 type Memberships []*Membership
 
-type membershipResponse struct {
-	Membership *Membership `json:"membership"`
-}
-
-type membershipsResponse struct {
-	Memberships []*membershipResponse `json:"memberships"`
-}
-
-func (psr *membershipsResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(psr)
-}
-
-func (psr *membershipsResponse) memberships() Memberships {
-	ps := make(Memberships, 0, len(psr.Memberships))
-	for _, p := range psr.Memberships {
-		ps = append(ps, p.Membership)
-	}
-
-	return ps
-}
-
 type User struct {
 	ID            int           `json:"id"`
 	Job           string        `json:"job"`
@@ -145,63 +123,28 @@ type UserUpdate struct {
 	Website string `json:"website"`
 }
 
-type userRequest struct {
-	User interface{} `json:"user"`
-}
-
-func (ur *userRequest) Encode(w io.Writer) error {
-	enc := json.NewEncoder(w)
-	return enc.Encode(ur)
-}
-
-type userResponse struct {
-	User *User `json:"user"`
-}
-
-func (ur *userResponse) decode(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	return dec.Decode(ur)
-}
-
-func (s *Service) Get(idOrName string) (*User, error) {
+func (s *Service) Get(idOrName string, reqOpts ...lighthouse.RequestOption) (*User, error) {
 	id, err := lighthouse.ID(idOrName)
 	if err == nil {
-		return s.GetByID(id)
+		return s.GetByID(id, reqOpts...)
 	}
-	return s.GetByName(idOrName)
+	return s.GetByName(idOrName, reqOpts...)
 }
 
-func (s *Service) GetByID(id int) (*User, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+"/"+strconv.Itoa(id)+".json", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
-	}
-
-	uresp := &userResponse{}
-	err = uresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return uresp.User, nil
+func (s *Service) GetByID(id int, reqOpts ...lighthouse.RequestOption) (*User, error) {
+	return crud.Get[User](s.s, s.basePath+"/"+strconv.Itoa(id)+".json", "user", reqOpts...)
 }
 
-func (s *Service) GetByName(name string) (*User, error) {
+func (s *Service) GetByName(name string, reqOpts ...lighthouse.RequestOption) (*User, error) {
 	seen := map[int]struct{}{}
 	projectService := projects.NewService(s.s)
-	ps, err := projectService.List()
+	ps, err := projectService.List(reqOpts...)
 	if err != nil {
 		return nil, err
 	}
 	lower := strings.ToLower(name)
 	for _, p := range ps {
-		ms, err := projectService.MembershipsByID(p.ID)
+		ms, err := projectService.MembershipsByID(p.ID, reqOpts...)
 		if err != nil {
 			return nil, err
 		}
@@ -218,7 +161,7 @@ func (s *Service) GetByName(name string) (*User, error) {
 			}
 			switch {
 			case fullName == lower, firstName == lower:
-				return s.GetByID(m.User.ID)
+				return s.GetByID(m.User.ID, reqOpts...)
 			}
 
 		}
@@ -227,38 +170,19 @@ func (s *Service) GetByName(name string) (*User, error) {
 }
 
 // Only the fields in UserUpdate can be set.
-func (s *Service) Update(u *User) error {
-	ureq := &userRequest{
-		User: &UserUpdate{
-			ID:      u.ID,
-			Job:     u.Job,
-			Name:    u.Name,
-			Website: u.Website,
-		},
-	}
-
-	buf := &bytes.Buffer{}
-	err := ureq.Encode(buf)
-	if err != nil {
-		return err
-	}
-
-	resp, err := s.s.RoundTrip("PUT", s.basePath+"/"+strconv.Itoa(u.ID)+".json", buf)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return err
+func (s *Service) Update(u *User, reqOpts ...lighthouse.RequestOption) error {
+	uu := &UserUpdate{
+		ID:      u.ID,
+		Job:     u.Job,
+		Name:    u.Name,
+		Website: u.Website,
 	}
 
-	return nil
+	return crud.Update(s.s, s.basePath+"/"+strconv.Itoa(u.ID)+".json", "user", uu, reqOpts...)
 }
 
-func (s *Service) GetAvatar(u *User) (io.ReadCloser, string, error) {
-	resp, err := s.s.RoundTrip("GET", u.AvatarURL, nil)
+func (s *Service) GetAvatar(u *User, reqOpts ...lighthouse.RequestOption) (io.ReadCloser, string, error) {
+	resp, err := s.s.RoundTrip("GET", u.AvatarURL, nil, reqOpts...)
 	if err != nil {
 		return nil, "", err
 	}
@@ -273,39 +197,22 @@ func (s *Service) GetAvatar(u *User) (io.ReadCloser, string, error) {
 	return resp.Body, ctype, nil
 }
 
-func (s *Service) Memberships(idOrName string) (Memberships, error) {
+func (s *Service) Memberships(idOrName string, reqOpts ...lighthouse.RequestOption) (Memberships, error) {
 	id, err := lighthouse.ID(idOrName)
 	if err == nil {
-		return s.MembershipsByID(id)
+		return s.MembershipsByID(id, reqOpts...)
 	}
-	return s.MembershipsByName(idOrName)
+	return s.MembershipsByName(idOrName, reqOpts...)
 }
 
-func (s *Service) MembershipsByID(id int) (Memberships, error) {
-	resp, err := s.s.RoundTrip("GET", s.basePath+"/"+strconv.Itoa(id)+"/memberships.json", nil)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	err = lighthouse.CheckResponse(resp, http.StatusOK)
-	if err != nil {
-		return nil, err
-	}
-
-	usresp := &membershipsResponse{}
-	err = usresp.decode(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	return usresp.memberships(), nil
+func (s *Service) MembershipsByID(id int, reqOpts ...lighthouse.RequestOption) (Memberships, error) {
+	return crud.List[Membership](s.s, s.basePath+"/"+strconv.Itoa(id)+"/memberships.json", "membership", reqOpts...)
 }
 
-func (s *Service) MembershipsByName(name string) (Memberships, error) {
-	u, err := s.GetByName(name)
+func (s *Service) MembershipsByName(name string, reqOpts ...lighthouse.RequestOption) (Memberships, error) {
+	u, err := s.GetByName(name, reqOpts...)
 	if err != nil {
 		return nil, err
 	}
-	return s.MembershipsByID(u.ID)
+	return s.MembershipsByID(u.ID, reqOpts...)
 }
@@ -0,0 +1,382 @@
+package lighthouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FormatJSON uses Lighthouse's .json endpoints.  This is the
+	// default.
+	FormatJSON = "json"
+	// FormatXML uses Lighthouse's .xml endpoints, see
+	// Service.Format.
+	FormatXML = "xml"
+)
+
+// xmlPath returns path with a trailing .json extension replaced with
+// .xml and whether it was replaced.
+func xmlPath(path string) (string, bool) {
+	p, query := path, ""
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		p, query = path[:i], path[i:]
+	}
+	if !strings.HasSuffix(p, ".json") {
+		return path, false
+	}
+	return strings.TrimSuffix(p, ".json") + ".xml" + query, true
+}
+
+// FormatPath returns path, the path of a .json endpoint, as
+// *Service.RoundTrip requests it, i.e., with a .xml extension if
+// s.Format is FormatXML.  Requests made with Do, such as attachment
+// uploads, should use FormatPath so they honor Service.Format.
+func (s *Service) FormatPath(path string) string {
+	if s.Format == FormatXML {
+		path, _ = xmlPath(path)
+	}
+	return path
+}
+
+// WriteFormFields writes v, i.e., {"ticket": {...}}, as the part of
+// the multipart form w which carries a resource's fields alongside
+// attachments.  v is encoded as JSON in a part named "json" or, if
+// s.Format is FormatXML, converted with JSONToXML and written to a
+// part named "xml".
+func (s *Service) WriteFormFields(w *multipart.Writer, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	name, ctype := "json", "application/json"
+	if s.Format == FormatXML {
+		buf, err = JSONToXML(bytes.NewReader(buf))
+		if err != nil {
+			return fmt.Errorf("unable to convert form fields to XML: %v", err)
+		}
+		name, ctype = "xml", "application/xml"
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="`+name+`"`)
+	h.Set("Content-Type", ctype)
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(buf)
+	return err
+}
+
+// xmlNode is an element of an XML document read by XMLToJSON.
+type xmlNode struct {
+	name     string
+	attrs    map[string]string
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// XMLToJSON converts a Lighthouse XML document to the equivalent
+// JSON document so it can be decoded by the service packages.
+// Element names are converted from dashes to underscores, the root
+// element becomes a single-field object and the Rails type
+// attributes are honored:
+//
+//	<ticket>                          {"ticket": {
+//	  <number type="integer">5</number> "number": 5,
+//	  <closed type="boolean">false</closed> "closed": false,
+//	  <milestone-id nil="true"/>        "milestone_id": null,
+//	  <tags type="array">               "tags": [
+//	    <tag>...</tag>                    {"tag": {...}}
+//	  </tags>                           ]
+//	</ticket>                         }}
+//
+// Records within arrays are wrapped in a single-field object named
+// after their element, as in Lighthouse's JSON responses.
+func XMLToJSON(r io.Reader) ([]byte, error) {
+	dec := xml.NewDecoder(r)
+	var (
+		root  *xmlNode
+		stack []*xmlNode
+	)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{
+				name:  t.Name.Local,
+				attrs: map[string]string{},
+			}
+			for _, a := range t.Attr {
+				n.attrs[a.Name.Local] = a.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("XMLToJSON: no root element")
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	writeJSONString(buf, xmlToJSONName(root.name))
+	buf.WriteByte(':')
+	root.writeJSON(buf)
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func xmlToJSONName(name string) string {
+	return strings.Replace(name, "-", "_", -1)
+}
+
+func writeJSONString(buf *bytes.Buffer, s string) {
+	b, _ := json.Marshal(s)
+	buf.Write(b)
+}
+
+// isRecord reports whether n is a record, i.e., an element containing
+// other elements which is not an array.
+func (n *xmlNode) isRecord() bool {
+	return len(n.children) > 0 && n.attrs["type"] != "array"
+}
+
+func (n *xmlNode) writeJSON(buf *bytes.Buffer) {
+	if n.attrs["nil"] == "true" {
+		buf.WriteString("null")
+		return
+	}
+	typ := n.attrs["type"]
+	switch {
+	case typ == "array":
+		buf.WriteByte('[')
+		for i, c := range n.children {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if c.isRecord() {
+				buf.WriteByte('{')
+				writeJSONString(buf, xmlToJSONName(c.name))
+				buf.WriteByte(':')
+				c.writeJSON(buf)
+				buf.WriteByte('}')
+				continue
+			}
+			c.writeJSON(buf)
+		}
+		buf.WriteByte(']')
+		return
+	case len(n.children) > 0:
+		buf.WriteByte('{')
+		for i, c := range n.children {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, xmlToJSONName(c.name))
+			buf.WriteByte(':')
+			c.writeJSON(buf)
+		}
+		buf.WriteByte('}')
+		return
+	}
+
+	text := n.text.String()
+	switch typ {
+	case "integer":
+		text = strings.TrimSpace(text)
+		if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+			buf.WriteString("null")
+			return
+		}
+		buf.WriteString(text)
+	case "float", "decimal":
+		text = strings.TrimSpace(text)
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			buf.WriteString("null")
+			return
+		}
+		buf.WriteString(text)
+	case "boolean":
+		if strings.TrimSpace(text) == "true" {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	default:
+		writeJSONString(buf, text)
+	}
+}
+
+// xmlErrorsToJSON converts a Rails XML validation error document,
+// i.e., <errors><error>Title can't be blank</error></errors>, to
+// Lighthouse's JSON form, [["title", "can't be blank"]], so it can be
+// decoded into ErrUnprocessables.  Rails renders full messages, which
+// are split into field and message at the first space.  It returns
+// false if data is not such a document.
+func xmlErrorsToJSON(data []byte) ([]byte, bool) {
+	var doc struct {
+		XMLName xml.Name `xml:"errors"`
+		Errors  []string `xml:"error"`
+	}
+	if xml.Unmarshal(data, &doc) != nil {
+		return nil, false
+	}
+	pairs := make([][]string, 0, len(doc.Errors))
+	for _, msg := range doc.Errors {
+		msg = strings.TrimSpace(msg)
+		field := msg
+		if i := strings.IndexByte(msg, ' '); i > 0 {
+			field, msg = msg[:i], msg[i+1:]
+		}
+		pairs = append(pairs, []string{strings.ToLower(field), msg})
+	}
+	buf, err := json.Marshal(pairs)
+	if err != nil {
+		return nil, false
+	}
+	return buf, true
+}
+
+// singular returns the singular of name, a dashed XML element name,
+// as Rails names the elements of an array, i.e., 'categories'
+// becomes 'category'.  If name isn't plural, '-item' is appended.
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 3:
+		return strings.TrimSuffix(name, "ies") + "y"
+	case strings.HasSuffix(name, "sses"),
+		strings.HasSuffix(name, "shes"),
+		strings.HasSuffix(name, "ches"),
+		strings.HasSuffix(name, "xes"),
+		strings.HasSuffix(name, "zes"):
+		return strings.TrimSuffix(name, "es")
+	case strings.HasSuffix(name, "ss"), strings.HasSuffix(name, "us"), strings.HasSuffix(name, "is"):
+		return name + "-item"
+	case strings.HasSuffix(name, "s") && len(name) > 1:
+		return strings.TrimSuffix(name, "s")
+	}
+	return name + "-item"
+}
+
+// JSONToXML converts a JSON request body to the equivalent Lighthouse
+// XML document, reversing the conversion done by XMLToJSON.  Each
+// field of the top-level object becomes a root element, so data
+// should contain a single field, i.e., {"ticket": {...}}.  Array
+// elements are named after the singular of their field, i.e.,
+// <multiple-watchers type="array"><multiple-watcher>.
+func JSONToXML(r io.Reader) ([]byte, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return nil, fmt.Errorf("JSONToXML: expected object")
+	}
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		err = writeXMLValue(buf, tok.(string), dec)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func jsonToXMLName(name string) string {
+	return strings.Replace(name, "_", "-", -1)
+}
+
+// writeXMLValue reads the next JSON value from dec and writes it to
+// buf as an element named name.
+func writeXMLValue(buf *bytes.Buffer, name string, dec *json.Decoder) error {
+	name = jsonToXMLName(name)
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			buf.WriteString("<" + name + ">")
+			for dec.More() {
+				tok, err = dec.Token()
+				if err != nil {
+					return err
+				}
+				err = writeXMLValue(buf, tok.(string), dec)
+				if err != nil {
+					return err
+				}
+			}
+		case '[':
+			buf.WriteString("<" + name + ` type="array">`)
+			child := singular(name)
+			for dec.More() {
+				err = writeXMLValue(buf, child, dec)
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("JSONToXML: unexpected %v", v)
+		}
+		_, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		buf.WriteString("</" + name + ">")
+	case nil:
+		buf.WriteString("<" + name + ` nil="true"/>`)
+	case bool:
+		buf.WriteString("<" + name + ` type="boolean">` + strconv.FormatBool(v) + "</" + name + ">")
+	case json.Number:
+		typ := "integer"
+		if _, err := v.Int64(); err != nil {
+			typ = "float"
+		}
+		buf.WriteString("<" + name + ` type="` + typ + `">` + v.String() + "</" + name + ">")
+	case string:
+		buf.WriteString("<" + name + ">")
+		xml.EscapeText(buf, []byte(v))
+		buf.WriteString("</" + name + ">")
+	}
+	return nil
+}